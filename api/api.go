@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+)
+
+// Config describes a single experiment. Worker, Lab and Context are optional:
+// by default the workload runs on a local worker that knows every registered
+// workload step, and samples are not persisted. Window is the length of each
+// window of interval statistics, zero for the default and negative for none.
+// Metadata is recorded by stores that keep it.
+type Config struct {
+	Iterations          int
+	Concurrency         []int
+	ConcurrencyStepTime time.Duration
+	Interval            int
+	Stop                int
+	Window              time.Duration
+	Workload            string
+	Context             context.Context
+	Worker              benchmarker.Worker
+	Lab                 laboratory.Laboratory
+	Metadata            experiment.Metadata
+}
+
+type Result struct {
+	Guid  string
+	Final *experiment.Sample
+}
+
+type Subscriber func(sample *experiment.Sample)
+
+type Execution struct {
+	Guid  string
+	lab   laboratory.Laboratory
+	done  chan struct{}
+	final *experiment.Sample
+}
+
+func Register(name string, fn func(context.Context) error, description string) error {
+	return workloads.Register(workloads.StepWithContext(name, fn, description))
+}
+
+func Workloads() []workloads.WorkloadStep {
+	return workloads.Registered().Workloads
+}
+
+func NewWorker() benchmarker.Worker {
+	worker := benchmarker.NewLocalWorker()
+	workloads.Registered().DescribeWorkloads(worker)
+	return worker
+}
+
+// Run starts an experiment and blocks until it has finished.
+func Run(config Config, subscribers ...Subscriber) (Result, error) {
+	execution, err := Start(config, subscribers...)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return execution.Wait()
+}
+
+// Start starts an experiment and returns without waiting for it to finish.
+// Subscribers are called, in order, with every sample the experiment produces.
+func Start(config Config, subscribers ...Subscriber) (*Execution, error) {
+	if config.Worker == nil {
+		config.Worker = NewWorker()
+	}
+
+	if config.Lab == nil {
+		config.Lab = laboratory.NewLaboratory(discardStore{})
+	}
+
+	if config.Context == nil {
+		config.Context = context.New()
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	experimentConfig := experiment.NewExperimentConfiguration(
+		config.Iterations, config.Concurrency, config.ConcurrencyStepTime, config.Interval, config.Stop, config.Worker, config.Workload)
+	if config.Window != 0 {
+		experimentConfig.Window = config.Window
+	}
+
+	runnable := experiment.NewRunnableExperiment(experimentConfig)
+	runnable.Metadata = config.Metadata
+
+	execution := &Execution{lab: config.Lab, done: make(chan struct{})}
+	guid, err := config.Lab.RunWithHandlers(
+		runnable,
+		[]func(<-chan *experiment.Sample){execution.handler(subscribers)}, config.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	execution.Guid = guid
+	return execution, nil
+}
+
+func (execution *Execution) Wait() (Result, error) {
+	<-execution.done
+	return Result{execution.Guid, execution.final}, nil
+}
+
+// Cancel stops the experiment. Wait still returns once the iterations that
+// were running have finished, with a final sample of type CancelledSample.
+func (execution *Execution) Cancel() error {
+	return execution.lab.Cancel(execution.Guid)
+}
+
+func (execution *Execution) handler(subscribers []Subscriber) func(<-chan *experiment.Sample) {
+	return func(samples <-chan *experiment.Sample) {
+		defer close(execution.done)
+		for s := range samples {
+			for _, fn := range subscribers {
+				fn(s)
+			}
+			execution.final = s
+		}
+	}
+}
+
+func (config Config) validate() error {
+	if config.Iterations < 1 {
+		return errors.New("iterations must be at least 1")
+	}
+
+	if len(config.Concurrency) == 0 || config.Concurrency[len(config.Concurrency)-1] < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	if ok, err := config.Worker.Validate(config.Workload); !ok {
+		return errors.New("invalid workload: " + err.Error())
+	}
+
+	return nil
+}
+
+type discardStore struct{}
+
+func (discardStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
+	return func(samples <-chan *experiment.Sample) {
+		for _ = range samples {
+		}
+	}
+}
+
+func (discardStore) LoadAll() ([]experiment.Experiment, error) {
+	return []experiment.Experiment{}, nil
+}
+
+func (discardStore) Delete(guid string) error {
+	return nil
+}
@@ -0,0 +1,229 @@
+package api_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/api"
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Api", func() {
+	var (
+		lock   sync.Mutex
+		called int
+	)
+
+	BeforeEach(func() {
+		Register("api:count", func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			called++
+			return nil
+		}, "counts how often it is called")
+	})
+
+	JustBeforeEach(func() {
+		called = 0
+	})
+
+	Describe("Registering workloads", func() {
+		It("lists registered workloads next to the defaults", func() {
+			var names []string
+			for _, w := range Workloads() {
+				names = append(names, w.Name)
+			}
+
+			Ω(names).Should(ContainElement("api:count"))
+			Ω(names).Should(ContainElement("dummy"))
+		})
+
+		It("does not allow a name to be registered twice", func() {
+			err := Register("api:count", func(ctx context.Context) error { return nil }, "again")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Running an experiment", func() {
+		It("runs the registered workload and returns the final sample", func() {
+			result, err := Run(Config{Iterations: 3, Concurrency: []int{2}, Workload: "api:count,api:count"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(called).Should(Equal(6))
+			Ω(result.Guid).ShouldNot(BeEmpty())
+			Ω(result.Final.Total).Should(Equal(int64(3)))
+			Ω(result.Final.Commands["api:count"].Count).Should(Equal(int64(6)))
+		})
+
+		It("calls each subscriber with every sample", func() {
+			var first, second []*experiment.Sample
+			_, err := Run(Config{Iterations: 2, Concurrency: []int{1}, Workload: "api:count"},
+				func(s *experiment.Sample) { first = append(first, s) },
+				func(s *experiment.Sample) { second = append(second, s) })
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(first).ShouldNot(BeEmpty())
+			Ω(second).Should(Equal(first))
+		})
+
+		It("passes the context to the workload", func() {
+			Register("api:recordContext", func(ctx context.Context) error {
+				lock.Lock()
+				defer lock.Unlock()
+				value, _ := ctx.GetString("key")
+				if value == "value" {
+					called++
+				}
+				return nil
+			}, "")
+
+			ctx := context.New()
+			ctx.PutString("key", "value")
+			_, err := Run(Config{Iterations: 1, Concurrency: []int{1}, Workload: "api:recordContext", Context: ctx})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(called).Should(Equal(1))
+		})
+
+		It("returns an error for an unknown workload", func() {
+			_, err := Run(Config{Iterations: 1, Concurrency: []int{1}, Workload: "api:doesNotExist"})
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("api:doesNotExist"))
+		})
+
+		It("returns an error when iterations or concurrency are missing", func() {
+			_, err := Run(Config{Concurrency: []int{1}, Workload: "api:count"})
+			Ω(err).Should(HaveOccurred())
+
+			_, err = Run(Config{Iterations: 1, Workload: "api:count"})
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Cancelling an experiment", func() {
+		It("stops starting iterations and ends with a cancelled sample", func() {
+			Register("api:slow", func(ctx context.Context) error {
+				lock.Lock()
+				called++
+				lock.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}, "")
+
+			execution, err := Start(Config{Iterations: 1000, Concurrency: []int{1}, Workload: "api:slow"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() int {
+				lock.Lock()
+				defer lock.Unlock()
+				return called
+			}).ShouldNot(BeZero())
+
+			Ω(execution.Cancel()).Should(Succeed())
+			result, err := execution.Wait()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result.Final.Type).Should(Equal(experiment.CancelledSample))
+			Ω(result.Final.Total).Should(BeNumerically("<", 1000))
+		})
+	})
+})
+
+var _ = Describe("Experiment specifications", func() {
+	It("makes a config with the defaults of the command line", func() {
+		spec := DefaultSpec()
+		spec.Workload = "dummy"
+		config, err := spec.Config(NewWorker())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Iterations).Should(Equal(1))
+		Ω(config.Concurrency).Should(Equal([]int{1}))
+		Ω(config.ConcurrencyStepTime).Should(Equal(60 * time.Second))
+		Ω(config.Window).Should(Equal(experiment.DefaultWindow))
+
+		space, _ := config.Context.GetString("rest:space")
+		Ω(space).Should(Equal("dev"))
+	})
+
+	It("turns interval statistics off with a window of 0", func() {
+		spec := DefaultSpec()
+		spec.Workload, spec.Window = "dummy", 0
+		config, err := spec.Config(NewWorker())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Window).Should(BeNumerically("<", 0))
+	})
+
+	It("lists every field that is not valid", func() {
+		spec := DefaultSpec()
+		spec.Iterations, spec.Concurrency, spec.Interval, spec.Workload = 0, "x", -1, "api:doesNotExist"
+		_, err := spec.Config(NewWorker())
+		Ω(err).Should(HaveOccurred())
+
+		fields := make([]string, 0)
+		for _, f := range err.(*ValidationError).Errors {
+			fields = append(fields, f.Field)
+		}
+		Ω(fields).Should(Equal([]string{"iterations", "concurrency", "interval", "workload"}))
+		Ω(err.Error()).Should(ContainSubstring("api:doesNotExist"))
+	})
+
+	It("keeps the name, description and tags as metadata", func() {
+		spec := DefaultSpec()
+		spec.Workload, spec.Name, spec.Description = "dummy", "nightly", "the nightly push"
+		spec.Tags = map[string]string{"env": "staging"}
+		config, err := spec.Config(NewWorker())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Metadata).Should(Equal(experiment.Metadata{Name: "nightly", Description: "the nightly push", Tags: map[string]string{"env": "staging"}}))
+	})
+
+	It("gives the slaves the iteration timeout of the experiment", func() {
+		spec := DefaultSpec()
+		spec.Workload, spec.TaskTimeout = "dummy", 900
+		config, err := spec.Config(NewWorker())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Context.GetInt("redis-worker:timeout")).Should(Equal(900))
+
+		spec.TaskTimeout = -1
+		_, err = spec.Config(NewWorker())
+		Ω(err.(*ValidationError).Errors[0].Field).Should(Equal("redis-worker:timeout"))
+	})
+
+	It("does not accept empty tag keys", func() {
+		spec := DefaultSpec()
+		spec.Workload, spec.Tags = "dummy", map[string]string{"": "staging"}
+		_, err := spec.Config(NewWorker())
+		Ω(err).Should(HaveOccurred())
+		Ω(err.(*ValidationError).Errors[0].Field).Should(Equal("tags"))
+	})
+
+	Describe("ParseTags", func() {
+		It("reads key=value tags, given separately or separated by commas", func() {
+			Ω(ParseTags([]string{"env=staging", "team=runtime, release=1.2"})).Should(Equal(map[string]string{"env": "staging", "team": "runtime", "release": "1.2"}))
+		})
+
+		It("keeps everything after the first = as the value", func() {
+			Ω(ParseTags([]string{"query=a=b"})).Should(Equal(map[string]string{"query": "a=b"}))
+		})
+
+		It("does not accept tags without a key or a value", func() {
+			for _, t := range []string{"env", "=staging"} {
+				_, err := ParseTags([]string{t})
+				Ω(err).Should(HaveOccurred(), t)
+			}
+		})
+	})
+
+	Describe("ParseConcurrency", func() {
+		It("reads a fixed number of workers", func() {
+			Ω(ParseConcurrency("5")).Should(Equal([]int{5}))
+		})
+
+		It("reads a ramp", func() {
+			Ω(ParseConcurrency("1..10")).Should(Equal([]int{1, 10}))
+		})
+
+		It("does not accept ramps down, no workers or anything else", func() {
+			for _, c := range []string{"10..1", "0", "1-3", "", "a..b"} {
+				_, err := ParseConcurrency(c)
+				Ω(err).Should(HaveOccurred(), c)
+			}
+		})
+	})
+})
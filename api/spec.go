@@ -0,0 +1,196 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	"github.com/cloudfoundry-incubator/pat/context"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+)
+
+// Spec is a JSON description of an experiment with the same options as the
+// command line, and the same names. Durations are in seconds, a Window of 0
+// turns interval statistics off. Name, Description and Tags are kept with
+// the results.
+type Spec struct {
+	Name                string            `json:"name,omitempty"`
+	Description         string            `json:"description,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"`
+	Iterations          int               `json:"iterations"`
+	Concurrency         string            `json:"concurrency"`
+	ConcurrencyStepTime int               `json:"concurrency:timeBetweenSteps"`
+	Interval            int               `json:"interval"`
+	Stop                int               `json:"stop"`
+	Window              int               `json:"window"`
+	Workload            string            `json:"workload"`
+	App                 string            `json:"app"`
+	Manifest            string            `json:"app:manifest"`
+	RestTarget          string            `json:"rest:target"`
+	RestUsername        string            `json:"rest:username"`
+	RestPassword        string            `json:"rest:password"`
+	RestSpace           string            `json:"rest:space"`
+	TaskTimeout         int               `json:"redis-worker:timeout,omitempty"`
+}
+
+// FieldError says what is wrong with one field of a Spec.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every field of a Spec that is not valid.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, f := range e.Errors {
+		messages[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{field, fmt.Sprintf(format, args...)})
+}
+
+// DefaultSpec has the defaults of the command line, decode into it so that
+// missing fields keep them.
+func DefaultSpec() Spec {
+	return Spec{
+		Iterations:          1,
+		Concurrency:         "1",
+		ConcurrencyStepTime: 60,
+		Window:              int(experiment.DefaultWindow / time.Second),
+		Workload:            "cf:push",
+		App:                 "assets/dora",
+		RestSpace:           "dev",
+	}
+}
+
+// Config validates the spec against the workloads the worker knows, and
+// returns a Config for it with a context holding the app and REST options.
+func (s Spec) Config(worker benchmarker.Worker) (Config, error) {
+	invalid := &ValidationError{}
+
+	if s.Iterations < 1 {
+		invalid.add("iterations", "must be at least 1")
+	}
+
+	concurrency, err := ParseConcurrency(s.Concurrency)
+	if err != nil {
+		invalid.add("concurrency", "%s", err.Error())
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int
+	}{{"concurrency:timeBetweenSteps", s.ConcurrencyStepTime}, {"interval", s.Interval}, {"stop", s.Stop}, {"window", s.Window}, {"redis-worker:timeout", s.TaskTimeout}} {
+		if f.value < 0 {
+			invalid.add(f.name, "must not be negative")
+		}
+	}
+
+	for k := range s.Tags {
+		if err := validTagKey(k); err != nil {
+			invalid.add("tags", "%s", err.Error())
+		}
+	}
+
+	workload := strings.Replace(s.Workload, " ", "", -1)
+	if workload == "" {
+		invalid.add("workload", "must name at least one workload step")
+	} else if ok, err := worker.Validate(workload); !ok {
+		invalid.add("workload", "is not valid: %s", err.Error())
+	}
+
+	ctx := context.New()
+	workloads.PopulateRestContext(s.RestTarget, s.RestUsername, s.RestPassword, s.RestSpace, ctx)
+	if err := workloads.PopulateAppContext(s.App, s.Manifest, ctx); err != nil {
+		invalid.add("app", "%s", err.Error())
+	}
+	if s.TaskTimeout > 0 {
+		ctx.PutInt(benchmarker.TaskTimeoutKey, s.TaskTimeout)
+	}
+
+	if len(invalid.Errors) > 0 {
+		return Config{}, invalid
+	}
+
+	window := time.Duration(s.Window) * time.Second
+	if s.Window == 0 {
+		window = -1
+	}
+
+	return Config{
+		Iterations:          s.Iterations,
+		Concurrency:         concurrency,
+		ConcurrencyStepTime: time.Duration(s.ConcurrencyStepTime) * time.Second,
+		Interval:            s.Interval,
+		Stop:                s.Stop,
+		Window:              window,
+		Workload:            workload,
+		Context:             ctx,
+		Worker:              worker,
+		Metadata:            experiment.Metadata{Name: s.Name, Description: s.Description, Tags: s.Tags},
+	}, nil
+}
+
+// ParseConcurrency reads a fixed number of workers, e.g. "5", or a ramp from
+// one number of workers up to another, e.g. "1..10".
+func ParseConcurrency(concurrency string) ([]int, error) {
+	raw := strings.SplitN(strings.TrimSpace(concurrency), "..", 2)
+	parsed := make([]int, len(raw))
+	for i, v := range raw {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("must be a number of workers, or a range such as 1..10")
+		}
+		parsed[i] = n
+	}
+
+	if parsed[len(parsed)-1] < 1 {
+		return nil, fmt.Errorf("must be at least 1")
+	}
+	if len(parsed) == 2 && parsed[0] > parsed[1] {
+		return nil, fmt.Errorf("must not ramp down, %d is more than %d", parsed[0], parsed[1])
+	}
+	return parsed, nil
+}
+
+// ParseTags reads key=value tags, each item may also hold several tags
+// separated by commas, e.g. "env=staging,team=runtime".
+func ParseTags(items []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, item := range items {
+		for _, tag := range strings.Split(item, ",") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("tag %q should be key=value", tag)
+			}
+
+			key := strings.TrimSpace(kv[0])
+			if err := validTagKey(key); err != nil {
+				return nil, err
+			}
+			tags[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	return tags, nil
+}
+
+func validTagKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "=,") {
+		return fmt.Errorf("tag key %q must not be empty or contain = or ,", key)
+	}
+	return nil
+}
@@ -16,6 +16,25 @@ type IterationResult struct {
 	Duration time.Duration
 	Steps    []StepResult
 	Error    *EncodableError
+	Slave    *SlaveStatus `json:",omitempty"`
+	Origin   *Origin      `json:",omitempty"`
+}
+
+// Origin records when, and by which worker, an iteration was started.
+type Origin struct {
+	Started   time.Time
+	Worker    int
+	Iteration int
+}
+
+// SlaveStatus describes how busy the slave that ran an iteration was when it
+// replied. Pending is the number of tasks still waiting in the shared queue.
+type SlaveStatus struct {
+	Name        string
+	Running     int
+	Capacity    int
+	Utilisation float64
+	Pending     int
 }
 
 func Time(experiment func() error) (result time.Duration, err error) {
@@ -35,8 +54,13 @@ func Counted(out chan<- int, fn func(context.Context)) func(context.Context) {
 
 func TimedWithWorker(out chan<- IterationResult, worker Worker, experiment string) func(context.Context) {
 	return func(workloadCtx context.Context) {
-		time := worker.Time(experiment, workloadCtx)
-		out <- time
+		origin := &Origin{Started: time.Now()}
+		origin.Worker, _ = workloadCtx.GetInt("workerIndex")
+		origin.Iteration, _ = workloadCtx.GetInt("iterationIndex")
+
+		result := worker.Time(experiment, workloadCtx)
+		result.Origin = origin
+		out <- result
 	}
 }
 
@@ -74,11 +98,26 @@ func RepeatEveryUntil(repeatInterval int, runTime int, fn func(context.Context),
 }
 
 func Repeat(n int, fn func(context.Context)) <-chan func(context.Context) {
+	return RepeatUntil(n, fn, nil)
+}
+
+// RepeatUntil is Repeat, but stops handing out tasks once quit is closed.
+func RepeatUntil(n int, fn func(context.Context), quit <-chan bool) <-chan func(context.Context) {
 	ch := make(chan func(context.Context))
 	go func() {
 		defer close(ch)
 		for i := 0; i < n; i++ {
-			ch <- fn
+			select {
+			case <-quit:
+				return
+			default:
+			}
+
+			select {
+			case ch <- fn:
+			case <-quit:
+				return
+			}
 		}
 	}()
 	return ch
@@ -92,20 +131,33 @@ func Execute(tasks <-chan func(context.Context), workloadCtx context.Context) {
 
 func ExecuteConcurrently(schedule <-chan int, tasks <-chan func(context.Context), workloadCtx context.Context) {
 	var wg sync.WaitGroup
+	var indexLock sync.Mutex
 	indexCounter := 0
+	workerCounter := 0
+
+	nextIndex := func() int {
+		indexLock.Lock()
+		defer indexLock.Unlock()
+		index := indexCounter
+		indexCounter++
+		return index
+	}
 
 	for increment := range schedule {
 
 		for i := 0; i < increment; i++ {
 			wg.Add(1)
-			go func(t <-chan func(context.Context), ctx context.Context) {
+			workerCtx := workloadCtx.NewScope(context.WorkerScope)
+			workerCtx.PutInt("workerIndex", workerCounter)
+			workerCounter++
+			go func(t <-chan func(context.Context), workerCtx context.Context) {
 				defer wg.Done()
 				for task := range t {
-					ctx.PutInt("iterationIndex", indexCounter)
-					indexCounter++
-					task(ctx)
+					iterationCtx := workerCtx.NewScope(context.IterationScope)
+					iterationCtx.PutInt("iterationIndex", nextIndex())
+					task(iterationCtx)
 				}
-			}(tasks, workloadCtx.Clone())
+			}(tasks, workerCtx)
 		}
 	}
 	wg.Wait()
@@ -34,6 +34,20 @@ var _ = Describe("Benchmarker", func() {
 			TimedWithWorker(ch, &DummyWorker{}, "three")(workloadCtx)
 			Ω((<-result).Seconds()).Should(BeNumerically("==", 3))
 		})
+
+		It("records when and by which worker the iteration was started", func() {
+			ch := make(chan IterationResult, 1)
+			iterationCtx := workloadCtx.NewScope(context.IterationScope)
+			iterationCtx.PutInt("workerIndex", 2)
+			iterationCtx.PutInt("iterationIndex", 7)
+
+			before := time.Now()
+			TimedWithWorker(ch, &DummyWorker{}, "three")(iterationCtx)
+			origin := (<-ch).Origin
+			Ω(origin.Worker).Should(Equal(2))
+			Ω(origin.Iteration).Should(Equal(7))
+			Ω(origin.Started.Before(before)).Should(BeFalse())
+		})
 	})
 
 	Describe("Counted", func() {
@@ -61,6 +75,26 @@ var _ = Describe("Benchmarker", func() {
 		})
 	})
 
+	Describe("RepeatUntil", func() {
+		It("stops repeating once quit is closed", func() {
+			quit := make(chan bool)
+			called := 0
+			Execute(RepeatUntil(10, func(context.Context) {
+				called = called + 1
+				if called == 2 {
+					close(quit)
+				}
+			}, quit), workloadCtx)
+			Ω(called).Should(BeNumerically("<=", 3))
+		})
+
+		It("repeats a function N times when quit is never closed", func() {
+			called := 0
+			Execute(RepeatUntil(3, func(context.Context) { called = called + 1 }, make(chan bool)), workloadCtx)
+			Ω(called).Should(Equal(3))
+		})
+	})
+
 	Describe("RepeatEveryUntil", func() {
 		It("repeats a function every interval seconds", func() {
 			start := time.Now()
@@ -153,8 +187,8 @@ var _ = Describe("Benchmarker", func() {
 						tasks <- func(ctx context.Context) {
 							var tmp = n
 							defer GinkgoRecover()
-							index, exists := ctx.GetInt("iterationIndex")
-							Ω(exists).ShouldNot(BeFalse())
+							index, err := ctx.GetInt("iterationIndex")
+							Ω(err).ShouldNot(HaveOccurred())
 							Ω(index).Should(Equal(tmp))
 							time.Sleep(1 * time.Second)
 						}
@@ -168,6 +202,36 @@ var _ = Describe("Benchmarker", func() {
 			})
 		})
 
+		Context("When several workers are started", func() {
+			It("Pushes a distinct workerIndex into each worker's context", func() {
+				schedule := make(chan int)
+				tasks := make(chan func(context.Context))
+				seen := make(chan int, 10)
+				go func() {
+					defer close(tasks)
+					for i := 0; i < 10; i++ {
+						tasks <- func(ctx context.Context) {
+							index, _ := ctx.GetInt("workerIndex")
+							seen <- index
+							time.Sleep(10 * time.Millisecond)
+						}
+					}
+				}()
+				go func() {
+					defer close(schedule)
+					schedule <- 3
+				}()
+				ExecuteConcurrently(schedule, tasks, workloadCtx)
+				close(seen)
+
+				workers := make(map[int]bool)
+				for index := range seen {
+					workers[index] = true
+				}
+				Ω(workers).Should(Equal(map[int]bool{0: true, 1: true, 2: true}))
+			})
+		})
+
 		Context("When an event larger than one is pushed", func() {
 			It("Creates mutlple new goroutines that execute the tasks concurrent", func() {
 				schedule := make(chan int)
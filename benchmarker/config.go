@@ -5,22 +5,42 @@ import (
 
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/redis"
+	"github.com/cloudfoundry-incubator/pat/secrets"
 	"github.com/cloudfoundry-incubator/pat/workloads"
 )
 
 var params = struct {
 	startMasterAndSlave bool
+	taskTimeout         int
+	leaseSeconds        int
+	localSlave          bool
+	slaveName           string
+	slaveCapacity       int
+	slaveNamespaces     string
+	replyTTL            int
 }{}
 
 func DescribeParameters(config config.Config) {
 	config.BoolVar(&params.startMasterAndSlave, "use-redis-worker", false, "Runs in master mode, sending work to perform to a redis queue")
+	config.IntVar(&params.taskTimeout, "redis-worker:timeout", DefaultTimeout, "seconds to wait for a slave to complete a single iteration before giving up")
+	config.IntVar(&params.leaseSeconds, "redis-worker:lease", DefaultLeaseSeconds, "seconds a slave may go without a heartbeat before its tasks are given to another slave")
+	config.BoolVar(&params.localSlave, "redis-worker:local-slave", true, "also run a slave inside the master process, set to false to only use slaves started with -slave")
+	config.StringVar(&params.slaveName, "slave:name", "", "name this slave registers with, defaults to the hostname")
+	config.IntVar(&params.slaveCapacity, "slave:capacity", 0, "maximum number of tasks this slave runs at once, it stops taking tasks from the queue when saturated, 0 for unlimited")
+	config.StringVar(&params.slaveNamespaces, "slave:namespaces", "", "comma separated redis namespaces this slave takes tasks from, defaults to -redis-namespace")
+	config.IntVar(&params.replyTTL, "redis-worker:reply-ttl", DefaultTimeout, "seconds a slave's reply is kept in redis when no master collects it")
+	redis.DescribeParameters(config)
+	secrets.DescribeParameters(config)
 }
 
 func WithConfiguredWorkerAndSlaves(fn func(worker Worker) error) error {
 	if params.startMasterAndSlave {
 		return WithRedisConnection(func(conn redis.Conn) error {
-			slave := SlaveFactory(conn, configure(LocalWorkerFactory()))
-			defer slave.Close()
+			if params.localSlave {
+				slave := SlaveFactory(conn, configure(LocalWorkerFactory()))
+				defer slave.Close()
+			}
+			logSlaves(conn)
 			return fn(configure(RedisWorkerFactory(conn)))
 		})
 	}
@@ -47,7 +67,7 @@ var LocalWorkerFactory = func() *LocalWorker {
 }
 
 var RedisWorkerFactory = func(conn redis.Conn) Worker {
-	return NewRedisWorker(conn)
+	return NewRedisWorkerWithTimeout(conn, taskTimeout())
 }
 
 var SlaveFactory = func(conn redis.Conn, delegate Worker) io.Closer {
@@ -55,5 +75,5 @@ var SlaveFactory = func(conn redis.Conn, delegate Worker) io.Closer {
 }
 
 var WorkloadListFactory = func() WorkloadDescriber {
-	return workloads.DefaultWorkloadList()
+	return workloads.Registered()
 }
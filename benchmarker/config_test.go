@@ -64,6 +64,23 @@ var _ = Describe("Config", func() {
 		flags.Parse(args)
 	})
 
+	Describe("Running as a standalone slave", func() {
+		It("serves tasks until it is told to stop, then closes the slave", func() {
+			stopped := false
+			WaitForStop = func() {
+				Ω(slaveStarted).Should(BeTrue())
+				Ω(slaveFromFactory.wasClosed).Should(BeFalse())
+				stopped = true
+			}
+
+			Ω(ServeSlave()).Should(Succeed())
+			Ω(stopped).Should(BeTrue())
+			Ω(slaveFromFactory.conn).Should(Equal(connectionFromFactory))
+			Ω(slaveFromFactory.worker).Should(Equal(localWorker))
+			Ω(slaveFromFactory.wasClosed).Should(BeTrue())
+		})
+	})
+
 	Context("When -use-redis-worker is not set", func() {
 		It("Calls with a local worker", func() {
 			var worker Worker
@@ -155,6 +172,20 @@ var _ = Describe("Config", func() {
 		It("closes the slave after the function returns", func() {
 			Ω(slaveFromFactory.wasClosed).Should(BeTrue())
 		})
+
+		Context("And -redis-worker:local-slave is false", func() {
+			BeforeEach(func() {
+				args = []string{"-redis-worker:local-slave=false", "-use-redis-worker", "true"}
+			})
+
+			It("only sends work to remote slaves", func() {
+				WithConfiguredWorkerAndSlaves(func(w Worker) error {
+					return nil
+				})
+
+				Ω(slaveStarted).Should(BeFalse())
+			})
+		})
 	})
 })
 
@@ -43,8 +43,8 @@ var _ = Describe("LocalWorker", func() {
 			worker.AddWorkloadStep(StepWithContext("bar", func(ctx context.Context) error { a, _ := ctx.GetInt("a"); ctx.PutInt("a", a+2); return nil }, ""))
 			worker.Time("foo", workloadCtx)
 
-			_, exists := workloadContext.GetInt("a")
-			Ω(exists).Should(Equal(true))
+			_, err := workloadContext.GetInt("a")
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 	})
 
@@ -2,120 +2,527 @@ package benchmarker
 
 import (
 	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/logs"
 	"github.com/cloudfoundry-incubator/pat/redis"
+	"github.com/cloudfoundry-incubator/pat/secrets"
 	"github.com/cloudfoundry-incubator/pat/workloads"
 	"github.com/nu7hatch/gouuid"
 )
 
+// Tasks are pushed on to the pending list by the master. A slave atomically
+// moves a task to the in-progress list and holds a lease on it, which its
+// heartbeat keeps alive until the task is acknowledged. If the lease expires,
+// the waiting master puts the task back on the pending list.
+const (
+	pendingTasks    = "tasks"
+	inProgressTasks = "tasks-in-progress"
+)
+
+// TaskTimeoutKey is the workload context key holding the seconds a slave may
+// take over an iteration of that workload.
+const TaskTimeoutKey = "redis-worker:timeout"
+
+const (
+	DefaultTimeout      = 60 * 5
+	DefaultLeaseSeconds = 30
+	MaxAttempts         = 3
+	maxBackoff          = 5 * time.Second
+)
+
 type rw struct {
 	defaultWorker
 	conn             redis.Conn
 	timeoutInSeconds int
+	ns               redis.Namespace
 }
 
 type redisMessage struct {
+	Guid            string
 	Reply           string
+	ReplyTTL        int
 	Workload        string
 	WorkloadContext context.Context
+	Secrets         string
+	Deadline        int64
+	Attempt         int
 }
 
-const DefaultTimeout = 60 * 5
+type task struct {
+	raw          string
+	msg          redisMessage
+	leaseMissing time.Time
+	taken        bool
+}
 
 func NewRedisWorker(conn redis.Conn) Worker {
 	return NewRedisWorkerWithTimeout(conn, DefaultTimeout)
 }
 
 func NewRedisWorkerWithTimeout(conn redis.Conn, timeoutInSeconds int) Worker {
-	return &rw{defaultWorker{make(map[string]workloads.WorkloadStep)}, conn, timeoutInSeconds}
+	return &rw{defaultWorker{make(map[string]workloads.WorkloadStep)}, conn, timeoutInSeconds, redis.CurrentNamespace()}
 }
 
 func (rw rw) Time(workload string, workloadCtx context.Context) (result IterationResult) {
+	sealed, err := secrets.Seal(workloadCtx)
+	if err != nil {
+		return errorResult(err)
+	}
+
 	guid, _ := uuid.NewV4()
-	redisMsg := redisMessage{
+	timeout := rw.timeout(workloadCtx)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	t := &task{msg: redisMessage{
+		Guid:            guid.String(),
 		Workload:        workload,
-		Reply:           "replies-" + guid.String(),
+		Reply:           rw.ns.Key("replies-" + guid.String()),
+		ReplyTTL:        replyTTL(),
 		WorkloadContext: workloadCtx,
+		Secrets:         sealed,
+		Deadline:        deadline.Unix(),
+		Attempt:         1,
+	}}
+
+	if err = rw.enqueue(t, "LPUSH", deadline); err != nil {
+		return errorResult(err)
+	}
+
+	reply, err := rw.awaitReply(t, deadline, timeout)
+	if err != nil {
+		rw.conn.Do("LREM", rw.ns.Key(pendingTasks), 0, t.raw)
+		rw.conn.Do("LREM", rw.ns.Key(inProgressTasks), 0, t.raw)
+		return errorResult(err)
 	}
 
-	var jsonRedisMsg []byte
-	var err error
-	jsonRedisMsg, err = json.Marshal(redisMsg)
+	json.Unmarshal([]byte(reply), &result)
+	return
+}
 
+func (rw rw) enqueue(t *task, cmd string, deadline time.Time) error {
+	encoded, err := json.Marshal(t.msg)
 	if err != nil {
-		return IterationResult{0, []StepResult{}, encodeError(err)}
+		return err
 	}
+	t.raw = string(encoded)
 
-	rw.conn.Do("RPUSH", "tasks", string(jsonRedisMsg))
+	return retry(deadline, func() error {
+		_, err := rw.conn.Do(cmd, rw.ns.Key(pendingTasks), t.raw)
+		return err
+	})
+}
 
-	reply, err := redis.Strings(rw.conn.Do("BLPOP", "replies-"+guid.String(), rw.timeoutInSeconds))
+// timeout is the TaskTimeoutKey of the workload context when it is set, so an
+// experiment can allow its iterations longer than the worker's default.
+func (rw rw) timeout(workloadCtx context.Context) int {
+	if seconds, err := workloadCtx.GetInt(TaskTimeoutKey); err == nil && seconds > 0 {
+		return seconds
+	}
+	return rw.timeoutInSeconds
+}
 
+func (rw rw) awaitReply(t *task, deadline time.Time, timeout int) (string, error) {
+	logger := logs.NewLogger("redis.worker")
+	backoff := newBackoff()
+	for time.Now().Before(deadline) {
+		reply, err := redis.Strings(rw.conn.Do("BLPOP", t.msg.Reply, 1))
+		if err == nil {
+			rw.conn.Do("DEL", t.msg.Reply)
+			return reply[1], nil
+		}
+
+		if err != redis.ErrNil {
+			logger.Warnf("Lost connection to redis while waiting for a reply, retrying: %v", err)
+			backoff.wait()
+			continue
+		}
+		backoff.reset()
+
+		if err = rw.checkLease(t, deadline); err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("timed out after %d seconds waiting for a slave to run %s", timeout, t.msg.Workload)
+}
+
+// checkLease requeues the task if it is in progress but no slave has renewed
+// its lease for a whole lease period, which usually means the slave died.
+// A task is known to have been taken once its lease has been seen. Until
+// then it is most likely still pending, so the in-progress list is only
+// searched for it once a lease period, and the period only starts once it is
+// found there, so a slave that has just popped it has time to take the lease.
+func (rw rw) checkLease(t *task, deadline time.Time) error {
+	leased, err := redis.Int(rw.conn.Do("EXISTS", leaseKey(rw.ns, t.msg.Guid)))
 	if err != nil {
-		return IterationResult{0, []StepResult{}, encodeError(err)}
-	} else {
-		json.Unmarshal([]byte(reply[1]), &result)
-		return
+		return nil
+	}
+	if leased == 1 {
+		t.taken = true
+		t.leaseMissing = time.Time{}
+		return nil
+	}
+
+	if t.leaseMissing.IsZero() {
+		t.leaseMissing = time.Now()
+		return nil
+	}
+
+	if time.Since(t.leaseMissing) < leaseDuration() {
+		return nil
 	}
+
+	if !t.taken {
+		t.leaseMissing = time.Now()
+		t.taken = rw.inProgress(t)
+		return nil
+	}
+	t.leaseMissing = time.Time{}
+
+	removed, err := redis.Int(rw.conn.Do("LREM", rw.ns.Key(inProgressTasks), 1, t.raw))
+	if err != nil || removed == 0 {
+		return nil
+	}
+
+	if t.msg.Attempt >= MaxAttempts {
+		return fmt.Errorf("%s was lost by %d slaves, giving up", t.msg.Workload, t.msg.Attempt)
+	}
+
+	logs.NewLogger("redis.worker").Warnf("Lease on %s expired, requeueing (attempt %d)", t.msg.Guid, t.msg.Attempt+1)
+	t.msg.Attempt++
+	t.taken = false
+	return rw.enqueue(t, "RPUSH", deadline)
+}
+
+func (rw rw) inProgress(t *task) bool {
+	tasks, err := redis.Strings(rw.conn.Do("LRANGE", rw.ns.Key(inProgressTasks), 0, -1))
+	if err != nil {
+		return false
+	}
+	for _, raw := range tasks {
+		if raw == t.raw {
+			return true
+		}
+	}
+	return false
 }
 
 type slave struct {
-	guid string
-	conn redis.Conn
+	guid       string
+	conn       redis.Conn
+	home       redis.Namespace
+	namespaces []redis.Namespace
+	capacity   int
 }
 
+// StartSlave starts serving tasks from each of the namespaces given by
+// -slave:namespaces, or the current namespace if there are none.
 func StartSlave(conn redis.Conn, delegate Worker) slave {
 	guid, _ := uuid.NewV4()
-	go slaveLoop(conn, delegate, guid.String())
-	return slave{guid.String(), conn}
+	s := slave{guid.String(), conn, redis.CurrentNamespace(), redis.ParseNamespaces(params.slaveNamespaces), params.slaveCapacity}
+	for _, ns := range s.namespaces {
+		if err := s.register(ns); err != nil {
+			logs.NewLogger("redis.slave").Warnf("Could not register slave, will retry: %v", err)
+		}
+	}
+	go s.loop(delegate)
+	return s
 }
 
 func (slave slave) Close() error {
-	_, err := slave.conn.Do("RPUSH", "stop-"+slave.guid, true)
+	_, err := slave.conn.Do("RPUSH", slave.home.Key("stop-"+slave.guid), true)
 	if err == nil {
-		_, err = slave.conn.Do("BLPOP", "stopped-"+slave.guid, DefaultTimeout)
+		_, err = slave.conn.Do("BLPOP", slave.home.Key("stopped-"+slave.guid), DefaultTimeout)
 	}
 
 	logs.NewLogger("redis.slave").Infof("Redis slave shutting down, %v", err)
 	return err
 }
 
-func slaveLoop(conn redis.Conn, delegate Worker, handle string) {
-	var redisMsg redisMessage
+// leases maps the guid of each running task to its namespace.
+type leases struct {
+	sync.Mutex
+	running map[string]redis.Namespace
+}
 
+func (slave slave) loop(delegate Worker) {
+	conn := slave.conn
 	logger := logs.NewLogger("redis.slave")
 	logger.Info("Started slave")
 
+	held := &leases{running: make(map[string]redis.Namespace)}
+	stopHeartbeat := make(chan bool)
+	go slave.heartbeat(held, stopHeartbeat)
+
+	slots := newSlots(slave.capacity)
+	backoff := newBackoff()
 	for {
-		reply, err := redis.Strings(conn.Do("BLPOP", "stop-"+handle, "tasks", 0))
+		if stop, err := redis.String(conn.Do("LPOP", slave.home.Key("stop-"+slave.guid))); err == nil && stop != "" {
+			break
+		}
 
-		if len(reply) == 0 {
-			panic("Empty task, usually means connection lost, shutting down")
+		if !slots.acquire(time.Second) {
+			continue
 		}
 
-		if reply[0] == "stop-"+handle {
-			conn.Do("RPUSH", "stopped-"+handle, true)
-			break
+		raw, ns, err := slave.pop()
+		if err == redis.ErrNil {
+			slots.release()
+			backoff.reset()
+			continue
 		}
 
-		if err == nil {
+		if err != nil {
+			slots.release()
+			logger.Warnf("Lost connection to redis, reconnecting: %v", err)
+			backoff.wait()
+			continue
+		}
+		backoff.reset()
+
+		var msg redisMessage
+		msg.WorkloadContext = context.New()
+		if err = json.Unmarshal([]byte(raw), &msg); err != nil {
+			slots.release()
+			logger.Warnf("Discarding malformed task: %v", err)
+			conn.Do("LREM", ns.Key(inProgressTasks), 1, raw)
+			continue
+		}
+
+		held.acquire(slave, ns, msg.Guid)
+		go func(raw string, ns redis.Namespace, msg redisMessage) {
+			defer slots.release()
+			defer held.release(slave, msg.Guid)
+
+			if time.Now().Unix() > msg.Deadline {
+				logger.Infof("Skipping task %s, its master has stopped waiting", msg.Guid)
+				conn.Do("LREM", ns.Key(inProgressTasks), 1, raw)
+				return
+			}
+
+			var result IterationResult
+			if err := withSecrets(msg.WorkloadContext, msg.Secrets); err != nil {
+				result = errorResult(err)
+			} else {
+				result = delegate.Time(msg.Workload, msg.WorkloadContext)
+			}
+			result.Slave = slave.status(ns, held)
+
+			encoded, _ := json.Marshal(result)
+			logger.Debug("Completed slave task, replying")
+			conn.Do("RPUSH", msg.Reply, string(encoded))
+			if msg.ReplyTTL > 0 {
+				conn.Do("EXPIRE", msg.Reply, msg.ReplyTTL)
+			}
+			conn.Do("LREM", ns.Key(inProgressTasks), 1, raw)
+		}(raw, ns, msg)
+	}
+
+	close(stopHeartbeat)
+	for _, ns := range slave.namespaces {
+		slave.deregister(ns)
+	}
+	conn.Do("RPUSH", slave.home.Key("stopped-"+slave.guid), true)
+}
 
-			redisMsg.WorkloadContext = context.New()
+// pop moves the next task to the in-progress list of its namespace. With a
+// single namespace it blocks for up to a second, with several it polls each
+// in turn so that no namespace is starved.
+func (slave slave) pop() (string, redis.Namespace, error) {
+	if len(slave.namespaces) == 1 {
+		ns := slave.namespaces[0]
+		raw, err := redis.String(slave.conn.Do("BRPOPLPUSH", ns.Key(pendingTasks), ns.Key(inProgressTasks), 1))
+		return raw, ns, err
+	}
+
+	for _, ns := range slave.namespaces {
+		raw, err := redis.String(slave.conn.Do("RPOPLPUSH", ns.Key(pendingTasks), ns.Key(inProgressTasks)))
+		if err != redis.ErrNil {
+			return raw, ns, err
+		}
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	return "", "", redis.ErrNil
+}
+
+func (slave slave) status(ns redis.Namespace, held *leases) *SlaveStatus {
+	pending, _ := redis.Int(slave.conn.Do("LLEN", ns.Key(pendingTasks)))
+	status := &SlaveStatus{Name: slaveName(), Running: held.count(), Capacity: slave.capacity, Pending: pending}
+	if slave.capacity > 0 {
+		status.Utilisation = float64(status.Running) / float64(slave.capacity)
+	}
+	return status
+}
 
-			json.Unmarshal([]byte(reply[1]), &redisMsg)
+// slots limits the number of tasks a slave runs at once, a nil channel means
+// there is no limit.
+type slots chan bool
+
+func newSlots(capacity int) slots {
+	if capacity < 1 {
+		return nil
+	}
+	return make(slots, capacity)
+}
+
+// acquire waits up to timeout for a free slot, so the slave can still notice
+// it has been asked to stop while it is saturated.
+func (s slots) acquire(timeout time.Duration) bool {
+	if s == nil {
+		return true
+	}
+
+	select {
+	case s <- true:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
 
-			go func(experiment string, replyTo string, workloadCtx context.Context) {
-				result := delegate.Time(experiment, workloadCtx)
-				var encoded []byte
-				encoded, err = json.Marshal(result)
-				logger.Debug("Completed slave task, replying")
-				conn.Do("RPUSH", replyTo, string(encoded))
-			}(redisMsg.Workload, redisMsg.Reply, redisMsg.WorkloadContext)
+func (s slots) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+func (slave slave) heartbeat(held *leases, stop chan bool) {
+	conn := slave.conn
+	for {
+		for _, ns := range slave.namespaces {
+			if registered, _ := redis.Int(conn.Do("EXISTS", slaveKey(ns, slave.guid))); registered == 0 {
+				slave.register(ns)
+			}
+			conn.Do("HMSET", slaveKey(ns, slave.guid), "heartbeat", time.Now().Unix(), "running", held.countIn(ns))
+			conn.Do("EXPIRE", slaveKey(ns, slave.guid), leaseSeconds())
 		}
+		held.renew(conn)
 
-		if err != nil {
-			logger.Warnf("ERROR: slave encountered error: %v", err)
+		select {
+		case <-stop:
+			return
+		case <-time.After(leaseDuration() / 3):
+		}
+	}
+}
+
+func (l *leases) acquire(slave slave, ns redis.Namespace, guid string) {
+	l.Lock()
+	defer l.Unlock()
+	l.running[guid] = ns
+	slave.conn.Do("SET", leaseKey(ns, guid), slave.guid, "EX", leaseSeconds())
+	slave.conn.Do("HINCRBY", slaveKey(ns, slave.guid), "running", 1)
+}
+
+func (l *leases) release(slave slave, guid string) {
+	l.Lock()
+	defer l.Unlock()
+	ns := l.running[guid]
+	delete(l.running, guid)
+	slave.conn.Do("DEL", leaseKey(ns, guid))
+	slave.conn.Do("HINCRBY", slaveKey(ns, slave.guid), "running", -1)
+	slave.conn.Do("HINCRBY", slaveKey(ns, slave.guid), "completed", 1)
+}
+
+func (l *leases) count() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.running)
+}
+
+// countIn is how many of the tasks the slave holds came from a namespace.
+func (l *leases) countIn(ns redis.Namespace) int {
+	l.Lock()
+	defer l.Unlock()
+	n := 0
+	for _, from := range l.running {
+		if from == ns {
+			n++
 		}
 	}
+	return n
+}
+
+func (l *leases) renew(conn redis.Conn) {
+	l.Lock()
+	defer l.Unlock()
+	for guid, ns := range l.running {
+		conn.Do("EXPIRE", leaseKey(ns, guid), leaseSeconds())
+	}
+}
+
+func leaseKey(ns redis.Namespace, guid string) string {
+	return ns.Key("lease-" + guid)
+}
+
+func taskTimeout() int {
+	if params.taskTimeout < 1 {
+		return DefaultTimeout
+	}
+	return params.taskTimeout
+}
+
+func replyTTL() int {
+	if params.replyTTL < 1 {
+		return DefaultTimeout
+	}
+	return params.replyTTL
+}
+
+func leaseSeconds() int {
+	if params.leaseSeconds < 1 {
+		return DefaultLeaseSeconds
+	}
+	return params.leaseSeconds
+}
+
+func leaseDuration() time.Duration {
+	return time.Duration(leaseSeconds()) * time.Second
+}
+
+type backoff struct {
+	delay time.Duration
+}
+
+func newBackoff() *backoff {
+	b := &backoff{}
+	b.reset()
+	return b
+}
+
+func (b *backoff) reset() {
+	b.delay = 100 * time.Millisecond
+}
+
+func (b *backoff) wait() {
+	time.Sleep(b.delay)
+	if b.delay *= 2; b.delay > maxBackoff {
+		b.delay = maxBackoff
+	}
+}
+
+func retry(deadline time.Time, fn func() error) (err error) {
+	backoff := newBackoff()
+	for err = fn(); err != nil && time.Now().Before(deadline); err = fn() {
+		logs.NewLogger("redis.worker").Warnf("Redis command failed, retrying: %v", err)
+		backoff.wait()
+	}
+	return
+}
+
+func errorResult(err error) IterationResult {
+	return IterationResult{0, []StepResult{}, encodeError(err), nil, nil}
+}
+
+// withSecrets restores secrets which were sent encrypted, and fills in the
+// rest from the slave's own environment or credentials file.
+func withSecrets(workloadCtx context.Context, sealed string) error {
+	if err := secrets.Unseal(sealed, workloadCtx); err != nil {
+		return err
+	}
+	return secrets.Populate(workloadCtx)
 }
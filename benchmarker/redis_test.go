@@ -1,13 +1,17 @@
 package benchmarker
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
+	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/redis"
 	"github.com/cloudfoundry-incubator/pat/workloads"
@@ -45,6 +49,28 @@ var _ = Describe("RedisWorker", func() {
 				}()
 				Eventually(result, 2).Should(Receive())
 			})
+
+			It("Does not put secrets on the queue in plain text", func() {
+				worker := NewRedisWorkerWithTimeout(conn, 2)
+				workloadCtx.PutString("cfUsername", "user1")
+				workloadCtx.PutSecret("rest:password", "hunter2")
+				go worker.Time("foo", workloadCtx)
+
+				var tasks []string
+				Eventually(func() []string {
+					tasks, _ = redis.Strings(conn.Do("LRANGE", "tasks", 0, -1))
+					return tasks
+				}).Should(HaveLen(1))
+				Ω(tasks[0]).Should(ContainSubstring("user1"))
+				Ω(tasks[0]).ShouldNot(ContainSubstring("hunter2"))
+			})
+
+			It("Removes the task from the queue when it times out", func() {
+				worker := NewRedisWorkerWithTimeout(conn, 1)
+				result := worker.Time("foo", workloadCtx)
+				Ω(result.Error).ShouldNot(BeNil())
+				Ω(redis.Strings(conn.Do("LRANGE", "tasks", 0, -1))).Should(BeEmpty())
+			})
 		})
 
 		Context("When a slave is running", func() {
@@ -55,6 +81,7 @@ var _ = Describe("RedisWorker", func() {
 				wasCalledWithWorkerUsername string
 				wasCalledWithRandomKey      string
 				wasCalledWithBoolTypeKey    bool
+				wasCalledWithSecret         string
 			)
 
 			JustBeforeEach(func() {
@@ -69,6 +96,10 @@ var _ = Describe("RedisWorker", func() {
 					wasCalledWithWorkerIndex, _ = ctx.GetInt("iterationIndex")
 					return nil
 				}, ""))
+				delegate.AddWorkloadStep(workloads.StepWithContext("recordSecret", func(ctx context.Context) error {
+					wasCalledWithSecret, _ = ctx.GetString("rest:password")
+					return nil
+				}, ""))
 				delegate.AddWorkloadStep(workloads.StepWithContext("recordWorkerBool", func(ctx context.Context) error { wasCalledWithBoolTypeKey, _ = ctx.GetBool("boolTypeKey"); return nil }, ""))
 				delegate.AddWorkloadStep(workloads.StepWithContext("recordWorkerInfo", func(ctx context.Context) error {
 					wasCalledWithRandomKey, _ = ctx.GetString("RandomKey")
@@ -114,8 +145,8 @@ var _ = Describe("RedisWorker", func() {
 				worker := NewRedisWorker(conn)
 				worker.Time("fooWithContext,barWithContext", workloadCtx)
 
-				result, exists := workloadCtx.GetInt("a")
-				Ω(exists).Should(Equal(true))
+				result, err := workloadCtx.GetInt("a")
+				Ω(err).ShouldNot(HaveOccurred())
 				Ω(result).Should(Equal(3))
 			})
 
@@ -196,12 +227,424 @@ var _ = Describe("RedisWorker", func() {
 						Ω(wasCalledWithRandomKey).Should(Equal("some info  !"))
 					})
 				})
+
+				Describe("When the context contains secrets", func() {
+					BeforeEach(func() {
+						wasCalledWithSecret = ""
+					})
+
+					AfterEach(func() {
+						os.Setenv("PAT_SECRET_KEY", "")
+						parseParameters()
+					})
+
+					It("does not pass them to the slave without a shared key", func() {
+						worker := NewRedisWorker(conn)
+						workloadCtx.PutSecret("rest:password", "hunter2")
+						result := worker.Time("recordSecret", workloadCtx)
+						Ω(result.Error).Should(BeNil())
+						Ω(wasCalledWithSecret).Should(BeEmpty())
+					})
+
+					It("passes them to the slave encrypted with the shared key", func() {
+						os.Setenv("PAT_SECRET_KEY", "shared")
+						parseParameters()
+
+						worker := NewRedisWorker(conn)
+						workloadCtx.PutSecret("rest:password", "hunter2")
+						result := worker.Time("recordSecret", workloadCtx)
+						Ω(result.Error).Should(BeNil())
+						Ω(wasCalledWithSecret).Should(Equal("hunter2"))
+					})
+				})
+			})
+
+			Describe("Slave registry", func() {
+				AfterEach(func() {
+					parseParameters()
+				})
+
+				It("registers the slave with its name, capacity and version", func() {
+					slaves, err := NewRedisWorker(conn).(SlaveLister).Slaves()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(slaves).Should(HaveLen(1))
+					Ω(slaves[0].Name).ShouldNot(BeEmpty())
+					Ω(slaves[0].Version).Should(Equal(Version))
+				})
+
+				It("uses the configured name and capacity", func() {
+					parseParameters("-slave:name", "loader-1", "-slave:capacity", "50")
+					other := StartSlave(conn, delegate)
+					defer other.Close()
+
+					slaves, _ := ListSlaves(conn)
+					Ω(slaves).Should(HaveLen(2))
+					capacities := make(map[string]int)
+					for _, s := range slaves {
+						capacities[s.Name] = s.Capacity
+					}
+					Ω(capacities).Should(HaveKeyWithValue("loader-1", 50))
+				})
+
+				It("counts running and completed tasks", func() {
+					worker := NewRedisWorker(conn)
+					done := make(chan bool)
+					go func() {
+						worker.Time("bar", workloadCtx)
+						done <- true
+					}()
+
+					Eventually(func() int {
+						slaves, _ := ListSlaves(conn)
+						return slaves[0].Running
+					}).Should(Equal(1))
+					Eventually(done, 5).Should(Receive())
+
+					Eventually(func() int {
+						slaves, _ := ListSlaves(conn)
+						return slaves[0].Completed
+					}).Should(Equal(1))
+					slaves, _ := ListSlaves(conn)
+					Ω(slaves[0].Running).Should(Equal(0))
+				})
+
+				It("reports how busy the slave was with each result", func() {
+					result := NewRedisWorker(conn).Time("foo", workloadCtx)
+					Ω(result.Slave).ShouldNot(BeNil())
+					Ω(result.Slave.Name).ShouldNot(BeEmpty())
+					Ω(result.Slave.Running).Should(Equal(1))
+					Ω(result.Slave.Pending).Should(Equal(0))
+				})
+
+				Context("When the slave has a limited capacity", func() {
+					BeforeEach(func() {
+						parseParameters("-slave:capacity", "1")
+					})
+
+					JustBeforeEach(func() {
+						slave.Close()
+						slave = StartSlave(conn, delegate)
+					})
+
+					It("leaves tasks on the queue while it is saturated", func() {
+						worker := NewRedisWorkerWithTimeout(conn, 10)
+						results := make(chan IterationResult, 2)
+						for i := 0; i < 2; i++ {
+							go func() { results <- worker.Time("bar", workloadCtx) }()
+						}
+
+						Eventually(func() int {
+							pending, _ := redis.Int(conn.Do("LLEN", "tasks"))
+							return pending
+						}).Should(Equal(1))
+						Consistently(func() int {
+							slaves, _ := ListSlaves(conn)
+							return slaves[0].Running
+						}, 1).Should(BeNumerically("<=", 1))
+
+						var first, second IterationResult
+						Eventually(results, 6).Should(Receive(&first))
+						Eventually(results, 6).Should(Receive(&second))
+						Ω(first.Error).Should(BeNil())
+						Ω(second.Error).Should(BeNil())
+						Ω(first.Slave.Utilisation).Should(Equal(1.0))
+					})
+				})
+
+				It("deregisters the slave when it is closed", func() {
+					slave.Close()
+					slave = nopCloser{}
+					Ω(ListSlaves(conn)).Should(BeEmpty())
+				})
+
+				It("forgets slaves which stop heartbeating", func() {
+					conn.Do("SADD", "slaves", "dead-slave")
+					slaves, _ := ListSlaves(conn)
+					Ω(slaves).Should(HaveLen(1))
+					Ω(redis.Strings(conn.Do("SMEMBERS", "slaves"))).ShouldNot(ContainElement("dead-slave"))
+				})
+			})
+
+			Describe("Reliable delivery", func() {
+				AfterEach(func() {
+					parseParameters()
+				})
+
+				It("keeps a heartbeat for the slave while it runs", func() {
+					slaves, err := ListSlaves(conn)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(slaves).Should(HaveLen(1))
+					Ω(slaves[0].LastHeartbeat).Should(BeNumerically("~", time.Now().Unix(), 2))
+				})
+
+				It("acknowledges completed tasks", func() {
+					worker := NewRedisWorker(conn)
+					result := worker.Time("foo", workloadCtx)
+					Ω(result.Error).Should(BeNil())
+					Eventually(func() []string {
+						tasks, _ := redis.Strings(conn.Do("LRANGE", "tasks-in-progress", 0, -1))
+						return tasks
+					}).Should(BeEmpty())
+					Eventually(func() []string {
+						leases, _ := redis.Strings(conn.Do("KEYS", "lease-*"))
+						return leases
+					}).Should(BeEmpty())
+				})
+
+				Context("When a slave dies while running a task", func() {
+					var stolen chan bool
+
+					BeforeEach(func() {
+						parseParameters("-redis-worker:lease", "1")
+						stolen = make(chan bool)
+					})
+
+					JustBeforeEach(func() {
+						slave.Close()
+						go func() {
+							defer GinkgoRecover()
+							_, err := redis.String(conn.Do("BRPOPLPUSH", "tasks", "tasks-in-progress", 5))
+							Ω(err).ShouldNot(HaveOccurred())
+							slave = StartSlave(conn, delegate)
+							stolen <- true
+						}()
+					})
+
+					It("requeues the task once its lease has expired", func() {
+						worker := NewRedisWorkerWithTimeout(conn, 10)
+						result := worker.Time("recordWorkerIndex", workloadCtx)
+						Ω(stolen).Should(Receive())
+						Ω(result.Error).Should(BeNil())
+						Ω(result.Steps).Should(HaveLen(1))
+					})
+				})
+
+				Context("When a task waits on the queue for longer than a lease", func() {
+					BeforeEach(func() {
+						parseParameters("-redis-worker:lease", "1")
+					})
+
+					JustBeforeEach(func() {
+						slave.Close()
+						slave = nopCloser{}
+					})
+
+					It("gives the slave that takes it time to lease it", func() {
+						worker := NewRedisWorkerWithTimeout(conn, 6)
+						go worker.Time("foo", workloadCtx)
+						time.Sleep(2500 * time.Millisecond)
+
+						raw, err := redis.String(conn.Do("BRPOPLPUSH", "tasks", "tasks-in-progress", 5))
+						Ω(err).ShouldNot(HaveOccurred())
+						time.Sleep(500 * time.Millisecond)
+						var msg redisMessage
+						json.Unmarshal([]byte(raw), &msg)
+						conn.Do("SET", "lease-"+msg.Guid, "slow-slave", "EX", 10)
+
+						Consistently(func() []string {
+							tasks, _ := redis.Strings(conn.Do("LRANGE", "tasks-in-progress", 0, -1))
+							return tasks
+						}, 2).Should(HaveLen(1))
+						Ω(redis.Strings(conn.Do("LRANGE", "tasks", 0, -1))).Should(BeEmpty())
+					})
+
+					It("only looks for it in progress once a lease period", func() {
+						parseParameters("-redis-worker:lease", "3")
+						counting := &countingConn{Conn: conn, counts: make(map[string]int)}
+						worker := NewRedisWorkerWithTimeout(counting, 6)
+						worker.Time("foo", workloadCtx)
+						Ω(counting.count("LRANGE")).Should(BeNumerically("<=", 2))
+					})
+				})
+
+				Context("When every slave dies while running a task", func() {
+					BeforeEach(func() {
+						parseParameters("-redis-worker:lease", "1")
+					})
+
+					JustBeforeEach(func() {
+						slave.Close()
+						slave = nopCloser{}
+						go func() {
+							for i := 0; i < MaxAttempts; i++ {
+								conn.Do("BRPOPLPUSH", "tasks", "tasks-in-progress", 5)
+							}
+						}()
+					})
+
+					It("gives up after a number of attempts", func() {
+						worker := NewRedisWorkerWithTimeout(conn, 20)
+						result := worker.Time("foo", workloadCtx)
+						Ω(result.Error).ShouldNot(BeNil())
+						Ω(result.Error.Error()).Should(ContainSubstring("giving up"))
+					})
+				})
+
+				Context("When the connection to redis is lost", func() {
+					It("reconnects rather than stopping", func() {
+						StopRedis()
+						time.Sleep(500 * time.Millisecond)
+						StartRedis("../redis/redis.conf")
+
+						worker := NewRedisWorkerWithTimeout(conn, 5)
+						workloadCtx.PutInt("iterationIndex", 3)
+						result := worker.Time("recordWorkerIndex", workloadCtx)
+						Ω(result.Error).Should(BeNil())
+						Ω(wasCalledWithWorkerIndex).Should(Equal(3))
+					})
+				})
 			})
 
 		})
 	})
+
+	Describe("Namespaces", func() {
+		var (
+			delegate *LocalWorker
+			slave    io.Closer
+			ran      chan string
+			hold     chan bool
+		)
+
+		BeforeEach(func() {
+			ran = make(chan string, 10)
+			hold = make(chan bool)
+			delegate = NewLocalWorker()
+			delegate.AddWorkloadStep(workloads.StepWithContext("recordTeam", func(ctx context.Context) error {
+				team, _ := ctx.GetString("team")
+				ran <- team
+				return nil
+			}, ""))
+			delegate.AddWorkloadStep(workloads.Step("hold", func() error { <-hold; return nil }, ""))
+		})
+
+		AfterEach(func() {
+			slave.Close()
+			parseParameters()
+		})
+
+		workerIn := func(namespace string) Worker {
+			parseParameters("-redis-namespace", namespace)
+			return NewRedisWorkerWithTimeout(conn, 2)
+		}
+
+		timeAs := func(worker Worker, team string) IterationResult {
+			ctx := context.New()
+			ctx.PutString("team", team)
+			return worker.Time("recordTeam", ctx)
+		}
+
+		It("only serves tasks from the slave's own namespace", func() {
+			teamA := workerIn("team-a")
+			teamB := workerIn("team-b")
+			slave = StartSlave(conn, delegate)
+
+			Ω(timeAs(teamB, "b").Error).Should(BeNil())
+			Ω(timeAs(teamA, "a").Error).ShouldNot(BeNil())
+			Ω(ran).Should(Receive(Equal("b")))
+			Ω(ran).ShouldNot(Receive())
+		})
+
+		It("prefixes the queue and registry keys with the namespace", func() {
+			parseParameters("-redis-namespace", "team-a", "-slave:name", "a-slave")
+			slave = StartSlave(conn, delegate)
+
+			Ω(redis.Strings(conn.Do("SMEMBERS", "team-a:slaves"))).Should(HaveLen(1))
+			Ω(redis.Strings(conn.Do("SMEMBERS", "slaves"))).Should(BeEmpty())
+			Ω(ListSlaves(conn)).Should(HaveLen(1))
+		})
+
+		It("serves several namespaces from one slave", func() {
+			teamA := workerIn("team-a")
+			teamB := workerIn("team-b")
+			parseParameters("-slave:namespaces", "team-a, team-b")
+			slave = StartSlave(conn, delegate)
+
+			Ω(timeAs(teamA, "a").Error).Should(BeNil())
+			Ω(timeAs(teamB, "b").Error).Should(BeNil())
+			Ω(ran).Should(Receive(Equal("a")))
+			Ω(ran).Should(Receive(Equal("b")))
+
+			for _, worker := range []Worker{teamA, teamB} {
+				slaves, err := worker.(SlaveLister).Slaves()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(slaves).Should(HaveLen(1))
+			}
+		})
+
+		It("counts running tasks in the namespace they came from", func() {
+			teamA := workerIn("team-a")
+			teamB := workerIn("team-b")
+			parseParameters("-slave:namespaces", "team-a, team-b", "-redis-worker:lease", "1")
+			slave = StartSlave(conn, delegate)
+
+			done := make(chan bool)
+			go func() {
+				teamA.Time("hold", context.New())
+				done <- true
+			}()
+
+			running := func(worker Worker) func() int {
+				return func() int {
+					slaves, _ := worker.(SlaveLister).Slaves()
+					if len(slaves) == 0 {
+						return -1
+					}
+					return slaves[0].Running
+				}
+			}
+			Eventually(running(teamA)).Should(Equal(1))
+			Consistently(running(teamB), 1).Should(Equal(0))
+
+			close(hold)
+			Eventually(done, 5).Should(Receive())
+		})
+
+		It("expires unclaimed replies after the reply ttl", func() {
+			parseParameters("-redis-worker:reply-ttl", "7")
+			slave = nopCloser{}
+			go timeAs(NewRedisWorkerWithTimeout(conn, 1), "a")
+			Eventually(func() ([]string, error) { return redis.Strings(conn.Do("LRANGE", "tasks", 0, -1)) }).Should(ContainElement(ContainSubstring(`"ReplyTTL":7`)))
+
+			slave = StartSlave(conn, delegate)
+			conn.Do("LPUSH", "tasks", `{"Guid":"abandoned","Reply":"replies-abandoned","ReplyTTL":7,"Workload":"recordTeam","Deadline":9999999999}`)
+
+			Eventually(func() (int, error) { return redis.Int(conn.Do("TTL", "replies-abandoned")) }).Should(BeNumerically("~", 7, 1))
+		})
+	})
 })
 
+func parseParameters(args ...string) {
+	flags := config.NewConfig()
+	DescribeParameters(flags)
+	flags.Parse(args)
+}
+
+type countingConn struct {
+	redis.Conn
+	sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.Lock()
+	c.counts[cmd]++
+	c.Unlock()
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *countingConn) count(cmd string) int {
+	c.Lock()
+	defer c.Unlock()
+	return c.counts[cmd]
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
 func StartRedis(config string) {
 	_, filename, _, _ := runtime.Caller(0)
 	dir, _ := filepath.Abs(filepath.Dir(filename))
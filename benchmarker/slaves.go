@@ -0,0 +1,162 @@
+package benchmarker
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/logs"
+	"github.com/cloudfoundry-incubator/pat/redis"
+)
+
+// Version is reported by slaves when they register, override it at build time
+// with -ldflags "-X github.com/cloudfoundry-incubator/pat/benchmarker.Version=..."
+var Version = "dev"
+
+// Every running slave adds its guid to the slaves set of each namespace it
+// serves and describes itself in a slave-<guid> hash there, which expires
+// unless the slave keeps heartbeating.
+const registeredSlaves = "slaves"
+
+type SlaveInfo struct {
+	Guid          string
+	Name          string
+	Capacity      int
+	Version       string
+	Started       int64
+	LastHeartbeat int64
+	Running       int
+	Completed     int
+}
+
+type SlaveLister interface {
+	Slaves() ([]SlaveInfo, error)
+}
+
+// ServeSlave runs a slave, without a master, until the process is told to stop.
+func ServeSlave() error {
+	return WithRedisConnection(func(conn redis.Conn) error {
+		slave := SlaveFactory(conn, configure(LocalWorkerFactory()))
+		logs.NewLogger("redis.slave").Infof("Serving tasks as %s until stopped", slaveName())
+		WaitForStop()
+		return slave.Close()
+	})
+}
+
+var WaitForStop = func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+}
+
+func (rw rw) Slaves() ([]SlaveInfo, error) {
+	return listSlaves(rw.conn, rw.ns)
+}
+
+// ListSlaves returns the slaves registered in the current namespace, sorted by
+// name, and forgets any that have stopped heartbeating.
+func ListSlaves(conn redis.Conn) ([]SlaveInfo, error) {
+	return listSlaves(conn, redis.CurrentNamespace())
+}
+
+func listSlaves(conn redis.Conn, ns redis.Namespace) ([]SlaveInfo, error) {
+	guids, err := redis.Strings(conn.Do("SMEMBERS", ns.Key(registeredSlaves)))
+	if err != nil {
+		return nil, err
+	}
+
+	slaves := make([]SlaveInfo, 0, len(guids))
+	for _, guid := range guids {
+		fields, err := redis.StringMap(conn.Do("HGETALL", slaveKey(ns, guid)))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) == 0 {
+			conn.Do("SREM", ns.Key(registeredSlaves), guid)
+			continue
+		}
+
+		slaves = append(slaves, SlaveInfo{
+			Guid:          guid,
+			Name:          fields["name"],
+			Capacity:      atoi(fields["capacity"]),
+			Version:       fields["version"],
+			Started:       int64(atoi(fields["started"])),
+			LastHeartbeat: int64(atoi(fields["heartbeat"])),
+			Running:       atoi(fields["running"]),
+			Completed:     atoi(fields["completed"]),
+		})
+	}
+
+	sort.Sort(byName(slaves))
+	return slaves, nil
+}
+
+func logSlaves(conn redis.Conn) {
+	logger := logs.NewLogger("redis.worker")
+	slaves, err := ListSlaves(conn)
+	if err != nil {
+		logger.Warnf("Could not list slaves: %v", err)
+		return
+	}
+
+	logger.Infof("%d slaves registered", len(slaves))
+	for _, s := range slaves {
+		logger.Infof("  %s (version %s): running %d of %d", s.Name, s.Version, s.Running, s.Capacity)
+	}
+}
+
+func (slave slave) register(ns redis.Namespace) error {
+	conn := slave.conn
+	now := time.Now().Unix()
+	_, err := conn.Do("HMSET", slaveKey(ns, slave.guid),
+		"name", slaveName(),
+		"capacity", slave.capacity,
+		"version", Version,
+		"started", now,
+		"heartbeat", now,
+		"running", 0,
+		"completed", 0)
+	if err == nil {
+		conn.Do("EXPIRE", slaveKey(ns, slave.guid), leaseSeconds())
+		_, err = conn.Do("SADD", ns.Key(registeredSlaves), slave.guid)
+	}
+	return err
+}
+
+func (slave slave) deregister(ns redis.Namespace) {
+	slave.conn.Do("SREM", ns.Key(registeredSlaves), slave.guid)
+	slave.conn.Do("DEL", slaveKey(ns, slave.guid))
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+func slaveKey(ns redis.Namespace, handle string) string {
+	return ns.Key("slave-" + handle)
+}
+
+func slaveName() string {
+	if params.slaveName != "" {
+		return params.slaveName
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "unknown"
+}
+
+type byName []SlaveInfo
+
+func (s byName) Len() int      { return len(s) }
+func (s byName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool {
+	return s[i].Name < s[j].Name || (s[i].Name == s[j].Name && s[i].Guid < s[j].Guid)
+}
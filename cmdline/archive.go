@@ -0,0 +1,75 @@
+package cmdline
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cloudfoundry-incubator/pat/api"
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/laboratory"
+)
+
+// archive exports the experiments of the store to -archive:export, or
+// imports those of -archive:import.
+func archive(history Store) error {
+	if params.importArchive != "" {
+		f, err := os.Open(params.importArchive)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		imported, err := ReadArchive(f, history)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d experiments from %s\n", imported, params.importArchive)
+		return nil
+	}
+
+	tags, err := api.ParseTags(params.tags)
+	if err != nil {
+		return err
+	}
+
+	all, err := history.LoadAll()
+	if err != nil {
+		return err
+	}
+
+	experiments := make([]Experiment, 0)
+	for _, e := range all {
+		if tagged(e, tags) {
+			experiments = append(experiments, e)
+		}
+	}
+
+	if err = writeFile(params.exportArchive, func(f io.Writer) error { return WriteArchive(f, experiments) }); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d experiments to %s\n", len(experiments), params.exportArchive)
+	return nil
+}
+
+func tagged(e Experiment, tags map[string]string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+
+	source, ok := e.(MetadataSource)
+	if !ok {
+		return false
+	}
+	metadata, err := source.GetMetadata()
+	if err != nil {
+		return false
+	}
+
+	for k, v := range tags {
+		if metadata.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -2,16 +2,20 @@ package cmdline
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/cloudfoundry-incubator/pat/api"
 	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/cloudfoundry-incubator/pat/experiment"
 	. "github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/report"
+	"github.com/cloudfoundry-incubator/pat/secrets"
 	"github.com/cloudfoundry-incubator/pat/store"
 	"github.com/cloudfoundry-incubator/pat/workloads"
 )
@@ -27,10 +31,19 @@ var params = struct {
 	workload            string
 	interval            int
 	stop                int
+	window              int
 	restUser            string
 	restPass            string
 	restTarget          string
 	restSpace           string
+	reportJson          string
+	reportJunit         string
+	thresholds          string
+	name                string
+	description         string
+	tags                []string
+	exportArchive       string
+	importArchive       string
 }{}
 
 func InitCommandLineFlags(config config.Config) {
@@ -43,84 +56,147 @@ func InitCommandLineFlags(config config.Config) {
 	config.StringVar(&params.workload, "workload", "cf:push", "a comma-separated list of operations a user should issue (use -list-workloads to see available workload options)")
 	config.IntVar(&params.interval, "interval", 0, "repeat a workload every n seconds, to be used with -stop")
 	config.IntVar(&params.stop, "stop", 0, "repeat a repeating interval until n seconds, to be used with -interval")
+	config.IntVar(&params.window, "window", 10, "seconds in each window of interval statistics (throughput, average, 95th percentile and errors), 0 to disable")
+	config.StringVar(&params.reportJson, "report:json", "", "file to write a JSON summary to at the end of a -silent run")
+	config.StringVar(&params.reportJunit, "report:junit", "", "file to write a JUnit XML summary to at the end of a -silent run, one testcase per command")
+	config.StringVar(&params.thresholds, "report:thresholds", "", "comma-separated limits a -silent run must meet, as [command.]metric=limit with metrics average, p50, p90, p95, p99, worst and errors, e.g. errors=0,p95=30s,cf:push.average=10s")
+	config.StringVar(&params.name, "name", "", "a name for the experiment, shown in the history")
+	config.StringVar(&params.description, "description", "", "a description of the experiment, shown in the history")
+	config.StringsVar(&params.tags, "tag", "key=value tag to find the experiment by later, e.g. env=staging, can be given more than once")
+	config.StringVar(&params.exportArchive, "archive:export", "", "file to export the experiments in the store to, only those with every -tag when tags are given, instead of running an experiment")
+	config.StringVar(&params.importArchive, "archive:import", "", "file of exported experiments to import into the store, instead of running an experiment")
 	config.BoolVar(&params.listWorkloads, "list-workloads", false, "Lists the available workloads")
 	config.StringVar(&params.restTarget, "rest:target", "", "the target for the REST api")
 	config.StringVar(&params.restUser, "rest:username", "", "username for REST api")
-	config.StringVar(&params.restPass, "rest:password", "", "password for REST api")
+	config.StringVar(&params.restPass, "rest:password", "", "password for REST api, prefer the PAT_REST_PASSWORD environment variable or a -credentials file")
 	config.StringVar(&params.restSpace, "rest:space", "dev", "space to target for REST api")
 	benchmarker.DescribeParameters(config)
 	store.DescribeParameters(config)
 }
 
 func RunCommandLine() error {
+	if params.exportArchive != "" || params.importArchive != "" {
+		return store.WithStore(archive)
+	}
+
 	params.workload = strings.Replace(params.workload, " ", "", -1)
 
 	workloadContext := NewContext()
 	workloads.PopulateRestContext(params.restTarget, params.restUser, params.restPass, params.restSpace, workloadContext)
 	workloads.PopulateAppContext(params.app, params.manifest, workloadContext)
+	if err := secrets.Populate(workloadContext); err != nil {
+		return err
+	}
 
 	return WithConfiguredWorkerAndSlaves(func(worker benchmarker.Worker) error {
 		return validateParameters(worker, func() error {
-			return store.WithStore(func(store Store) error {
+			return store.WithStore(func(history Store) error {
 
-				parsedConcurrency, err := parseConcurrency(params.concurrency)
+				parsedConcurrency, err := api.ParseConcurrency(params.concurrency)
 				if err != nil {
 					return err
 				}
 				parsedConcurrencyStepTime := parseConcurrencyStepTime(params.concurrencyStepTime)
 
-				lab := LaboratoryFactory(store)
+				sinks, err := store.Sinks()
+				if err != nil {
+					return err
+				}
+
+				thresholds, err := report.ParseThresholds(params.thresholds)
+				if err != nil {
+					return err
+				}
+
+				tags, err := api.ParseTags(params.tags)
+				if err != nil {
+					return err
+				}
+
+				lab := LaboratoryFactory(history, sinks...)
+				if pruned, err := lab.Prune(store.Retention()); err != nil {
+					return err
+				} else if len(pruned) > 0 {
+					fmt.Printf("Deleted %d experiments that are past the retention policy\n", len(pruned))
+				}
+
+				collector := report.NewCollector()
+				subscribers := []api.Subscriber{collector.Observe}
 
-				handlers := make([]func(<-chan *Sample), 0)
 				if !params.silent {
-					handlers = append(handlers, func(s <-chan *Sample) {
+					subscribers = append(subscribers, func(s *Sample) {
 						display(params.concurrency, params.iterations, params.interval, params.stop, params.concurrencyStepTime, s)
 					})
 				}
 
-				exitBlocker := make(chan int)
-				if params.silent {
-					var tryBlock = func(s <-chan *Sample) {
-						for _ = range s {
-							exitBlocker <- 1
-						}
-						close(exitBlocker)
-					}
-					handlers = append(handlers, func(s <-chan *Sample) {
-						tryBlock(s)
-					})
+				execution, err := api.Start(api.Config{
+					Iterations:          params.iterations,
+					Concurrency:         parsedConcurrency,
+					ConcurrencyStepTime: parsedConcurrencyStepTime,
+					Interval:            params.interval,
+					Stop:                params.stop,
+					Window:              parseWindow(params.window),
+					Workload:            params.workload,
+					Context:             workloadContext,
+					Worker:              worker,
+					Lab:                 lab,
+					Metadata:            Metadata{Name: params.name, Description: params.description, Tags: tags},
+				}, subscribers...)
+				if err != nil {
+					return err
 				}
 
-				lab.RunWithHandlers(
-					NewRunnableExperiment(
-						NewExperimentConfiguration(
-							params.iterations, parsedConcurrency, parsedConcurrencyStepTime, params.interval, params.stop, worker, params.workload)), handlers, workloadContext)
-
-				if params.silent {
-					SilentExit(exitBlocker)
-				} else {
+				if !params.silent {
 					BlockExit()
+					return nil
 				}
-				return err
+
+				result, err := execution.Wait()
+				if err != nil {
+					return err
+				}
+				return writeReports(collector.Report(result.Guid, params.workload, thresholds), len(thresholds) > 0)
 			})
 		})
 	})
 }
 
-func parseConcurrency(concurrency string) ([]int, error) {
-	rawConcurrency := strings.SplitN(concurrency, "..", 2)
-	parsedConcurrency := make([]int, len(rawConcurrency))
-	for i, v := range rawConcurrency {
-		intV, err := strconv.Atoi(v)
-		if err != nil {
-			parsedConcurrency = []int{1}
-			return parsedConcurrency, err
-		} else {
-			parsedConcurrency[i] = intV
+func writeReports(r *report.Report, checked bool) error {
+	if params.reportJson != "" {
+		if err := writeFile(params.reportJson, r.WriteJSON); err != nil {
+			return err
+		}
+	}
+
+	if params.reportJunit != "" {
+		if err := writeFile(params.reportJunit, r.WriteJUnit); err != nil {
+			return err
 		}
+	}
 
+	if checked && !r.Passed {
+		breached := make([]string, 0)
+		for _, t := range r.Thresholds {
+			if !t.Passed {
+				breached = append(breached, t.String())
+			}
+		}
+		return fmt.Errorf("thresholds breached: %s", strings.Join(breached, "; "))
 	}
-	return parsedConcurrency, nil
+	return nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return write(f)
 }
 
 func parseConcurrencyStepTime(concurrencyStepTime int) time.Duration {
@@ -128,6 +204,13 @@ func parseConcurrencyStepTime(concurrencyStepTime int) time.Duration {
 	return parsedConcurrencyStepTime
 }
 
+func parseWindow(window int) time.Duration {
+	if window <= 0 {
+		return -1
+	}
+	return time.Duration(window) * time.Second
+}
+
 func validateParameters(worker benchmarker.Worker, then func() error) error {
 	if params.listWorkloads {
 		worker.Visit(PrintWorkload)
@@ -150,8 +233,8 @@ var WithConfiguredWorkerAndSlaves = func(fn func(worker benchmarker.Worker) erro
 	return benchmarker.WithConfiguredWorkerAndSlaves(fn)
 }
 
-var LaboratoryFactory = func(store Store) (lab Laboratory) {
-	lab = NewLaboratory(store)
+var LaboratoryFactory = func(store Store, handlers ...HandlerFactory) (lab Laboratory) {
+	lab = NewLaboratory(store, handlers...)
 	return
 }
 
@@ -165,12 +248,6 @@ var BlockExit = func() {
 	}
 }
 
-var SilentExit = func(e <-chan int) {
-	for _ = range e {
-	}
-	return
-}
-
 var PrintWorkload = func(workload workloads.WorkloadStep) {
 	fmt.Printf("\x1b[1m%s\x1b[0m\n\t%s\n", workload.Name, workload.Description)
 }
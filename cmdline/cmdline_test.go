@@ -2,6 +2,10 @@ package cmdline_test
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
 	"time"
 
 	"github.com/cloudfoundry-incubator/pat/benchmarker"
@@ -10,6 +14,7 @@ import (
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 	"github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/store"
 	"github.com/cloudfoundry-incubator/pat/workloads"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,10 +22,12 @@ import (
 
 var _ = Describe("Cmdline", func() {
 	var (
-		flags config.Config
-		args  []string
-		lab   *dummyLab
-		err   error
+		flags       config.Config
+		args        []string
+		lab         *dummyLab
+		labHandlers []laboratory.HandlerFactory
+		labSamples  []*experiment.Sample
+		err         error
 	)
 
 	BeforeEach(func() {
@@ -32,8 +39,9 @@ var _ = Describe("Cmdline", func() {
 			return fn(worker)
 		}
 
-		LaboratoryFactory = func(store laboratory.Store) (newLab laboratory.Laboratory) {
-			lab = &dummyLab{}
+		LaboratoryFactory = func(store laboratory.Store, handlers ...laboratory.HandlerFactory) (newLab laboratory.Laboratory) {
+			labHandlers = handlers
+			lab = &dummyLab{samples: labSamples}
 			newLab = lab
 			return
 		}
@@ -66,20 +74,20 @@ var _ = Describe("Cmdline", func() {
 		})
 
 		It("configures the experiment with the parameter", func() {
-			target, ok := ctx.GetString("rest:target")
-			Ω(ok).To(BeTrue())
+			target, err := ctx.GetString("rest:target")
+			Ω(err).ShouldNot(HaveOccurred())
 			Ω(target).To(Equal("someTarget"))
 
-			user, ok := ctx.GetString("rest:username")
-			Ω(ok).To(BeTrue())
+			user, err := ctx.GetString("rest:username")
+			Ω(err).ShouldNot(HaveOccurred())
 			Ω(user).To(Equal("someUser"))
 
-			password, ok := ctx.GetString("rest:password")
-			Ω(ok).To(BeTrue())
+			password, err := ctx.GetString("rest:password")
+			Ω(err).ShouldNot(HaveOccurred())
 			Ω(password).To(Equal("hunter2"))
 
-			space, ok := ctx.GetString("rest:space")
-			Ω(ok).To(BeTrue())
+			space, err := ctx.GetString("rest:space")
+			Ω(err).ShouldNot(HaveOccurred())
 			Ω(space).To(Equal("theFinalFrontier"))
 		})
 	})
@@ -98,12 +106,76 @@ var _ = Describe("Cmdline", func() {
 		})
 
 		It("configures the experiment with the parameter", func() {
-			path, ok := ctx.GetString("app")
-			Ω(ok).To(BeTrue())
+			path, err := ctx.GetString("app")
+			Ω(err).ShouldNot(HaveOccurred())
 			Ω(path).To(Equal("foo/bar/baz"))
 		})
 	})
 
+	Describe("When result sinks are supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-statsd", "udp://localhost:8125", "-influxdb", "udp://localhost:8089"}
+		})
+
+		It("adds a handler for each sink to the laboratory", func() {
+			Ω(labHandlers).Should(HaveLen(2))
+		})
+	})
+
+	Describe("When a result sink is malformed", func() {
+		BeforeEach(func() {
+			args = []string{"-graphite", "http://localhost:2003"}
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("When reports are requested for a silent run", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "reports")
+			labSamples = []*experiment.Sample{
+				&experiment.Sample{Total: 1, Average: 2 * time.Second, Commands: map[string]experiment.Command{"push": {Count: 1, Average: 2 * time.Second}}},
+			}
+			args = []string{"-silent", "-workload", "push",
+				"-report:json", path.Join(dir, "pat.json"),
+				"-report:junit", path.Join(dir, "junit", "pat.xml"),
+			}
+		})
+
+		AfterEach(func() {
+			labSamples = nil
+			os.RemoveAll(dir)
+		})
+
+		It("writes them once the run has finished", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+
+			encoded, err := ioutil.ReadFile(path.Join(dir, "pat.json"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(encoded)).Should(ContainSubstring(`"Guid": "abc"`))
+
+			xml, err := ioutil.ReadFile(path.Join(dir, "junit", "pat.xml"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(xml)).Should(ContainSubstring(`<testcase classname="pat.push" name="push" time="2">`))
+		})
+
+		Context("and a threshold is breached", func() {
+			BeforeEach(func() {
+				args = append(args, "-report:thresholds", "average=1s")
+			})
+
+			It("still writes the reports, and returns an error", func() {
+				Ω(err).Should(MatchError("thresholds breached: average was 2s, limit 1s"))
+				_, statErr := os.Stat(path.Join(dir, "pat.json"))
+				Ω(statErr).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("When -iterations is supplied", func() {
 		BeforeEach(func() {
 			args = []string{"-iterations", "3"}
@@ -207,6 +279,100 @@ var _ = Describe("Cmdline", func() {
 		})
 	})
 
+	Describe("When -window is supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-window", "5"}
+		})
+
+		It("configures the experiment with the parameter", func() {
+			Ω(lab).Should(HaveBeenRunWith("window", 5*time.Second))
+		})
+	})
+
+	Describe("When -window is 0", func() {
+		BeforeEach(func() {
+			args = []string{"-window", "0"}
+		})
+
+		It("disables interval statistics", func() {
+			Ω(lab).Should(HaveBeenRunWith("window", time.Duration(-1)))
+		})
+	})
+
+	Describe("When -name, -description and -tag are supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-name", "nightly", "-description", "the nightly push", "-tag", "env=staging", "-tag", "team=runtime"}
+		})
+
+		It("describes the experiment with them", func() {
+			Ω(lab).Should(HaveBeenRunWith("metadata", experiment.Metadata{
+				Name:        "nightly",
+				Description: "the nightly push",
+				Tags:        map[string]string{"env": "staging", "team": "runtime"},
+			}))
+		})
+	})
+
+	Describe("When a -tag is malformed", func() {
+		BeforeEach(func() {
+			args = []string{"-tag", "staging"}
+		})
+
+		It("returns an error", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("When a retention policy is supplied", func() {
+		BeforeEach(func() {
+			args = []string{"-retention:keep", "5"}
+		})
+
+		It("deletes the experiments past it before running", func() {
+			Ω(lab.retention).Should(Equal(laboratory.Retention{Keep: 5}))
+			Ω(lab.lastRunWith).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("When experiments are exported and imported", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "archive")
+			csvs := store.NewCsvStore(path.Join(dir, "from"), workloads.DefaultWorkloadList())
+			csvs.Describe("tagged", experiment.Metadata{Tags: map[string]string{"env": "staging"}})
+			csvs.Describe("other", experiment.Metadata{})
+			for _, guid := range []string{"tagged", "other"} {
+				ch := make(chan *experiment.Sample)
+				go func() { ch <- &experiment.Sample{Type: experiment.ResultSample}; close(ch) }()
+				csvs.Writer(guid)(ch)
+			}
+
+			lab = nil
+			args = []string{"-csv-dir", path.Join(dir, "from"), "-archive:export", path.Join(dir, "pat.json.gz"), "-tag", "env=staging"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("exports the experiments with the tags and imports them into another store", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lab).Should(BeNil())
+
+			os.MkdirAll(path.Join(dir, "to"), 0755)
+			flags = config.NewConfig()
+			InitCommandLineFlags(flags)
+			flags.Parse([]string{"-csv-dir", path.Join(dir, "to"), "-archive:import", path.Join(dir, "pat.json.gz")})
+			Ω(RunCommandLine()).Should(Succeed())
+
+			imported, err := store.NewCsvStore(path.Join(dir, "to"), workloads.DefaultWorkloadList()).LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imported).Should(HaveLen(1))
+			Ω(imported[0].GetGuid()).Should(Equal("tagged"))
+		})
+	})
+
 	Describe("When -concurrency:timeBetweenSteps is supplied", func() {
 		BeforeEach(func() {
 			args = []string{"-concurrency:timeBetweenSteps", "3"}
@@ -244,6 +410,10 @@ func (m *runWithMatcher) Match(actualLab interface{}) (bool, error) {
 		actual = runWith.Stop
 	case "concurrencysteptime":
 		actual = runWith.ConcurrencyStepTime
+	case "window":
+		actual = runWith.Window
+	case "metadata":
+		actual = runWith.Metadata
 	}
 	m.lastMatch = actual
 	return Equal(actual).Match(m.value)
@@ -259,20 +429,65 @@ func (m *runWithMatcher) FailureMessage(actual interface{}) string {
 
 type dummyLab struct {
 	lastRunWith *experiment.RunnableExperiment
+	samples     []*experiment.Sample
+	retention   laboratory.Retention
+}
+
+func (d *dummyLab) Delete(guid string) error {
+	return nil
+}
+
+func (d *dummyLab) Prune(retention laboratory.Retention) ([]string, error) {
+	d.retention = retention
+	return nil, nil
+}
+
+func (d *dummyLab) Import(archive io.Reader) (int, error) {
+	return 0, nil
 }
 
 func (d *dummyLab) GetData(guid string) ([]*experiment.Sample, error) {
 	return nil, nil
 }
 
+func (d *dummyLab) Running(guid string) bool {
+	return false
+}
+
+func (d *dummyLab) Queue() []string {
+	return nil
+}
+
+func (d *dummyLab) Cancel(guid string) error {
+	return laboratory.ErrNotRunning
+}
+
 func (d *dummyLab) Run(runnable laboratory.Runnable, workloadCtx context.Context) (string, error) {
 	return "", nil
 }
 
 func (d *dummyLab) RunWithHandlers(runnable laboratory.Runnable, handlers []func(<-chan *experiment.Sample), workloadCtx context.Context) (string, error) {
 	d.lastRunWith = runnable.(*experiment.RunnableExperiment)
-	return "", nil
+	if d.samples != nil {
+		for _, handler := range handlers {
+			ch := make(chan *experiment.Sample)
+			go handler(ch)
+			for _, s := range d.samples {
+				ch <- s
+			}
+			close(ch)
+		}
+	}
+	return "abc", nil
 }
 
 func (d *dummyLab) Visit(func(experiment.Experiment)) {
 }
+
+func (d *dummyLab) Query(laboratory.Filter) ([]experiment.Experiment, error) {
+	return nil, nil
+}
+
+func (d *dummyLab) Find(string) (experiment.Experiment, error) {
+	return nil, nil
+}
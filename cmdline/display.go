@@ -4,47 +4,73 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 )
 
-func display(concurrency string, iterations int, interval int, stop int, concurrencyStepTime int, samples <-chan *experiment.Sample) {
-	for s := range samples {
-		fmt.Print("\033[2J\033[;H")
-		fmt.Println("\x1b[32;1mCloud Foundry Performance Acceptance Tests\x1b[0m")
-		fmt.Printf("Test underway. Concurrency: \x1b[36m%v\x1b[0m  Concurrency:TimeBetwenSteps: \x1b[36m%v\x1b[0m Workload iterations: \x1b[36m%v\x1b[0m  Interval: \x1b[36m%v\x1b[0m  Stop: \x1b[36m%v\x1b[0m\n",
-			concurrency, concurrencyStepTime, iterations, interval, stop)
-		fmt.Println("┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄\n")
+func display(concurrency string, iterations int, interval int, stop int, concurrencyStepTime int, s *experiment.Sample) {
+	fmt.Print("\033[2J\033[;H")
+	fmt.Println("\x1b[32;1mCloud Foundry Performance Acceptance Tests\x1b[0m")
+	fmt.Printf("Test underway. Concurrency: \x1b[36m%v\x1b[0m  Concurrency:TimeBetwenSteps: \x1b[36m%v\x1b[0m Workload iterations: \x1b[36m%v\x1b[0m  Interval: \x1b[36m%v\x1b[0m  Stop: \x1b[36m%v\x1b[0m\n",
+		concurrency, concurrencyStepTime, iterations, interval, stop)
+	fmt.Println("┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄\n")
 
-		fmt.Printf("\x1b[36mTotal iterations\x1b[0m:    %v  \x1b[36m%v\x1b[0m / %v\n", bar(s.Total, totalIterations(iterations, interval, stop), 25), s.Total, totalIterations(iterations, interval, stop))
+	fmt.Printf("\x1b[36mTotal iterations\x1b[0m:    %v  \x1b[36m%v\x1b[0m / %v\n", bar(s.Total, totalIterations(iterations, interval, stop), 25), s.Total, totalIterations(iterations, interval, stop))
 
+	fmt.Println()
+	fmt.Printf("\x1b[1mLatest iteration\x1b[0m:  \x1b[36m%v\x1b[0m\n", s.LastResult)
+	fmt.Printf("\x1b[1mWorst iteration\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.WorstResult)
+	fmt.Printf("\x1b[1mAverage iteration\x1b[0m: \x1b[36m%v\x1b[0m\n", s.Average)
+	fmt.Printf("\x1b[1m95th Percentile\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.NinetyfifthPercentile)
+	fmt.Printf("\x1b[1mTotal time\x1b[0m:        \x1b[36m%v\x1b[0m\n", s.TotalTime)
+	fmt.Printf("\x1b[1mWall time\x1b[0m:         \x1b[36m%v\x1b[0m\n", s.WallTime)
+	fmt.Printf("\x1b[1mThroughput\x1b[0m:        \x1b[36m%.2f\x1b[0m iterations per second\n", s.Throughput)
+	fmt.Printf("\x1b[1mRunning Workers\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.TotalWorkers)
+	fmt.Println()
+	fmt.Println("\x1b[32;1mCommands Issued:\x1b[0m")
+	fmt.Println()
+	for key, command := range s.Commands {
+		fmt.Printf("\x1b[1m%v\x1b[0m:\n", key)
+		fmt.Printf("\x1b[1m\tCount\x1b[0m:                 \x1b[36m%v\x1b[0m\n", command.Count)
+		fmt.Printf("\x1b[1m\tAverage\x1b[0m:               \x1b[36m%v\x1b[0m\n", command.Average)
+		fmt.Printf("\x1b[1m\tLast time\x1b[0m:             \x1b[36m%v\x1b[0m\n", command.LastTime)
+		fmt.Printf("\x1b[1m\tWorst time\x1b[0m:            \x1b[36m%v\x1b[0m\n", command.WorstTime)
+		fmt.Printf("\x1b[1m\tTotal time\x1b[0m:            \x1b[36m%v\x1b[0m\n", command.TotalTime)
+		fmt.Printf("\x1b[1m\tPer second throughput\x1b[0m: \x1b[36m%.2f\x1b[0m\n", command.Throughput)
+		fmt.Printf("\x1b[1m\tPer worker throughput\x1b[0m: \x1b[36m%.2f\x1b[0m\n", command.PerWorkerThroughput)
+	}
+	if len(s.Slaves) > 0 {
 		fmt.Println()
-		fmt.Printf("\x1b[1mLatest iteration\x1b[0m:  \x1b[36m%v\x1b[0m\n", s.LastResult)
-		fmt.Printf("\x1b[1mWorst iteration\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.WorstResult)
-		fmt.Printf("\x1b[1mAverage iteration\x1b[0m: \x1b[36m%v\x1b[0m\n", s.Average)
-		fmt.Printf("\x1b[1m95th Percentile\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.NinetyfifthPercentile)
-		fmt.Printf("\x1b[1mTotal time\x1b[0m:        \x1b[36m%v\x1b[0m\n", s.TotalTime)
-		fmt.Printf("\x1b[1mWall time\x1b[0m:         \x1b[36m%v\x1b[0m\n", s.WallTime)
-		fmt.Printf("\x1b[1mRunning Workers\x1b[0m:   \x1b[36m%v\x1b[0m\n", s.TotalWorkers)
-		fmt.Println()
-		fmt.Println("\x1b[32;1mCommands Issued:\x1b[0m")
+		fmt.Println("\x1b[32;1mSlaves:\x1b[0m")
 		fmt.Println()
-		for key, command := range s.Commands {
-			fmt.Printf("\x1b[1m%v\x1b[0m:\n", key)
-			fmt.Printf("\x1b[1m\tCount\x1b[0m:                 \x1b[36m%v\x1b[0m\n", command.Count)
-			fmt.Printf("\x1b[1m\tAverage\x1b[0m:               \x1b[36m%v\x1b[0m\n", command.Average)
-			fmt.Printf("\x1b[1m\tLast time\x1b[0m:             \x1b[36m%v\x1b[0m\n", command.LastTime)
-			fmt.Printf("\x1b[1m\tWorst time\x1b[0m:            \x1b[36m%v\x1b[0m\n", command.WorstTime)
-			fmt.Printf("\x1b[1m\tTotal time\x1b[0m:            \x1b[36m%v\x1b[0m\n", command.TotalTime)
-			fmt.Printf("\x1b[1m\tPer second throughput\x1b[0m: \x1b[36m%v\x1b[0m\n", command.Throughput)
+		for name, slave := range s.Slaves {
+			fmt.Printf("\x1b[1m%v\x1b[0m:\t\x1b[36m%v\x1b[0m running, %v\n", name, slave.Running, utilisation(slave))
 		}
-		fmt.Println("┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄")
-		if s.TotalErrors > 0 {
-			fmt.Printf("\nTotal errors: %d\n", s.TotalErrors)
-			fmt.Printf("Last error: %v\n", s.LastError)
+		fmt.Printf("\x1b[1mQueued tasks\x1b[0m:\t\x1b[36m%v\x1b[0m\n", queued(s.Slaves))
+	}
+	fmt.Println("┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄")
+	if s.TotalErrors > 0 {
+		fmt.Printf("\nTotal errors: %d\n", s.TotalErrors)
+		fmt.Printf("Last error: %v\n", s.LastError)
+	}
+	fmt.Println()
+	fmt.Println("Type q <Enter> (or ctrl-c) to exit")
+}
+
+func utilisation(slave benchmarker.SlaveStatus) string {
+	if slave.Capacity == 0 {
+		return "no capacity limit"
+	}
+	return fmt.Sprintf("\x1b[36m%.0f%%\x1b[0m of capacity %v", slave.Utilisation*100, slave.Capacity)
+}
+
+func queued(slaves map[string]benchmarker.SlaveStatus) (pending int) {
+	for _, slave := range slaves {
+		if slave.Pending > pending {
+			pending = slave.Pending
 		}
-		fmt.Println()
-		fmt.Println("Type q <Enter> (or ctrl-c) to exit")
 	}
+	return
 }
 
 func totalIterations(iterations int, interval int, stopTime int) int64 {
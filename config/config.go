@@ -4,6 +4,7 @@ import (
 	"flag"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	goyaml "github.com/go-yaml/yaml"
 )
@@ -12,6 +13,7 @@ type Config interface {
 	StringVar(target *string, name string, defaultValue string, description string)
 	IntVar(target *int, name string, defaultValue int, description string)
 	BoolVar(target *bool, name string, defaultValue bool, description string)
+	StringsVar(target *[]string, name string, description string)
 	EnvVar(target *string, name string, defaultValue string, description string)
 	Parse(args []string) error
 }
@@ -53,6 +55,26 @@ func (f *f) BoolVar(target *bool, name string, defaultValue bool, description st
 	})
 }
 
+// StringsVar binds a flag that can be given more than once, every value is
+// appended to the target.
+func (f *f) StringsVar(target *[]string, name string, description string) {
+	f.allowDoubleSetting(target, name, func() {
+		*target = nil
+		f.flagSet.Var((*stringsValue)(target), name, description)
+	})
+}
+
+type stringsValue []string
+
+func (s *stringsValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsValue) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func (f *f) EnvVar(target *string, name string, defaultValue string, description string) {
 	f.envVars = append(f.envVars, env{target, name, defaultValue, description})
 }
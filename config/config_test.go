@@ -176,6 +176,48 @@ var _ = Describe("ConfigAndFlags", func() {
 		})
 	})
 
+	Describe("Adding a flag that can be given more than once", func() {
+		var (
+			values  []string
+			values2 []string
+			flags   []string
+		)
+
+		BeforeEach(func() {
+			config.StringsVar(&values, "name", "description")
+		})
+
+		JustBeforeEach(func() {
+			config.Parse(flags)
+		})
+
+		Describe("When the parameter is provided as flags", func() {
+			BeforeEach(func() {
+				flags = []string{"-name", "beans", "-name", "toast"}
+			})
+
+			It("Reads every value", func() {
+				Ω(values).Should(Equal([]string{"beans", "toast"}))
+			})
+
+			It("does not allow double-binding unless the target is the same", func() {
+				Ω(func() { config.StringsVar(&values2, "name", "description") }).Should(Panic())
+				Ω(func() { config.StringsVar(&values, "name", "description") }).ShouldNot(Panic())
+			})
+		})
+
+		Describe("When the parameter is provided in a config file", func() {
+			BeforeEach(func() {
+				flags = []string{"-config", "/tmp/config.yml"}
+				ioutil.WriteFile("/tmp/config.yml", []byte("name: beans"), 0755)
+			})
+
+			It("Reads the value from the file", func() {
+				Ω(values).Should(Equal([]string{"beans"}))
+			})
+		})
+	})
+
 	Describe("Binding an environment variable", func() {
 		var (
 			value  string
@@ -2,93 +2,385 @@ package context
 
 import (
 	"encoding/json"
-	"strconv"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 )
 
+type Scope int
+
+const (
+	ExperimentScope Scope = iota
+	WorkerScope
+	IterationScope
+)
+
+var scopeNames = []string{"experiment", "worker", "iteration"}
+
+const Redacted = "[REDACTED]"
+
+// secret values read like strings but are never encoded or printed.
+type secret string
+
 type Context interface {
 	PutString(k string, v string)
-	GetString(k string) (string, bool)
+	GetString(k string) (string, error)
 	PutInt(k string, v int)
-	GetInt(k string) (int, bool)
+	GetInt(k string) (int, error)
 	PutFloat64(k string, v float64)
-	GetFloat64(k string) (float64, bool)
+	GetFloat64(k string) (float64, error)
 	PutBool(k string, v bool)
-	GetBool(k string) (bool, bool)
+	GetBool(k string) (bool, error)
+	PutStrings(k string, v []string)
+	GetStrings(k string) ([]string, error)
+	PutSecret(k string, v string)
+	IsSecret(k string) bool
+	Secrets() map[string]string
+	Has(k string) bool
+	Keys() []string
+	Scope() Scope
+	NewScope(scope Scope) Context
+	Scoped(scope Scope) Context
 	MarshalJSON() ([]byte, error)
 	UnmarshalJSON(b []byte) error
-	Clone() contextMap
+	Clone() Context
+	String() string
 }
 
-type contextMap map[string]interface{}
+type NotFoundError struct {
+	Key string
+}
+
+type WrongTypeError struct {
+	Key      string
+	Expected string
+	Actual   interface{}
+}
+
+type contextMap struct {
+	sync.RWMutex
+	scope  Scope
+	values map[string]interface{}
+	parent *contextMap
+}
+
+type encodedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type encodedContext struct {
+	Scope  string                  `json:"scope"`
+	Values map[string]encodedValue `json:"values"`
+}
 
 func New() Context {
-	var c contextMap = make(contextMap)
-	return &c
+	return newContextMap(ExperimentScope, nil)
+}
+
+func newContextMap(scope Scope, parent *contextMap) *contextMap {
+	return &contextMap{scope: scope, values: make(map[string]interface{}), parent: parent}
+}
+
+func (s Scope) String() string {
+	if s < 0 || int(s) >= len(scopeNames) {
+		return fmt.Sprintf("scope(%d)", int(s))
+	}
+	return scopeNames[s]
+}
+
+func parseScope(name string) (Scope, error) {
+	for i, n := range scopeNames {
+		if n == name {
+			return Scope(i), nil
+		}
+	}
+	return ExperimentScope, fmt.Errorf("unknown context scope %q", name)
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("%s does not exist in the context", e.Key)
+}
+
+func (e WrongTypeError) Error() string {
+	return fmt.Sprintf("%s in the context is a %T, not a %s", e.Key, e.Actual, e.Expected)
+}
+
+func IsNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
+}
+
+func (c *contextMap) put(k string, v interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[k] = v
+}
+
+func (c *contextMap) get(k string) (interface{}, error) {
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		ctx.RLock()
+		v, ok := ctx.values[k]
+		ctx.RUnlock()
+		if ok {
+			return v, nil
+		}
+	}
+	return nil, NotFoundError{k}
+}
+
+func (c *contextMap) PutString(k string, v string) {
+	c.put(k, v)
+}
+
+func (c *contextMap) GetString(k string) (string, error) {
+	v, err := c.get(k)
+	if err != nil {
+		return "", err
+	}
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case secret:
+		return string(s), nil
+	}
+	return "", WrongTypeError{k, "string", v}
+}
+
+func (c *contextMap) PutInt(k string, v int) {
+	c.put(k, v)
+}
+
+func (c *contextMap) GetInt(k string) (int, error) {
+	v, err := c.get(k)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := v.(int); ok {
+		return i, nil
+	}
+	return 0, WrongTypeError{k, "int", v}
 }
 
-func (c contextMap) PutString(k string, v string) {
-	c[k] = v
+func (c *contextMap) PutFloat64(k string, v float64) {
+	c.put(k, v)
 }
 
-func (c contextMap) GetString(k string) (string, bool) {
-	if c[k] == nil {
-		return "", false
-	} else {
-		return c[k].(string), true
+func (c *contextMap) GetFloat64(k string) (float64, error) {
+	v, err := c.get(k)
+	if err != nil {
+		return 0, err
+	}
+	if f, ok := v.(float64); ok {
+		return f, nil
 	}
+	return 0, WrongTypeError{k, "float64", v}
 }
 
-func (c contextMap) PutInt(k string, v int) {
-	// saves as string, avoids json.Marshal turning int into json.numbers(float64)
-	c[k] = strconv.Itoa(v)
+func (c *contextMap) PutBool(k string, v bool) {
+	c.put(k, v)
 }
 
-func (c contextMap) GetInt(k string) (int, bool) {
-	if c[k] == nil {
-		return 0, false
-	} else {
-		value, _ := strconv.ParseInt(c[k].(string), 0, 0)
-		return int(value), true
+func (c *contextMap) GetBool(k string) (bool, error) {
+	v, err := c.get(k)
+	if err != nil {
+		return false, err
 	}
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, WrongTypeError{k, "bool", v}
 }
 
-func (c contextMap) PutFloat64(k string, v float64) {
-	c[k] = v
+func (c *contextMap) PutStrings(k string, v []string) {
+	c.put(k, append([]string{}, v...))
 }
 
-func (c contextMap) GetFloat64(k string) (float64, bool) {
-	if c[k] == nil {
-		return 0, false
-	} else {
-		return c[k].(float64), true
+func (c *contextMap) GetStrings(k string) ([]string, error) {
+	v, err := c.get(k)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := v.([]string); ok {
+		return append([]string{}, l...), nil
 	}
+	return nil, WrongTypeError{k, "[]string", v}
 }
 
-func (c contextMap) PutBool(k string, v bool) {
-	c[k] = v
+func (c *contextMap) PutSecret(k string, v string) {
+	c.put(k, secret(v))
 }
 
-func (c contextMap) GetBool(k string) (bool, bool) {
-	if c[k] == nil {
-		return false, false
-	} else {
-		return c[k].(bool), true
+func (c *contextMap) IsSecret(k string) bool {
+	v, err := c.get(k)
+	_, ok := v.(secret)
+	return err == nil && ok
+}
+
+func (c *contextMap) Secrets() map[string]string {
+	secrets := make(map[string]string)
+	for k, v := range c.flatten() {
+		if s, ok := v.(secret); ok {
+			secrets[k] = string(s)
+		}
 	}
+	return secrets
 }
 
-func (c contextMap) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}(c))
+func (c *contextMap) Has(k string) bool {
+	_, err := c.get(k)
+	return err == nil
 }
 
-func (c contextMap) UnmarshalJSON(b []byte) error {
-	var m map[string]interface{} = c
-	return json.Unmarshal(b, &m)
+func (c *contextMap) Keys() []string {
+	keys := make([]string, 0)
+	for k, _ := range c.flatten() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-func (c contextMap) Clone() contextMap {
-	var clone = make(contextMap)
-	for k, v := range c {
-		clone[k] = v
+func (c *contextMap) Scope() Scope {
+	return c.scope
+}
+
+func (c *contextMap) NewScope(scope Scope) Context {
+	return newContextMap(scope, c)
+}
+
+func (c *contextMap) Scoped(scope Scope) Context {
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		if ctx.scope == scope {
+			return ctx
+		}
+	}
+	return c
+}
+
+func (c *contextMap) flatten() map[string]interface{} {
+	var chain []*contextMap
+	for ctx := c; ctx != nil; ctx = ctx.parent {
+		chain = append(chain, ctx)
+	}
+
+	values := make(map[string]interface{})
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].RLock()
+		for k, v := range chain[i].values {
+			values[k] = v
+		}
+		chain[i].RUnlock()
+	}
+	return values
+}
+
+func (c *contextMap) Clone() Context {
+	clone := newContextMap(c.scope, nil)
+	for k, v := range c.flatten() {
+		if l, ok := v.([]string); ok {
+			v = append([]string{}, l...)
+		}
+		clone.values[k] = v
 	}
 	return clone
 }
+
+func (c *contextMap) String() string {
+	values := c.flatten()
+	pairs := make([]string, 0, len(values))
+	for _, k := range c.Keys() {
+		v := values[k]
+		if _, ok := v.(secret); ok {
+			v = Redacted
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	return fmt.Sprintf("%s{%s}", c.scope, strings.Join(pairs, " "))
+}
+
+// MarshalJSON leaves out secret values, they have to be passed on separately.
+func (c *contextMap) MarshalJSON() ([]byte, error) {
+	encoded := encodedContext{c.scope.String(), make(map[string]encodedValue)}
+	for k, v := range c.flatten() {
+		var t string
+		switch v.(type) {
+		case secret:
+			continue
+		case string:
+			t = "string"
+		case int:
+			t = "int"
+		case float64:
+			t = "float64"
+		case bool:
+			t = "bool"
+		case []string:
+			t = "strings"
+		default:
+			return nil, fmt.Errorf("cannot encode %s, unsupported type %T", k, v)
+		}
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Values[k] = encodedValue{t, raw}
+	}
+	return json.Marshal(encoded)
+}
+
+func (c *contextMap) UnmarshalJSON(b []byte) error {
+	var encoded encodedContext
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return err
+	}
+
+	scope, err := parseScope(encoded.Scope)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	for k, e := range encoded.Values {
+		v, err := decodeValue(k, e)
+		if err != nil {
+			return err
+		}
+		values[k] = v
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.scope = scope
+	c.values = values
+	c.parent = nil
+	return nil
+}
+
+func decodeValue(k string, e encodedValue) (interface{}, error) {
+	switch e.Type {
+	case "string":
+		var s string
+		err := json.Unmarshal(e.Value, &s)
+		return s, err
+	case "int":
+		var i int
+		err := json.Unmarshal(e.Value, &i)
+		return i, err
+	case "float64":
+		var f float64
+		err := json.Unmarshal(e.Value, &f)
+		return f, err
+	case "bool":
+		var b bool
+		err := json.Unmarshal(e.Value, &b)
+		return b, err
+	case "strings":
+		var l []string
+		err := json.Unmarshal(e.Value, &l)
+		return l, err
+	}
+	return nil, fmt.Errorf("cannot decode %s, unsupported type %s", k, e.Type)
+}
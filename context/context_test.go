@@ -1,6 +1,8 @@
 package context_test
 
 import (
+	"encoding/json"
+
 	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -21,13 +23,13 @@ var _ = Describe("Context map", func() {
 			localContext.PutString("key1", "abc")
 			localContext.PutString("key2", "123")
 
-			result, exists := localContext.GetString("key1")
+			result, err := localContext.GetString("key1")
 			Ω(result).Should(Equal("abc"))
-			Ω(exists).Should(Equal(true))
+			Ω(err).ShouldNot(HaveOccurred())
 
-			result, exists = localContext.GetString("key2")
+			result, err = localContext.GetString("key2")
 			Ω(result).Should(Equal("123"))
-			Ω(exists).Should(Equal(true))
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 
 		It("can store string value as provided", func() {
@@ -57,6 +59,32 @@ var _ = Describe("Context map", func() {
 			result, _ := localContext.GetFloat64("key")
 			Ω(result).Should(Equal(float64(3.14)))
 		})
+
+		It("can store a list of strings", func() {
+			localContext.PutStrings("list", []string{"a", "b"})
+
+			result, err := localContext.GetStrings("list")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result).Should(Equal([]string{"a", "b"}))
+		})
+	})
+
+	Context("Missing and mistyped values", func() {
+		It("returns a not found error for a missing key", func() {
+			_, err := localContext.GetString("missing")
+			Ω(err).Should(HaveOccurred())
+			Ω(context.IsNotFound(err)).Should(BeTrue())
+			Ω(localContext.Has("missing")).Should(BeFalse())
+		})
+
+		It("returns an error rather than panicking when the type does not match", func() {
+			localContext.PutInt("int", 123)
+
+			_, err := localContext.GetString("int")
+			Ω(err).Should(HaveOccurred())
+			Ω(context.IsNotFound(err)).Should(BeFalse())
+			Ω(err.Error()).Should(ContainSubstring("int"))
+		})
 	})
 
 	Context("Cloning map", func() {
@@ -76,4 +104,137 @@ var _ = Describe("Context map", func() {
 		})
 	})
 
+	Context("Scopes", func() {
+		var (
+			workerContext    context.Context
+			iterationContext context.Context
+		)
+
+		JustBeforeEach(func() {
+			localContext.PutString("shared", "experiment")
+			workerContext = localContext.NewScope(context.WorkerScope)
+			iterationContext = workerContext.NewScope(context.IterationScope)
+		})
+
+		It("starts in the experiment scope", func() {
+			Ω(localContext.Scope()).Should(Equal(context.ExperimentScope))
+			Ω(iterationContext.Scope()).Should(Equal(context.IterationScope))
+		})
+
+		It("reads values from enclosing scopes", func() {
+			result, err := iterationContext.GetString("shared")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result).Should(Equal("experiment"))
+		})
+
+		It("keeps values written in an inner scope out of the outer scopes", func() {
+			iterationContext.PutString("shared", "iteration")
+
+			result, _ := iterationContext.GetString("shared")
+			Ω(result).Should(Equal("iteration"))
+
+			result, _ = workerContext.GetString("shared")
+			Ω(result).Should(Equal("experiment"))
+		})
+
+		It("can write to an enclosing scope", func() {
+			iterationContext.Scoped(context.WorkerScope).PutInt("count", 1)
+
+			Ω(workerContext.Has("count")).Should(BeTrue())
+			Ω(localContext.Has("count")).Should(BeFalse())
+			Ω(workerContext.NewScope(context.IterationScope).Has("count")).Should(BeTrue())
+		})
+
+		It("is safe to use from several goroutines", func() {
+			done := make(chan bool)
+			for i := 0; i < 10; i++ {
+				go func(i int) {
+					for j := 0; j < 100; j++ {
+						workerContext.PutInt("value", i)
+						workerContext.NewScope(context.IterationScope).GetInt("value")
+					}
+					done <- true
+				}(i)
+			}
+			for i := 0; i < 10; i++ {
+				<-done
+			}
+		})
+	})
+
+	Context("JSON encoding", func() {
+		It("round trips values with their types", func() {
+			localContext.PutString("str", "a, b")
+			localContext.PutInt("int", 72)
+			localContext.PutFloat64("float", 1.5)
+			localContext.PutBool("bool", true)
+			localContext.PutStrings("list", []string{"x", "y"})
+
+			encoded, err := json.Marshal(localContext.NewScope(context.IterationScope))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			decoded := context.New()
+			Ω(json.Unmarshal(encoded, decoded)).Should(Succeed())
+
+			Ω(decoded.Scope()).Should(Equal(context.IterationScope))
+			Ω(decoded.GetString("str")).Should(Equal("a, b"))
+			Ω(decoded.GetInt("int")).Should(Equal(72))
+			Ω(decoded.GetFloat64("float")).Should(Equal(1.5))
+			Ω(decoded.GetBool("bool")).Should(BeTrue())
+			Ω(decoded.GetStrings("list")).Should(Equal([]string{"x", "y"}))
+		})
+
+		It("encodes the same values to the same bytes", func() {
+			localContext.PutString("b", "2")
+			localContext.PutString("a", "1")
+			other := context.New()
+			other.PutString("a", "1")
+			other.PutString("b", "2")
+
+			Ω(json.Marshal(localContext)).Should(Equal(mustMarshal(other)))
+		})
+	})
+
+	Context("Secrets", func() {
+		JustBeforeEach(func() {
+			localContext.PutString("user", "bob")
+			localContext.PutSecret("password", "hunter2")
+		})
+
+		It("reads secrets as strings", func() {
+			Ω(localContext.GetString("password")).Should(Equal("hunter2"))
+			Ω(localContext.IsSecret("password")).Should(BeTrue())
+			Ω(localContext.IsSecret("user")).Should(BeFalse())
+			Ω(localContext.Secrets()).Should(Equal(map[string]string{"password": "hunter2"}))
+		})
+
+		It("never encodes secret values", func() {
+			encoded := mustMarshal(localContext)
+			Ω(string(encoded)).ShouldNot(ContainSubstring("hunter2"))
+			Ω(string(encoded)).ShouldNot(ContainSubstring("password"))
+
+			decoded := context.New()
+			Ω(json.Unmarshal(encoded, decoded)).Should(Succeed())
+			Ω(decoded.Has("password")).Should(BeFalse())
+			Ω(decoded.GetString("user")).Should(Equal("bob"))
+		})
+
+		It("redacts secret values when printed", func() {
+			Ω(localContext.String()).Should(ContainSubstring("user=bob"))
+			Ω(localContext.String()).Should(ContainSubstring("password=" + context.Redacted))
+			Ω(localContext.String()).ShouldNot(ContainSubstring("hunter2"))
+		})
+
+		It("keeps secrets in clones and inner scopes", func() {
+			Ω(localContext.Clone().IsSecret("password")).Should(BeTrue())
+			Ω(localContext.NewScope(context.IterationScope).Secrets()).Should(HaveKeyWithValue("password", "hunter2"))
+		})
+	})
+
 })
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	Ω(err).ShouldNot(HaveOccurred())
+	return b
+}
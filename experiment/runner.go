@@ -2,6 +2,8 @@ package experiment
 
 import (
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	. "github.com/cloudfoundry-incubator/pat/benchmarker"
@@ -9,22 +11,30 @@ import (
 )
 
 type SampleType int
-type concurrencySchedule func() chan int
+type concurrencySchedule func(quit <-chan bool) chan int
 
 const (
 	ResultSample SampleType = iota
 	WorkerSample
 	ErrorSample
 	OtherSample
+	WindowSample
+	CancelledSample
 )
 
+const DefaultWindow = 10 * time.Second
+
+// Command.Throughput is completions per second of wall time, across all
+// workers. PerWorkerThroughput is Count / TotalTime, the rate a single worker
+// running the command back to back would achieve.
 type Command struct {
-	Count      int64
-	Throughput float64
-	Average    time.Duration
-	TotalTime  time.Duration
-	LastTime   time.Duration
-	WorstTime  time.Duration
+	Count               int64
+	Throughput          float64
+	Average             time.Duration
+	TotalTime           time.Duration
+	LastTime            time.Duration
+	WorstTime           time.Duration
+	PerWorkerThroughput float64
 }
 
 type Sample struct {
@@ -41,6 +51,46 @@ type Sample struct {
 	NinetyfifthPercentile time.Duration
 	WallTime              time.Duration
 	Type                  SampleType
+	Slaves                map[string]SlaveStatus `json:",omitempty"`
+	Event                 *Event                 `json:"-"`
+	Window                *Window                `json:",omitempty"`
+	Throughput            float64
+}
+
+// Window holds statistics for just the iterations that completed in one
+// window of the run, so that changes part way through are not averaged away.
+type Window struct {
+	Start                 time.Duration
+	Duration              time.Duration
+	Count                 int64
+	Errors                int
+	Throughput            float64
+	Average               time.Duration
+	NinetyfifthPercentile time.Duration
+	WorstResult           time.Duration
+}
+
+// Event is the raw result of a single iteration. Samples only keep running
+// totals, stores log every event so any statistic can be recomputed later.
+type Event struct {
+	Timestamp string
+	Worker    int
+	Iteration int
+	Duration  time.Duration
+	Steps     []StepResult
+	Error     string `json:",omitempty"`
+	Slave     string `json:",omitempty"`
+}
+
+// EventSource is implemented by experiments whose store keeps the raw events.
+type EventSource interface {
+	GetEvents() ([]*Event, error)
+}
+
+// LastSampleSource is implemented by experiments whose store can read their
+// last sample without loading the others. It is nil when there is none.
+type LastSampleSource interface {
+	GetLastSample() (*Sample, error)
 }
 
 type Experiment interface {
@@ -48,20 +98,91 @@ type Experiment interface {
 	GetData() ([]*Sample, error)
 }
 
+// WithEvents pairs events, in order, with the result samples they were
+// counted in, as they were when the experiment ran. Samples that get an event
+// are copied rather than changed.
+func WithEvents(samples []*Sample, events []*Event) []*Sample {
+	paired := make([]*Sample, len(samples))
+	for i, s := range samples {
+		paired[i] = s
+		if s.Type == ResultSample && len(events) > 0 {
+			copied := *s
+			copied.Event, events = events[0], events[1:]
+			paired[i] = &copied
+		}
+	}
+	return paired
+}
+
+// StartTime is the time of the first sample of an experiment, ok is false
+// when it has not produced one yet.
+func StartTime(e Experiment) (started time.Time, ok bool) {
+	data, err := e.GetData()
+	if err != nil || len(data) == 0 {
+		return started, false
+	}
+
+	started, err = time.Parse(time.RFC3339Nano, data[0].SystemTime)
+	return started, err == nil
+}
+
+// LastSample is the last sample of an experiment, ok is false when it has not
+// produced one yet.
+func LastSample(e Experiment) (last *Sample, ok bool) {
+	if source, isSource := e.(LastSampleSource); isSource {
+		last, err := source.GetLastSample()
+		return last, err == nil && last != nil
+	}
+
+	data, err := e.GetData()
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	return data[len(data)-1], true
+}
+
+// Metadata describes an experiment for the people looking at its results.
+// Tags are free-form key/value pairs, such as env=staging, to find runs by.
+// Workload is the workload the experiment ran, the laboratory fills it in.
+type Metadata struct {
+	Name        string            `json:",omitempty"`
+	Description string            `json:",omitempty"`
+	Tags        map[string]string `json:",omitempty"`
+	StartedBy   string            `json:",omitempty"`
+	Workload    string            `json:",omitempty"`
+}
+
+// MetadataSource is implemented by experiments whose store keeps their
+// Metadata.
+type MetadataSource interface {
+	GetMetadata() (Metadata, error)
+}
+
+// ConfigurationSource is implemented by experiments whose store keeps how
+// they were configured. The configuration is nil when the store has none.
+type ConfigurationSource interface {
+	GetConfiguration() (*ExperimentConfiguration, error)
+}
+
 type ExperimentConfiguration struct {
 	Iterations          int
 	Concurrency         []int
 	ConcurrencyStepTime time.Duration
 	Interval            int
 	Stop                int
-	Worker              Worker
+	Worker              Worker `json:"-"`
 	Workload            string
+	Window              time.Duration
 }
 
 type RunnableExperiment struct {
 	ExperimentConfiguration
+	Metadata        Metadata
 	executerFactory func(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable
-	samplerFactory  func(iterations int, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable
+	samplerFactory  func(iterations int, window time.Duration, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable
+	lock            sync.Mutex
+	quit            chan bool
+	cancelled       bool
 }
 
 type ExecutableExperiment struct {
@@ -78,6 +199,7 @@ type SamplableExperiment struct {
 	workers       chan int
 	samples       chan *Sample
 	quit          chan bool
+	window        time.Duration
 }
 
 type Executable interface {
@@ -89,11 +211,11 @@ type Samplable interface {
 }
 
 func NewExperimentConfiguration(iterations int, concurrency []int, concurrencyStepTime time.Duration, interval int, stop int, worker Worker, workload string) ExperimentConfiguration {
-	return ExperimentConfiguration{iterations, concurrency, concurrencyStepTime, interval, stop, worker, workload}
+	return ExperimentConfiguration{iterations, concurrency, concurrencyStepTime, interval, stop, worker, workload, DefaultWindow}
 }
 
 func NewRunnableExperiment(config ExperimentConfiguration) *RunnableExperiment {
-	return &RunnableExperiment{config, config.newExecutableExperiment, newRunningExperiment}
+	return &RunnableExperiment{ExperimentConfiguration: config, executerFactory: config.newExecutableExperiment, samplerFactory: newRunningExperiment, quit: make(chan bool)}
 }
 
 func (c ExperimentConfiguration) newExecutableExperiment(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable {
@@ -106,8 +228,8 @@ func (c ExperimentConfiguration) newExecutableExperiment(iterationResults chan I
 	return &ExecutableExperiment{c, iterationResults, workers, quit, schedule}
 }
 
-func newRunningExperiment(iterations int, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
-	return &SamplableExperiment{iterations, iterationResults, workers, samples, quit}
+func newRunningExperiment(iterations int, window time.Duration, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
+	return &SamplableExperiment{iterations, iterationResults, workers, samples, quit, window}
 }
 
 func (config *RunnableExperiment) Run(tracker func(<-chan *Sample), workloadCtx context.Context) error {
@@ -115,13 +237,19 @@ func (config *RunnableExperiment) Run(tracker func(<-chan *Sample), workloadCtx
 	errors := make(chan error)
 	workers := make(chan int)
 	samples := make(chan *Sample)
-	quit := make(chan bool)
 	done := make(chan bool)
+	config.lock.Lock()
+	if config.quit == nil {
+		config.quit = make(chan bool)
+	}
+	quit := config.quit
+	config.lock.Unlock()
+
 	maxIterations := config.Iterations
 	if config.Stop != 0 && config.Interval != 0 && config.Interval < config.Stop {
 		maxIterations *= int(1 + (float64(config.Stop) / float64(config.Interval)))
 	}
-	sampler := config.samplerFactory(maxIterations, iteration, errors, workers, samples, quit)
+	sampler := config.samplerFactory(maxIterations, config.Window, iteration, errors, workers, samples, quit)
 	go sampler.Sample()
 	go func(d chan bool) {
 		tracker(samples)
@@ -130,17 +258,56 @@ func (config *RunnableExperiment) Run(tracker func(<-chan *Sample), workloadCtx
 
 	config.executerFactory(iteration, errors, workers, quit).Execute(workloadCtx)
 	<-done
+
+	config.lock.Lock()
+	config.quit = nil
+	config.lock.Unlock()
 	return nil
 }
 
+// Cancel stops a running experiment. No new iterations are started, those
+// already running are left to finish, and the last sample is a
+// CancelledSample. An experiment made by NewRunnableExperiment can also be
+// cancelled before Run is called, it then runs no iterations at all. It
+// returns false if the experiment has finished or was already cancelled.
+func (config *RunnableExperiment) Cancel() bool {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+	if config.quit == nil || config.cancelled {
+		return false
+	}
+
+	config.cancelled = true
+	close(config.quit)
+	return true
+}
+
 func (ex *ExecutableExperiment) Execute(workloadCtx context.Context) {
 	Execute(RepeatEveryUntil(ex.Interval, ex.Stop, func(context.Context) {
-		ExecuteConcurrently(ex.schedule.start(), Repeat(ex.Iterations, Counted(ex.workers, TimedWithWorker(ex.iteration, ex.Worker, ex.Workload))), workloadCtx)
+		ExecuteConcurrently(ex.schedule.start(ex.quit), RepeatUntil(ex.Iterations, Counted(ex.workers, TimedWithWorker(ex.iteration, ex.Worker, ex.Workload)), ex.quit), workloadCtx)
 	}, ex.quit), workloadCtx)
 
 	close(ex.iteration)
 }
 
+// withThroughput clones the commands, with the throughput of each over the
+// wall time so far.
+func withThroughput(src map[string]Command, wallTime time.Duration) map[string]Command {
+	commands := clone(src)
+	for k, cmd := range commands {
+		cmd.Throughput = throughput(cmd.Count, wallTime)
+		commands[k] = cmd
+	}
+	return commands
+}
+
+func throughput(count int64, wallTime time.Duration) float64 {
+	if wallTime <= 0 {
+		return 0
+	}
+	return float64(count) / wallTime.Seconds()
+}
+
 func clone(src map[string]Command) map[string]Command {
 	var clone = make(map[string]Command)
 	for k, v := range src {
@@ -149,12 +316,22 @@ func clone(src map[string]Command) map[string]Command {
 	return clone
 }
 
-func (schedule concurrencySchedule) start() chan int {
-	return schedule()
+// cloneSlaves copies the map before it is changed, so samples that have
+// already been sent keep the status they were sent with.
+func cloneSlaves(src map[string]SlaveStatus) map[string]SlaveStatus {
+	var clone = make(map[string]SlaveStatus)
+	for k, v := range src {
+		clone[k] = v
+	}
+	return clone
+}
+
+func (schedule concurrencySchedule) start(quit <-chan bool) chan int {
+	return schedule(quit)
 }
 
 func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime time.Duration) concurrencySchedule {
-	return func() chan int {
+	return func(quit <-chan bool) chan int {
 		myStartingWorkers := startingWorkers
 		myTotalWorkers := totalWorkers
 		myConcurrencyStepTime := concurrencyStepTime
@@ -166,12 +343,17 @@ func linearSchedule(startingWorkers int, totalWorkers int, concurrencyStepTime t
 			}
 			if myConcurrencyStepTime > 0 && myStartingWorkers < myTotalWorkers {
 				tick := time.NewTicker(myConcurrencyStepTime)
-				for _ = range tick.C {
+				defer tick.Stop()
+				for {
+					select {
+					case <-tick.C:
+					case <-quit:
+						return
+					}
 					ch <- 1
 					myStartingWorkers++
 					if myStartingWorkers >= myTotalWorkers {
-						tick.Stop()
-						break
+						return
 					}
 				}
 			}
@@ -194,17 +376,44 @@ func (ex *SamplableExperiment) Sample() {
 	var percentileLength = int(math.Floor(float64(ex.maxIterations)*.05 + 0.95))
 	var percentile = make([]time.Duration, percentileLength, percentileLength)
 	var heartbeat = time.NewTicker(1 * time.Second)
+	var slaves map[string]SlaveStatus
 	startTime := time.Now()
 
+	// windows are disabled unless the sampler is given a window size
+	var windowTick <-chan time.Time
+	var current *window
+	if ex.window > 0 {
+		ticker := time.NewTicker(ex.window)
+		defer ticker.Stop()
+		windowTick = ticker.C
+		current = &window{start: startTime}
+	}
+
+	sample := func(sampleType SampleType, event *Event, w *Window) *Sample {
+		wallTime := time.Now().Sub(startTime)
+		return &Sample{withThroughput(commands, wallTime), avg, totalTime, time.Now().Format(time.RFC3339Nano), iterations, totalErrors, workers, lastResult, lastError, worstResult, ninetyfifthPercentile, wallTime, sampleType, slaves, event, w, throughput(iterations, wallTime)}
+	}
+
 	for {
 		sampleType := OtherSample
+		var event *Event
+		var closed *Window
 		select {
 		case iteration, ok := <-ex.iteration:
 			if !ok {
+				if current != nil && current.count() > 0 {
+					ex.samples <- sample(WindowSample, nil, current.close(startTime, time.Now()))
+				}
+				select {
+				case <-ex.quit:
+					ex.samples <- sample(CancelledSample, nil, nil)
+				default:
+				}
 				close(ex.samples)
 				return
 			}
 			sampleType = ResultSample
+			event = newEvent(iteration)
 			iterations = iterations + 1
 			totalTime = totalTime + iteration.Duration
 			avg = time.Duration(totalTime.Nanoseconds() / iterations)
@@ -228,7 +437,7 @@ func (ex *SamplableExperiment) Sample() {
 				cmd.TotalTime = cmd.TotalTime + step.Duration
 				cmd.LastTime = step.Duration
 				cmd.Average = time.Duration(cmd.TotalTime.Nanoseconds() / cmd.Count)
-				cmd.Throughput = float64(cmd.Count) / cmd.TotalTime.Seconds()
+				cmd.PerWorkerThroughput = float64(cmd.Count) / cmd.TotalTime.Seconds()
 				if step.Duration > cmd.WorstTime {
 					cmd.WorstTime = step.Duration
 				}
@@ -240,11 +449,89 @@ func (ex *SamplableExperiment) Sample() {
 				lastError = iteration.Error.Error()
 				totalErrors = totalErrors + 1
 			}
+
+			if iteration.Slave != nil {
+				slaves = cloneSlaves(slaves)
+				slaves[iteration.Slave.Name] = *iteration.Slave
+			}
+
+			if current != nil {
+				current.add(iteration)
+			}
 		case w := <-ex.workers:
 			workers = workers + w
+		case now := <-windowTick:
+			sampleType = WindowSample
+			closed = current.close(startTime, now)
+			current = &window{start: now}
 		case _ = <-heartbeat.C:
 			//heartbeat for updating CLI Walltime every second
 		}
-		ex.samples <- &Sample{clone(commands), avg, totalTime, time.Now().Format(time.RFC3339Nano), iterations, totalErrors, workers, lastResult, lastError, worstResult, ninetyfifthPercentile, time.Now().Sub(startTime), sampleType}
+		ex.samples <- sample(sampleType, event, closed)
+	}
+}
+
+// window collects the iterations that complete until it is closed.
+type window struct {
+	start     time.Time
+	durations []time.Duration
+	total     time.Duration
+	errors    int
+}
+
+func (w *window) add(iteration IterationResult) {
+	w.durations = append(w.durations, iteration.Duration)
+	w.total = w.total + iteration.Duration
+	if iteration.Error != nil {
+		w.errors = w.errors + 1
+	}
+}
+
+func (w *window) count() int {
+	return len(w.durations)
+}
+
+func (w *window) close(runStarted time.Time, end time.Time) *Window {
+	closed := &Window{
+		Start:    w.start.Sub(runStarted),
+		Duration: end.Sub(w.start),
+		Count:    int64(len(w.durations)),
+		Errors:   w.errors,
+	}
+
+	closed.Throughput = throughput(closed.Count, closed.Duration)
+
+	if closed.Count > 0 {
+		sort.Sort(byDuration(w.durations))
+		closed.Average = time.Duration(w.total.Nanoseconds() / closed.Count)
+		closed.NinetyfifthPercentile = w.durations[int(math.Ceil(float64(closed.Count)*.95))-1]
+		closed.WorstResult = w.durations[closed.Count-1]
+	}
+	return closed
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+
+func newEvent(iteration IterationResult) *Event {
+	event := &Event{Duration: iteration.Duration, Steps: iteration.Steps}
+	started := time.Now().Add(-iteration.Duration)
+	if iteration.Origin != nil {
+		started = iteration.Origin.Started
+		event.Worker = iteration.Origin.Worker
+		event.Iteration = iteration.Origin.Iteration
+	}
+	event.Timestamp = started.Format(time.RFC3339Nano)
+
+	if iteration.Error != nil {
+		event.Error = iteration.Error.Error()
+	}
+
+	if iteration.Slave != nil {
+		event.Slave = iteration.Slave.Name
 	}
+	return event
 }
@@ -19,7 +19,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			sampleFunc      func(*DummySampler)
 			executorFunc    func(*DummyExecutor)
 			executorFactory func(chan IterationResult, chan error, chan int, chan bool) Executable
-			samplerFactory  func(int, chan IterationResult, chan error, chan int, chan *Sample, chan bool) Samplable
+			samplerFactory  func(int, time.Duration, chan IterationResult, chan error, chan int, chan *Sample, chan bool) Samplable
 			sample1         *Sample
 			sample2         *Sample
 			worker          Worker
@@ -35,11 +35,11 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 				executor = &DummyExecutor{iterationResults, workers, errors, executorFunc}
 				return executor
 			}
-			samplerFactory = func(maxIterations int, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
+			samplerFactory = func(maxIterations int, window time.Duration, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
 				sampler = &DummySampler{maxIterations, samples, iterationResults, workers, errors, sampleFunc}
 				return sampler
 			}
-			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 1, 3, worker, "push"}, executorFactory, samplerFactory}
+			config = &RunnableExperiment{ExperimentConfiguration: ExperimentConfiguration{5, []int{2}, 1 * time.Second, 1, 3, worker, "push", 0}, executerFactory: executorFactory, samplerFactory: samplerFactory}
 		})
 
 		It("Sends Samples from Sampler to the passed tracker function", func() {
@@ -68,8 +68,22 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			Ω(sampler.maxIterations).Should(Equal(20))
 		})
 
+		It("Passes the window size to the sampler", func() {
+			var window time.Duration
+			samplerFactory = func(maxIterations int, w time.Duration, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
+				window = w
+				sampler = &DummySampler{maxIterations, samples, iterationResults, workers, errors, func(s *DummySampler) { close(s.samples) }}
+				return sampler
+			}
+			config = &RunnableExperiment{ExperimentConfiguration: ExperimentConfiguration{5, []int{2}, 1 * time.Second, 1, 3, worker, "push", 3 * time.Second}, executerFactory: executorFactory, samplerFactory: samplerFactory}
+			executorFunc = func(e *DummyExecutor) {}
+			config.Run(func(samples <-chan *Sample) {}, workloadCtx)
+
+			Ω(window).Should(Equal(3 * time.Second))
+		})
+
 		It("Calculates the maximum iterations correctly when stop is not divisible by interval", func() {
-			config = &RunnableExperiment{ExperimentConfiguration{5, []int{2}, 1 * time.Second, 2, 5, worker, "push"}, executorFactory, samplerFactory}
+			config = &RunnableExperiment{ExperimentConfiguration: ExperimentConfiguration{5, []int{2}, 1 * time.Second, 2, 5, worker, "push", 0}, executerFactory: executorFactory, samplerFactory: samplerFactory}
 			executorFunc = func(e *DummyExecutor) {}
 			sampleFunc = func(s *DummySampler) {}
 			config.Run(func(samples <-chan *Sample) {}, workloadCtx)
@@ -143,6 +157,64 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			Ω(got).Should(HaveLen(1))
 			Ω(got[0].Error()).Should(Equal("Foo"))
 		})
+
+		Describe("Cancelling", func() {
+			It("Can't cancel an experiment that is not running", func() {
+				Ω(config.Cancel()).Should(BeFalse())
+			})
+
+			It("Closes the quit channel passed to the executor and sampler", func() {
+				var executorQuit, samplerQuit chan bool
+				started := make(chan bool)
+				config.executerFactory = func(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable {
+					executorQuit = quit
+					return &DummyExecutor{iterationResults, workers, errors, func(e *DummyExecutor) {
+						close(started)
+						<-quit
+					}}
+				}
+				config.samplerFactory = func(maxIterations int, window time.Duration, iterationResults chan IterationResult, errors chan error, workers chan int, samples chan *Sample, quit chan bool) Samplable {
+					samplerQuit = quit
+					return &DummySampler{maxIterations, samples, iterationResults, workers, errors, func(s *DummySampler) { close(s.samples) }}
+				}
+
+				finished := make(chan bool)
+				go func() {
+					config.Run(func(samples <-chan *Sample) {
+						for _ = range samples {
+						}
+					}, workloadCtx)
+					close(finished)
+				}()
+
+				<-started
+				Ω(config.Cancel()).Should(BeTrue())
+				Ω(config.Cancel()).Should(BeFalse())
+				Eventually(finished).Should(BeClosed())
+				Ω(executorQuit).Should(BeClosed())
+				Ω(samplerQuit).Should(Equal(executorQuit))
+			})
+
+			It("Can cancel an experiment that is about to run", func() {
+				executorFunc = func(e *DummyExecutor) {}
+				sampleFunc = func(s *DummySampler) { close(s.samples) }
+				config = NewRunnableExperiment(config.ExperimentConfiguration)
+				var executorQuit chan bool
+				config.executerFactory = func(iterationResults chan IterationResult, errors chan error, workers chan int, quit chan bool) Executable {
+					executorQuit = quit
+					return executorFactory(iterationResults, errors, workers, quit)
+				}
+				config.samplerFactory = samplerFactory
+
+				Ω(config.Cancel()).Should(BeTrue())
+				config.Run(func(samples <-chan *Sample) {
+					for _ = range samples {
+					}
+				}, workloadCtx)
+				Ω(executorQuit).Should(BeClosed())
+				Ω(config.Cancel()).Should(BeFalse())
+			})
+		})
 	})
 
 	Describe("Executing", func() {
@@ -166,14 +238,14 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			workers = make(chan int)
 			quit = make(chan bool)
 			samples = make(chan *Sample)
-			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit}).Sample()
+			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit, 0}).Sample()
 		})
 
 		It("saves command in a immutable map", func() {
 			go func() {
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
 			}()
 
 			Ω((<-samples).Commands["push"].Count).Should(Equal(int64(1)))
@@ -197,13 +269,13 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			workers = make(chan int)
 			quit = make(chan bool)
 			samples = make(chan *Sample)
-			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit}).Sample()
+			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit, 0}).Sample()
 		})
 
 		It("Calculates the running average", func() {
-			go func() { iteration <- IterationResult{2 * time.Second, nil, nil} }()
-			go func() { iteration <- IterationResult{4 * time.Second, nil, nil} }()
-			go func() { iteration <- IterationResult{6 * time.Second, nil, nil} }()
+			go func() { iteration <- IterationResult{2 * time.Second, nil, nil, nil, nil} }()
+			go func() { iteration <- IterationResult{4 * time.Second, nil, nil, nil, nil} }()
+			go func() { iteration <- IterationResult{6 * time.Second, nil, nil, nil, nil} }()
 
 			Ω((<-samples).Average).Should(Equal(2 * time.Second))
 			Ω((<-samples).Average).Should(Equal(3 * time.Second))
@@ -212,7 +284,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 		It("Closes the samples channel when there are no more iterationResults", func() {
 			go func() {
-				iteration <- IterationResult{2 * time.Second, nil, nil}
+				iteration <- IterationResult{2 * time.Second, nil, nil, nil, nil}
 				close(iteration)
 			}()
 
@@ -221,36 +293,102 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			return
 		})
 
+		It("Sends a cancelled sample with the totals last when the experiment was cancelled", func() {
+			go func() {
+				iteration <- IterationResult{2 * time.Second, nil, nil, nil, nil}
+				close(quit)
+				close(iteration)
+			}()
+
+			Ω((<-samples).Type).Should(Equal(ResultSample))
+			last := <-samples
+			Ω(last.Type).Should(Equal(CancelledSample))
+			Ω(last.Total).Should(Equal(int64(1)))
+			Ω(samples).Should(BeClosed())
+		})
+
 		It("Counts errors", func() {
 			go func() {
-				iteration <- IterationResult{0, nil, &EncodableError{"fishfingers burnt"}}
-				iteration <- IterationResult{0, nil, &EncodableError{"toast not buttered"}}
+				iteration <- IterationResult{0, nil, &EncodableError{"fishfingers burnt"}, nil, nil}
+				iteration <- IterationResult{0, nil, &EncodableError{"toast not buttered"}, nil, nil}
 			}()
 
 			Ω((<-samples).TotalErrors).Should(Equal(1))
 			Ω((<-samples).TotalErrors).Should(Equal(2))
 		})
 
-		It("Calculates the throughput for a command", func() {
+		It("Attaches the raw result of each iteration to its sample", func() {
+			started := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+			go func() {
+				iteration <- IterationResult{2 * time.Second, []StepResult{StepResult{Command: "push", Duration: 2 * time.Second}},
+					&EncodableError{"boom"}, &SlaveStatus{Name: "loader-1"}, &Origin{started, 3, 11}}
+			}()
+
+			event := (<-samples).Event
+			Ω(event).Should(Equal(&Event{
+				Timestamp: started.Format(time.RFC3339Nano),
+				Worker:    3,
+				Iteration: 11,
+				Duration:  2 * time.Second,
+				Steps:     []StepResult{StepResult{Command: "push", Duration: 2 * time.Second}},
+				Error:     "boom",
+				Slave:     "loader-1",
+			}))
+		})
+
+		It("Reports the latest status of each slave", func() {
+			go func() {
+				iteration <- IterationResult{0, nil, nil, &SlaveStatus{Name: "a", Running: 1, Capacity: 2, Utilisation: 0.5}, nil}
+				iteration <- IterationResult{0, nil, nil, &SlaveStatus{Name: "b", Running: 2, Capacity: 2, Utilisation: 1}, nil}
+				iteration <- IterationResult{0, nil, nil, &SlaveStatus{Name: "a", Running: 2, Capacity: 2, Utilisation: 1, Pending: 5}, nil}
+			}()
+
+			first := <-samples
+			Ω(first.Slaves).Should(HaveLen(1))
+			Ω((<-samples).Slaves).Should(HaveLen(2))
+
+			third := <-samples
+			Ω(third.Slaves["a"].Utilisation).Should(Equal(1.0))
+			Ω(third.Slaves["a"].Pending).Should(Equal(5))
+			Ω(third.Slaves["b"].Running).Should(Equal(2))
+			Ω(first.Slaves["a"].Utilisation).Should(Equal(0.5))
+		})
+
+		It("Calculates the per worker throughput for a command", func() {
 			go func() {
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil}
-				iteration <- IterationResult{0, []StepResult{StepResult{Command: "list", Duration: 2 * time.Second}}, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
+				iteration <- IterationResult{0, []StepResult{StepResult{Command: "list", Duration: 2 * time.Second}}, nil, nil, nil}
 			}()
 
-			Ω((<-samples).Commands["push"].Throughput).Should(BeNumerically("==", 1))
-			Ω((<-samples).Commands["list"].Throughput).Should(BeNumerically("==", 0.5))
+			Ω((<-samples).Commands["push"].PerWorkerThroughput).Should(BeNumerically("==", 1))
+			Ω((<-samples).Commands["list"].PerWorkerThroughput).Should(BeNumerically("==", 0.5))
 
 			go func() {
 				iteration <- IterationResult{0, []StepResult{
 					StepResult{Command: "push", Duration: 3 * time.Second},
 					StepResult{Command: "push", Duration: 2 * time.Second}},
-					nil}
+					nil, nil, nil}
 			}()
 
 			sample := <-samples
 			Ω(sample.Commands["push"].Count).Should(Equal(int64(3)))
 			Ω(sample.Commands["push"].TotalTime).Should(Equal(6 * time.Second))
-			Ω(sample.Commands["push"].Throughput).Should(BeNumerically("==", 0.5))
+			Ω(sample.Commands["push"].PerWorkerThroughput).Should(BeNumerically("==", 0.5))
+		})
+
+		It("Calculates throughput over wall time, across all workers", func() {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				iteration <- IterationResult{1 * time.Second, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
+				iteration <- IterationResult{1 * time.Second, []StepResult{StepResult{Command: "push", Duration: 1 * time.Second}}, nil, nil, nil}
+			}()
+
+			<-samples
+			sample := <-samples
+			Ω(sample.WallTime).Should(BeNumerically(">=", 100*time.Millisecond))
+			Ω(sample.Throughput).Should(Equal(2 / sample.WallTime.Seconds()))
+			Ω(sample.Commands["push"].Throughput).Should(Equal(2 / sample.WallTime.Seconds()))
+			Ω(sample.Commands["push"].PerWorkerThroughput).Should(BeNumerically("==", 1))
 		})
 	})
 
@@ -271,7 +409,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			quit = make(chan bool)
 			samples = make(chan *Sample)
 			ticks = make(chan int)
-			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit}).Sample()
+			go (&SamplableExperiment{maxIterations, iteration, workers, samples, quit, 0}).Sample()
 		})
 
 		It("Calculates the 95th percentile", func() {
@@ -280,7 +418,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 
 			go func() {
 				for i := 0; i < maxIterations; i++ {
-					iteration <- IterationResult{time.Duration(samplesToSend[i]) * time.Second, nil, nil}
+					iteration <- IterationResult{time.Duration(samplesToSend[i]) * time.Second, nil, nil, nil, nil}
 				}
 			}()
 			for q := 0; q < maxIterations; q++ {
@@ -289,10 +427,81 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 		})
 	})
 
+	Describe("Windows", func() {
+		var (
+			iteration chan IterationResult
+			samples   chan *Sample
+		)
+
+		BeforeEach(func() {
+			iteration = make(chan IterationResult)
+			samples = make(chan *Sample)
+			go (&SamplableExperiment{10, iteration, make(chan int), samples, make(chan bool), 200 * time.Millisecond}).Sample()
+		})
+
+		nextWindow := func() *Sample {
+			for s := range samples {
+				if s.Type == WindowSample {
+					return s
+				}
+			}
+			return nil
+		}
+
+		It("Emits statistics for the iterations in each window", func() {
+			go func() {
+				iteration <- IterationResult{1 * time.Second, nil, nil, nil, nil}
+				iteration <- IterationResult{3 * time.Second, nil, &EncodableError{"boom"}, nil, nil}
+			}()
+
+			first := nextWindow()
+			Ω(first.Window.Start).Should(Equal(time.Duration(0)))
+			Ω(first.Window.Duration).Should(BeNumerically("~", 200*time.Millisecond, 50*time.Millisecond))
+			Ω(first.Window.Count).Should(Equal(int64(2)))
+			Ω(first.Window.Errors).Should(Equal(1))
+			Ω(first.Window.Average).Should(Equal(2 * time.Second))
+			Ω(first.Window.NinetyfifthPercentile).Should(Equal(3 * time.Second))
+			Ω(first.Window.WorstResult).Should(Equal(3 * time.Second))
+			Ω(first.Window.Throughput).Should(BeNumerically("~", 10, 2.5))
+
+			go func() { iteration <- IterationResult{5 * time.Second, nil, nil, nil, nil} }()
+			second := nextWindow()
+			Ω(second.Window.Start).Should(BeNumerically("~", 200*time.Millisecond, 50*time.Millisecond))
+			Ω(second.Window.Count).Should(Equal(int64(1)))
+			Ω(second.Window.Average).Should(Equal(5 * time.Second))
+			Ω(second.Average).Should(Equal(3 * time.Second))
+		})
+
+		It("Emits empty windows when nothing completes", func() {
+			Ω(nextWindow().Window.Count).Should(Equal(int64(0)))
+		})
+
+		It("Emits the last, partial, window when the run finishes", func() {
+			go func() {
+				iteration <- IterationResult{1 * time.Second, nil, nil, nil, nil}
+				close(iteration)
+			}()
+
+			Ω((<-samples).Type).Should(Equal(ResultSample))
+			last := <-samples
+			Ω(last.Type).Should(Equal(WindowSample))
+			Ω(last.Window.Count).Should(Equal(int64(1)))
+			Ω(samples).Should(BeClosed())
+		})
+	})
+
 	Describe("Scheduling", func() {
 		Context("#linearSchedule", func() {
+			It("Stops adding workers once quit is closed", func() {
+				quit := make(chan bool)
+				schedule := linearSchedule(1, 3, 1*time.Second).start(quit)
+				Ω(<-schedule).ShouldNot(BeNil())
+				close(quit)
+				Eventually(schedule).Should(BeClosed())
+			})
+
 			It("Creates a prepopulated channel containing the starting amount of events", func() {
-				schedule := linearSchedule(3, 0, 0*time.Second).start()
+				schedule := linearSchedule(3, 0, 0*time.Second).start(nil)
 				for i := 0; i < 3; i++ {
 					Ω(<-schedule).ShouldNot(BeNil())
 				}
@@ -300,7 +509,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			})
 
 			It("Pushes events at the provided interval", func() {
-				schedule := linearSchedule(0, 3, 3*time.Second).start()
+				schedule := linearSchedule(0, 3, 3*time.Second).start(nil)
 				for i := 0; i < 3; i++ {
 					delay, _ := Time(func() error {
 						<-schedule
@@ -312,7 +521,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			})
 
 			It("Only pushes the starting workers when supplied with a concurrencyStepTime of 0", func() {
-				schedule := linearSchedule(3, 6, 0*time.Second).start()
+				schedule := linearSchedule(3, 6, 0*time.Second).start(nil)
 				for i := 0; i < 3; i++ {
 					Ω(<-schedule).ShouldNot(BeNil())
 				}
@@ -322,7 +531,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 			Context("Repeated scheduling", func() {
 				It("creates a new schedule each time start() is called", func() {
 					scheduler := linearSchedule(1, 3, 3*time.Second)
-					schedule := scheduler.start()
+					schedule := scheduler.start(nil)
 					Ω(<-schedule).ShouldNot(BeNil())
 					for i := 0; i < 2; i++ {
 						delay, _ := Time(func() error {
@@ -332,7 +541,7 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 						Ω(delay.Seconds()).Should(BeNumerically("~", 3, .1))
 					}
 					Ω(schedule).Should(BeClosed())
-					schedule = scheduler.start()
+					schedule = scheduler.start(nil)
 					Ω(<-schedule).ShouldNot(BeNil())
 					for i := 0; i < 2; i++ {
 						delay, _ := Time(func() error {
@@ -348,6 +557,21 @@ var _ = Describe("ExperimentConfiguration and Sampler", func() {
 	})
 })
 
+var _ = Describe("WithEvents", func() {
+	It("pairs events with the result samples they were counted in", func() {
+		samples := []*Sample{{Type: WorkerSample}, {Type: ResultSample}, {Type: WindowSample}, {Type: ResultSample}, {Type: ResultSample}}
+		events := []*Event{{Iteration: 1}, {Iteration: 2}}
+
+		paired := WithEvents(samples, events)
+		Ω(paired).Should(HaveLen(5))
+		Ω(paired[0].Event).Should(BeNil())
+		Ω(paired[1].Event).Should(Equal(events[0]))
+		Ω(paired[3].Event).Should(Equal(events[1]))
+		Ω(paired[4].Event).Should(BeNil())
+		Ω(samples[1].Event).Should(BeNil())
+	})
+})
+
 type DummySampler struct {
 	maxIterations    int
 	samples          chan *Sample
@@ -0,0 +1,144 @@
+package laboratory
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// ArchiveVersion is the version of the archives written. Version 1 archives
+// did not have the configuration of each experiment, and can still be read.
+const ArchiveVersion = 2
+
+// ArchiveError says why an archive could not be read.
+type ArchiveError struct {
+	Reason string
+}
+
+func (e *ArchiveError) Error() string {
+	return e.Reason
+}
+
+// ArchivedExperiment is one experiment in an archive. An archive is a gzip
+// compressed stream of these as JSON, one after the other, so it can be
+// written and read without holding every experiment in memory. Events and
+// the configuration are only there when the store kept them.
+type ArchivedExperiment struct {
+	Version       int
+	Guid          string
+	Metadata      experiment.Metadata
+	Configuration *experiment.ExperimentConfiguration `json:",omitempty"`
+	Samples       []*experiment.Sample
+	Events        []*experiment.Event `json:",omitempty"`
+}
+
+// WriteArchive writes the experiments, with everything their stores kept
+// about them, to an archive.
+func WriteArchive(w io.Writer, experiments []experiment.Experiment) error {
+	compressed := gzip.NewWriter(w)
+	encoder := json.NewEncoder(compressed)
+	for _, e := range experiments {
+		archived := &ArchivedExperiment{Version: ArchiveVersion, Guid: e.GetGuid()}
+
+		var err error
+		if archived.Samples, err = e.GetData(); err != nil {
+			return err
+		}
+		if source, ok := e.(experiment.MetadataSource); ok {
+			if archived.Metadata, err = source.GetMetadata(); err != nil {
+				return err
+			}
+		}
+		if source, ok := e.(experiment.ConfigurationSource); ok {
+			if archived.Configuration, err = source.GetConfiguration(); err != nil {
+				return err
+			}
+		}
+		if source, ok := e.(experiment.EventSource); ok {
+			if archived.Events, err = source.GetEvents(); err != nil {
+				return err
+			}
+		}
+
+		if err = encoder.Encode(archived); err != nil {
+			return err
+		}
+	}
+	return compressed.Close()
+}
+
+// ReadArchive writes the experiments of an archive to the store, and returns
+// how many there were. Experiments the store already has are skipped.
+func ReadArchive(r io.Reader, store Store) (imported int, err error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, &ArchiveError{"not an archive: " + err.Error()}
+	}
+	defer compressed.Close()
+
+	existing, err := store.LoadAll()
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool)
+	for _, e := range existing {
+		seen[e.GetGuid()] = true
+	}
+
+	decoder := json.NewDecoder(compressed)
+	for {
+		var archived ArchivedExperiment
+		if err = decoder.Decode(&archived); err == io.EOF {
+			return imported, nil
+		} else if err != nil {
+			return imported, &ArchiveError{"not an archive: " + err.Error()}
+		}
+
+		if archived.Version < 1 || archived.Version > ArchiveVersion {
+			return imported, &ArchiveError{fmt.Sprintf("archive version %d is not supported, expected at most %d", archived.Version, ArchiveVersion)}
+		}
+		if archived.Guid == "" || seen[archived.Guid] {
+			continue
+		}
+
+		if err = restore(store, &archived); err != nil {
+			return imported, err
+		}
+		seen[archived.Guid] = true
+		imported++
+	}
+}
+
+// restore writes an archived experiment through the store's Configure,
+// Describe and Writer, so every store keeps it as if it had just run. Each result sample carries the event
+// of its iteration, as it did when the experiment ran.
+func restore(store Store, archived *ArchivedExperiment) error {
+	if configured, ok := store.(ConfigurationStore); ok && archived.Configuration != nil {
+		if err := configured.Configure(archived.Guid, *archived.Configuration); err != nil {
+			return err
+		}
+	}
+	if described, ok := store.(MetadataStore); ok {
+		if err := described.Describe(archived.Guid, archived.Metadata); err != nil {
+			return err
+		}
+	}
+
+	write := store.Writer(archived.Guid)
+	samples := make(chan *experiment.Sample)
+	done := make(chan struct{})
+	go func() {
+		write(samples)
+		close(done)
+	}()
+
+	for _, s := range experiment.WithEvents(archived.Samples, archived.Events) {
+		samples <- s
+	}
+	close(samples)
+	<-done
+	return nil
+}
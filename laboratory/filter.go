@@ -0,0 +1,55 @@
+package laboratory
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// Filter selects experiments by start time, workload and tags. Zero values
+// match every experiment.
+type Filter struct {
+	Since    time.Time
+	Until    time.Time
+	Workload string
+	Tags     map[string]string
+}
+
+// A QueryStore can select the experiments that match a Filter itself, rather
+// than the laboratory loading every experiment to look at them.
+type QueryStore interface {
+	Store
+	Query(filter Filter) ([]experiment.Experiment, error)
+}
+
+// Matches checks an experiment against the filter using its metadata and
+// first sample. Experiments that have not produced a sample yet count as
+// starting now.
+func (f Filter) Matches(e experiment.Experiment) bool {
+	if f.Workload != "" || len(f.Tags) > 0 {
+		var m experiment.Metadata
+		if source, ok := e.(experiment.MetadataSource); ok {
+			m, _ = source.GetMetadata()
+		}
+
+		if f.Workload != "" && m.Workload != f.Workload {
+			return false
+		}
+		for k, v := range f.Tags {
+			if value, found := m.Tags[k]; !found || value != v {
+				return false
+			}
+		}
+	}
+
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		started, ok := experiment.StartTime(e)
+		if !ok {
+			started = time.Now()
+		}
+		if started.Before(f.Since) || (!f.Until.IsZero() && !started.Before(f.Until)) {
+			return false
+		}
+	}
+	return true
+}
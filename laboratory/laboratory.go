@@ -1,40 +1,97 @@
 package laboratory
 
 import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
 	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 	"github.com/nu7hatch/gouuid"
 )
 
 type lab struct {
-	store  Store
-	loaded []experiment.Experiment
+	store       Store
+	handlers    []HandlerFactory
+	lock        sync.Mutex
+	changed     *sync.Cond
+	running     map[string]Runnable
+	queue       []string
+	parallelism int
 }
 
 type Laboratory interface {
 	Run(ex Runnable, workloadCtx context.Context) (string, error)
 	RunWithHandlers(ex Runnable, fns []func(samples <-chan *experiment.Sample), workloadCtx context.Context) (string, error)
 	Visit(fn func(ex experiment.Experiment))
+	Query(filter Filter) ([]experiment.Experiment, error)
+	Find(name string) (experiment.Experiment, error)
 	GetData(name string) ([]*experiment.Sample, error)
+	Running(name string) bool
+	Queue() []string
+	Cancel(name string) error
+	Delete(name string) error
+	Prune(retention Retention) ([]string, error)
+	Import(archive io.Reader) (int, error)
 }
 
 type Runnable interface {
 	Run(handler func(samples <-chan *experiment.Sample), workloadCtx context.Context) error
 }
 
+// A Cancellable experiment can be stopped before it finishes.
+type Cancellable interface {
+	Cancel() bool
+}
+
+var ErrNotRunning = errors.New("experiment is not running")
+var ErrNotCancellable = errors.New("experiment can not be cancelled")
+var ErrRunning = errors.New("experiment has not finished")
+
+// HandlerFactory makes a handler for the samples of one experiment. The
+// laboratory adds one to the Multiplexer of every experiment it runs.
+type HandlerFactory func(guid string, ex Runnable) func(samples <-chan *experiment.Sample)
+
+// A Store keeps the samples of experiments. Delete removes an experiment and
+// everything the store keeps about it, it is not an error if the store does
+// not have it.
 type Store interface {
 	Writer(guid string) func(samples <-chan *experiment.Sample)
 	LoadAll() ([]experiment.Experiment, error)
+	Delete(guid string) error
 }
 
-func NewLaboratory(history Store) Laboratory {
-	lab := &lab{history, make([]experiment.Experiment, 0)}
-	lab.reload()
-	return lab
+// A FindStore can look up one experiment without loading the others. Find
+// returns nil when the store does not have the experiment.
+type FindStore interface {
+	Store
+	Find(guid string) (experiment.Experiment, error)
+}
+
+// A ConfigurationStore also records how each experiment was configured.
+type ConfigurationStore interface {
+	Store
+	Configure(guid string, config experiment.ExperimentConfiguration) error
+}
+
+// A MetadataStore also records the Metadata of each experiment.
+type MetadataStore interface {
+	Store
+	Describe(guid string, metadata experiment.Metadata) error
 }
 
-func (self *lab) reload() {
-	self.loaded, _ = self.store.LoadAll()
+func NewLaboratory(history Store, handlers ...HandlerFactory) Laboratory {
+	return NewQueuedLaboratory(0, history, handlers...)
+}
+
+// NewQueuedLaboratory runs at most parallelism experiments at a time, the
+// others wait in a queue and start in the order they were run. A parallelism
+// below 1 runs every experiment right away.
+func NewQueuedLaboratory(parallelism int, history Store, handlers ...HandlerFactory) Laboratory {
+	lab := &lab{store: history, handlers: handlers, running: make(map[string]Runnable), parallelism: parallelism}
+	lab.changed = sync.NewCond(&lab.lock)
+	return lab
 }
 
 func (self *lab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
@@ -44,28 +101,217 @@ func (self *lab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
 func (self *lab) RunWithHandlers(ex Runnable, additionalHandlers []func(<-chan *experiment.Sample), workloadCtx context.Context) (string, error) {
 	guid, _ := uuid.NewV4()
 	handlers := make([]func(<-chan *experiment.Sample), 1)
+	if runnable, ok := ex.(*experiment.RunnableExperiment); ok {
+		if configured, ok := self.store.(ConfigurationStore); ok {
+			configured.Configure(guid.String(), runnable.ExperimentConfiguration)
+		}
+		if described, ok := self.store.(MetadataStore); ok {
+			metadata := runnable.Metadata
+			metadata.Workload = runnable.Workload
+			described.Describe(guid.String(), metadata)
+		}
+	}
 	handlers[0] = self.store.Writer(guid.String())
+	for _, factory := range self.handlers {
+		handlers = append(handlers, factory(guid.String(), ex))
+	}
 	for _, h := range additionalHandlers {
 		handlers = append(handlers, h)
 	}
-	go ex.Run(Multiplexer(handlers).Multiplex, workloadCtx)
+
+	self.lock.Lock()
+	started := self.admit(guid.String(), ex)
+	if !started {
+		self.queue = append(self.queue, guid.String())
+	}
+	self.lock.Unlock()
+
+	go func() {
+		if !started && !self.wait(guid.String(), ex) {
+			cancelled(Multiplexer(handlers).Multiplex)
+			return
+		}
+
+		ex.Run(Multiplexer(handlers).Multiplex, workloadCtx)
+
+		self.lock.Lock()
+		delete(self.running, guid.String())
+		self.changed.Broadcast()
+		self.lock.Unlock()
+	}()
 	return guid.String(), nil
 }
 
+// admit starts an experiment if nothing is queued before it and there is
+// room, the lock must be held.
+func (self *lab) admit(guid string, ex Runnable) bool {
+	if len(self.queue) > 0 && self.queue[0] != guid {
+		return false
+	}
+	if self.parallelism > 0 && len(self.running) >= self.parallelism {
+		return false
+	}
+
+	if len(self.queue) > 0 {
+		self.queue = self.queue[1:]
+	}
+	self.running[guid] = ex
+	return true
+}
+
+// wait blocks until a queued experiment can start, or returns false if it
+// was cancelled first.
+func (self *lab) wait(guid string, ex Runnable) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for {
+		if self.position(guid) == 0 {
+			return false
+		}
+		if self.admit(guid, ex) {
+			// the next experiment in the queue may fit as well
+			self.changed.Broadcast()
+			return true
+		}
+		self.changed.Wait()
+	}
+}
+
+// position is where an experiment is in the queue, counting from 1, or 0
+// if it is not queued. The lock must be held.
+func (self *lab) position(guid string) int {
+	for i, queued := range self.queue {
+		if queued == guid {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// cancelled ends an experiment that was cancelled before it started with a
+// single CancelledSample.
+func cancelled(handler func(samples <-chan *experiment.Sample)) {
+	samples := make(chan *experiment.Sample, 1)
+	samples <- &experiment.Sample{Type: experiment.CancelledSample, SystemTime: time.Now().Format(time.RFC3339Nano)}
+	close(samples)
+	handler(samples)
+}
+
+// Delete removes a finished experiment from the store, experiments that are
+// running or queued have to be cancelled first.
+func (self *lab) Delete(name string) error {
+	self.lock.Lock()
+	_, running := self.running[name]
+	queued := self.position(name) > 0
+	self.lock.Unlock()
+	if running || queued {
+		return ErrRunning
+	}
+
+	return self.store.Delete(name)
+}
+
+// Import adds the experiments of an archive to the store.
+func (self *lab) Import(archive io.Reader) (int, error) {
+	return ReadArchive(archive, self.store)
+}
+
 func (self *lab) Visit(fn func(ex experiment.Experiment)) {
-	self.reload()
-	for _, e := range self.loaded {
+	experiments, _ := self.store.LoadAll()
+	for _, e := range experiments {
 		fn(e)
 	}
 }
 
-func (self *lab) GetData(name string) ([]*experiment.Sample, error) {
-	self.reload()
-	for _, e := range self.loaded {
-		if e.GetGuid() == name {
-			return e.GetData()
+// Query lists the experiments that match a filter, oldest first. Stores that
+// can query their experiments do the filtering, the others are loaded and
+// filtered here.
+func (self *lab) Query(filter Filter) ([]experiment.Experiment, error) {
+	if queried, ok := self.store.(QueryStore); ok {
+		return queried.Query(filter)
+	}
+
+	experiments, err := self.store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]experiment.Experiment, 0)
+	for _, e := range experiments {
+		if filter.Matches(e) {
+			matching = append(matching, e)
 		}
 	}
+	return matching, nil
+}
+
+// Find returns the experiment with the given guid from the store, or nil if
+// the store does not have it.
+func (self *lab) Find(name string) (experiment.Experiment, error) {
+	if found, ok := self.store.(FindStore); ok {
+		return found.Find(name)
+	}
+
+	experiments, err := self.store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
 
+	for _, e := range experiments {
+		if e.GetGuid() == name {
+			return e, nil
+		}
+	}
 	return nil, nil
 }
+
+func (self *lab) GetData(name string) ([]*experiment.Sample, error) {
+	e, err := self.Find(name)
+	if e == nil || err != nil {
+		return nil, err
+	}
+	return e.GetData()
+}
+
+func (self *lab) Running(name string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	_, ok := self.running[name]
+	return ok
+}
+
+// Queue lists the experiments that are waiting to start, next first.
+func (self *lab) Queue() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]string{}, self.queue...)
+}
+
+// Cancel stops a running experiment. Its samples are still written, ending
+// with a CancelledSample, once the iterations in flight have finished. A
+// queued experiment is taken out of the queue and only gets the
+// CancelledSample.
+func (self *lab) Cancel(name string) error {
+	self.lock.Lock()
+	if i := self.position(name); i > 0 {
+		self.queue = append(self.queue[:i-1], self.queue[i:]...)
+		self.changed.Broadcast()
+		self.lock.Unlock()
+		return nil
+	}
+	ex, ok := self.running[name]
+	self.lock.Unlock()
+	if !ok {
+		return ErrNotRunning
+	}
+
+	cancellable, ok := ex.(Cancellable)
+	if !ok {
+		return ErrNotCancellable
+	}
+
+	if !cancellable.Cancel() {
+		return ErrNotRunning
+	}
+	return nil
+}
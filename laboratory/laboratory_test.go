@@ -1,6 +1,13 @@
 package laboratory
 
 import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/cloudfoundry-incubator/pat/experiment"
 	. "github.com/onsi/ginkgo"
@@ -57,6 +64,34 @@ var _ = Describe("Laboratory", func() {
 			Ω(handlerRecieved).Should(HaveLen(3))
 		})
 
+		Context("When the laboratory has handler factories", func() {
+			var (
+				factoryGuid string
+				factoryRan  Runnable
+				received    chan *Sample
+			)
+
+			BeforeEach(func() {
+				received = make(chan *Sample, 10)
+			})
+
+			It("adds a handler made for each experiment it runs", func() {
+				lab := NewLaboratory(store, func(guid string, ex Runnable) func(<-chan *Sample) {
+					factoryGuid, factoryRan = guid, ex
+					return func(samples <-chan *Sample) {
+						for s := range samples {
+							received <- s
+						}
+					}
+				})
+				guid, _ := lab.Run(experiment1, workloadCtx)
+
+				Eventually(received).Should(Receive())
+				Ω(factoryGuid).Should(Equal(guid))
+				Ω(factoryRan).Should(Equal(experiment1))
+			})
+		})
+
 		Describe("Loading previous experiment at startup", func() {
 			var (
 				loadedExperiment1 Experiment
@@ -127,16 +162,388 @@ var _ = Describe("Laboratory", func() {
 	})
 })
 
+var _ = Describe("Recording the configuration", func() {
+	It("passes the configuration of an experiment to a store that records it", func() {
+		store := &configuringStore{dummyStore: dummyStore{make(map[string][]*Sample), make([]Experiment, 0)}}
+		config := NewExperimentConfiguration(0, []int{1}, 0, 0, 0, benchmarker.NewLocalWorker(), "")
+		guid, _ := NewLaboratory(store).Run(NewRunnableExperiment(config), context.New())
+
+		Ω(store.configured).Should(HaveKey(guid))
+		Ω(store.configured[guid].Concurrency).Should(Equal([]int{1}))
+	})
+
+	It("passes the metadata of an experiment to a store that records it", func() {
+		store := &configuringStore{dummyStore: dummyStore{make(map[string][]*Sample), make([]Experiment, 0)}}
+		ex := NewRunnableExperiment(NewExperimentConfiguration(0, []int{1}, 0, 0, 0, benchmarker.NewLocalWorker(), "gcf:push"))
+		ex.Metadata.StartedBy = "someone"
+		guid, _ := NewLaboratory(store).Run(ex, context.New())
+
+		Ω(store.described).Should(HaveKeyWithValue(guid, Metadata{StartedBy: "someone", Workload: "gcf:push"}))
+	})
+})
+
+var _ = Describe("Cancelling an experiment", func() {
+	var (
+		lab   Laboratory
+		store *dummyStore
+		ex    *cancellableExperiment
+		guid  string
+	)
+
+	BeforeEach(func() {
+		store = &dummyStore{make(map[string][]*Sample), make([]Experiment, 0)}
+		lab = NewLaboratory(store)
+		ex = &cancellableExperiment{make(chan bool)}
+		guid, _ = lab.Run(ex, context.New())
+	})
+
+	It("cancels a running experiment", func() {
+		Ω(lab.Running(guid)).Should(BeTrue())
+		Ω(lab.Cancel(guid)).Should(Succeed())
+		Eventually(func() bool { return lab.Running(guid) }).Should(BeFalse())
+	})
+
+	It("can not cancel an experiment that has finished", func() {
+		lab.Cancel(guid)
+		Eventually(func() bool { return lab.Running(guid) }).Should(BeFalse())
+		Ω(lab.Cancel(guid)).Should(Equal(ErrNotRunning))
+	})
+
+	It("can not cancel an experiment it does not know", func() {
+		Ω(lab.Cancel("unknown")).Should(Equal(ErrNotRunning))
+		lab.Cancel(guid)
+	})
+
+	It("can not cancel an experiment that does not support it", func() {
+		blocked := &cancellableExperiment{make(chan bool)}
+		other, _ := lab.Run(struct{ Runnable }{blocked}, context.New())
+		Ω(lab.Cancel(other)).Should(Equal(ErrNotCancellable))
+		blocked.Cancel()
+		lab.Cancel(guid)
+	})
+})
+
+var _ = Describe("Queueing experiments", func() {
+	var (
+		lab           Laboratory
+		store         *lockedStore
+		first, second *cancellableExperiment
+		run1, run2    string
+	)
+
+	BeforeEach(func() {
+		store = &lockedStore{dummyStore: dummyStore{make(map[string][]*Sample), make([]Experiment, 0)}}
+		lab = NewQueuedLaboratory(1, store)
+		first = &cancellableExperiment{make(chan bool)}
+		second = &cancellableExperiment{make(chan bool)}
+		run1, _ = lab.Run(first, context.New())
+		run2, _ = lab.Run(second, context.New())
+	})
+
+	It("runs experiments one at a time, in order", func() {
+		Ω(lab.Running(run1)).Should(BeTrue())
+		Ω(lab.Running(run2)).Should(BeFalse())
+		Ω(lab.Queue()).Should(Equal([]string{run2}))
+
+		first.Cancel()
+		Eventually(func() bool { return lab.Running(run2) }).Should(BeTrue())
+		Ω(lab.Queue()).Should(BeEmpty())
+		second.Cancel()
+	})
+
+	It("takes a cancelled experiment out of the queue and records it as cancelled", func() {
+		Ω(lab.Cancel(run2)).Should(Succeed())
+		Ω(lab.Queue()).Should(BeEmpty())
+		Eventually(func() []*Sample { return store.samples(run2) }).Should(HaveLen(1))
+		Ω(store.samples(run2)[0].Type).Should(Equal(CancelledSample))
+		Ω(lab.Running(run2)).Should(BeFalse())
+
+		first.Cancel()
+		Consistently(func() bool { return lab.Running(run2) }).Should(BeFalse())
+	})
+
+	It("runs every experiment right away without a limit", func() {
+		lab = NewLaboratory(store)
+		third := &cancellableExperiment{make(chan bool)}
+		fourth := &cancellableExperiment{make(chan bool)}
+		run3, _ := lab.Run(third, context.New())
+		run4, _ := lab.Run(fourth, context.New())
+		Ω(lab.Running(run3)).Should(BeTrue())
+		Ω(lab.Running(run4)).Should(BeTrue())
+		third.Cancel()
+		fourth.Cancel()
+		first.Cancel()
+		lab.Cancel(run2)
+	})
+})
+
+var _ = Describe("Deleting experiments", func() {
+	var (
+		lab   Laboratory
+		store *dummyStore
+	)
+
+	BeforeEach(func() {
+		store = &dummyStore{make(map[string][]*Sample), []Experiment{&dummyExperiment{"old", []*Sample{&Sample{}}}}}
+		lab = NewLaboratory(store)
+	})
+
+	It("removes a finished experiment from the store", func() {
+		Ω(lab.Delete("old")).Should(Succeed())
+		Ω(store.previous).Should(BeEmpty())
+		Ω(data(lab.GetData("old"))).Should(BeNil())
+	})
+
+	It("does not delete an experiment that is running", func() {
+		ex := &cancellableExperiment{make(chan bool)}
+		guid, _ := lab.Run(ex, context.New())
+		Ω(lab.Delete(guid)).Should(Equal(ErrRunning))
+		ex.Cancel()
+	})
+})
+
+var _ = Describe("Retention", func() {
+	var (
+		lab   Laboratory
+		store *dummyStore
+	)
+
+	startedAt := func(name string, age time.Duration) Experiment {
+		return &dummyExperiment{name, []*Sample{&Sample{SystemTime: time.Now().Add(-age).Format(time.RFC3339Nano)}}}
+	}
+
+	BeforeEach(func() {
+		store = &dummyStore{make(map[string][]*Sample), []Experiment{
+			startedAt("oldest", 72*time.Hour),
+			startedAt("newest", time.Hour),
+			&dummyExperiment{"starting", []*Sample{}},
+			startedAt("older", 48*time.Hour),
+		}}
+		lab = NewLaboratory(store)
+	})
+
+	guids := func() []string {
+		guids := make([]string, 0)
+		for _, e := range store.previous {
+			guids = append(guids, e.GetGuid())
+		}
+		return guids
+	}
+
+	It("keeps the newest experiments", func() {
+		Ω(lab.Prune(Retention{Keep: 2})).Should(Equal([]string{"oldest"}))
+		Ω(guids()).Should(Equal([]string{"newest", "starting", "older"}))
+	})
+
+	It("keeps the experiments started within the maximum age", func() {
+		Ω(lab.Prune(Retention{MaxAge: 60 * time.Hour})).Should(Equal([]string{"oldest"}))
+		Ω(lab.Prune(Retention{MaxAge: 24 * time.Hour})).Should(Equal([]string{"older"}))
+	})
+
+	It("deletes the experiments either policy does not keep", func() {
+		Ω(lab.Prune(Retention{Keep: 1, MaxAge: 60 * time.Hour})).Should(Equal([]string{"older", "oldest"}))
+	})
+
+	It("keeps everything without a policy", func() {
+		Ω(lab.Prune(Retention{})).Should(BeEmpty())
+		Ω(guids()).Should(HaveLen(4))
+	})
+})
+
+var _ = Describe("Archives", func() {
+	var (
+		archive bytes.Buffer
+		store   *configuringStore
+	)
+
+	BeforeEach(func() {
+		archive.Reset()
+		exported := &describedExperiment{
+			dummyExperiment{"exported", []*Sample{&Sample{Type: ResultSample, Total: 1}, &Sample{Type: WindowSample}, &Sample{Type: ResultSample, Total: 2}}},
+			Metadata{Name: "nightly", Tags: map[string]string{"env": "staging"}},
+			[]*Event{&Event{Iteration: 1}, &Event{Iteration: 2}},
+			&ExperimentConfiguration{Iterations: 3, Concurrency: []int{1, 2}, Workload: "gcf:push"},
+		}
+		Ω(WriteArchive(&archive, []Experiment{exported})).Should(Succeed())
+		store = &configuringStore{dummyStore: dummyStore{make(map[string][]*Sample), make([]Experiment, 0)}}
+	})
+
+	It("restores the samples, events and metadata of each experiment", func() {
+		Ω(ReadArchive(&archive, store)).Should(Equal(1))
+		samples := store.stored["exported"]
+		Ω(samples).Should(HaveLen(3))
+		Ω(samples[2].Total).Should(BeEquivalentTo(2))
+		Ω(samples[0].Event.Iteration).Should(Equal(1))
+		Ω(samples[1].Event).Should(BeNil())
+		Ω(samples[2].Event.Iteration).Should(Equal(2))
+		Ω(store.described["exported"].Tags).Should(Equal(map[string]string{"env": "staging"}))
+	})
+
+	It("restores the configuration of each experiment", func() {
+		Ω(ReadArchive(&archive, store)).Should(Equal(1))
+		Ω(store.configured["exported"].Concurrency).Should(Equal([]int{1, 2}))
+		Ω(store.configured["exported"].Workload).Should(Equal("gcf:push"))
+	})
+
+	It("reads archives written before they had configurations", func() {
+		archive.Reset()
+		compressed := gzip.NewWriter(&archive)
+		compressed.Write([]byte(`{"Version":1,"Guid":"old","Samples":[{"Total":1}]}`))
+		compressed.Close()
+
+		Ω(ReadArchive(&archive, store)).Should(Equal(1))
+		Ω(store.stored["old"]).Should(HaveLen(1))
+		Ω(store.configured).Should(BeEmpty())
+	})
+
+	It("skips experiments the store already has", func() {
+		store.previous = []Experiment{&dummyExperiment{"exported", nil}}
+		Ω(ReadArchive(&archive, store)).Should(Equal(0))
+		Ω(store.stored).Should(BeEmpty())
+	})
+
+	It("imports into the store of a laboratory", func() {
+		lab := NewLaboratory(store)
+		Ω(lab.Import(&archive)).Should(Equal(1))
+	})
+
+	It("does not accept anything else", func() {
+		_, err := ReadArchive(strings.NewReader("guid,samples"), store)
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
 func data(s []*Sample, e error) []*Sample {
 	Ω(e).ShouldNot(HaveOccurred())
 	return s
 }
 
+var _ = Describe("Querying experiments", func() {
+	var store *dummyStore
+
+	describedAt := func(name string, workload string, tags map[string]string, started string) Experiment {
+		return &describedExperiment{dummyExperiment: dummyExperiment{name, []*Sample{&Sample{SystemTime: started}}}, metadata: Metadata{Workload: workload, Tags: tags}}
+	}
+
+	guids := func(experiments []Experiment, err error) []string {
+		Ω(err).ShouldNot(HaveOccurred())
+		guids := make([]string, 0)
+		for _, e := range experiments {
+			guids = append(guids, e.GetGuid())
+		}
+		return guids
+	}
+
+	BeforeEach(func() {
+		store = &dummyStore{make(map[string][]*Sample), []Experiment{
+			describedAt("a", "gcf:push", map[string]string{"env": "staging"}, "2014-05-01T10:00:00Z"),
+			describedAt("b", "gcf:login", map[string]string{"env": "prod"}, "2014-06-01T10:00:00Z"),
+			&dummyExperiment{"c", []*Sample{}},
+		}}
+	})
+
+	It("filters the experiments of a store on their workload, tags and start time", func() {
+		lab := NewLaboratory(store)
+		Ω(guids(lab.Query(Filter{}))).Should(Equal([]string{"a", "b", "c"}))
+		Ω(guids(lab.Query(Filter{Workload: "gcf:push"}))).Should(Equal([]string{"a"}))
+		Ω(guids(lab.Query(Filter{Tags: map[string]string{"env": "prod"}}))).Should(Equal([]string{"b"}))
+		Ω(guids(lab.Query(Filter{Until: time.Date(2014, 5, 15, 0, 0, 0, 0, time.UTC)}))).Should(Equal([]string{"a"}))
+		Ω(guids(lab.Query(Filter{Since: time.Date(2014, 5, 15, 0, 0, 0, 0, time.UTC)}))).Should(Equal([]string{"b", "c"}))
+	})
+
+	It("leaves the filtering to a store that can query its experiments", func() {
+		querying := &queryingStore{dummyStore: *store}
+		found, err := NewLaboratory(querying).Query(Filter{Workload: "gcf:push"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(querying.filter.Workload).Should(Equal("gcf:push"))
+		Ω(found).Should(HaveLen(3))
+	})
+})
+
+var _ = Describe("Finding an experiment", func() {
+	It("loads the experiments of the store to find one", func() {
+		store := &dummyStore{make(map[string][]*Sample), []Experiment{&dummyExperiment{"a", []*Sample{}}, &dummyExperiment{"b", []*Sample{}}}}
+		lab := NewLaboratory(store)
+		Ω(lab.Find("b")).Should(Equal(&dummyExperiment{"b", []*Sample{}}))
+		Ω(lab.Find("c")).Should(BeNil())
+	})
+
+	It("looks the experiment up in a store that can find one", func() {
+		store := &findingStore{dummyStore: dummyStore{make(map[string][]*Sample), []Experiment{}}}
+		lab := NewLaboratory(store)
+		Ω(data(lab.GetData("a"))).Should(HaveLen(1))
+		Ω(store.found).Should(Equal([]string{"a"}))
+	})
+})
+
 type dummyStore struct {
 	stored   map[string][]*Sample
 	previous []Experiment
 }
 
+type configuringStore struct {
+	dummyStore
+	configured map[string]ExperimentConfiguration
+	described  map[string]Metadata
+}
+
+func (store *configuringStore) Configure(guid string, config ExperimentConfiguration) error {
+	if store.configured == nil {
+		store.configured = make(map[string]ExperimentConfiguration)
+	}
+	store.configured[guid] = config
+	return nil
+}
+
+func (store *configuringStore) Describe(guid string, metadata Metadata) error {
+	if store.described == nil {
+		store.described = make(map[string]Metadata)
+	}
+	store.described[guid] = metadata
+	return nil
+}
+
+type queryingStore struct {
+	dummyStore
+	filter Filter
+}
+
+func (store *queryingStore) Query(filter Filter) ([]Experiment, error) {
+	store.filter = filter
+	return store.previous, nil
+}
+
+type findingStore struct {
+	dummyStore
+	found []string
+}
+
+func (store *findingStore) Find(guid string) (Experiment, error) {
+	store.found = append(store.found, guid)
+	return &dummyExperiment{guid, []*Sample{&Sample{Total: 1}}}, nil
+}
+
+type lockedStore struct {
+	dummyStore
+	sync.Mutex
+}
+
+func (store *lockedStore) Writer(guid string) func(samples <-chan *Sample) {
+	return func(samples <-chan *Sample) {
+		for s := range samples {
+			store.Lock()
+			store.stored[guid] = append(store.stored[guid], s)
+			store.Unlock()
+		}
+	}
+}
+
+func (store *lockedStore) samples(guid string) []*Sample {
+	store.Lock()
+	defer store.Unlock()
+	return store.stored[guid]
+}
+
 type dummyExperiment struct {
 	name string
 	data []*Sample
@@ -155,6 +562,17 @@ func (store *dummyStore) LoadAll() ([]Experiment, error) {
 	return store.previous, nil
 }
 
+func (store *dummyStore) Delete(guid string) error {
+	delete(store.stored, guid)
+	for i, e := range store.previous {
+		if e.GetGuid() == guid {
+			store.previous = append(store.previous[:i], store.previous[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 func (e *dummyExperiment) Run(fn func(samples <-chan *Sample), workloadCtx context.Context) error {
 	ch := make(chan *Sample)
 	done := make(chan bool)
@@ -177,3 +595,41 @@ func (e *dummyExperiment) GetData() ([]*Sample, error) {
 func (e *dummyExperiment) GetGuid() string {
 	return e.name
 }
+
+type describedExperiment struct {
+	dummyExperiment
+	metadata      Metadata
+	events        []*Event
+	configuration *ExperimentConfiguration
+}
+
+func (e *describedExperiment) GetConfiguration() (*ExperimentConfiguration, error) {
+	return e.configuration, nil
+}
+
+func (e *describedExperiment) GetMetadata() (Metadata, error) {
+	return e.metadata, nil
+}
+
+func (e *describedExperiment) GetEvents() ([]*Event, error) {
+	return e.events, nil
+}
+
+type cancellableExperiment struct {
+	quit chan bool
+}
+
+func (e *cancellableExperiment) Run(fn func(samples <-chan *Sample), workloadCtx context.Context) error {
+	ch := make(chan *Sample)
+	go func() {
+		<-e.quit
+		close(ch)
+	}()
+	fn(ch)
+	return nil
+}
+
+func (e *cancellableExperiment) Cancel() bool {
+	close(e.quit)
+	return true
+}
@@ -0,0 +1,73 @@
+package laboratory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// Retention says which finished experiments to keep: the Keep newest, and
+// those started within MaxAge. Zero values keep every experiment.
+type Retention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+func (r Retention) IsZero() bool {
+	return r.Keep < 1 && r.MaxAge <= 0
+}
+
+type started struct {
+	guid string
+	at   time.Time
+}
+
+type newestFirst []started
+
+func (s newestFirst) Len() int           { return len(s) }
+func (s newestFirst) Less(i, j int) bool { return s[i].at.After(s[j].at) }
+func (s newestFirst) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Prune deletes the experiments the retention policy does not keep, and
+// returns their guids. Experiments that are running, queued or have no
+// samples yet are always kept.
+func (self *lab) Prune(retention Retention) ([]string, error) {
+	deleted := make([]string, 0)
+	if retention.IsZero() {
+		return deleted, nil
+	}
+
+	experiments, err := self.store.LoadAll()
+	if err != nil {
+		return deleted, err
+	}
+
+	finished := make(newestFirst, 0)
+	for _, e := range experiments {
+		self.lock.Lock()
+		_, running := self.running[e.GetGuid()]
+		queued := self.position(e.GetGuid()) > 0
+		self.lock.Unlock()
+		if running || queued {
+			continue
+		}
+
+		if at, ok := experiment.StartTime(e); ok {
+			finished = append(finished, started{e.GetGuid(), at})
+		}
+	}
+	sort.Stable(finished)
+
+	cutoff := time.Now().Add(-retention.MaxAge)
+	for i, f := range finished {
+		if (retention.Keep > 0 && i >= retention.Keep) || (retention.MaxAge > 0 && f.at.Before(cutoff)) {
+			if err = self.store.Delete(f.guid); err != nil {
+				break
+			}
+			deleted = append(deleted, f.guid)
+		}
+	}
+
+	return deleted, err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/cmdline"
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/logs"
@@ -12,8 +13,10 @@ import (
 
 func main() {
 	useServer := false
+	useSlave := false
 	flags := config.ConfigAndFlags
 	flags.BoolVar(&useServer, "server", false, "true to run the HTTP server interface")
+	flags.BoolVar(&useSlave, "slave", false, "true to run only as a redis slave, serving tasks until stopped")
 
 	logs.InitCommandLineFlags(flags)
 	cmdline.InitCommandLineFlags(flags)
@@ -27,6 +30,12 @@ func main() {
 	if useServer == true {
 		logs.NewLogger("main").Info("Starting in server mode")
 		server.Serve()
+	} else if useSlave == true {
+		logs.NewLogger("main").Info("Starting in slave mode")
+		if err = benchmarker.ServeSlave(); err != nil {
+			fmt.Println(err)
+			os.Exit(30)
+		}
 	} else {
 		err = cmdline.RunCommandLine()
 		if err != nil {
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+)
+
+const (
+	IterationDuration = "pat_iteration_duration_seconds"
+	StepDuration      = "pat_step_duration_seconds"
+	Errors            = "pat_errors_total"
+	Workers           = "pat_workers"
+	QueueDepth        = "pat_redis_queue_depth"
+)
+
+var Buckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Expiry is how long the series of an experiment are still served after it
+// ends, so that scrapers see its last values before they are dropped.
+var Expiry = 10 * time.Minute
+
+// Default is the registry served at /metrics by the server.
+var Default = NewRegistry()
+
+type Registry struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help   string
+	kind   string
+	series map[string]*series
+}
+
+type series struct {
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{
+		IterationDuration: newFamily("histogram", "Duration of each iteration of an experiment."),
+		StepDuration:      newFamily("histogram", "Duration of each step of an iteration, by command."),
+		Errors:            newFamily("counter", "Failed iterations, by the command that failed and the class of the error."),
+		Workers:           newFamily("gauge", "Workers currently running an experiment."),
+		QueueDepth:        newFamily("gauge", "Tasks waiting in the redis queue, as last reported by the slaves."),
+	}}
+}
+
+func newFamily(kind string, help string) *family {
+	return &family{help: help, kind: kind, series: make(map[string]*series)}
+}
+
+// Handler records the samples of one experiment. It has the signature of a
+// laboratory.HandlerFactory so it can be given to laboratory.NewLaboratory.
+func (r *Registry) Handler(guid string, ex laboratory.Runnable) func(<-chan *experiment.Sample) {
+	workload := ""
+	if runnable, ok := ex.(*experiment.RunnableExperiment); ok {
+		workload = runnable.Workload
+	}
+
+	return func(samples <-chan *experiment.Sample) {
+		base := []string{"experiment", guid, "workload", workload}
+		for s := range samples {
+			r.record(base, s)
+		}
+		r.set(Workers, labels(base...), 0)
+		time.AfterFunc(Expiry, func() { r.forget(labels(base...)) })
+	}
+}
+
+// forget drops every series with the given labels, and any more after them.
+func (r *Registry) forget(base string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, f := range r.families {
+		for key := range f.series {
+			if key == base || strings.HasPrefix(key, base+",") {
+				delete(f.series, key)
+			}
+		}
+	}
+}
+
+func (r *Registry) record(base []string, s *experiment.Sample) {
+	r.set(Workers, labels(base...), float64(s.TotalWorkers))
+
+	if len(s.Slaves) > 0 {
+		depth := 0
+		for _, slave := range s.Slaves {
+			if slave.Pending > depth {
+				depth = slave.Pending
+			}
+		}
+		r.set(QueueDepth, labels(base...), float64(depth))
+	}
+
+	if s.Event == nil {
+		return
+	}
+
+	r.observe(IterationDuration, labels(base...), s.Event.Duration)
+	for _, step := range s.Event.Steps {
+		r.observe(StepDuration, labels(append(base, "command", step.Command)...), step.Duration)
+	}
+
+	if s.Event.Error != "" {
+		command := ""
+		if len(s.Event.Steps) > 0 {
+			command = s.Event.Steps[len(s.Event.Steps)-1].Command
+		}
+		r.add(Errors, labels(append(base, "command", command, "class", ErrorClass(s.Event.Error))...), 1)
+	}
+}
+
+// ErrorClass groups error messages into a small set of classes so that the
+// error counters keep a bounded number of series.
+func ErrorClass(msg string) string {
+	lower := strings.ToLower(msg)
+	switch {
+	case len(msg) >= 3 && msg[0] == '4' && isDigits(msg[1:3]):
+		return "http_4xx"
+	case len(msg) >= 3 && msg[0] == '5' && isDigits(msg[1:3]):
+		return "http_5xx"
+	case strings.Contains(lower, "timed out") || strings.Contains(lower, "timeout"):
+		return "timeout"
+	case strings.Contains(lower, "was lost by"):
+		return "lost"
+	case strings.Contains(lower, "connection") || strings.Contains(lower, "no such host") || strings.Contains(lower, "eof"):
+		return "connection"
+	}
+	return "other"
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Registry) get(name string, key string) *series {
+	f := r.families[name]
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{}
+		if f.kind == "histogram" {
+			s.buckets = make([]uint64, len(Buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (r *Registry) set(name string, key string, value float64) {
+	r.Lock()
+	defer r.Unlock()
+	r.get(name, key).value = value
+}
+
+func (r *Registry) add(name string, key string, value float64) {
+	r.Lock()
+	defer r.Unlock()
+	r.get(name, key).value += value
+}
+
+func (r *Registry) observe(name string, key string, d time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	s := r.get(name, key)
+	seconds := d.Seconds()
+	for i, bound := range Buckets {
+		if seconds <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// ServeHTTP writes every metric in the prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range sortedKeys(r.families) {
+		f := r.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(w, "%s{%s} %v\n", name, key, s.value)
+				continue
+			}
+			for i, bound := range Buckets {
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%v\"} %d\n", name, key, bound, s.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, s.count)
+			fmt.Fprintf(w, "%s_sum{%s} %v\n", name, key, s.sum)
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, key, s.count)
+		}
+	}
+}
+
+func sortedKeys(m map[string]*family) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(pairs ...string) string {
+	rendered := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rendered = append(rendered, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+	return strings.Join(rendered, ",")
+}
@@ -0,0 +1,134 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		registry *metrics.Registry
+		samples  chan *Sample
+		done     chan bool
+	)
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+		samples = make(chan *Sample)
+		done = make(chan bool)
+
+		config := NewExperimentConfiguration(1, []int{1}, 0, 0, 0, nil, "cf:push")
+		handler := registry.Handler("abc-123", NewRunnableExperiment(config))
+		go func() {
+			handler(samples)
+			done <- true
+		}()
+	})
+
+	scrape := func() (string, http.Header) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		registry.ServeHTTP(resp, req)
+		return resp.Body.String(), resp.Header()
+	}
+
+	It("serves the prometheus text format", func() {
+		close(samples)
+		<-done
+		body, header := scrape()
+		Ω(header.Get("Content-Type")).Should(Equal("text/plain; version=0.0.4"))
+		Ω(body).Should(ContainSubstring("# TYPE pat_iteration_duration_seconds histogram\n"))
+		Ω(body).Should(ContainSubstring("# TYPE pat_errors_total counter\n"))
+		Ω(body).Should(ContainSubstring("# TYPE pat_workers gauge\n"))
+	})
+
+	It("observes the duration of iterations and steps", func() {
+		steps := []benchmarker.StepResult{{"login", 200 * time.Millisecond}, {"push", 2 * time.Second}}
+		samples <- &Sample{Event: &Event{Duration: 2200 * time.Millisecond, Steps: steps}}
+		close(samples)
+		<-done
+
+		body, _ := scrape()
+		Ω(body).Should(ContainSubstring(`pat_iteration_duration_seconds_bucket{experiment="abc-123",workload="cf:push",le="1"} 0`))
+		Ω(body).Should(ContainSubstring(`pat_iteration_duration_seconds_bucket{experiment="abc-123",workload="cf:push",le="2.5"} 1`))
+		Ω(body).Should(ContainSubstring(`pat_iteration_duration_seconds_count{experiment="abc-123",workload="cf:push"} 1`))
+		Ω(body).Should(ContainSubstring(`pat_step_duration_seconds_bucket{experiment="abc-123",workload="cf:push",command="login",le="0.25"} 1`))
+		Ω(body).Should(ContainSubstring(`pat_step_duration_seconds_sum{experiment="abc-123",workload="cf:push",command="push"} 2`))
+	})
+
+	It("counts errors by the failing command and the class of error", func() {
+		steps := []benchmarker.StepResult{{"login", time.Second}, {"push", time.Second}}
+		samples <- &Sample{Event: &Event{Steps: steps, Error: "timed out after 30 seconds waiting for a slave to run push"}}
+		samples <- &Sample{Event: &Event{Steps: steps, Error: "timed out after 30 seconds waiting for a slave to run push"}}
+		samples <- &Sample{Event: &Event{Steps: steps, Error: "500 Internal Server Error"}}
+		close(samples)
+		<-done
+
+		body, _ := scrape()
+		Ω(body).Should(ContainSubstring(`pat_errors_total{experiment="abc-123",workload="cf:push",command="push",class="timeout"} 2`))
+		Ω(body).Should(ContainSubstring(`pat_errors_total{experiment="abc-123",workload="cf:push",command="push",class="http_5xx"} 1`))
+	})
+
+	It("tracks the active workers and resets them when the experiment ends", func() {
+		samples <- &Sample{TotalWorkers: 3}
+		Eventually(func() string { body, _ := scrape(); return body }).Should(
+			ContainSubstring(`pat_workers{experiment="abc-123",workload="cf:push"} 3`))
+
+		close(samples)
+		<-done
+		body, _ := scrape()
+		Ω(body).Should(ContainSubstring(`pat_workers{experiment="abc-123",workload="cf:push"} 0`))
+	})
+
+	Context("When the experiment has ended for a while", func() {
+		var expiry time.Duration
+
+		BeforeEach(func() {
+			expiry = metrics.Expiry
+			metrics.Expiry = 100 * time.Millisecond
+		})
+
+		AfterEach(func() {
+			metrics.Expiry = expiry
+		})
+
+		It("drops its series", func() {
+			steps := []benchmarker.StepResult{{"push", time.Second}}
+			samples <- &Sample{TotalWorkers: 1, Event: &Event{Duration: time.Second, Steps: steps, Error: "500 Internal Server Error"}}
+			close(samples)
+			<-done
+
+			body, _ := scrape()
+			Ω(body).Should(ContainSubstring(`experiment="abc-123"`))
+			Eventually(func() string { body, _ = scrape(); return body }).ShouldNot(ContainSubstring(`experiment="abc-123"`))
+			Ω(body).Should(ContainSubstring("# TYPE pat_workers gauge\n"))
+		})
+	})
+
+	It("reports the deepest redis queue seen by the slaves", func() {
+		samples <- &Sample{Slaves: map[string]benchmarker.SlaveStatus{"a": {Pending: 4}, "b": {Pending: 7}}}
+		close(samples)
+		<-done
+
+		body, _ := scrape()
+		Ω(body).Should(ContainSubstring(`pat_redis_queue_depth{experiment="abc-123",workload="cf:push"} 7`))
+	})
+
+	Describe("ErrorClass", func() {
+		It("classifies errors", func() {
+			Ω(metrics.ErrorClass("timed out after 5 seconds")).Should(Equal("timeout"))
+			Ω(metrics.ErrorClass("push was lost by 3 slaves, giving up")).Should(Equal("lost"))
+			Ω(metrics.ErrorClass("dial tcp: connection refused")).Should(Equal("connection"))
+			Ω(metrics.ErrorClass("404 Not Found")).Should(Equal("http_4xx"))
+			Ω(metrics.ErrorClass("502 Bad Gateway")).Should(Equal("http_5xx"))
+			Ω(metrics.ErrorClass("App Failed to Stage")).Should(Equal("other"))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/pat/config"
 )
@@ -11,12 +12,14 @@ var params = struct {
 	redisPort     int
 	redisPassword string
 	vcapServices  string
+	namespace     string
 }{}
 
 func DescribeParameters(config config.Config) {
 	config.StringVar(&params.redisHost, "redis-host", "localhost", "Redis hostname")
 	config.IntVar(&params.redisPort, "redis-port", 6379, "Redis port")
 	config.StringVar(&params.redisPassword, "redis-password", "", "Redis password")
+	config.StringVar(&params.namespace, "redis-namespace", "", "Prefix for every redis key, so that several deployments can share one redis")
 	config.EnvVar(&params.vcapServices, "VCAP_SERVICES", "", "The VCAP_SERVICES environment variable")
 }
 
@@ -57,3 +60,34 @@ func parseVcapServices() {
 var ConnFactory = func(host string, port int, password string) (Conn, error) {
 	return Connect(host, port, password)
 }
+
+// Namespace prefixes keys so that experiments from different deployments
+// sharing a redis do not see each other's tasks, replies and results.
+type Namespace string
+
+func CurrentNamespace() Namespace {
+	return Namespace(params.namespace)
+}
+
+func (ns Namespace) Key(name string) string {
+	if ns == "" {
+		return name
+	}
+	return string(ns) + ":" + name
+}
+
+// ParseNamespaces splits a comma-separated list, an empty list means the
+// current namespace.
+func ParseNamespaces(list string) []Namespace {
+	namespaces := make([]Namespace, 0)
+	for _, ns := range strings.Split(list, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, Namespace(ns))
+		}
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = append(namespaces, CurrentNamespace())
+	}
+	return namespaces
+}
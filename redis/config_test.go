@@ -150,6 +150,25 @@ var _ = Describe("Config", func() {
 			})
 		})
 	})
+
+	Describe("Namespaces", func() {
+		BeforeEach(func() {
+			args = []string{"-redis-namespace", "team-a"}
+		})
+
+		It("prefixes keys with the namespace", func() {
+			Ω(CurrentNamespace().Key("tasks")).Should(Equal("team-a:tasks"))
+			Ω(Namespace("").Key("tasks")).Should(Equal("tasks"))
+		})
+
+		It("parses a comma separated list of namespaces", func() {
+			Ω(ParseNamespaces("a, b,,c")).Should(Equal([]Namespace{"a", "b", "c"}))
+		})
+
+		It("defaults to the current namespace", func() {
+			Ω(ParseNamespaces("")).Should(Equal([]Namespace{"team-a"}))
+		})
+	})
 })
 
 type dummyConn struct{}
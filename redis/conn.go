@@ -78,3 +78,22 @@ func Strings(reply interface{}, err error) ([]string, error) {
 func Bytes(reply interface{}, err error) ([]byte, error) {
 	return redis.Bytes(reply, err)
 }
+
+var ErrNil = redis.ErrNil
+
+func Int(reply interface{}, err error) (int, error) {
+	return redis.Int(reply, err)
+}
+
+func StringMap(reply interface{}, err error) (map[string]string, error) {
+	values, err := redis.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for i := 0; i+1 < len(values); i += 2 {
+		result[values[i]] = values[i+1]
+	}
+	return result, nil
+}
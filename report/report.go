@@ -0,0 +1,344 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// Report summarises a finished experiment for CI systems.
+type Report struct {
+	Guid        string
+	Workload    string
+	Final       *experiment.Sample
+	Percentiles Percentiles
+	Errors      int
+	Commands    map[string]CommandReport
+	Thresholds  []Result
+	Passed      bool
+}
+
+type CommandReport struct {
+	experiment.Command
+	Errors      int
+	Percentiles Percentiles
+}
+
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// Threshold is a limit on a metric of the whole run, or of one command when
+// Command is set. Metrics are average, p50, p90, p95, p99, worst and errors.
+type Threshold struct {
+	Command string
+	Metric  string
+	Limit   float64
+}
+
+// Result is how a threshold fared. A threshold on a command that never ran
+// is Missing, and fails.
+type Result struct {
+	Threshold
+	Actual  float64
+	Passed  bool
+	Missing bool `json:",omitempty"`
+}
+
+var metrics = []string{"average", "p50", "p90", "p95", "p99", "worst", "errors"}
+
+// ParseThresholds reads a comma separated list of metric=limit or
+// command.metric=limit, e.g. "errors=0,p95=30s,cf:push.average=10s".
+// Latency limits are durations, error limits are counts.
+func ParseThresholds(list string) ([]Threshold, error) {
+	thresholds := make([]Threshold, 0)
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("threshold %s must be of the form [command.]metric=limit", spec)
+		}
+
+		t := Threshold{Metric: parts[0]}
+		if i := strings.LastIndex(parts[0], "."); i >= 0 {
+			t.Command, t.Metric = parts[0][:i], parts[0][i+1:]
+		}
+
+		if !known(t.Metric) {
+			return nil, fmt.Errorf("threshold %s has an unknown metric, expected one of %s", spec, strings.Join(metrics, ", "))
+		}
+
+		if t.Metric == "errors" {
+			limit, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("threshold %s must limit errors to a number", spec)
+			}
+			t.Limit = float64(limit)
+		} else {
+			limit, err := time.ParseDuration(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("threshold %s must limit %s to a duration, e.g. 30s", spec, t.Metric)
+			}
+			t.Limit = limit.Seconds()
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+func known(metric string) bool {
+	for _, m := range metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Collector records every sample of an experiment so that percentiles can be
+// worked out from the raw iterations.
+type Collector struct {
+	final      *experiment.Sample
+	iterations []time.Duration
+	steps      map[string][]time.Duration
+	errors     map[string]int
+}
+
+func NewCollector() *Collector {
+	return &Collector{steps: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (c *Collector) Observe(s *experiment.Sample) {
+	c.final = s
+	if s.Event == nil {
+		return
+	}
+
+	c.iterations = append(c.iterations, s.Event.Duration)
+	for _, step := range s.Event.Steps {
+		c.steps[step.Command] = append(c.steps[step.Command], step.Duration)
+	}
+	if s.Event.Error != "" && len(s.Event.Steps) > 0 {
+		c.errors[s.Event.Steps[len(s.Event.Steps)-1].Command]++
+	}
+}
+
+func (c *Collector) Report(guid string, workload string, thresholds []Threshold) *Report {
+	r := &Report{Guid: guid, Workload: workload, Final: c.final, Commands: make(map[string]CommandReport), Passed: true}
+	r.Percentiles = percentiles(c.iterations)
+	if c.final != nil {
+		r.Errors = int(c.final.TotalErrors)
+		for name, command := range c.final.Commands {
+			r.Commands[name] = CommandReport{command, c.errors[name], percentiles(c.steps[name])}
+		}
+	}
+
+	for _, t := range thresholds {
+		actual, ran := r.measure(t.Command, t.Metric)
+		result := Result{Threshold: t, Actual: actual, Missing: !ran}
+		result.Passed = ran && result.Actual <= t.Limit
+		r.Passed = r.Passed && result.Passed
+		r.Thresholds = append(r.Thresholds, result)
+	}
+	return r
+}
+
+// measure reads a metric of the whole run or of one command, ran is false
+// when the command is not in the final sample.
+func (r *Report) measure(command string, metric string) (actual float64, ran bool) {
+	p, errors, average, worst := r.Percentiles, r.Errors, time.Duration(0), time.Duration(0)
+	if r.Final != nil {
+		average, worst = r.Final.Average, r.Final.WorstResult
+	}
+	if command != "" {
+		c, found := r.Commands[command]
+		if !found {
+			return 0, false
+		}
+		p, errors, average, worst = c.Percentiles, c.Errors, c.Average, c.WorstTime
+	}
+
+	switch metric {
+	case "errors":
+		return float64(errors), true
+	case "average":
+		return average.Seconds(), true
+	case "p50":
+		return p.P50.Seconds(), true
+	case "p90":
+		return p.P90.Seconds(), true
+	case "p95":
+		return p.P95.Seconds(), true
+	case "p99":
+		return p.P99.Seconds(), true
+	}
+	return worst.Seconds(), true
+}
+
+func percentiles(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := append([]time.Duration{}, durations...)
+	sort.Sort(byDuration(sorted))
+	at := func(p float64) time.Duration {
+		return sorted[int(math.Ceil(float64(len(sorted))*p))-1]
+	}
+	return Percentiles{at(.5), at(.9), at(.95), at(.99)}
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoded, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(encoded, '\n'))
+	return err
+}
+
+type testsuite struct {
+	XMLName  xml.Name   `xml:"testsuite"`
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Time     float64    `xml:"time,attr"`
+	Cases    []testcase `xml:"testcase"`
+}
+
+type testcase struct {
+	Classname string    `xml:"classname,attr"`
+	Name      string    `xml:"name,attr"`
+	Time      float64   `xml:"time,attr"`
+	Failures  []failure `xml:"failure"`
+}
+
+type failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// WriteJUnit writes one testcase per command, and one for the iterations as
+// a whole. A testcase fails for every threshold it breaches, and for errors
+// when no errors threshold was given for it.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := testsuite{Name: "pat." + r.Guid}
+	if r.Final != nil {
+		suite.Time = r.Final.WallTime.Seconds()
+	}
+
+	names := make([]string, 0, len(r.Commands))
+	for name := range r.Commands {
+		names = append(names, name)
+	}
+	// commands that never ran still get a testcase for their thresholds
+	for _, result := range r.Thresholds {
+		if result.Missing && !contains(names, result.Command) {
+			names = append(names, result.Command)
+		}
+	}
+	sort.Strings(names)
+
+	iterations := r.Final != nil && r.Final.Total > 0
+	if iterations {
+		suite.Cases = append(suite.Cases, r.testcase("", r.Errors, r.Final.Average))
+	}
+	for _, name := range names {
+		suite.Cases = append(suite.Cases, r.testcase(name, r.Commands[name].Errors, r.Commands[name].Average))
+	}
+
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if len(c.Failures) > 0 {
+			suite.Failures++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (r *Report) testcase(command string, errors int, average time.Duration) testcase {
+	c := testcase{Classname: "pat." + r.Workload, Name: command, Time: average.Seconds()}
+	if command == "" {
+		c.Name = "iterations"
+	}
+
+	limitsErrors := false
+	for _, result := range r.Thresholds {
+		if result.Command != command {
+			continue
+		}
+		limitsErrors = limitsErrors || result.Metric == "errors"
+		if !result.Passed {
+			c.Failures = append(c.Failures, failure{Type: "threshold", Message: result.String()})
+		}
+	}
+
+	if errors > 0 && !limitsErrors {
+		message := fmt.Sprintf("%d errors", errors)
+		if command == "" && r.Final != nil && r.Final.LastError != "" {
+			message = message + ", last: " + r.Final.LastError
+		}
+		c.Failures = append(c.Failures, failure{Type: "error", Message: message})
+	}
+	return c
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Result) String() string {
+	name := r.Metric
+	if r.Command != "" {
+		name = r.Command + "." + r.Metric
+	}
+
+	if r.Missing {
+		return fmt.Sprintf("%s has no value, %s never ran", name, r.Command)
+	}
+
+	if r.Metric == "errors" {
+		return fmt.Sprintf("%s was %v, limit %v", name, r.Actual, r.Limit)
+	}
+	return fmt.Sprintf("%s was %v, limit %v", name, seconds(r.Actual), seconds(r.Limit))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
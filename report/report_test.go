@@ -0,0 +1,167 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/report"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var (
+		collector  *Collector
+		thresholds []Threshold
+		report     *Report
+	)
+
+	iteration := func(push time.Duration, err string) *experiment.Sample {
+		steps := []benchmarker.StepResult{{"login", time.Second}, {"push", push}}
+		return &experiment.Sample{Event: &experiment.Event{Duration: push + time.Second, Steps: steps, Error: err}}
+	}
+
+	BeforeEach(func() {
+		collector = NewCollector()
+		thresholds = nil
+		for i := 1; i <= 10; i++ {
+			collector.Observe(iteration(time.Duration(i)*time.Second, ""))
+		}
+		collector.Observe(&experiment.Sample{
+			Total:       10,
+			TotalErrors: 0,
+			Average:     6500 * time.Millisecond,
+			WorstResult: 11 * time.Second,
+			WallTime:    20 * time.Second,
+			Commands: map[string]experiment.Command{
+				"login": {Count: 10, Average: time.Second, WorstTime: time.Second},
+				"push":  {Count: 10, Average: 5500 * time.Millisecond, WorstTime: 10 * time.Second},
+			},
+		})
+	})
+
+	JustBeforeEach(func() {
+		report = collector.Report("abc", "login,push", thresholds)
+	})
+
+	It("works out percentiles of the iterations and of each command", func() {
+		Ω(report.Percentiles.P50).Should(Equal(6 * time.Second))
+		Ω(report.Percentiles.P90).Should(Equal(10 * time.Second))
+		Ω(report.Percentiles.P99).Should(Equal(11 * time.Second))
+		Ω(report.Commands["push"].Percentiles.P95).Should(Equal(10 * time.Second))
+		Ω(report.Commands["login"].Percentiles.P50).Should(Equal(time.Second))
+		Ω(report.Commands["push"].Count).Should(BeEquivalentTo(10))
+	})
+
+	It("passes when there are no thresholds", func() {
+		Ω(report.Passed).Should(BeTrue())
+	})
+
+	Context("When thresholds are breached", func() {
+		BeforeEach(func() {
+			var err error
+			thresholds, err = ParseThresholds("p95=30s,push.average=5s,login.worst=2s")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("records which thresholds passed", func() {
+			Ω(report.Passed).Should(BeFalse())
+			Ω(report.Thresholds).Should(HaveLen(3))
+			Ω(report.Thresholds[0].Passed).Should(BeTrue())
+			Ω(report.Thresholds[1].Passed).Should(BeFalse())
+			Ω(report.Thresholds[1].Actual).Should(Equal(5.5))
+			Ω(report.Thresholds[2].Passed).Should(BeTrue())
+		})
+
+		It("fails the testcase of the command in JUnit", func() {
+			var out bytes.Buffer
+			Ω(report.WriteJUnit(&out)).Should(Succeed())
+			Ω(out.String()).Should(ContainSubstring(`<testsuite name="pat.abc" tests="3" failures="1" time="20">`))
+			Ω(out.String()).Should(ContainSubstring(`<testcase classname="pat.login,push" name="push" time="5.5">`))
+			Ω(out.String()).Should(ContainSubstring(`<failure message="push.average was 5.5s, limit 5s" type="threshold"></failure>`))
+		})
+	})
+
+	Context("When a threshold is on a command that never ran", func() {
+		BeforeEach(func() {
+			thresholds, _ = ParseThresholds("psh.p95=10s")
+		})
+
+		It("fails the threshold", func() {
+			Ω(report.Passed).Should(BeFalse())
+			Ω(report.Thresholds[0].Missing).Should(BeTrue())
+			Ω(report.Thresholds[0].String()).Should(Equal("psh.p95 has no value, psh never ran"))
+		})
+
+		It("fails a testcase for the command in JUnit", func() {
+			var out bytes.Buffer
+			Ω(report.WriteJUnit(&out)).Should(Succeed())
+			Ω(out.String()).Should(ContainSubstring(`<testcase classname="pat.login,push" name="psh" time="0">`))
+			Ω(out.String()).Should(ContainSubstring(`<failure message="psh.p95 has no value, psh never ran" type="threshold"></failure>`))
+		})
+	})
+
+	Context("When iterations failed", func() {
+		BeforeEach(func() {
+			collector.Observe(iteration(time.Second, "boom"))
+			collector.Observe(&experiment.Sample{Total: 11, TotalErrors: 1, LastError: "boom", Commands: map[string]experiment.Command{"push": {Count: 11}}})
+		})
+
+		It("counts the errors against the command that failed", func() {
+			Ω(report.Errors).Should(Equal(1))
+			Ω(report.Commands["push"].Errors).Should(Equal(1))
+		})
+
+		It("fails the testcases in JUnit", func() {
+			var out bytes.Buffer
+			Ω(report.WriteJUnit(&out)).Should(Succeed())
+			Ω(out.String()).Should(ContainSubstring(`<failure message="1 errors, last: boom" type="error"></failure>`))
+			Ω(out.String()).Should(ContainSubstring(`<failure message="1 errors" type="error"></failure>`))
+		})
+
+		Context("and errors are allowed by a threshold", func() {
+			BeforeEach(func() {
+				thresholds, _ = ParseThresholds("errors=1,push.errors=1")
+			})
+
+			It("does not fail the testcases", func() {
+				var out bytes.Buffer
+				report.WriteJUnit(&out)
+				Ω(out.String()).ShouldNot(ContainSubstring("<failure"))
+				Ω(report.Passed).Should(BeTrue())
+			})
+		})
+	})
+
+	It("writes JSON", func() {
+		var out bytes.Buffer
+		Ω(report.WriteJSON(&out)).Should(Succeed())
+
+		var decoded map[string]interface{}
+		Ω(json.Unmarshal(out.Bytes(), &decoded)).Should(Succeed())
+		Ω(decoded["Guid"]).Should(Equal("abc"))
+		Ω(decoded["Final"]).Should(HaveKey("Total"))
+		Ω(decoded["Commands"]).Should(HaveKey("push"))
+		Ω(decoded["Percentiles"]).Should(HaveKey("P95"))
+	})
+
+	Describe("ParseThresholds", func() {
+		It("reads metrics of the run and of commands", func() {
+			thresholds, err := ParseThresholds("errors=0, cf:push.p99=1m")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(thresholds).Should(Equal([]Threshold{{"", "errors", 0}, {"cf:push", "p99", 60}}))
+		})
+
+		It("rejects unknown metrics and bad limits", func() {
+			_, err := ParseThresholds("median=1s")
+			Ω(err).Should(HaveOccurred())
+			_, err = ParseThresholds("p95=fast")
+			Ω(err).Should(HaveOccurred())
+			_, err = ParseThresholds("errors=none")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a cron expression with the five usual fields: minute, hour, day of
+// the month, month and day of the week (0 or 7 is Sunday). Fields are a *, a
+// number, a range such as 1-5, a step such as */15 or 1-30/2, or a list of
+// those separated by commas. As in cron, when both days are restricted a day
+// matching either of them matches.
+type Cron struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	anyDay     bool
+}
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@nightly":  "0 2 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSteps bounds the search for the next time an expression matches, it is
+// enough to skip several years.
+const maxSteps = 20000
+
+func ParseCron(expression string) (*Cron, error) {
+	if shortcut, ok := shortcuts[strings.TrimSpace(expression)]; ok {
+		expression = shortcut
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.New("must have 5 fields: minute, hour, day of month, month and day of week")
+	}
+
+	c := &Cron{}
+	var err error
+	for _, f := range []struct {
+		name     string
+		value    string
+		min, max int
+		target   *uint64
+	}{
+		{"minute", fields[0], 0, 59, &c.minute},
+		{"hour", fields[1], 0, 23, &c.hour},
+		{"day of month", fields[2], 1, 31, &c.dayOfMonth},
+		{"month", fields[3], 1, 12, &c.month},
+		{"day of week", fields[4], 0, 7, &c.dayOfWeek},
+	} {
+		if *f.target, err = parseField(f.value, f.min, f.max); err != nil {
+			return nil, fmt.Errorf("%s %s", f.name, err.Error())
+		}
+	}
+
+	if c.dayOfWeek&(1<<7) != 0 {
+		c.dayOfWeek |= 1
+	}
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, errors.New("never matches")
+	}
+	return c, nil
+}
+
+func parseField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("has a step that is not a positive number: %q", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("is not a number, range or *: %q", part)
+			}
+			from = n
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("is not a number, range or *: %q", part)
+				}
+			} else if step == 1 {
+				to = from
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("must be between %d and %d: %q", min, max, part)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next is the first minute after the given time that matches, or the zero
+// time if none does within a few years.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, after.Location()).Add(time.Minute)
+	for i := 0; i < maxSteps; i++ {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	dayOfMonth, dayOfWeek := has(c.dayOfMonth, t.Day()), has(c.dayOfWeek, int(t.Weekday()))
+	if c.anyDay {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
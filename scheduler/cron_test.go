@@ -0,0 +1,50 @@
+package scheduler_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/scheduler"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+	// a Wednesday
+	start := time.Date(2014, time.January, 1, 10, 30, 15, 0, time.UTC)
+
+	next := func(expression string, after time.Time) time.Time {
+		cron, err := ParseCron(expression)
+		Ω(err).ShouldNot(HaveOccurred())
+		return cron.Next(after)
+	}
+
+	It("finds the next minute that matches", func() {
+		Ω(next("* * * * *", start)).Should(Equal(time.Date(2014, time.January, 1, 10, 31, 0, 0, time.UTC)))
+		Ω(next("0 2 * * *", start)).Should(Equal(time.Date(2014, time.January, 2, 2, 0, 0, 0, time.UTC)))
+		Ω(next("45 10 * * *", start)).Should(Equal(time.Date(2014, time.January, 1, 10, 45, 0, 0, time.UTC)))
+		Ω(next("0 0 1 3 *", start)).Should(Equal(time.Date(2014, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("reads ranges, steps and lists", func() {
+		Ω(next("*/20 * * * *", start)).Should(Equal(time.Date(2014, time.January, 1, 10, 40, 0, 0, time.UTC)))
+		Ω(next("0 9-17/4 * * *", start)).Should(Equal(time.Date(2014, time.January, 1, 13, 0, 0, 0, time.UTC)))
+		Ω(next("15,35 * * * *", start)).Should(Equal(time.Date(2014, time.January, 1, 10, 35, 0, 0, time.UTC)))
+	})
+
+	It("matches either day when both are restricted", func() {
+		Ω(next("0 0 * * 1-5", time.Date(2014, time.January, 3, 12, 0, 0, 0, time.UTC))).Should(Equal(time.Date(2014, time.January, 6, 0, 0, 0, 0, time.UTC)))
+		Ω(next("0 0 15 * 7", start)).Should(Equal(time.Date(2014, time.January, 5, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("knows the usual shortcuts", func() {
+		Ω(next("@nightly", start)).Should(Equal(time.Date(2014, time.January, 2, 2, 0, 0, 0, time.UTC)))
+		Ω(next("@weekly", start)).Should(Equal(time.Date(2014, time.January, 5, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("does not accept expressions that are not valid or never match", func() {
+		for _, expression := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "0 0 30 2 *"} {
+			_, err := ParseCron(expression)
+			Ω(err).Should(HaveOccurred(), expression)
+		}
+	})
+})
@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/api"
+	"github.com/cloudfoundry-incubator/pat/logs"
+	"github.com/nu7hatch/gouuid"
+)
+
+// A Schedule starts an experiment every time its Cron expression matches.
+type Schedule struct {
+	Id        string
+	Name      string `json:",omitempty"`
+	Cron      string
+	Spec      api.Spec
+	CreatedBy string `json:",omitempty"`
+	Next      time.Time
+	LastRun   *Run `json:",omitempty"`
+}
+
+// Run is the last time a schedule started an experiment, with the guid of
+// the experiment or the reason it could not start.
+type Run struct {
+	Time  time.Time
+	Guid  string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+var ErrNotFound = errors.New("schedule does not exist")
+
+// TickInterval is how often the scheduler looks for schedules that are due.
+var TickInterval = 10 * time.Second
+
+// Scheduler keeps schedules in a JSON file and starts their experiments when
+// they are due. Runs that were missed while the scheduler was stopped are
+// skipped.
+type Scheduler struct {
+	path      string
+	start     func(schedule Schedule) (string, error)
+	lock      sync.Mutex
+	schedules []*Schedule
+	crons     map[string]*Cron
+	quit      chan bool
+}
+
+// New loads the schedules saved at path, if there are any. Start is called
+// with each schedule that is due and returns the guid of the experiment it
+// started.
+func New(path string, start func(schedule Schedule) (string, error)) (*Scheduler, error) {
+	s := &Scheduler{path: path, start: start, schedules: make([]*Schedule, 0), crons: make(map[string]*Cron)}
+
+	encoded, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(encoded, &s.schedules); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, schedule := range s.schedules {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, errors.New("schedule " + schedule.Id + " has a cron expression that " + err.Error())
+		}
+		s.crons[schedule.Id] = cron
+		schedule.Next = cron.Next(now)
+	}
+	return s, nil
+}
+
+func (s *Scheduler) List() []Schedule {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	schedules := make([]Schedule, len(s.schedules))
+	for i, schedule := range s.schedules {
+		schedules[i] = *schedule
+	}
+	return schedules
+}
+
+func (s *Scheduler) Get(id string) (Schedule, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if i := s.find(id); i >= 0 {
+		return *s.schedules[i], nil
+	}
+	return Schedule{}, ErrNotFound
+}
+
+// Add saves a new schedule. The cron expression is checked, the spec should
+// already have been validated.
+func (s *Scheduler) Add(schedule Schedule) (Schedule, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.put(id.String(), schedule)
+}
+
+// Update replaces a schedule, keeping its id and last run.
+func (s *Scheduler) Update(id string, schedule Schedule) (Schedule, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return Schedule{}, ErrNotFound
+	}
+	schedule.LastRun = s.schedules[i].LastRun
+	return s.put(id, schedule)
+}
+
+func (s *Scheduler) Remove(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	s.schedules = append(s.schedules[:i], s.schedules[i+1:]...)
+	delete(s.crons, id)
+	return s.save()
+}
+
+// put validates a schedule and saves it under the given id, the lock must
+// be held.
+func (s *Scheduler) put(id string, schedule Schedule) (Schedule, error) {
+	invalid := &api.ValidationError{}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		invalid.Errors = append(invalid.Errors, api.FieldError{Field: "Cron", Message: err.Error()})
+	}
+	if schedule.Spec.RestPassword != "" {
+		invalid.Errors = append(invalid.Errors, api.FieldError{Field: "rest:password", Message: "is not saved with schedules, give it with -credentials or PAT_REST_PASSWORD instead"})
+	}
+	if len(invalid.Errors) > 0 {
+		return Schedule{}, invalid
+	}
+
+	schedule.Id = id
+	schedule.Next = cron.Next(time.Now())
+	s.crons[id] = cron
+	if i := s.find(id); i >= 0 {
+		s.schedules[i] = &schedule
+	} else {
+		s.schedules = append(s.schedules, &schedule)
+	}
+	return schedule, s.save()
+}
+
+func (s *Scheduler) find(id string) int {
+	for i, schedule := range s.schedules {
+		if schedule.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the schedules to a new file that replaces the old one, so a
+// crash never leaves half a file behind.
+func (s *Scheduler) save() error {
+	encoded, err := json.MarshalIndent(s.schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(s.path+".new", encoded, 0600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".new", s.path)
+}
+
+// RunDue starts the experiments of every schedule that was due at the given
+// time, and works out when each of them is due next.
+func (s *Scheduler) RunDue(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ran := false
+	for _, schedule := range s.schedules {
+		if schedule.Next.IsZero() || schedule.Next.After(now) {
+			continue
+		}
+
+		run := &Run{Time: now}
+		if guid, err := s.start(*schedule); err != nil {
+			logs.NewLogger("scheduler").Errorf("Can't start the experiment of schedule %s: %v", schedule.Id, err)
+			run.Error = err.Error()
+		} else {
+			run.Guid = guid
+		}
+
+		schedule.LastRun = run
+		schedule.Next = s.crons[schedule.Id].Next(now)
+		ran = true
+	}
+
+	if ran {
+		if err := s.save(); err != nil {
+			logs.NewLogger("scheduler").Errorf("Can't save schedules: %v", err)
+		}
+	}
+}
+
+// Start runs due schedules every TickInterval until Stop is called.
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	s.quit = make(chan bool)
+	quit := s.quit
+	s.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(TickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.RunDue(now)
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.quit != nil {
+		close(s.quit)
+		s.quit = nil
+	}
+}
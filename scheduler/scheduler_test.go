@@ -0,0 +1,131 @@
+package scheduler_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/api"
+	. "github.com/cloudfoundry-incubator/pat/scheduler"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		dir       string
+		file      string
+		scheduler *Scheduler
+		started   []Schedule
+		fail      error
+	)
+
+	start := func(schedule Schedule) (string, error) {
+		started = append(started, schedule)
+		return "guid-" + schedule.Name, fail
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "scheduler")
+		Ω(err).ShouldNot(HaveOccurred())
+		file = path.Join(dir, "schedules", "schedules.json")
+
+		started, fail = nil, nil
+		scheduler, err = New(file, start)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	nightly := func() Schedule {
+		spec := api.DefaultSpec()
+		spec.Concurrency = "10"
+		return Schedule{Name: "nightly", Cron: "0 2 * * *", Spec: spec, CreatedBy: "someone"}
+	}
+
+	It("adds schedules with an id and the next time they are due", func() {
+		added, err := scheduler.Add(nightly())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(added.Id).ShouldNot(BeEmpty())
+		Ω(added.Next.Hour()).Should(Equal(2))
+		Ω(added.Next).Should(BeTemporally(">", time.Now()))
+
+		Ω(scheduler.List()).Should(Equal([]Schedule{added}))
+		Ω(scheduler.Get(added.Id)).Should(Equal(added))
+	})
+
+	It("keeps schedules across restarts", func() {
+		added, _ := scheduler.Add(nightly())
+
+		reloaded, err := New(file, start)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reloaded.List()).Should(HaveLen(1))
+		Ω(reloaded.List()[0].Id).Should(Equal(added.Id))
+		Ω(reloaded.List()[0].Spec.Concurrency).Should(Equal("10"))
+	})
+
+	It("updates and removes schedules", func() {
+		added, _ := scheduler.Add(nightly())
+
+		changed := nightly()
+		changed.Cron = "30 * * * *"
+		updated, err := scheduler.Update(added.Id, changed)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(updated.Id).Should(Equal(added.Id))
+		Ω(updated.Next.Minute()).Should(Equal(30))
+
+		Ω(scheduler.Remove(added.Id)).Should(Succeed())
+		Ω(scheduler.List()).Should(BeEmpty())
+		Ω(scheduler.Remove(added.Id)).Should(Equal(ErrNotFound))
+		_, err = scheduler.Update(added.Id, changed)
+		Ω(err).Should(Equal(ErrNotFound))
+	})
+
+	It("does not save schedules with a cron expression that is not valid, or a password", func() {
+		schedule := nightly()
+		schedule.Cron = "every night"
+		schedule.Spec.RestPassword = "secret"
+		_, err := scheduler.Add(schedule)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.(*api.ValidationError).Errors).Should(HaveLen(2))
+		Ω(scheduler.List()).Should(BeEmpty())
+	})
+
+	It("starts the experiments of the schedules that are due", func() {
+		added, _ := scheduler.Add(nightly())
+		hourly := nightly()
+		hourly.Name, hourly.Cron = "hourly", "@hourly"
+		scheduler.Add(hourly)
+
+		scheduler.RunDue(time.Now())
+		Ω(started).Should(BeEmpty())
+
+		scheduler.RunDue(added.Next)
+		Ω(started).Should(HaveLen(2))
+
+		scheduler.RunDue(added.Next)
+		Ω(started).Should(HaveLen(2))
+
+		ran, _ := scheduler.Get(added.Id)
+		Ω(ran.LastRun.Guid).Should(Equal("guid-nightly"))
+		Ω(ran.Next).Should(Equal(added.Next.Add(24 * time.Hour)))
+
+		reloaded, _ := New(file, start)
+		Ω(reloaded.List()[0].LastRun.Guid).Should(Equal("guid-nightly"))
+	})
+
+	It("records why an experiment could not start", func() {
+		added, _ := scheduler.Add(nightly())
+		fail = errors.New("no workers")
+		scheduler.RunDue(added.Next)
+
+		ran, _ := scheduler.Get(added.Id)
+		Ω(ran.LastRun.Error).Should(Equal("no workers"))
+		Ω(ran.Next).Should(BeTemporally(">", added.Next))
+	})
+})
@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/pat/config"
+	"github.com/cloudfoundry-incubator/pat/context"
+	goyaml "github.com/go-yaml/yaml"
+)
+
+var params = struct {
+	credentials string
+	key         string
+}{}
+
+// Keys are always treated as secrets, whether they come from a flag, a form,
+// the environment or a credentials file.
+var Keys = []string{"rest:password"}
+
+func DescribeParameters(config config.Config) {
+	config.StringVar(&params.credentials, "credentials", "", "YML file containing secret context values, i.e. rest:password")
+	config.EnvVar(&params.key, "PAT_SECRET_KEY", "", "Shared key used to encrypt secrets sent to redis slaves, secrets never leave the process without it")
+}
+
+// EnvName is the environment variable a secret can be read from, i.e.
+// PAT_REST_PASSWORD for rest:password.
+func EnvName(key string) string {
+	return "PAT_" + strings.ToUpper(strings.NewReplacer(":", "_", "-", "_", ".", "_").Replace(key))
+}
+
+// Populate stores secrets from the credentials file and the environment in
+// the context, without overwriting values that are already set.
+func Populate(ctx context.Context) error {
+	values := make(map[string]string)
+	if params.credentials != "" {
+		file, err := ioutil.ReadFile(params.credentials)
+		if err != nil {
+			return err
+		}
+
+		if err = goyaml.Unmarshal(file, &values); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range Keys {
+		if v := os.Getenv(EnvName(k)); v != "" {
+			values[k] = v
+		}
+	}
+
+	for k, v := range values {
+		if existing, err := ctx.GetString(k); err != nil || existing == "" {
+			ctx.PutSecret(k, v)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/cloudfoundry-incubator/pat/context"
+)
+
+// Seal encrypts the secrets in the context with the shared key so they can be
+// sent to a slave. Without a key nothing is sealed and the slave has to
+// populate the secrets itself.
+func Seal(ctx context.Context) (string, error) {
+	secrets := ctx.Secrets()
+	if params.key == "" || len(secrets) == 0 {
+		return "", nil
+	}
+
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Unseal decrypts secrets produced by Seal and stores them in the context.
+func Unseal(sealed string, ctx context.Context) error {
+	if sealed == "" {
+		return nil
+	}
+
+	if params.key == "" {
+		return errors.New("received encrypted secrets but PAT_SECRET_KEY is not set")
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newCipher()
+	if err != nil {
+		return err
+	}
+
+	if len(encrypted) < gcm.NonceSize() {
+		return errors.New("encrypted secrets are truncated")
+	}
+
+	plain, err := gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], nil)
+	if err != nil {
+		return errors.New("could not decrypt secrets, is PAT_SECRET_KEY the same everywhere?")
+	}
+
+	secrets := make(map[string]string)
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return err
+	}
+
+	for k, v := range secrets {
+		ctx.PutSecret(k, v)
+	}
+	return nil
+}
+
+func newCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(params.key))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
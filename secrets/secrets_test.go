@@ -0,0 +1,149 @@
+package secrets_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/pat/config"
+	"github.com/cloudfoundry-incubator/pat/context"
+	. "github.com/cloudfoundry-incubator/pat/secrets"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secrets", func() {
+	var (
+		ctx  context.Context
+		args []string
+	)
+
+	BeforeEach(func() {
+		ctx = context.New()
+		args = []string{}
+		os.Setenv("PAT_SECRET_KEY", "")
+		os.Setenv("PAT_REST_PASSWORD", "")
+	})
+
+	JustBeforeEach(func() {
+		flags := config.NewConfig()
+		DescribeParameters(flags)
+		flags.Parse(args)
+	})
+
+	AfterEach(func() {
+		os.Setenv("PAT_SECRET_KEY", "")
+		os.Setenv("PAT_REST_PASSWORD", "")
+	})
+
+	It("names environment variables after the key", func() {
+		Ω(EnvName("rest:password")).Should(Equal("PAT_REST_PASSWORD"))
+	})
+
+	Describe("Populating a context", func() {
+		Context("When the secret is in the environment", func() {
+			BeforeEach(func() {
+				os.Setenv("PAT_REST_PASSWORD", "from-env")
+			})
+
+			It("stores it as a secret", func() {
+				Ω(Populate(ctx)).Should(Succeed())
+				Ω(ctx.GetString("rest:password")).Should(Equal("from-env"))
+				Ω(ctx.IsSecret("rest:password")).Should(BeTrue())
+			})
+
+			It("does not overwrite a value which is already set", func() {
+				ctx.PutSecret("rest:password", "from-flag")
+				Ω(Populate(ctx)).Should(Succeed())
+				Ω(ctx.GetString("rest:password")).Should(Equal("from-flag"))
+			})
+
+			It("fills in a value which is empty", func() {
+				ctx.PutSecret("rest:password", "")
+				Ω(Populate(ctx)).Should(Succeed())
+				Ω(ctx.GetString("rest:password")).Should(Equal("from-env"))
+			})
+		})
+
+		Context("When a credentials file is given", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "secrets")
+				Ω(err).ShouldNot(HaveOccurred())
+				path := filepath.Join(dir, "credentials.yml")
+				ioutil.WriteFile(path, []byte("rest:password: from-file\nother:token: abc\n"), 0600)
+				args = []string{"-credentials", path}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("stores every value in the file as a secret", func() {
+				Ω(Populate(ctx)).Should(Succeed())
+				Ω(ctx.Secrets()).Should(Equal(map[string]string{"rest:password": "from-file", "other:token": "abc"}))
+			})
+
+			It("prefers the environment over the file", func() {
+				os.Setenv("PAT_REST_PASSWORD", "from-env")
+				Ω(Populate(ctx)).Should(Succeed())
+				Ω(ctx.GetString("rest:password")).Should(Equal("from-env"))
+			})
+		})
+
+		It("returns an error when the credentials file is missing", func() {
+			flags := config.NewConfig()
+			DescribeParameters(flags)
+			flags.Parse([]string{"-credentials", "/does/not/exist.yml"})
+			Ω(Populate(ctx)).ShouldNot(Succeed())
+		})
+	})
+
+	Describe("Sealing secrets", func() {
+		BeforeEach(func() {
+			ctx.PutString("rest:username", "bob")
+			ctx.PutSecret("rest:password", "hunter2")
+		})
+
+		Context("Without a shared key", func() {
+			It("does not send the secrets anywhere", func() {
+				Ω(Seal(ctx)).Should(BeEmpty())
+			})
+
+			It("refuses to open sealed secrets", func() {
+				Ω(Unseal("c2VhbGVk", context.New())).ShouldNot(Succeed())
+			})
+		})
+
+		Context("With a shared key", func() {
+			BeforeEach(func() {
+				os.Setenv("PAT_SECRET_KEY", "shared")
+			})
+
+			It("round trips the secrets without exposing them", func() {
+				sealed, err := Seal(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(sealed).ShouldNot(BeEmpty())
+				Ω(sealed).ShouldNot(ContainSubstring("hunter2"))
+
+				opened := context.New()
+				Ω(Unseal(sealed, opened)).Should(Succeed())
+				Ω(opened.Secrets()).Should(Equal(map[string]string{"rest:password": "hunter2"}))
+				Ω(opened.Has("rest:username")).Should(BeFalse())
+			})
+
+			It("fails when the keys differ", func() {
+				sealed, _ := Seal(ctx)
+
+				os.Setenv("PAT_SECRET_KEY", "different")
+				flags := config.NewConfig()
+				DescribeParameters(flags)
+				flags.Parse([]string{})
+
+				Ω(Unseal(sealed, context.New())).ShouldNot(Succeed())
+			})
+		})
+	})
+})
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/secrets"
+)
+
+// A Role says what a user may do: readers may look at experiments, operators
+// may also start and cancel them.
+type Role int
+
+const (
+	NoAccess Role = iota
+	Reader
+	Operator
+)
+
+type User struct {
+	Name string
+	Role Role
+}
+
+// An Authenticator finds the user who sent a request. It returns a nil user
+// when the request has no credentials it understands, or wrong ones.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*User, error)
+	Challenge() string
+}
+
+// AuthenticatorFactory returns the authenticator configured on the command
+// line, or nil when the server is open to everyone.
+var AuthenticatorFactory = func() (Authenticator, error) {
+	authenticators := make(authenticators, 0)
+
+	users := params.users
+	if users == "" {
+		users = os.Getenv(secrets.EnvName("server:users"))
+	}
+	if users != "" {
+		basic, err := NewBasicAuthenticator(users)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, basic)
+	}
+
+	if params.uaa != "" {
+		secret := params.uaaSecret
+		if secret == "" {
+			secret = os.Getenv(secrets.EnvName("server:uaa:secret"))
+		}
+		authenticators = append(authenticators, NewUaaAuthenticator(params.uaa, params.uaaClient, secret, params.uaaReadScope, params.uaaOperatorScope))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return authenticators, nil
+}
+
+type basicAuthenticator struct {
+	passwords map[string]string
+	roles     map[string]Role
+}
+
+// NewBasicAuthenticator checks basic auth credentials against a comma
+// separated list of name:password:role users, where role is read or operator
+// and defaults to read. The name ends at the first colon and the role follows
+// the last one, so a password may contain colons as long as the role is
+// given, but not commas.
+func NewBasicAuthenticator(users string) (Authenticator, error) {
+	basic := &basicAuthenticator{make(map[string]string), make(map[string]Role)}
+	for i, user := range strings.Split(users, ",") {
+		if user = strings.TrimSpace(user); user == "" {
+			continue
+		}
+
+		fields := strings.SplitN(user, ":", 2)
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("user %d (%q) should be name:password or name:password:role", i+1, fields[0])
+		}
+		name, password := fields[0], fields[1]
+
+		role := Reader
+		if last := strings.LastIndex(password, ":"); last >= 0 {
+			switch password[last+1:] {
+			case "read":
+			case "operator":
+				role = Operator
+			default:
+				return nil, fmt.Errorf("user %d (%q) has an unknown role %q, it should be read or operator", i+1, name, password[last+1:])
+			}
+			password = password[:last]
+		}
+
+		basic.passwords[name] = password
+		basic.roles[name] = role
+	}
+	return basic, nil
+}
+
+func (b *basicAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Basic ") {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return nil, nil
+	}
+
+	credentials := strings.SplitN(string(decoded), ":", 2)
+	if len(credentials) != 2 {
+		return nil, nil
+	}
+	name, password := credentials[0], credentials[1]
+
+	if expected, found := b.passwords[name]; !found || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		return nil, nil
+	}
+	return &User{name, b.roles[name]}, nil
+}
+
+func (b *basicAuthenticator) Challenge() string {
+	return `Basic realm="pat"`
+}
+
+type uaaAuthenticator struct {
+	checkTokenUrl string
+	client        string
+	secret        string
+	readScope     string
+	operatorScope string
+	lock          sync.Mutex
+	checked       map[string]checkedToken
+}
+
+type checkedToken struct {
+	user    *User
+	expires time.Time
+}
+
+// TokenCacheTime is the longest a token checked with the UAA is trusted
+// without checking it again.
+var TokenCacheTime = time.Minute
+
+// NewUaaAuthenticator checks bearer tokens with the check_token endpoint of a
+// UAA, as the given client. Tokens with the operator scope are operators, and
+// tokens with the read scope are readers.
+func NewUaaAuthenticator(uaa string, client string, secret string, readScope string, operatorScope string) Authenticator {
+	return &uaaAuthenticator{
+		checkTokenUrl: strings.TrimSuffix(uaa, "/") + "/check_token",
+		client:        client,
+		secret:        secret,
+		readScope:     readScope,
+		operatorScope: operatorScope,
+		checked:       make(map[string]checkedToken),
+	}
+}
+
+func (u *uaaAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, nil
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	u.lock.Lock()
+	checked, found := u.checked[token]
+	u.lock.Unlock()
+	if found && time.Now().Before(checked.expires) {
+		return checked.user, nil
+	}
+
+	user, expires, err := u.checkToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit := time.Now().Add(TokenCacheTime); expires.IsZero() || expires.After(limit) {
+		expires = limit
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for t, c := range u.checked {
+		if time.Now().After(c.expires) {
+			delete(u.checked, t)
+		}
+	}
+	u.checked[token] = checkedToken{user, expires}
+	return user, nil
+}
+
+func (u *uaaAuthenticator) checkToken(token string) (*User, time.Time, error) {
+	req, err := http.NewRequest("POST", u.checkTokenUrl, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(u.client, u.secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	// the UAA answers 400 for tokens that are not valid or have expired
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, time.Time{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("the UAA could not check the token: %s", resp.Status)
+	}
+
+	var checked struct {
+		UserName string   `json:"user_name"`
+		ClientId string   `json:"client_id"`
+		Scope    []string `json:"scope"`
+		Exp      int64    `json:"exp"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&checked); err != nil {
+		return nil, time.Time{}, errors.New("the UAA answered with a token that can't be read: " + err.Error())
+	}
+
+	user := &User{Name: checked.UserName, Role: NoAccess}
+	if user.Name == "" {
+		user.Name = checked.ClientId
+	}
+	for _, scope := range checked.Scope {
+		if scope == u.operatorScope {
+			user.Role = Operator
+		} else if scope == u.readScope && user.Role < Reader {
+			user.Role = Reader
+		}
+	}
+
+	var expires time.Time
+	if checked.Exp > 0 {
+		expires = time.Unix(checked.Exp, 0)
+	}
+	return user, expires, nil
+}
+
+func (u *uaaAuthenticator) Challenge() string {
+	return `Bearer realm="pat"`
+}
+
+// authenticators accepts the credentials of the first authenticator that
+// knows the user.
+type authenticators []Authenticator
+
+func (all authenticators) Authenticate(r *http.Request) (*User, error) {
+	for _, a := range all {
+		if user, err := a.Authenticate(r); user != nil || err != nil {
+			return user, err
+		}
+	}
+	return nil, nil
+}
+
+func (all authenticators) Challenge() string {
+	challenges := make([]string, len(all))
+	for i, a := range all {
+		challenges[i] = a.Challenge()
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// authenticate only lets users in, and only lets operators change anything.
+// Responses of the v1 API are Error documents.
+func (ctx *serverContext) authenticate(h http.Handler) http.Handler {
+	if ctx.auth == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := ctx.auth.Authenticate(r)
+		switch {
+		case err != nil:
+			refuse(w, r, newError(http.StatusBadGateway, "%s", err.Error()))
+		case user == nil:
+			w.Header().Set("WWW-Authenticate", ctx.auth.Challenge())
+			refuse(w, r, newError(http.StatusUnauthorized, "credentials are missing or not valid"))
+		case user.Role < Reader:
+			refuse(w, r, newError(http.StatusForbidden, "%s may not use this server", user.Name))
+		case user.Role < Operator && r.Method != "GET" && r.Method != "HEAD":
+			refuse(w, r, newError(http.StatusForbidden, "%s may only look at experiments", user.Name))
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+func refuse(w http.ResponseWriter, r *http.Request, e *Error) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(e)
+		return
+	}
+	http.Error(w, e.Message, e.Status)
+}
+
+// user is the name of whoever sent the request, or empty when the server is
+// open to everyone.
+func (ctx *serverContext) user(r *http.Request) string {
+	if ctx.auth == nil {
+		return ""
+	}
+
+	user, _ := ctx.auth.Authenticate(r)
+	if user == nil {
+		return ""
+	}
+	return user.Name
+}
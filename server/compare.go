@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// ComparisonPoints is how many steps a comparison is split into when the
+// request does not give the length of a step.
+const ComparisonPoints = 60
+
+// MaxComparisonStep is the longest step a request may give, in seconds.
+const MaxComparisonStep = 24 * 60 * 60
+
+// Comparison lines up several experiments on the time since each of them
+// started. Times are the ends of the steps, and the Points of each experiment
+// cover the steps until it finished.
+type Comparison struct {
+	Step        time.Duration
+	Times       []time.Duration
+	Experiments []*ComparedExperiment
+}
+
+// ComparedExperiment is an experiment in a comparison, Last is its last
+// result sample with the totals of each command.
+type ComparedExperiment struct {
+	*ExperimentDocument
+	Points []*ComparisonPoint
+	Last   *Sample `json:",omitempty"`
+}
+
+// ComparisonPoint holds the iterations of an experiment that ended in one
+// step of a comparison.
+type ComparisonPoint struct {
+	Count       int64
+	Errors      int
+	Average     time.Duration
+	WorstResult time.Duration
+	Throughput  float64
+}
+
+func (ctx *serverContext) handleCompareV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	names := r.URL.Query()["experiment"]
+	if len(names) < 2 {
+		return 0, nil, newError(http.StatusBadRequest, "give at least two experiments to compare")
+	}
+	seconds, err := queryInt(r, "step", 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if seconds > MaxComparisonStep {
+		return 0, nil, newError(http.StatusBadRequest, "step must be at most %d seconds", MaxComparisonStep)
+	}
+
+	results := make([][]*Sample, len(names))
+	comparison := &Comparison{Step: time.Duration(seconds) * time.Second, Times: []time.Duration{}, Experiments: []*ComparedExperiment{}}
+	for i, name := range names {
+		compared := &ComparedExperiment{ExperimentDocument: ctx.document(name, "Running")}
+		if e, err := ctx.find(name); err == nil {
+			compared.ExperimentDocument = ctx.describe(e)
+		} else if !ctx.lab.Running(name) {
+			return 0, nil, err
+		}
+
+		data, err := ctx.samples(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, s := range data {
+			if s.Type == ResultSample {
+				results[i] = append(results[i], s)
+			}
+		}
+		if n := len(results[i]); n > 0 {
+			compared.Last = results[i][n-1]
+		}
+		comparison.Experiments = append(comparison.Experiments, compared)
+	}
+
+	var end time.Duration
+	for _, samples := range results {
+		if n := len(samples); n > 0 && samples[n-1].WallTime > end {
+			end = samples[n-1].WallTime
+		}
+	}
+	if comparison.Step == 0 {
+		comparison.Step = defaultStep(end)
+	}
+
+	for t := comparison.Step; t-comparison.Step < end; t += comparison.Step {
+		comparison.Times = append(comparison.Times, t)
+	}
+	for i, compared := range comparison.Experiments {
+		compared.Points = align(results[i], comparison.Step)
+	}
+	return http.StatusOK, comparison, nil
+}
+
+// defaultStep splits the longest experiment into about ComparisonPoints
+// steps of whole seconds.
+func defaultStep(end time.Duration) time.Duration {
+	step := (end/ComparisonPoints + time.Second - 1) / time.Second * time.Second
+	if step < time.Second {
+		return time.Second
+	}
+	return step
+}
+
+// align puts the result samples of an experiment into steps by their wall
+// time. Each sample counts one iteration, it failed when the number of
+// errors went up.
+func align(results []*Sample, step time.Duration) []*ComparisonPoint {
+	points := make([]*ComparisonPoint, 0)
+	total := make([]time.Duration, 0)
+	errors := 0
+	for _, s := range results {
+		i := int(s.WallTime / step)
+		if s.WallTime > 0 && s.WallTime%step == 0 {
+			i--
+		}
+		for len(points) <= i {
+			points = append(points, &ComparisonPoint{})
+			total = append(total, 0)
+		}
+
+		p := points[i]
+		p.Count++
+		total[i] += s.LastResult
+		if s.LastResult > p.WorstResult {
+			p.WorstResult = s.LastResult
+		}
+		if s.TotalErrors > errors {
+			p.Errors += s.TotalErrors - errors
+			errors = s.TotalErrors
+		}
+	}
+
+	for i, p := range points {
+		if p.Count > 0 {
+			p.Average = total[i] / time.Duration(p.Count)
+		}
+		p.Throughput = float64(p.Count) / step.Seconds()
+	}
+	return points
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/laboratory"
+)
+
+// experimentFilter selects experiments by the query of a list request: name
+// matches part of the name, ignoring case, each tag is key=value or just a
+// key that must be there, workload is the exact workload, and since and until
+// bound the start time.
+type experimentFilter struct {
+	name     string
+	tags     map[string]*string
+	workload string
+	since    time.Time
+	until    time.Time
+}
+
+func parseFilter(r *http.Request) (*experimentFilter, error) {
+	query := r.URL.Query()
+	filter := &experimentFilter{name: strings.ToLower(strings.TrimSpace(query.Get("name"))), tags: make(map[string]*string), workload: strings.TrimSpace(query.Get("workload"))}
+
+	for _, tag := range query["tag"] {
+		kv := strings.SplitN(tag, "=", 2)
+		if kv[0] == "" {
+			return nil, newError(http.StatusBadRequest, "tag %q should be key=value or key", tag)
+		}
+		if len(kv) == 2 {
+			filter.tags[kv[0]] = &kv[1]
+		} else {
+			filter.tags[kv[0]] = nil
+		}
+	}
+
+	var err error
+	if filter.since, err = parseTime(query.Get("since")); err != nil {
+		return nil, newError(http.StatusBadRequest, "since %s", err.Error())
+	}
+	if filter.until, err = parseTime(query.Get("until")); err != nil {
+		return nil, newError(http.StatusBadRequest, "until %s", err.Error())
+	}
+	return filter, nil
+}
+
+// parseTime reads an RFC 3339 time or a date, the zero time when it is empty.
+func parseTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("must be a date such as 2014-05-01 or a time such as 2014-05-01T10:00:00Z")
+}
+
+// query is the part of the filter that the laboratory applies: the workload,
+// the start time and the tags with a value.
+func (f *experimentFilter) query() Filter {
+	query := Filter{Since: f.since, Until: f.until, Workload: f.workload, Tags: make(map[string]string)}
+	for k, v := range f.tags {
+		if v != nil {
+			query.Tags[k] = *v
+		}
+	}
+	return query
+}
+
+// apply keeps the experiments whose name matches and that have the tags that
+// only need a key, the rest of the filter was applied by the laboratory.
+func (f *experimentFilter) apply(experiments []Experiment) []Experiment {
+	if f.name == "" && len(f.tags) == 0 {
+		return experiments
+	}
+
+	matching := make([]Experiment, 0)
+	for _, e := range experiments {
+		if f.matches(e) {
+			matching = append(matching, e)
+		}
+	}
+	return matching
+}
+
+func (f *experimentFilter) matches(e Experiment) bool {
+	m := metadata(e)
+	if f.name != "" && !strings.Contains(strings.ToLower(m.Name), f.name) {
+		return false
+	}
+
+	for k, v := range f.tags {
+		if _, found := m.Tags[k]; !found && v == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/logs"
+	"github.com/gorilla/mux"
+)
+
+// RetentionInterval is how often the server deletes the experiments that are
+// past the retention policy.
+var RetentionInterval = time.Hour
+
+type importResponse struct {
+	Imported int
+}
+
+func (ctx *serverContext) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if _, err := ctx.remove(mux.Vars(r)["name"]); err != nil {
+		e := err.(*Error)
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ctx *serverContext) handleDeleteExperimentV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	document, err := ctx.remove(mux.Vars(r)["name"])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, document, nil
+}
+
+// remove deletes a finished experiment and returns what it was, it is a 404
+// Error when there is no such experiment and a 409 when it has not finished.
+func (ctx *serverContext) remove(name string) (*ExperimentDocument, error) {
+	e, err := ctx.find(name)
+	if err != nil {
+		return nil, err
+	}
+	document := ctx.describe(e)
+
+	switch err = ctx.lab.Delete(name); err {
+	case nil:
+		return document, nil
+	case ErrRunning:
+		return nil, newError(http.StatusConflict, "experiment %s has not finished", name)
+	default:
+		return nil, newError(http.StatusInternalServerError, "%s", err.Error())
+	}
+}
+
+// handleExportV1 downloads the experiments that match the filter of the
+// request as an archive.
+func (ctx *serverContext) handleExportV1(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		e := err.(*Error)
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+
+	found, err := ctx.lab.Query(filter.query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="pat-experiments.json.gz"`)
+	if err := WriteArchive(w, filter.apply(found)); err != nil {
+		logs.NewLogger("server").Errorf("Can't export experiments: %v", err)
+	}
+}
+
+func (ctx *serverContext) handleImportV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	imported, err := ctx.lab.Import(r.Body)
+	if invalid, ok := err.(*ArchiveError); ok {
+		return 0, nil, newError(http.StatusBadRequest, "%s", invalid.Reason)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &importResponse{imported}, nil
+}
+
+// prune deletes the experiments that are past the retention policy now and
+// every RetentionInterval after that, unless there is no policy.
+func prune(lab Laboratory, retention Retention) {
+	if retention.IsZero() {
+		return
+	}
+
+	pruneOnce(lab, retention)
+	go func() {
+		for _ = range time.Tick(RetentionInterval) {
+			pruneOnce(lab, retention)
+		}
+	}()
+}
+
+func pruneOnce(lab Laboratory, retention Retention) {
+	deleted, err := lab.Prune(retention)
+	if err != nil {
+		logs.NewLogger("server").Errorf("Can't delete experiments that are past the retention policy: %v", err)
+	}
+	if len(deleted) > 0 {
+		logs.NewLogger("server").Infof("Deleted %d experiments that are past the retention policy", len(deleted))
+	}
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, OpenAPI)
+}
+
+// OpenAPI describes version 1 of the REST API.
+const OpenAPI = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "PAT",
+    "description": "Runs performance experiments against Cloud Foundry and reports their results.",
+    "version": "1"
+  },
+  "servers": [{ "url": "/api/v1" }],
+  "security": [{ "basic": [] }, { "bearer": [] }, {}],
+  "paths": {
+    "/experiments": {
+      "get": {
+        "summary": "Lists experiments, newest first",
+        "parameters": [
+          { "name": "offset", "in": "query", "schema": { "type": "integer", "minimum": 0, "default": 0 } },
+          { "name": "limit", "in": "query", "schema": { "type": "integer", "minimum": 1, "maximum": 500, "default": 50 } },
+          { "$ref": "#/components/parameters/Name" },
+          { "$ref": "#/components/parameters/Tag" },
+          { "$ref": "#/components/parameters/Workload" },
+          { "$ref": "#/components/parameters/Since" },
+          { "$ref": "#/components/parameters/Until" }
+        ],
+        "responses": {
+          "200": { "description": "A page of experiments", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Page" } } } },
+          "400": { "$ref": "#/components/responses/Error" }
+        }
+      },
+      "post": {
+        "summary": "Starts an experiment",
+        "requestBody": { "required": true, "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Spec" } } } },
+        "responses": {
+          "201": {
+            "description": "The experiment has started",
+            "headers": { "Location": { "schema": { "type": "string" } } },
+            "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Experiment" } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/experiments/{guid}": {
+      "parameters": [{ "$ref": "#/components/parameters/Guid" }],
+      "get": {
+        "summary": "Describes an experiment",
+        "responses": {
+          "200": { "description": "The experiment", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Experiment" } } } },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      },
+      "delete": {
+        "summary": "Deletes a finished experiment with everything recorded about it",
+        "responses": {
+          "200": { "description": "The experiment that was deleted", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Experiment" } } } },
+          "404": { "$ref": "#/components/responses/Error" },
+          "409": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/experiments/{guid}/samples": {
+      "parameters": [{ "$ref": "#/components/parameters/Guid" }],
+      "get": {
+        "summary": "Lists the samples of an experiment",
+        "responses": {
+          "200": {
+            "description": "The samples so far",
+            "content": { "application/json": { "schema": { "type": "object", "properties": { "Items": { "type": "array", "items": { "$ref": "#/components/schemas/Sample" } } } } } }
+          },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/experiments/{guid}/cancel": {
+      "parameters": [{ "$ref": "#/components/parameters/Guid" }],
+      "post": {
+        "summary": "Cancels a running experiment",
+        "responses": {
+          "202": { "description": "The experiment will stop once the iterations in flight finish", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Experiment" } } } },
+          "404": { "$ref": "#/components/responses/Error" },
+          "409": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/compare": {
+      "get": {
+        "summary": "Lines up the iterations of several experiments on the time since each of them started",
+        "parameters": [
+          { "name": "experiment", "in": "query", "required": true, "description": "The guid of an experiment to compare; give two or more", "schema": { "type": "array", "items": { "type": "string" } }, "explode": true },
+          { "name": "step", "in": "query", "description": "Seconds in each step, by default the longest experiment is split into about 60 steps", "schema": { "type": "integer", "minimum": 1, "maximum": 86400 } }
+        ],
+        "responses": {
+          "200": { "description": "The comparison", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Comparison" } } } },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/archive": {
+      "get": {
+        "summary": "Exports experiments, with their samples, events and metadata",
+        "parameters": [
+          { "$ref": "#/components/parameters/Name" },
+          { "$ref": "#/components/parameters/Tag" },
+          { "$ref": "#/components/parameters/Workload" },
+          { "$ref": "#/components/parameters/Since" },
+          { "$ref": "#/components/parameters/Until" }
+        ],
+        "responses": {
+          "200": { "description": "A gzip compressed stream of JSON documents, one for each experiment", "content": { "application/gzip": { "schema": { "type": "string", "format": "binary" } } } },
+          "400": { "description": "The filter is not valid" }
+        }
+      },
+      "post": {
+        "summary": "Imports the experiments of an archive, skipping those that are already there",
+        "requestBody": { "required": true, "content": { "application/gzip": { "schema": { "type": "string", "format": "binary" } } } },
+        "responses": {
+          "200": { "description": "How many experiments were imported", "content": { "application/json": { "schema": { "type": "object", "properties": { "Imported": { "type": "integer" } } } } } },
+          "400": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/schedules": {
+      "get": {
+        "summary": "Lists the recurring schedules",
+        "responses": {
+          "200": {
+            "description": "The schedules",
+            "content": { "application/json": { "schema": { "type": "object", "properties": { "Items": { "type": "array", "items": { "$ref": "#/components/schemas/Schedule" } } } } } }
+          }
+        }
+      },
+      "post": {
+        "summary": "Adds a schedule",
+        "requestBody": { "required": true, "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } } },
+        "responses": {
+          "201": {
+            "description": "The schedule was added",
+            "headers": { "Location": { "schema": { "type": "string" } } },
+            "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/schedules/{id}": {
+      "parameters": [{ "name": "id", "in": "path", "required": true, "schema": { "type": "string" } }],
+      "get": {
+        "summary": "Describes a schedule",
+        "responses": {
+          "200": { "description": "The schedule", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } } },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      },
+      "put": {
+        "summary": "Replaces a schedule",
+        "requestBody": { "required": true, "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } } },
+        "responses": {
+          "200": { "description": "The schedule", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } } },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      },
+      "delete": {
+        "summary": "Removes a schedule",
+        "responses": {
+          "200": { "description": "The schedule that was removed", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } } },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/workloads": {
+      "get": {
+        "summary": "Lists the workload steps experiments can run",
+        "responses": {
+          "200": {
+            "description": "The workload steps",
+            "content": { "application/json": { "schema": { "type": "object", "properties": { "Items": { "type": "array", "items": { "type": "object", "properties": { "Name": { "type": "string" }, "Description": { "type": "string" } } } } } } } }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basic": { "type": "http", "scheme": "basic", "description": "Users given with -server:users" },
+      "bearer": { "type": "http", "scheme": "bearer", "description": "UAA tokens with the pat.read or pat.operator scope, checked with the UAA given with -server:uaa" }
+    },
+    "parameters": {
+      "Guid": { "name": "guid", "in": "path", "required": true, "schema": { "type": "string" } },
+      "Name": { "name": "name", "in": "query", "description": "Only experiments whose name contains this, ignoring case", "schema": { "type": "string" } },
+      "Tag": { "name": "tag", "in": "query", "description": "Only experiments with this tag, as key=value or just a key; may be repeated", "schema": { "type": "array", "items": { "type": "string" } }, "explode": true },
+      "Workload": { "name": "workload", "in": "query", "description": "Only experiments that ran exactly this workload", "schema": { "type": "string" } },
+      "Since": { "name": "since", "in": "query", "description": "Only experiments started at or after this date or time", "schema": { "type": "string", "format": "date-time" } },
+      "Until": { "name": "until", "in": "query", "description": "Only experiments started before this date or time", "schema": { "type": "string", "format": "date-time" } }
+    },
+    "responses": {
+      "Error": { "description": "The request failed, with a 401 when credentials are required and a 403 when the user may not do what was asked", "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Error" } } } }
+    },
+    "schemas": {
+      "Spec": {
+        "type": "object",
+        "description": "Fields that are left out keep the defaults of the command line",
+        "properties": {
+          "name": { "type": "string" },
+          "description": { "type": "string" },
+          "tags": { "type": "object", "description": "Key/value pairs to find the experiment by later", "additionalProperties": { "type": "string" } },
+          "iterations": { "type": "integer", "minimum": 1, "default": 1 },
+          "concurrency": { "type": "string", "description": "A number of workers, or a ramp such as 1..10", "default": "1" },
+          "concurrency:timeBetweenSteps": { "type": "integer", "minimum": 0, "description": "Seconds between adding workers", "default": 60 },
+          "interval": { "type": "integer", "minimum": 0, "default": 0 },
+          "stop": { "type": "integer", "minimum": 0, "default": 0 },
+          "window": { "type": "integer", "minimum": 0, "description": "Seconds in each window of interval statistics, 0 to disable", "default": 10 },
+          "workload": { "type": "string", "default": "cf:push" },
+          "app": { "type": "string", "default": "assets/dora" },
+          "app:manifest": { "type": "string" },
+          "rest:target": { "type": "string" },
+          "rest:username": { "type": "string" },
+          "rest:password": { "type": "string" },
+          "rest:space": { "type": "string", "default": "dev" },
+          "redis-worker:timeout": { "type": "integer", "minimum": 0, "description": "Seconds a slave may take over one iteration of this experiment, 0 for the server's -redis-worker:timeout" }
+        }
+      },
+      "Experiment": {
+        "type": "object",
+        "properties": {
+          "Guid": { "type": "string" },
+          "Name": { "type": "string" },
+          "Description": { "type": "string" },
+          "Tags": { "type": "object", "additionalProperties": { "type": "string" } },
+          "State": { "type": "string", "enum": ["Queued", "Running", "Finished", "Cancelled", "Unknown"] },
+          "Position": { "type": "integer", "description": "The place of the experiment in the queue, counting from 1, while it is Queued" },
+          "StartedBy": { "type": "string", "description": "The user who started the experiment, when the server requires authentication" },
+          "Links": { "type": "object", "additionalProperties": { "type": "string" } }
+        }
+      },
+      "Schedule": {
+        "type": "object",
+        "properties": {
+          "Id": { "type": "string", "readOnly": true },
+          "Name": { "type": "string" },
+          "Cron": { "type": "string", "description": "Minute, hour, day of month, month and day of week, e.g. 0 2 * * *, or a shortcut such as @nightly" },
+          "Spec": { "$ref": "#/components/schemas/Spec" },
+          "CreatedBy": { "type": "string", "readOnly": true },
+          "Next": { "type": "string", "format": "date-time", "readOnly": true },
+          "LastRun": {
+            "type": "object",
+            "readOnly": true,
+            "properties": { "Time": { "type": "string", "format": "date-time" }, "Guid": { "type": "string" }, "Error": { "type": "string" } }
+          },
+          "Links": { "type": "object", "readOnly": true, "additionalProperties": { "type": "string" } }
+        }
+      },
+      "Comparison": {
+        "type": "object",
+        "description": "Durations are in nanoseconds",
+        "properties": {
+          "Step": { "type": "integer" },
+          "Times": { "type": "array", "description": "The end of each step, since the experiments started", "items": { "type": "integer" } },
+          "Experiments": {
+            "type": "array",
+            "items": {
+              "allOf": [
+                { "$ref": "#/components/schemas/Experiment" },
+                {
+                  "type": "object",
+                  "properties": {
+                    "Points": {
+                      "type": "array",
+                      "description": "The iterations that ended in each step, until the experiment finished",
+                      "items": { "type": "object", "properties": { "Count": { "type": "integer" }, "Errors": { "type": "integer" }, "Average": { "type": "integer" }, "WorstResult": { "type": "integer" }, "Throughput": { "type": "number" } } }
+                    },
+                    "Last": { "$ref": "#/components/schemas/Sample" }
+                  }
+                }
+              ]
+            }
+          }
+        }
+      },
+      "Page": {
+        "type": "object",
+        "properties": {
+          "Items": { "type": "array", "items": { "$ref": "#/components/schemas/Experiment" } },
+          "Offset": { "type": "integer" },
+          "Limit": { "type": "integer" },
+          "Total": { "type": "integer" },
+          "Links": { "type": "object", "description": "next and previous pages", "additionalProperties": { "type": "string" } }
+        }
+      },
+      "Sample": {
+        "type": "object",
+        "description": "Durations are in nanoseconds. Type is 0 for a result, 4 for a window of interval statistics and 5 for the last sample of a cancelled experiment",
+        "properties": {
+          "Type": { "type": "integer" },
+          "Total": { "type": "integer" },
+          "TotalErrors": { "type": "integer" },
+          "TotalWorkers": { "type": "integer" },
+          "Average": { "type": "integer" },
+          "LastResult": { "type": "integer" },
+          "WorstResult": { "type": "integer" },
+          "NinetyfifthPercentile": { "type": "integer" },
+          "WallTime": { "type": "integer" },
+          "Throughput": { "type": "number" },
+          "Commands": { "type": "object" },
+          "Event": {
+            "type": "object",
+            "description": "The raw result of the iteration a result sample counts, with the duration of each step, when it is known",
+            "properties": {
+              "Timestamp": { "type": "string", "format": "date-time" },
+              "Worker": { "type": "integer" },
+              "Iteration": { "type": "integer" },
+              "Duration": { "type": "integer" },
+              "Steps": { "type": "array", "items": { "type": "object", "properties": { "Command": { "type": "string" }, "Duration": { "type": "integer" } } } },
+              "Error": { "type": "string" },
+              "Slave": { "type": "string" }
+            }
+          }
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "Status": { "type": "integer" },
+          "Message": { "type": "string" },
+          "Errors": {
+            "type": "array",
+            "items": { "type": "object", "properties": { "Field": { "type": "string" }, "Message": { "type": "string" } } }
+          }
+        }
+      }
+    }
+  }
+}
+`
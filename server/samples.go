@@ -0,0 +1,41 @@
+package server
+
+import (
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+)
+
+// sampleDocument is a sample as clients see it: a result sample carries the
+// raw result of the iteration it counts, with the duration of each step,
+// when it is known.
+type sampleDocument struct {
+	*Sample
+	Event *Event `json:",omitempty"`
+}
+
+func documents(samples []*Sample) []*sampleDocument {
+	docs := make([]*sampleDocument, len(samples))
+	for i, s := range samples {
+		docs[i] = &sampleDocument{s, s.Event}
+	}
+	return docs
+}
+
+// samples returns the samples of an experiment from the laboratory, with the
+// events of the store, if it keeps them.
+func (ctx *serverContext) samples(name string) ([]*Sample, error) {
+	data, err := ctx.lab.GetData(name)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+
+	e, err := ctx.find(name)
+	if err != nil {
+		return data, nil
+	}
+	if source, ok := e.(EventSource); ok {
+		if events, err := source.GetEvents(); err == nil {
+			return WithEvents(data, events), nil
+		}
+	}
+	return data, nil
+}
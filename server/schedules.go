@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/api"
+	"github.com/cloudfoundry-incubator/pat/scheduler"
+	"github.com/gorilla/mux"
+)
+
+type ScheduleDocument struct {
+	scheduler.Schedule
+	Links map[string]string
+}
+
+// startScheduled starts the experiment of a schedule that is due, it is
+// recorded as started by the schedule.
+func (ctx *serverContext) startScheduled(schedule scheduler.Schedule) (string, error) {
+	name := schedule.Name
+	if name == "" {
+		name = schedule.Id
+	}
+	return ctx.start(schedule.Spec, "schedule "+name)
+}
+
+func (ctx *serverContext) handleListSchedulesV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	documents := make([]*ScheduleDocument, 0)
+	for _, schedule := range ctx.schedules.List() {
+		documents = append(documents, ctx.scheduleDocument(schedule))
+	}
+	return http.StatusOK, &listResponse{documents}, nil
+}
+
+func (ctx *serverContext) handleCreateScheduleV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	schedule, err := ctx.decodeSchedule(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if schedule, err = ctx.schedules.Add(schedule); err != nil {
+		return 0, nil, err
+	}
+
+	document := ctx.scheduleDocument(schedule)
+	w.Header().Set("Location", document.Links["self"])
+	return http.StatusCreated, document, nil
+}
+
+func (ctx *serverContext) handleGetScheduleV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	schedule, err := ctx.schedules.Get(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, nil, scheduleError(mux.Vars(r)["id"], err)
+	}
+	return http.StatusOK, ctx.scheduleDocument(schedule), nil
+}
+
+func (ctx *serverContext) handleUpdateScheduleV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	id := mux.Vars(r)["id"]
+	if _, err := ctx.schedules.Get(id); err != nil {
+		return 0, nil, scheduleError(id, err)
+	}
+
+	schedule, err := ctx.decodeSchedule(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if schedule, err = ctx.schedules.Update(id, schedule); err != nil {
+		return 0, nil, scheduleError(id, err)
+	}
+	return http.StatusOK, ctx.scheduleDocument(schedule), nil
+}
+
+func (ctx *serverContext) handleDeleteScheduleV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	id := mux.Vars(r)["id"]
+	schedule, err := ctx.schedules.Get(id)
+	if err == nil {
+		err = ctx.schedules.Remove(id)
+	}
+	if err != nil {
+		return 0, nil, scheduleError(id, err)
+	}
+	return http.StatusOK, ctx.scheduleDocument(schedule), nil
+}
+
+// decodeSchedule reads a schedule from the body of a request, its spec keeps
+// the defaults of the fields that are left out and has to be valid.
+func (ctx *serverContext) decodeSchedule(r *http.Request) (scheduler.Schedule, error) {
+	schedule := scheduler.Schedule{Spec: api.DefaultSpec()}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		return schedule, newError(http.StatusBadRequest, "the body is not a valid schedule: %s", err.Error())
+	}
+
+	if _, err := schedule.Spec.Config(ctx.worker); err != nil {
+		return schedule, err
+	}
+
+	schedule.Id, schedule.Next, schedule.LastRun = "", time.Time{}, nil
+	schedule.CreatedBy = ctx.user(r)
+	return schedule, nil
+}
+
+func scheduleError(id string, err error) error {
+	if err == scheduler.ErrNotFound {
+		return newError(http.StatusNotFound, "schedule %s does not exist", id)
+	}
+	return err
+}
+
+func (ctx *serverContext) scheduleDocument(schedule scheduler.Schedule) *ScheduleDocument {
+	links := make(map[string]string)
+	if u, err := ctx.router.Get("v1.schedule").URL("id", schedule.Id); err == nil {
+		links["self"] = u.String()
+	}
+	if schedule.LastRun != nil && schedule.LastRun.Guid != "" {
+		if u, err := ctx.router.Get("v1.experiment").URL("name", schedule.LastRun.Guid); err == nil {
+			links["lastRun"] = u.String()
+		}
+	}
+	return &ScheduleDocument{schedule, links}
+}
@@ -4,18 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strconv"
-	"time"
+	"strings"
 
+	"github.com/cloudfoundry-incubator/pat/api"
 	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/config"
-	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/cloudfoundry-incubator/pat/experiment"
 	. "github.com/cloudfoundry-incubator/pat/laboratory"
 	"github.com/cloudfoundry-incubator/pat/logs"
+	"github.com/cloudfoundry-incubator/pat/metrics"
+	"github.com/cloudfoundry-incubator/pat/scheduler"
+	"github.com/cloudfoundry-incubator/pat/secrets"
 	"github.com/cloudfoundry-incubator/pat/store"
-	"github.com/cloudfoundry-incubator/pat/workloads"
 	"github.com/gorilla/mux"
 )
 
@@ -29,24 +30,47 @@ type Response struct {
 }
 
 type serverContext struct {
-	router *mux.Router
-	lab    Laboratory
-	worker benchmarker.Worker
+	router    *mux.Router
+	lab       Laboratory
+	worker    benchmarker.Worker
+	auth      Authenticator
+	schedules *scheduler.Scheduler
 }
 
 var params = struct {
-	port string
+	port             string
+	parallelism      int
+	schedules        string
+	users            string
+	uaa              string
+	uaaClient        string
+	uaaSecret        string
+	uaaReadScope     string
+	uaaOperatorScope string
 }{}
 
 func InitCommandLineFlags(config config.Config) {
 	config.EnvVar(&params.port, "VCAP_APP_PORT", "8080", "The port to bind to")
+	config.IntVar(&params.parallelism, "server:parallelism", 1, "number of experiments the server runs at the same time, the others wait in a queue; 0 for no limit")
+	config.StringVar(&params.schedules, "server:schedules", "output/schedules.json", "file the server keeps recurring experiment schedules in")
+	config.StringVar(&params.users, "server:users", "", "comma-separated name:password:role users who may use the server with basic auth, role is read (the default) or operator; a password may contain colons when the role is given, but not commas; may also be set with PAT_SERVER_USERS")
+	config.StringVar(&params.uaa, "server:uaa", "", "URL of a UAA whose check_token endpoint checks bearer tokens sent to the server")
+	config.StringVar(&params.uaaClient, "server:uaa:client", "pat", "client the server checks bearer tokens as")
+	config.StringVar(&params.uaaSecret, "server:uaa:secret", "", "secret of the client the server checks bearer tokens as; may also be set with PAT_SERVER_UAA_SECRET")
+	config.StringVar(&params.uaaReadScope, "server:uaa:read-scope", "pat.read", "scope of the tokens of users who may look at experiments")
+	config.StringVar(&params.uaaOperatorScope, "server:uaa:operator-scope", "pat.operator", "scope of the tokens of users who may also start and cancel experiments")
 	store.DescribeParameters(config)
 	benchmarker.DescribeParameters(config)
 }
 
 func Serve() {
-	err := store.WithStore(func(store Store) error {
-		ServeWithLab(NewLaboratory(store))
+	err := store.WithStore(func(history Store) error {
+		sinks, err := store.Sinks()
+		if err != nil {
+			return err
+		}
+
+		ServeWithLab(NewQueuedLaboratory(params.parallelism, history, append(sinks, metrics.Default.Handler, Live.Handler)...))
 		return nil
 	})
 
@@ -56,18 +80,38 @@ func Serve() {
 }
 
 func ServeWithLab(lab Laboratory) {
+	auth, err := AuthenticatorFactory()
+	if err != nil {
+		panic(err)
+	}
+
 	benchmarker.WithConfiguredWorkerAndSlaves(func(worker benchmarker.Worker) error {
 		r := mux.NewRouter()
-		ctx := &serverContext{r, lab, worker}
+		ctx := &serverContext{router: r, lab: lab, worker: worker, auth: auth}
+		schedules, err := scheduler.New(params.schedules, ctx.startScheduled)
+		if err != nil {
+			panic(err)
+		}
+		ctx.schedules = schedules
+		schedules.Start()
+		prune(lab, store.Retention())
 
 		r.Methods("GET").Path("/experiments/").HandlerFunc(handler(ctx.handleListExperiments))
 		r.Methods("GET").Path("/experiments/{name}.csv").HandlerFunc(csvHandler(ctx.handleGetExperiment)).Name("csv")
 		r.Methods("GET").Path("/experiments/{name}").HandlerFunc(handler(ctx.handleGetExperiment)).Name("experiment")
+		r.Methods("GET").Path("/experiments/{name}/stream").HandlerFunc(ctx.handleStream).Name("stream")
+		r.Methods("POST").Path("/experiments/{name}/cancel").HandlerFunc(ctx.handleCancel).Name("cancel")
+		r.Methods("DELETE").Path("/experiments/{name}").HandlerFunc(ctx.handleDelete)
 		r.Methods("POST").Path("/experiments/").HandlerFunc(handler(ctx.handlePush))
+		r.Methods("GET").Path("/slaves").HandlerFunc(handler(ctx.handleListSlaves))
 		r.Methods("GET").Path("/").HandlerFunc(redirectBase)
+		ctx.routeV1(r)
 
-		http.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir("ui"))))
-		http.Handle("/", r)
+		// scrapers are let in without credentials, metrics only hold guids
+		// and timings
+		http.Handle("/metrics", metrics.Default)
+		http.Handle("/ui/", ctx.authenticate(http.StripPrefix("/ui/", http.FileServer(http.Dir("ui")))))
+		http.Handle("/", ctx.authenticate(r))
 		bind()
 
 		return nil
@@ -92,83 +136,249 @@ type listResponse struct {
 }
 
 func (ctx *serverContext) handleListExperiments(w http.ResponseWriter, r *http.Request) (interface{}, error) {
-	experiments := make([]map[string]string, 0)
-	ctx.lab.Visit(func(e Experiment) {
-		json := make(map[string]string)
+	filter, err := parseFilter(r)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := ctx.list(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	experiments := make([]map[string]interface{}, 0)
+	for _, e := range found {
+		json := make(map[string]interface{})
 		url, _ := ctx.router.Get("experiment").URL("name", e.GetGuid())
 		csvUrl, _ := ctx.router.Get("csv").URL("name", e.GetGuid())
+		m := metadata(e)
+		json["Guid"] = e.GetGuid()
 		json["Location"] = url.String()
 		json["CsvLocation"] = csvUrl.String()
-		json["Name"] = "Simple Push (" + e.GetGuid() + ")"
-		json["State"] = "Unknown"
+		json["Name"] = m.Name
+		if m.Name == "" {
+			json["Name"] = "Simple Push (" + e.GetGuid() + ")"
+		}
+		json["Description"] = m.Description
+		json["Tags"] = m.Tags
+		json["State"] = ctx.state(e)
+		json["StartedBy"] = m.StartedBy
 		experiments = append(experiments, json)
-	})
+	}
 
 	return &listResponse{experiments}, nil
 }
 
-func (ctx *serverContext) handlePush(w http.ResponseWriter, r *http.Request) (interface{}, error) {
-	pushes, err := strconv.Atoi(r.FormValue("iterations"))
+// list lists the experiments in the laboratory that match a filter, oldest
+// first, followed by those waiting in the queue that the store does not know
+// yet.
+func (ctx *serverContext) list(filter *experimentFilter) ([]Experiment, error) {
+	query := filter.query()
+	all, err := ctx.lab.Query(query)
 	if err != nil {
-		pushes = 1
+		return nil, newError(http.StatusInternalServerError, "%s", err.Error())
 	}
 
-	concurrency := make([]int, 1)
-	concurrency[0], err = strconv.Atoi(r.FormValue("concurrency"))
-	if err != nil {
-		concurrency[0] = 1
+	seen := make(map[string]bool)
+	for _, e := range all {
+		seen[e.GetGuid()] = true
+	}
+	for _, guid := range ctx.lab.Queue() {
+		if !seen[guid] && query.Matches(queuedExperiment(guid)) {
+			all = append(all, queuedExperiment(guid))
+		}
+	}
+	return filter.apply(all), nil
+}
+
+type queuedExperiment string
+
+func (q queuedExperiment) GetGuid() string {
+	return string(q)
+}
+
+func (q queuedExperiment) GetData() ([]*Sample, error) {
+	return []*Sample{}, nil
+}
+
+// position is where an experiment is in the queue, counting from 1, or 0 if
+// it is not queued.
+func (ctx *serverContext) position(guid string) int {
+	for i, queued := range ctx.lab.Queue() {
+		if queued == guid {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// state is Queued until the experiment starts, then Running until it
+// finishes, then Finished, or Cancelled when its last sample says that it was.
+func (ctx *serverContext) state(e Experiment) string {
+	if ctx.position(e.GetGuid()) > 0 {
+		return "Queued"
+	}
+
+	if ctx.lab.Running(e.GetGuid()) {
+		return "Running"
+	}
+
+	last, ok := LastSample(e)
+	if !ok {
+		return "Unknown"
+	}
+
+	if last.Type == CancelledSample {
+		return "Cancelled"
+	}
+	return "Finished"
+}
+
+// metadata is empty for experiments whose store does not keep it.
+func metadata(e Experiment) Metadata {
+	if source, ok := e.(MetadataSource); ok {
+		if m, err := source.GetMetadata(); err == nil {
+			return m
+		}
+	}
+	return Metadata{}
+}
+
+func (ctx *serverContext) handleCancel(w http.ResponseWriter, r *http.Request) {
+	switch err := ctx.lab.Cancel(mux.Vars(r)["name"]); err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case ErrNotRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handlePush starts an experiment from a JSON Spec, or from the form fields
+// of older clients. Fields that are left out keep their defaults.
+func (ctx *serverContext) handlePush(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	spec := api.DefaultSpec()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			return nil, &api.ValidationError{Errors: []api.FieldError{{Field: "body", Message: "is not a valid experiment specification: " + err.Error()}}}
+		}
+	} else if err := specFromForm(r, &spec); err != nil {
+		return nil, err
 	}
 
-	rawConcurrencyStepTime, err := strconv.Atoi(r.FormValue("concurrency:timeBetweenSteps"))
-	concurrencyStepTime := time.Duration(rawConcurrencyStepTime) * time.Second
+	guid, err := ctx.start(spec, ctx.user(r))
 	if err != nil {
-		concurrencyStepTime = 60 * time.Second
+		return nil, err
 	}
 
-	interval, err := strconv.Atoi(r.FormValue("interval"))
+	url, _ := ctx.router.Get("experiment").URL("name", guid)
+	csvUrl, _ := ctx.router.Get("csv").URL("name", guid)
+	return &location{url.String(), csvUrl.String()}, nil
+}
+
+type location struct {
+	Location    string
+	CsvLocation string
+}
+
+// start validates a spec and starts the experiment it describes, recording
+// who started it.
+func (ctx *serverContext) start(spec api.Spec, startedBy string) (string, error) {
+	config, err := spec.Config(ctx.worker)
 	if err != nil {
-		interval = 0
+		return "", err
 	}
-	stop, err := strconv.Atoi(r.FormValue("stop"))
+
+	if err := secrets.Populate(config.Context); err != nil {
+		return "", err
+	}
+
+	config.Lab = ctx.lab
+	config.Metadata.StartedBy = startedBy
+	execution, err := api.Start(config)
 	if err != nil {
-		stop = 0
+		return "", err
 	}
+	return execution.Guid, nil
+}
 
-	workload := r.FormValue("workload")
-	if workload == "" {
-		workload = "cf:push"
+// specFromForm reads a spec from the form fields of older clients, numbers
+// that are not valid are returned as a ValidationError.
+func specFromForm(r *http.Request, spec *api.Spec) error {
+	ints := []struct {
+		name  string
+		field *int
+	}{
+		{"iterations", &spec.Iterations},
+		{"concurrency:timeBetweenSteps", &spec.ConcurrencyStepTime},
+		{"interval", &spec.Interval},
+		{"stop", &spec.Stop},
+		{"window", &spec.Window},
+	}
+	invalid := &api.ValidationError{}
+	for _, i := range ints {
+		raw := r.FormValue(i.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			invalid.Errors = append(invalid.Errors, api.FieldError{Field: i.name, Message: "must be a whole number"})
+			continue
+		}
+		*i.field = v
 	}
 
-	workloadContext := context.New()
-	workloads.PopulateRestContext(r.FormValue("cfTarget"), r.FormValue("cfUsername"), r.FormValue("cfPassword"), r.FormValue("cfSpace"), workloadContext)
+	texts := map[string]*string{
+		"concurrency":  &spec.Concurrency,
+		"workload":     &spec.Workload,
+		"app":          &spec.App,
+		"app:manifest": &spec.Manifest,
+		"cfTarget":     &spec.RestTarget,
+		"cfUsername":   &spec.RestUsername,
+		"cfPassword":   &spec.RestPassword,
+		"cfSpace":      &spec.RestSpace,
+		"name":         &spec.Name,
+		"description":  &spec.Description,
+	}
+	for name, field := range texts {
+		if v := r.FormValue(name); v != "" {
+			*field = v
+		}
+	}
 
-	experiment, _ := ctx.lab.Run(
-		NewRunnableExperiment(
-			NewExperimentConfiguration(
-				pushes, concurrency, concurrencyStepTime, interval, stop, ctx.worker, workload)), workloadContext)
+	if len(invalid.Errors) > 0 {
+		return invalid
+	}
+	return nil
+}
 
-	return ctx.router.Get("experiment").URL("name", experiment)
+func (ctx *serverContext) handleListSlaves(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	lister, ok := ctx.worker.(benchmarker.SlaveLister)
+	if !ok {
+		return &listResponse{[]benchmarker.SlaveInfo{}}, nil
+	}
+
+	slaves, err := lister.Slaves()
+	return &listResponse{slaves}, err
 }
 
 func (ctx *serverContext) handleGetExperiment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	name := mux.Vars(r)["name"]
-	data, err := ctx.lab.GetData(name)
-	if len(data) == 0 {
-		// Ensure empty array is encoded as [] rather than null
-		/// see https://groups.google.com/forum/#!topic/golang-nuts/gOHbOk8DsFw
-		data = []*Sample{}
-	}
-	return &listResponse{data}, err
+	data, err := ctx.samples(name)
+	// documents encodes no samples as [] rather than null
+	return &listResponse{documents(data)}, err
 
 }
 
 func csvHandler(fn func(http.ResponseWriter, *http.Request) (interface{}, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if response, err := fn(w, r); err == nil {
-			fmt.Fprintf(w, "Average,TotalTime,Total,TotalErrors,TotalWorkers,LastResult,LastError,WorstResult,WallTime,Type\n")
-			for _, line := range response.(*listResponse).Items.([]*Sample) {
-				fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n",
-					line.Average, line.TotalTime, line.Total, line.TotalErrors, line.TotalWorkers, line.LastResult, line.LastError, line.WorstResult, line.WallTime, line.Type)
+			fmt.Fprintf(w, "Average,TotalTime,Total,TotalErrors,TotalWorkers,LastResult,LastError,WorstResult,WallTime,Type,Throughput\n")
+			for _, line := range response.(*listResponse).Items.([]*sampleDocument) {
+				fmt.Fprintf(w, "%v,%v,%v,%v,%v,%v,%v,%v,%v,%v,%v\n",
+					line.Average, line.TotalTime, line.Total, line.TotalErrors, line.TotalWorkers, line.LastResult, line.LastError, line.WorstResult, line.WallTime, line.Type, line.Throughput)
 			}
 		}
 	}
@@ -181,21 +391,29 @@ func handler(fn func(http.ResponseWriter, *http.Request) (interface{}, error)) h
 		var encoded []byte
 
 		if response, err = fn(w, r); err == nil {
-			switch r := response.(type) {
-			case *url.URL:
-				w.Header().Set("Location", r.String())
+			if l, ok := response.(*location); ok {
+				w.Header().Set("Location", l.Location)
+			}
+
+			if encoded, err = json.Marshal(response); err == nil {
 				w.Header().Set("Content-Type", "application/json")
-				fmt.Fprintf(w, "{ \"Location\": \"%v\", \"CsvLocation\": \"/csv/%v.csv\" }", r, r)
+				w.Write(encoded)
 				return
-			default:
-				if encoded, err = json.Marshal(r); err == nil {
-					w.Header().Set("Content-Type", "application/json")
-					fmt.Fprintf(w, string(encoded))
-					return
-				}
 			}
 		}
 
+		if invalid, ok := err.(*api.ValidationError); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(invalid)
+			return
+		}
+
+		if e, ok := err.(*Error); ok {
+			http.Error(w, e.Message, e.Status)
+			return
+		}
+
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
@@ -1,7 +1,12 @@
 package server_test
 
 import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	. "github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/context"
 	. "github.com/cloudfoundry-incubator/pat/experiment"
@@ -106,6 +112,7 @@ var _ = Describe("Server", func() {
 		Ω(json["Items"]).Should(HaveLen(3))
 		items := json["Items"].([]interface{})
 		Ω(items[0].(map[string]interface{})["Location"]).Should(Equal("/experiments/a"))
+		Ω(items[0].(map[string]interface{})["Guid"]).Should(Equal("a"))
 		Ω(items[1].(map[string]interface{})["Location"]).Should(Equal("/experiments/b"))
 		Ω(items[2].(map[string]interface{})["Location"]).Should(Equal("/experiments/c"))
 	})
@@ -120,6 +127,114 @@ var _ = Describe("Server", func() {
 		}
 	})
 
+	It("gives each result sample the steps of its iteration, when the store keeps them", func() {
+		items := get("/experiments/a")["Items"].([]interface{})
+		event := items[0].(map[string]interface{})["Event"].(map[string]interface{})
+		Ω(event["Steps"]).Should(HaveLen(2))
+		Ω(event["Steps"].([]interface{})[1].(map[string]interface{})["Command"]).Should(Equal("push"))
+		Ω(items[1]).ShouldNot(HaveKey("Event"))
+	})
+
+	It("lists the state of each experiment", func() {
+		lab.running = map[string]bool{"b": true}
+		json := get("/experiments/")
+		items := json["Items"].([]interface{})
+		Ω(items[0].(map[string]interface{})["State"]).Should(Equal("Finished"))
+		Ω(items[1].(map[string]interface{})["State"]).Should(Equal("Running"))
+		Ω(items[2].(map[string]interface{})["State"]).Should(Equal("Cancelled"))
+	})
+
+	It("reads only the last sample of each experiment to list its state", func() {
+		loads = 0
+		get("/experiments/")
+		get("/api/v1/experiments")
+		Ω(loads).Should(Equal(0))
+	})
+
+	It("lists who started each experiment", func() {
+		items := get("/experiments/")["Items"].([]interface{})
+		Ω(items[0].(map[string]interface{})["StartedBy"]).Should(Equal("someone"))
+		Ω(items[1].(map[string]interface{})["StartedBy"]).Should(Equal(""))
+	})
+
+	It("lists the name, description and tags of each experiment", func() {
+		items := get("/experiments/")["Items"].([]interface{})
+		Ω(items[0].(map[string]interface{})["Name"]).Should(Equal("Nightly push"))
+		Ω(items[0].(map[string]interface{})["Tags"]).Should(Equal(map[string]interface{}{"env": "staging"}))
+		Ω(items[1].(map[string]interface{})["Name"]).Should(Equal("Simple Push (b)"))
+		Ω(items[2].(map[string]interface{})["Description"]).Should(Equal("trying a 50% ramp"))
+	})
+
+	It("lists only the experiments with the tags of the filter", func() {
+		items := get("/experiments/?tag=env=prod")["Items"].([]interface{})
+		Ω(items).Should(HaveLen(1))
+		Ω(items[0].(map[string]interface{})["Location"]).Should(Equal("/experiments/c"))
+	})
+
+	It("lists queued experiments", func() {
+		lab.queue = []string{"b", "d"}
+		items := get("/experiments/")["Items"].([]interface{})
+		Ω(items).Should(HaveLen(4))
+		Ω(items[1].(map[string]interface{})["State"]).Should(Equal("Queued"))
+		Ω(items[3].(map[string]interface{})["Location"]).Should(Equal("/experiments/d"))
+		Ω(items[3].(map[string]interface{})["State"]).Should(Equal("Queued"))
+	})
+
+	Describe("Cancelling an experiment", func() {
+		It("cancels a running experiment", func() {
+			lab.running = map[string]bool{"b": true}
+			resp := record("POST", "/experiments/b/cancel")
+			Ω(resp.Code).Should(Equal(http.StatusAccepted))
+			Ω(lab.cancelled).Should(Equal([]string{"b"}))
+		})
+
+		It("refuses to cancel an experiment that is not running", func() {
+			resp := record("POST", "/experiments/a/cancel")
+			Ω(resp.Code).Should(Equal(http.StatusConflict))
+			Ω(lab.cancelled).Should(BeEmpty())
+		})
+	})
+
+	Describe("Deleting an experiment", func() {
+		It("deletes a finished experiment", func() {
+			resp := record("DELETE", "/experiments/a")
+			Ω(resp.Code).Should(Equal(http.StatusNoContent))
+			Ω(lab.deleted).Should(Equal([]string{"a"}))
+			Ω(get("/experiments/")["Items"]).Should(HaveLen(2))
+		})
+
+		It("refuses to delete an experiment that has not finished", func() {
+			lab.running = map[string]bool{"b": true}
+			Ω(record("DELETE", "/experiments/b").Code).Should(Equal(http.StatusConflict))
+			lab.queue = []string{"d"}
+			Ω(record("DELETE", "/experiments/d").Code).Should(Equal(http.StatusConflict))
+			Ω(lab.deleted).Should(BeEmpty())
+		})
+
+		It("is not found when there is no such experiment", func() {
+			Ω(record("DELETE", "/experiments/flibble").Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("When a retention policy is configured", func() {
+		var flags config.Config
+
+		BeforeEach(func() {
+			ListenAndServe = func(bind string) error { return nil }
+			flags = config.NewConfig()
+			InitCommandLineFlags(flags)
+			flags.Parse([]string{"-retention:keep", "10", "-retention:days", "30"})
+		})
+
+		AfterEach(func() {
+			InitCommandLineFlags(config.NewConfig())
+		})
+
+		It("deletes the experiments past it when it starts", func() {
+			Ω(lab.retention).Should(Equal(Retention{Keep: 10, MaxAge: 30 * 24 * time.Hour}))
+		})
+	})
+
 	It("lists experiments with a Csv Url link", func() {
 		json := get("/experiments/")
 		Ω(json["Items"]).Should(HaveLen(3))
@@ -134,6 +249,103 @@ var _ = Describe("Server", func() {
 		Ω(lines).Should(HaveLen(1 + 3 + 1)) // header, rows, newline
 		Ω(lines[0]).Should(ContainSubstring("Average,TotalTime,Total"))
 		Ω(lines[1]).Should(ContainSubstring("0,0,0"))
+		Ω(lines[0]).Should(ContainSubstring(",Type,Throughput"))
+	})
+
+	Describe("Streaming samples", func() {
+		It("replays a finished experiment and ends the stream", func() {
+			events := strings.Split(string(req("GET", "/experiments/a/stream")), "\n\n")
+			Ω(events).Should(HaveLen(5)) // 3 samples, end, trailing newline
+			Ω(events[0]).Should(MatchRegexp(`^event: sample\ndata: \{`))
+			Ω(events[3]).Should(Equal("event: end\ndata: {}"))
+			Ω(events[0]).Should(ContainSubstring(`"Steps":[{"Command":"login"`))
+		})
+
+		Describe("of a running experiment", func() {
+			var (
+				samples chan *Sample
+				server  *httptest.Server
+				resp    *http.Response
+				reader  *bufio.Reader
+			)
+
+			open := func(name string) {
+				var err error
+				server = httptest.NewServer(http.DefaultServeMux)
+				resp, err = http.Get(server.URL + "/experiments/" + name + "/stream")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(resp.Header.Get("Content-Type")).Should(Equal("text/event-stream"))
+				reader = bufio.NewReader(resp.Body)
+			}
+
+			next := func() (event string, data map[string]interface{}) {
+				line, _ := reader.ReadString('\n')
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+				line, _ = reader.ReadString('\n')
+				data = decode([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data: "))))
+				reader.ReadString('\n')
+				return
+			}
+
+			AfterEach(func() {
+				resp.Body.Close()
+				server.Close()
+			})
+
+			It("sends the last sample, then streams new ones until it finishes", func() {
+				samples = make(chan *Sample)
+				go Live.Handler("running", nil)(samples)
+				samples <- &Sample{Total: 1, WallTime: time.Second}
+				open("running")
+
+				event, data := next()
+				Ω(event).Should(Equal("sample"))
+				Ω(data["Total"]).Should(BeEquivalentTo(1))
+
+				samples <- &Sample{Total: 2, WallTime: 2 * time.Second}
+				event, data = next()
+				Ω(event).Should(Equal("sample"))
+				Ω(data["Total"]).Should(BeEquivalentTo(2))
+
+				close(samples)
+				event, _ = next()
+				Ω(event).Should(Equal("end"))
+			})
+
+			It("replays the samples the store already has, without sending them twice", func() {
+				samples = make(chan *Sample)
+				go Live.Handler("c", nil)(samples)
+				samples <- &Sample{Type: ResultSample, WallTime: 12 * time.Second, LastResult: 3 * time.Second}
+				open("c")
+
+				for i := 0; i < 4; i++ {
+					event, _ := next()
+					Ω(event).Should(Equal("sample"))
+				}
+
+				samples <- &Sample{Type: ResultSample, WallTime: 12 * time.Second}
+				samples <- &Sample{Type: ResultSample, WallTime: 13 * time.Second, Total: 13}
+				_, data := next()
+				Ω(data["Total"]).Should(BeEquivalentTo(13))
+				close(samples)
+			})
+		})
+
+		It("returns a 404 for an experiment that does not exist", func() {
+			resp := record("GET", "/experiments/nope/stream")
+			Ω(resp.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("lists no slaves when work is not sent to redis", func() {
+		json := get("/slaves")
+		Ω(json["Items"]).ShouldNot(BeNil())
+		Ω(json["Items"]).Should(BeEmpty())
+	})
+
+	It("exposes metrics in the prometheus text format", func() {
+		metrics := req("GET", "/metrics")
+		Ω(string(metrics)).Should(ContainSubstring("# TYPE pat_iteration_duration_seconds histogram"))
 	})
 
 	It("Runs experiment with default arguments", func() {
@@ -143,6 +355,7 @@ var _ = Describe("Server", func() {
 		Ω(lab.config.ConcurrencyStepTime).Should(Equal(60 * time.Second))
 		Ω(lab.config.Interval).Should(Equal(0))
 		Ω(lab.config.Stop).Should(Equal(0))
+		Ω(lab.config.Window).Should(Equal(DefaultWindow))
 		Ω(lab.config.Workload).Should(Equal("cf:push"))
 	})
 
@@ -171,9 +384,79 @@ var _ = Describe("Server", func() {
 		Ω(lab.config.Stop).Should(Equal(3))
 	})
 
+	It("Supports a 'window' parameter in seconds", func() {
+		post("/experiments/?window=5")
+		Ω(lab.config.Window).Should(Equal(5 * time.Second))
+	})
+
 	It("Supports a 'workload' parameter", func() {
+		post("/experiments/?workload=dummy")
+		Ω(lab.config.Workload).Should(Equal("dummy"))
+	})
+
+	It("Does not run an experiment with an unknown workload", func() {
 		post("/experiments/?workload=flibble")
-		Ω(lab.config.Workload).Should(Equal("flibble"))
+		Ω(lab.config).Should(BeNil())
+	})
+
+	It("Supports a ramping 'concurrency' parameter", func() {
+		post("/experiments/?concurrency=1..10")
+		Ω(lab.config.Concurrency).Should(Equal([]int{1, 10}))
+	})
+
+	It("returns a 400 for form fields that are not numbers", func() {
+		resp := record("POST", "/experiments/?iterations=abc&stop=1.5&interval=3")
+		Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+		Ω(lab.config).Should(BeNil())
+
+		errors := decode(resp.Body.Bytes())["Errors"].([]interface{})
+		Ω(errors).Should(HaveLen(2))
+		Ω(errors[0]).Should(Equal(map[string]interface{}{"Field": "iterations", "Message": "must be a whole number"}))
+		Ω(errors[1].(map[string]interface{})["Field"]).Should(Equal("stop"))
+	})
+
+	Describe("Posting a JSON experiment specification", func() {
+		It("runs the experiment it describes", func() {
+			resp := postJSON("/experiments/", `{"iterations": 4, "concurrency": "2..6", "concurrency:timeBetweenSteps": 5, "interval": 10, "stop": 30, "window": 0, "workload": "dummy", "app": "/tmp/app", "app:manifest": "/tmp/manifest.yml", "rest:target": "http://api.127.0.0.1", "rest:space": "test"}`)
+			Ω(resp.Code).Should(Equal(http.StatusOK))
+			Ω(lab.config.Iterations).Should(Equal(4))
+			Ω(lab.config.Concurrency).Should(Equal([]int{2, 6}))
+			Ω(lab.config.ConcurrencyStepTime).Should(Equal(5 * time.Second))
+			Ω(lab.config.Interval).Should(Equal(10))
+			Ω(lab.config.Stop).Should(Equal(30))
+			Ω(lab.config.Window).Should(BeNumerically("<", 0))
+			Ω(lab.config.Workload).Should(Equal("dummy"))
+			Ω(workloadCtxStringValue("app")).Should(Equal("/tmp/app"))
+			Ω(workloadCtxStringValue("app:manifest")).Should(Equal("/tmp/manifest.yml"))
+			Ω(workloadCtxStringValue("rest:target")).Should(Equal("http://api.127.0.0.1"))
+			Ω(workloadCtxStringValue("rest:space")).Should(Equal("test"))
+		})
+
+		It("keeps the defaults of fields that are left out", func() {
+			postJSON("/experiments/", `{"workload": "dummy"}`)
+			Ω(lab.config.Iterations).Should(Equal(1))
+			Ω(lab.config.Concurrency).Should(Equal([]int{1}))
+			Ω(lab.config.Window).Should(Equal(DefaultWindow))
+		})
+
+		It("returns every validation error with a 400", func() {
+			resp := postJSON("/experiments/", `{"iterations": 0, "concurrency": "5..1", "stop": -1, "workload": "flibble"}`)
+			Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+			Ω(lab.config).Should(BeNil())
+
+			errors := decode(resp.Body.Bytes())["Errors"].([]interface{})
+			fields := make([]interface{}, len(errors))
+			for i, e := range errors {
+				fields[i] = e.(map[string]interface{})["Field"]
+			}
+			Ω(fields).Should(Equal([]interface{}{"iterations", "concurrency", "stop", "workload"}))
+		})
+
+		It("returns a 400 when the body is not JSON", func() {
+			resp := postJSON("/experiments/", `{"iterations": `)
+			Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+			Ω(lab.config).Should(BeNil())
+		})
 	})
 
 	It("Supports a 'cfTarget' parameter", func() {
@@ -201,11 +484,513 @@ var _ = Describe("Server", func() {
 		Ω(json["Location"]).Should(Equal("/experiments/some-guid"))
 	})
 
+	It("Returns the CSV location of the experiment it started", func() {
+		json := post("/experiments/")
+		Ω(json["CsvLocation"]).Should(Equal("/experiments/some-guid.csv"))
+	})
+
+	Describe("The v1 API", func() {
+		guids := func(page map[string]interface{}) []string {
+			found := make([]string, 0)
+			for _, item := range page["Items"].([]interface{}) {
+				found = append(found, item.(map[string]interface{})["Guid"].(string))
+			}
+			return found
+		}
+
+		Describe("Listing experiments", func() {
+			It("lists experiments newest first", func() {
+				page := get("/api/v1/experiments")
+				Ω(guids(page)).Should(Equal([]string{"c", "b", "a"}))
+				Ω(page["Total"]).Should(BeEquivalentTo(3))
+			})
+
+			It("pages through experiments", func() {
+				page := get("/api/v1/experiments?limit=2")
+				Ω(guids(page)).Should(Equal([]string{"c", "b"}))
+				Ω(page["Links"]).Should(HaveKeyWithValue("next", "/api/v1/experiments?offset=2&limit=2"))
+
+				page = get("/api/v1/experiments?offset=2&limit=2")
+				Ω(guids(page)).Should(Equal([]string{"a"}))
+				Ω(page["Links"]).ShouldNot(HaveKey("next"))
+				Ω(page["Links"]).Should(HaveKeyWithValue("previous", "/api/v1/experiments?offset=0&limit=2"))
+			})
+
+			It("filters on tags, with or without a value", func() {
+				Ω(guids(get("/api/v1/experiments?tag=env=staging"))).Should(Equal([]string{"a"}))
+				Ω(guids(get("/api/v1/experiments?tag=env"))).Should(Equal([]string{"c", "a"}))
+				Ω(guids(get("/api/v1/experiments?tag=env&tag=team=runtime"))).Should(Equal([]string{"c"}))
+				Ω(guids(get("/api/v1/experiments?tag=env=dev"))).Should(BeEmpty())
+			})
+
+			It("filters on part of the name, ignoring case", func() {
+				Ω(guids(get("/api/v1/experiments?name=NIGHTLY"))).Should(Equal([]string{"a"}))
+			})
+
+			It("filters on the start time of the first sample", func() {
+				Ω(guids(get("/api/v1/experiments?since=2014-05-01&until=2014-06-01"))).Should(Equal([]string{"a"}))
+				Ω(guids(get("/api/v1/experiments?tag=env&since=2014-06-01T00:00:00Z"))).Should(Equal([]string{"c"}))
+			})
+
+			It("filters on the workload", func() {
+				Ω(guids(get("/api/v1/experiments?workload=gcf:push"))).Should(Equal([]string{"c"}))
+				Ω(guids(get("/api/v1/experiments?workload=gcf:login"))).Should(BeEmpty())
+			})
+
+			It("leaves the workload, start time and tags with a value to the laboratory", func() {
+				get("/api/v1/experiments?workload=gcf:push&tag=env=prod&tag=team&since=2014-06-01")
+				Ω(lab.queried.Workload).Should(Equal("gcf:push"))
+				Ω(lab.queried.Tags).Should(Equal(map[string]string{"env": "prod"}))
+				Ω(lab.queried.Since).Should(Equal(time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC)))
+			})
+
+			It("keeps the filter in the links to other pages", func() {
+				page := get("/api/v1/experiments?tag=env&limit=1")
+				Ω(page["Total"]).Should(BeEquivalentTo(2))
+				Ω(page["Links"]).Should(HaveKeyWithValue("next", "/api/v1/experiments?tag=env&offset=1&limit=1"))
+			})
+
+			It("describes each experiment with its name, description and tags", func() {
+				page := get("/api/v1/experiments?name=ad+hoc")
+				item := page["Items"].([]interface{})[0].(map[string]interface{})
+				Ω(item["Name"]).Should(Equal("ad hoc"))
+				Ω(item["Description"]).Should(Equal("trying a 50% ramp"))
+				Ω(item["Tags"]).Should(Equal(map[string]interface{}{"env": "prod", "team": "runtime"}))
+			})
+
+			It("rejects a filter that is not valid with a 400", func() {
+				for _, url := range []string{"/api/v1/experiments?since=yesterday", "/api/v1/experiments?tag==staging", "/experiments/?until=soon"} {
+					Ω(record("GET", url).Code).Should(Equal(http.StatusBadRequest), url)
+				}
+			})
+
+			It("rejects a limit that is out of range with a 400", func() {
+				resp := record("GET", "/api/v1/experiments?limit=0")
+				Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+				Ω(decode(resp.Body.Bytes())["Status"]).Should(BeEquivalentTo(400))
+			})
+		})
+
+		Describe("Getting an experiment", func() {
+			It("describes the experiment with links to its resources", func() {
+				experiment := get("/api/v1/experiments/a")
+				Ω(experiment["Guid"]).Should(Equal("a"))
+				Ω(experiment["State"]).Should(Equal("Finished"))
+				Ω(experiment["Links"]).Should(HaveKeyWithValue("self", "/api/v1/experiments/a"))
+				Ω(experiment["Links"]).Should(HaveKeyWithValue("samples", "/api/v1/experiments/a/samples"))
+				Ω(experiment["Links"]).Should(HaveKeyWithValue("csv", "/experiments/a.csv"))
+			})
+
+			It("looks the experiment up rather than listing every experiment", func() {
+				get("/api/v1/experiments/a")
+				Ω(lab.queries).Should(Equal(0))
+			})
+
+			It("returns the samples of an experiment", func() {
+				Ω(get("/api/v1/experiments/a/samples")["Items"]).Should(HaveLen(3))
+			})
+
+			It("returns a 404 for an experiment that does not exist", func() {
+				for _, url := range []string{"/api/v1/experiments/nope", "/api/v1/experiments/nope/samples"} {
+					resp := record("GET", url)
+					Ω(resp.Code).Should(Equal(http.StatusNotFound))
+					Ω(decode(resp.Body.Bytes())["Message"]).Should(ContainSubstring("nope"))
+				}
+			})
+		})
+
+		Describe("Starting an experiment", func() {
+			It("returns a 201 with the location of the experiment", func() {
+				resp := postJSON("/api/v1/experiments", `{"workload": "dummy", "concurrency": "1..3"}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+				Ω(resp.Header().Get("Location")).Should(Equal("/api/v1/experiments/some-guid"))
+				Ω(decode(resp.Body.Bytes())["Guid"]).Should(Equal("some-guid"))
+				Ω(lab.config.Concurrency).Should(Equal([]int{1, 3}))
+			})
+
+			It("returns a 400 with the fields in error", func() {
+				resp := postJSON("/api/v1/experiments", `{"iterations": -1, "workload": "dummy"}`)
+				Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+				errors := decode(resp.Body.Bytes())["Errors"].([]interface{})
+				Ω(errors).Should(HaveLen(1))
+				Ω(errors[0].(map[string]interface{})["Field"]).Should(Equal("iterations"))
+				Ω(lab.config).Should(BeNil())
+			})
+
+			It("records the name, description and tags of the experiment", func() {
+				resp := postJSON("/api/v1/experiments", `{"workload": "dummy", "name": "nightly", "description": "the nightly push", "tags": {"env": "staging"}}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+				Ω(decode(resp.Body.Bytes())["Tags"]).Should(Equal(map[string]interface{}{"env": "staging"}))
+				Ω(lab.config.Metadata).Should(Equal(Metadata{Name: "nightly", Description: "the nightly push", Tags: map[string]string{"env": "staging"}}))
+			})
+
+			It("returns a 400 when the body is not JSON", func() {
+				resp := postJSON("/api/v1/experiments", `iterations=3`)
+				Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Describe("Queueing experiments", func() {
+			It("gives the position of queued experiments", func() {
+				lab.queue = []string{"d", "e"}
+				page := get("/api/v1/experiments")
+				Ω(guids(page)).Should(Equal([]string{"e", "d", "c", "b", "a"}))
+
+				experiment := get("/api/v1/experiments/e")
+				Ω(experiment["State"]).Should(Equal("Queued"))
+				Ω(experiment["Position"]).Should(BeEquivalentTo(2))
+			})
+
+			It("says where a new experiment is in the queue", func() {
+				lab.queue = []string{"d", "some-guid"}
+				resp := postJSON("/api/v1/experiments", `{"workload": "dummy"}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+				Ω(decode(resp.Body.Bytes())["State"]).Should(Equal("Queued"))
+				Ω(decode(resp.Body.Bytes())["Position"]).Should(BeEquivalentTo(2))
+			})
+
+			It("takes a cancelled experiment out of the queue", func() {
+				lab.queue = []string{"d"}
+				resp := record("POST", "/api/v1/experiments/d/cancel")
+				Ω(resp.Code).Should(Equal(http.StatusAccepted))
+				Ω(decode(resp.Body.Bytes())["State"]).Should(Equal("Cancelled"))
+				Ω(lab.queue).Should(BeEmpty())
+			})
+		})
+
+		Describe("Schedules", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "schedules")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				flags := config.NewConfig()
+				InitCommandLineFlags(flags)
+				flags.Parse([]string{"-server:schedules", filepath.Join(dir, "schedules.json")})
+			})
+
+			AfterEach(func() {
+				InitCommandLineFlags(config.NewConfig())
+				os.RemoveAll(dir)
+			})
+
+			create := func() map[string]interface{} {
+				resp := postJSON("/api/v1/schedules", `{"Name": "nightly", "Cron": "0 2 * * *", "Spec": {"workload": "dummy", "concurrency": "10"}}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+				return decode(resp.Body.Bytes())
+			}
+
+			It("adds a schedule and lists it", func() {
+				schedule := create()
+				Ω(schedule["Id"]).ShouldNot(BeEmpty())
+				Ω(schedule["Next"]).ShouldNot(BeEmpty())
+				Ω(schedule["Spec"]).Should(HaveKeyWithValue("concurrency", "10"))
+				Ω(schedule["Spec"]).Should(HaveKeyWithValue("iterations", BeEquivalentTo(1)))
+				Ω(schedule["Links"]).Should(HaveKeyWithValue("self", "/api/v1/schedules/"+schedule["Id"].(string)))
+
+				Ω(get("/api/v1/schedules")["Items"]).Should(HaveLen(1))
+				Ω(get("/api/v1/schedules/" + schedule["Id"].(string))["Name"]).Should(Equal("nightly"))
+			})
+
+			It("saves schedules in the configured file", func() {
+				create()
+				saved, err := ioutil.ReadFile(filepath.Join(dir, "schedules.json"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(saved)).Should(ContainSubstring("nightly"))
+			})
+
+			It("changes and removes schedules", func() {
+				url := "/api/v1/schedules/" + create()["Id"].(string)
+
+				resp := httptest.NewRecorder()
+				req, _ := http.NewRequest("PUT", url, strings.NewReader(`{"Name": "hourly", "Cron": "@hourly", "Spec": {"workload": "dummy"}}`))
+				http.DefaultServeMux.ServeHTTP(resp, req)
+				Ω(resp.Code).Should(Equal(http.StatusOK))
+				Ω(get(url)["Cron"]).Should(Equal("@hourly"))
+
+				Ω(record("DELETE", url).Code).Should(Equal(http.StatusOK))
+				Ω(record("GET", url).Code).Should(Equal(http.StatusNotFound))
+				Ω(record("DELETE", url).Code).Should(Equal(http.StatusNotFound))
+			})
+
+			It("rejects schedules that are not valid with a 400", func() {
+				for _, body := range []string{
+					`{"Cron": "every night", "Spec": {"workload": "dummy"}}`,
+					`{"Cron": "@daily", "Spec": {"workload": "flibble"}}`,
+					`{"Cron": "@daily", "Spec": {"workload": "dummy", "rest:password": "secret"}}`,
+				} {
+					resp := postJSON("/api/v1/schedules", body)
+					Ω(resp.Code).Should(Equal(http.StatusBadRequest), body)
+					Ω(decode(resp.Body.Bytes())["Errors"]).Should(HaveLen(1), body)
+				}
+				Ω(get("/api/v1/schedules")["Items"]).Should(BeEmpty())
+			})
+		})
+
+		Describe("Cancelling an experiment", func() {
+			It("returns a 202 for a running experiment", func() {
+				lab.running = map[string]bool{"b": true}
+				resp := record("POST", "/api/v1/experiments/b/cancel")
+				Ω(resp.Code).Should(Equal(http.StatusAccepted))
+				Ω(lab.cancelled).Should(Equal([]string{"b"}))
+			})
+
+			It("returns a 409 for an experiment that has finished", func() {
+				resp := record("POST", "/api/v1/experiments/a/cancel")
+				Ω(resp.Code).Should(Equal(http.StatusConflict))
+			})
+
+			It("returns a 404 for an experiment that does not exist", func() {
+				resp := record("POST", "/api/v1/experiments/nope/cancel")
+				Ω(resp.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Describe("Deleting an experiment", func() {
+			It("returns the experiment it deleted", func() {
+				resp := record("DELETE", "/api/v1/experiments/c")
+				Ω(resp.Code).Should(Equal(http.StatusOK))
+				Ω(decode(resp.Body.Bytes())["Name"]).Should(Equal("ad hoc"))
+				Ω(lab.deleted).Should(Equal([]string{"c"}))
+			})
+
+			It("returns a 409 for an experiment that is running", func() {
+				lab.running = map[string]bool{"b": true}
+				resp := record("DELETE", "/api/v1/experiments/b")
+				Ω(resp.Code).Should(Equal(http.StatusConflict))
+				Ω(decode(resp.Body.Bytes())["Message"]).Should(ContainSubstring("has not finished"))
+			})
+
+			It("returns a 404 for an experiment that does not exist", func() {
+				Ω(record("DELETE", "/api/v1/experiments/nope").Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Describe("Comparing experiments", func() {
+			It("lines up their iterations on the time since each started", func() {
+				resp := record("GET", "/api/v1/compare?experiment=c&experiment=a&step=5")
+				Ω(resp.Code).Should(Equal(http.StatusOK))
+
+				comparison := decode(resp.Body.Bytes())
+				Ω(comparison["Step"]).Should(BeEquivalentTo(5 * time.Second))
+				Ω(comparison["Times"]).Should(Equal([]interface{}{float64(5 * time.Second), float64(10 * time.Second), float64(15 * time.Second)}))
+
+				experiments := comparison["Experiments"].([]interface{})
+				Ω(experiments).Should(HaveLen(2))
+				c := experiments[0].(map[string]interface{})
+				Ω(c["Guid"]).Should(Equal("c"))
+				Ω(c["Name"]).Should(Equal("ad hoc"))
+				points := c["Points"].([]interface{})
+				Ω(points).Should(HaveLen(3))
+				Ω(points[0]).Should(Equal(map[string]interface{}{"Count": 1.0, "Errors": 0.0, "Average": float64(2 * time.Second), "WorstResult": float64(2 * time.Second), "Throughput": 0.2}))
+				Ω(points[1].(map[string]interface{})["Errors"]).Should(BeEquivalentTo(1))
+				Ω(points[2].(map[string]interface{})["Count"]).Should(BeEquivalentTo(1))
+				Ω(c["Last"].(map[string]interface{})["Commands"]).Should(HaveKey("push"))
+			})
+
+			It("splits the longest experiment into steps of whole seconds when no step is given", func() {
+				comparison := get("/api/v1/compare?experiment=a&experiment=c")
+				Ω(comparison["Step"]).Should(BeEquivalentTo(time.Second))
+				Ω(comparison["Times"]).Should(HaveLen(12))
+			})
+
+			It("needs at least two experiments", func() {
+				Ω(record("GET", "/api/v1/compare?experiment=a").Code).Should(Equal(http.StatusBadRequest))
+			})
+
+			It("rejects a step longer than a day", func() {
+				Ω(record("GET", "/api/v1/compare?experiment=a&experiment=c&step=86400").Code).Should(Equal(http.StatusOK))
+				resp := record("GET", "/api/v1/compare?experiment=a&experiment=c&step=10000000000")
+				Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+				Ω(decode(resp.Body.Bytes())["Message"]).Should(ContainSubstring("86400"))
+			})
+
+			It("returns a 404 for an experiment that does not exist", func() {
+				Ω(record("GET", "/api/v1/compare?experiment=a&experiment=nope").Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Describe("Archives", func() {
+			It("exports the experiments that match the filter", func() {
+				resp := record("GET", "/api/v1/archive?tag=env=prod")
+				Ω(resp.Code).Should(Equal(http.StatusOK))
+				Ω(resp.Header().Get("Content-Disposition")).Should(ContainSubstring("attachment"))
+
+				uncompressed, err := gzip.NewReader(resp.Body)
+				Ω(err).ShouldNot(HaveOccurred())
+				decoder := json.NewDecoder(uncompressed)
+				var archived ArchivedExperiment
+				Ω(decoder.Decode(&archived)).Should(Succeed())
+				Ω(archived.Guid).Should(Equal("c"))
+				Ω(archived.Metadata.Name).Should(Equal("ad hoc"))
+				Ω(archived.Samples).Should(HaveLen(2))
+				Ω(decoder.Decode(&archived)).Should(Equal(io.EOF))
+			})
+
+			It("imports an archive", func() {
+				resp := postJSON("/api/v1/archive", "archive")
+				Ω(resp.Code).Should(Equal(http.StatusOK))
+				Ω(decode(resp.Body.Bytes())["Imported"]).Should(BeEquivalentTo(2))
+				Ω(string(lab.imported)).Should(Equal("archive"))
+			})
+
+			It("returns a 400 for a body that is not an archive", func() {
+				resp := postJSON("/api/v1/archive", "garbage")
+				Ω(resp.Code).Should(Equal(http.StatusBadRequest))
+				Ω(decode(resp.Body.Bytes())["Message"]).Should(ContainSubstring("not an archive"))
+			})
+		})
+
+		It("lists the workloads", func() {
+			Ω(get("/api/v1/workloads")["Items"]).ShouldNot(BeEmpty())
+		})
+
+		It("describes itself with OpenAPI", func() {
+			description := get("/api/v1/openapi.json")
+			Ω(description["openapi"]).Should(Equal("3.0.0"))
+			Ω(description["paths"]).Should(HaveKey("/experiments/{guid}/cancel"))
+		})
+	})
+
+	Describe("Authentication", func() {
+		var flags config.Config
+
+		BeforeEach(func() {
+			flags = config.NewConfig()
+			InitCommandLineFlags(flags)
+		})
+
+		AfterEach(func() {
+			InitCommandLineFlags(config.NewConfig())
+		})
+
+		It("lets everyone in when no users are configured", func() {
+			Ω(record("GET", "/experiments/").Code).Should(Equal(http.StatusOK))
+		})
+
+		Context("With basic auth users", func() {
+			BeforeEach(func() {
+				flags.Parse([]string{"-server:users", "reader:secret,admin:s3cret:operator"})
+			})
+
+			It("asks for credentials when there are none, or they are wrong", func() {
+				for _, user := range []string{"", "reader:wrong", "nobody:secret"} {
+					resp := recordAs("GET", "/experiments/", basic(user))
+					Ω(resp.Code).Should(Equal(http.StatusUnauthorized), user)
+					Ω(resp.Header().Get("WWW-Authenticate")).Should(ContainSubstring("Basic"))
+				}
+				Ω(recordAs("GET", "/ui/index.html", "").Code).Should(Equal(http.StatusUnauthorized))
+			})
+
+			It("lets prometheus scrape metrics without credentials", func() {
+				Ω(recordAs("GET", "/metrics", "").Code).Should(Equal(http.StatusOK))
+			})
+
+			It("lets readers look at experiments but not start or cancel them", func() {
+				Ω(recordAs("GET", "/experiments/", basic("reader:secret")).Code).Should(Equal(http.StatusOK))
+				Ω(recordAs("GET", "/api/v1/experiments/a", basic("reader:secret")).Code).Should(Equal(http.StatusOK))
+
+				lab.running = map[string]bool{"b": true}
+				Ω(recordAs("POST", "/experiments/?workload=dummy", basic("reader:secret")).Code).Should(Equal(http.StatusForbidden))
+				Ω(recordAs("POST", "/experiments/b/cancel", basic("reader:secret")).Code).Should(Equal(http.StatusForbidden))
+				Ω(lab.config).Should(BeNil())
+				Ω(lab.cancelled).Should(BeEmpty())
+			})
+
+			It("lets operators start experiments, and records who started them", func() {
+				resp := recordAs("POST", "/api/v1/experiments", basic("admin:s3cret"), `{"workload": "dummy"}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+				Ω(decode(resp.Body.Bytes())["StartedBy"]).Should(Equal("admin"))
+				Ω(lab.config.Metadata.StartedBy).Should(Equal("admin"))
+			})
+
+			It("refuses requests to the v1 API with an Error document", func() {
+				resp := recordAs("POST", "/api/v1/experiments", basic("reader:secret"), `{"workload": "dummy"}`)
+				Ω(resp.Code).Should(Equal(http.StatusForbidden))
+				Ω(decode(resp.Body.Bytes())["Message"]).Should(ContainSubstring("reader"))
+			})
+		})
+
+		Context("With a password that contains colons", func() {
+			BeforeEach(func() {
+				flags.Parse([]string{"-server:users", "admin:s3:cr:et:operator"})
+			})
+
+			It("takes the role from the end", func() {
+				resp := recordAs("POST", "/api/v1/experiments", basic("admin:s3:cr:et"), `{"workload": "dummy"}`)
+				Ω(resp.Code).Should(Equal(http.StatusCreated))
+			})
+		})
+
+		It("says which user is not valid", func() {
+			_, err := NewBasicAuthenticator("reader:secret,nopassword")
+			Ω(err).Should(MatchError(`user 2 ("nopassword") should be name:password or name:password:role`))
+
+			_, err = NewBasicAuthenticator("reader:secret,admin:pass:word")
+			Ω(err).Should(MatchError(`user 2 ("admin") has an unknown role "word", it should be read or operator`))
+		})
+
+		Context("With a UAA", func() {
+			var uaa *httptest.Server
+
+			BeforeEach(func() {
+				uaa = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					client, secret, _ := r.BasicAuth()
+					if r.URL.Path != "/check_token" || client != "pat" || secret != "client-secret" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+
+					switch r.FormValue("token") {
+					case "operator-token":
+						fmt.Fprint(w, `{"user_name": "operator", "scope": ["openid", "pat.operator"]}`)
+					case "reader-token":
+						fmt.Fprint(w, `{"client_id": "dashboard", "scope": ["pat.read"]}`)
+					case "other-token":
+						fmt.Fprint(w, `{"user_name": "other", "scope": ["openid"]}`)
+					default:
+						w.WriteHeader(http.StatusBadRequest)
+						fmt.Fprint(w, `{"error": "invalid_token"}`)
+					}
+				}))
+				flags.Parse([]string{"-server:uaa", uaa.URL, "-server:uaa:secret", "client-secret"})
+			})
+
+			AfterEach(func() {
+				uaa.Close()
+			})
+
+			It("checks bearer tokens with the UAA", func() {
+				resp := recordAs("GET", "/experiments/", "Bearer expired-token")
+				Ω(resp.Code).Should(Equal(http.StatusUnauthorized))
+				Ω(resp.Header().Get("WWW-Authenticate")).Should(ContainSubstring("Bearer"))
+
+				Ω(recordAs("GET", "/experiments/", "Bearer reader-token").Code).Should(Equal(http.StatusOK))
+				Ω(recordAs("GET", "/experiments/", "Bearer other-token").Code).Should(Equal(http.StatusForbidden))
+			})
+
+			It("gives the role of the scopes of the token", func() {
+				Ω(recordAs("POST", "/api/v1/experiments", "Bearer reader-token", `{"workload": "dummy"}`).Code).Should(Equal(http.StatusForbidden))
+				Ω(recordAs("POST", "/api/v1/experiments", "Bearer operator-token", `{"workload": "dummy"}`).Code).Should(Equal(http.StatusCreated))
+				Ω(lab.config.Metadata.StartedBy).Should(Equal("operator"))
+			})
+		})
+	})
 })
 
 type DummyLab struct {
 	experiments []*DummyExperiment
 	config      *RunnableExperiment
+	running     map[string]bool
+	queue       []string
+	cancelled   []string
+	deleted     []string
+	retention   Retention
+	imported    []byte
+	queried     Filter
+	queries     int
 }
 
 type DummyExperiment struct {
@@ -213,33 +998,159 @@ type DummyExperiment struct {
 }
 
 func (l *DummyLab) RunWithHandlers(ex Runnable, fns []func(<-chan *Sample), workloadCtx context.Context) (string, error) {
-	Fail("called unexpected dummy function")
-	return "", nil
-}
-
-func (l *DummyLab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
 	l.config = ex.(*RunnableExperiment)
 	workloadContext = workloadCtx
 	return "some-guid", nil
 }
 
+func (l *DummyLab) Run(ex Runnable, workloadCtx context.Context) (string, error) {
+	return l.RunWithHandlers(ex, nil, workloadCtx)
+}
+
 func (l *DummyLab) Visit(fn func(ex Experiment)) {
 	for _, e := range l.experiments {
 		fn(e)
 	}
 }
 
+func (l *DummyLab) Query(filter Filter) ([]Experiment, error) {
+	l.queried = filter
+	l.queries++
+	matching := make([]Experiment, 0)
+	for _, e := range l.experiments {
+		if filter.Matches(e) {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
+func (l *DummyLab) Find(name string) (Experiment, error) {
+	for _, e := range l.experiments {
+		if e.GetGuid() == name {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
 func (l *DummyLab) GetData(name string) ([]*Sample, error) {
 	if name == "a" {
 		return []*Sample{&Sample{}, &Sample{}, &Sample{}}, nil
 	}
+	if name == "c" {
+		return []*Sample{
+			&Sample{Type: WorkerSample, TotalWorkers: 1},
+			&Sample{Type: ResultSample, WallTime: 4 * time.Second, LastResult: 2 * time.Second},
+			&Sample{Type: ResultSample, WallTime: 10 * time.Second, LastResult: 4 * time.Second, TotalErrors: 1},
+			&Sample{Type: ResultSample, WallTime: 12 * time.Second, LastResult: 3 * time.Second, TotalErrors: 1,
+				Commands: map[string]Command{"push": Command{Count: 3, Average: 2 * time.Second}}},
+		}, nil
+	}
 	return nil, nil
 }
 
+func (l *DummyLab) Running(name string) bool {
+	return l.running[name]
+}
+
+func (l *DummyLab) Queue() []string {
+	return l.queue
+}
+
+func (l *DummyLab) Cancel(name string) error {
+	for i, queued := range l.queue {
+		if queued == name {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			l.cancelled = append(l.cancelled, name)
+			return nil
+		}
+	}
+	if !l.running[name] {
+		return ErrNotRunning
+	}
+	l.cancelled = append(l.cancelled, name)
+	return nil
+}
+
+func (l *DummyLab) Delete(name string) error {
+	if l.running[name] {
+		return ErrRunning
+	}
+	for _, queued := range l.queue {
+		if queued == name {
+			return ErrRunning
+		}
+	}
+
+	for i, e := range l.experiments {
+		if e.guid == name {
+			l.experiments = append(l.experiments[:i], l.experiments[i+1:]...)
+			l.deleted = append(l.deleted, name)
+		}
+	}
+	return nil
+}
+
+func (l *DummyLab) Prune(retention Retention) ([]string, error) {
+	l.retention = retention
+	return []string{}, nil
+}
+
+func (l *DummyLab) Import(archive io.Reader) (int, error) {
+	var err error
+	if l.imported, err = ioutil.ReadAll(archive); err != nil {
+		return 0, err
+	}
+	if string(l.imported) == "garbage" {
+		return 0, &ArchiveError{"not an archive: gzip: invalid header"}
+	}
+	return 2, nil
+}
+
+// loads counts how often all the samples of an experiment were read.
+var loads int
+
 func (e *DummyExperiment) GetData() ([]*Sample, error) {
+	loads++
+	return e.samples()
+}
+
+func (e *DummyExperiment) GetLastSample() (*Sample, error) {
+	samples, err := e.samples()
+	if err != nil || len(samples) == 0 {
+		return nil, err
+	}
+	return samples[len(samples)-1], nil
+}
+
+func (e *DummyExperiment) samples() ([]*Sample, error) {
+	if e.guid == "c" {
+		return []*Sample{&Sample{Type: ResultSample, SystemTime: "2014-06-10T10:00:00Z"}, &Sample{Type: CancelledSample}}, nil
+	}
+	if e.guid == "a" {
+		return []*Sample{&Sample{Type: ResultSample, SystemTime: "2014-05-01T10:00:00Z"}}, nil
+	}
 	return nil, nil
 }
 
+func (e *DummyExperiment) GetEvents() ([]*Event, error) {
+	if e.guid == "a" {
+		return []*Event{&Event{Iteration: 1, Duration: 3 * time.Second, Steps: []StepResult{{"login", time.Second}, {"push", 2 * time.Second}}}}, nil
+	}
+	return nil, nil
+}
+
+func (e *DummyExperiment) GetMetadata() (Metadata, error) {
+	if e.guid == "a" {
+		return Metadata{Name: "Nightly push", StartedBy: "someone", Tags: map[string]string{"env": "staging"}}, nil
+	}
+	if e.guid == "c" {
+		return Metadata{Name: "ad hoc", Description: "trying a 50% ramp", Tags: map[string]string{"env": "prod", "team": "runtime"}, Workload: "gcf:push"}, nil
+	}
+	return Metadata{}, nil
+}
+
 func (e *DummyExperiment) GetGuid() string {
 	return e.guid
 }
@@ -258,13 +1169,7 @@ func decode(encoded []byte) (decoded map[string]interface{}) {
 }
 
 func req(method string, url string) []byte {
-	resp := httptest.NewRecorder()
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		Ω(err).NotTo(HaveOccurred())
-	}
-
-	http.DefaultServeMux.ServeHTTP(resp, req)
+	resp := record(method, url)
 	if body, err := ioutil.ReadAll(resp.Body); err != nil {
 		Ω(err).NotTo(HaveOccurred())
 		return nil
@@ -277,3 +1182,48 @@ func workloadCtxStringValue(key string) string {
 	str, _ := workloadContext.GetString(key)
 	return str
 }
+
+func record(method string, url string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		Ω(err).NotTo(HaveOccurred())
+	}
+
+	http.DefaultServeMux.ServeHTTP(resp, req)
+	return resp
+}
+
+func postJSON(url string, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	Ω(err).NotTo(HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+
+	http.DefaultServeMux.ServeHTTP(resp, req)
+	return resp
+}
+
+// recordAs sends a request with the given Authorization header, and a JSON
+// body if there is one.
+func recordAs(method string, url string, authorization string, body ...string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, strings.NewReader(strings.Join(body, "")))
+	Ω(err).NotTo(HaveOccurred())
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	http.DefaultServeMux.ServeHTTP(resp, req)
+	return resp
+}
+
+func basic(credentials string) string {
+	if credentials == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/gorilla/mux"
+)
+
+// StreamBuffer is how many samples a client may fall behind by before its
+// stream is closed, it replays from the store when it reconnects.
+var StreamBuffer = 1000
+
+// Streams pushes the samples of running experiments to the clients that are
+// watching them as they arrive. Only the last sample of each experiment is
+// kept, clients replay the rest from the laboratory.
+type Streams struct {
+	sync.Mutex
+	running map[string]*stream
+}
+
+type stream struct {
+	sync.Mutex
+	last        *Sample
+	subscribers map[*subscriber]bool
+	done        bool
+}
+
+// subscriber is a client watching a stream, it is dropped when it falls
+// behind.
+type subscriber struct {
+	samples chan *Sample
+	dropped bool
+}
+
+var Live = NewStreams()
+
+func NewStreams() *Streams {
+	return &Streams{running: make(map[string]*stream)}
+}
+
+// Handler has the signature of a laboratory.HandlerFactory.
+func (s *Streams) Handler(guid string, ex Runnable) func(<-chan *Sample) {
+	st := newStream()
+	s.Lock()
+	s.running[guid] = st
+	s.Unlock()
+
+	return func(samples <-chan *Sample) {
+		for sample := range samples {
+			st.add(sample)
+		}
+		st.finish()
+
+		s.Lock()
+		delete(s.running, guid)
+		s.Unlock()
+	}
+}
+
+func (s *Streams) get(guid string) (*stream, bool) {
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.running[guid]
+	return st, ok
+}
+
+func newStream() *stream {
+	return &stream{subscribers: make(map[*subscriber]bool)}
+}
+
+// add passes a sample on to every subscriber, those that have fallen behind
+// by StreamBuffer samples are dropped.
+func (st *stream) add(sample *Sample) {
+	st.Lock()
+	defer st.Unlock()
+	st.last = sample
+	for sub := range st.subscribers {
+		select {
+		case sub.samples <- sample:
+		default:
+			sub.dropped = true
+			delete(st.subscribers, sub)
+			close(sub.samples)
+		}
+	}
+}
+
+func (st *stream) finish() {
+	st.Lock()
+	defer st.Unlock()
+	st.done = true
+	for sub := range st.subscribers {
+		close(sub.samples)
+	}
+	st.subscribers = make(map[*subscriber]bool)
+}
+
+// subscribe returns a subscriber to the samples that arrive from now on,
+// whose channel is closed once the experiment finishes, and the last sample
+// before them. The store may not have written that one yet.
+func (st *stream) subscribe() (*subscriber, *Sample) {
+	st.Lock()
+	defer st.Unlock()
+	sub := &subscriber{samples: make(chan *Sample, StreamBuffer)}
+	if st.done {
+		close(sub.samples)
+	} else {
+		st.subscribers[sub] = true
+	}
+	return sub, st.last
+}
+
+func (st *stream) unsubscribe(sub *subscriber) {
+	st.Lock()
+	defer st.Unlock()
+	if st.subscribers[sub] {
+		delete(st.subscribers, sub)
+		close(sub.samples)
+	}
+}
+
+// wasDropped is true when the channel of a subscriber was closed because it
+// fell behind, rather than because the experiment finished.
+func (st *stream) wasDropped(sub *subscriber) bool {
+	st.Lock()
+	defer st.Unlock()
+	return sub.dropped
+}
+
+func (ctx *serverContext) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	st, live := Live.get(name)
+	if !live {
+		if _, err := ctx.find(name); err != nil {
+			e := err.(*Error)
+			http.Error(w, e.Message, e.Status)
+			return
+		}
+	}
+
+	// subscribe before reading the store so that no sample falls in between
+	var sub *subscriber
+	var updates chan *Sample
+	var last *Sample
+	if live {
+		sub, last = st.subscribe()
+		defer st.unsubscribe(sub)
+		updates = sub.samples
+	}
+
+	replayed, err := ctx.samples(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var gone <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		gone = notifier.CloseNotify()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(sample *Sample) {
+		encoded, _ := json.Marshal(&sampleDocument{sample, sample.Event})
+		fmt.Fprintf(w, "event: sample\ndata: %s\n\n", encoded)
+	}
+
+	// samples carry the time since the experiment started, live ones that
+	// were already replayed from the store are skipped
+	var sent *Sample
+	for _, sample := range replayed {
+		write(sample)
+		sent = sample
+	}
+	send := func(sample *Sample) {
+		if sent == nil || sample.WallTime > sent.WallTime {
+			write(sample)
+			sent = sample
+		}
+	}
+
+	if last != nil {
+		send(last)
+	}
+	flusher.Flush()
+
+	for updates != nil {
+		select {
+		case sample, ok := <-updates:
+			if !ok {
+				if st.wasDropped(sub) {
+					// the client reconnects and replays from the store
+					return
+				}
+				updates = nil
+				break
+			}
+			send(sample)
+			flusher.Flush()
+		case <-gone:
+			return
+		}
+	}
+
+	fmt.Fprint(w, "event: end\ndata: {}\n\n")
+	flusher.Flush()
+}
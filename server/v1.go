@@ -0,0 +1,283 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/pat/api"
+	. "github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+	"github.com/gorilla/mux"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Error is the body of every response of the v1 API that is not a success.
+// Errors lists the fields in error when a specification is not valid.
+type Error struct {
+	Status  int
+	Message string
+	Errors  []api.FieldError `json:",omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(status int, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// ExperimentDocument describes an experiment. Position is its place in the
+// queue while it is Queued.
+type ExperimentDocument struct {
+	Guid        string
+	Name        string            `json:",omitempty"`
+	Description string            `json:",omitempty"`
+	Tags        map[string]string `json:",omitempty"`
+	State       string
+	Position    int    `json:",omitempty"`
+	StartedBy   string `json:",omitempty"`
+	Links       map[string]string
+}
+
+type Page struct {
+	Items  interface{}
+	Offset int
+	Limit  int
+	Total  int
+	Links  map[string]string
+}
+
+func (ctx *serverContext) routeV1(r *mux.Router) {
+	r.Methods("GET").Path("/api/v1/experiments").HandlerFunc(v1(ctx.handleListExperimentsV1)).Name("v1.experiments")
+	r.Methods("POST").Path("/api/v1/experiments").HandlerFunc(v1(ctx.handleCreateExperimentV1))
+	r.Methods("GET").Path("/api/v1/experiments/{name}").HandlerFunc(v1(ctx.handleGetExperimentV1)).Name("v1.experiment")
+	r.Methods("GET").Path("/api/v1/experiments/{name}/samples").HandlerFunc(v1(ctx.handleGetSamplesV1)).Name("v1.samples")
+	r.Methods("DELETE").Path("/api/v1/experiments/{name}").HandlerFunc(v1(ctx.handleDeleteExperimentV1))
+	r.Methods("POST").Path("/api/v1/experiments/{name}/cancel").HandlerFunc(v1(ctx.handleCancelExperimentV1)).Name("v1.cancel")
+	r.Methods("GET").Path("/api/v1/compare").HandlerFunc(v1(ctx.handleCompareV1)).Name("v1.compare")
+	r.Methods("GET").Path("/api/v1/archive").HandlerFunc(ctx.handleExportV1).Name("v1.archive")
+	r.Methods("POST").Path("/api/v1/archive").HandlerFunc(v1(ctx.handleImportV1))
+	r.Methods("GET").Path("/api/v1/schedules").HandlerFunc(v1(ctx.handleListSchedulesV1)).Name("v1.schedules")
+	r.Methods("POST").Path("/api/v1/schedules").HandlerFunc(v1(ctx.handleCreateScheduleV1))
+	r.Methods("GET").Path("/api/v1/schedules/{id}").HandlerFunc(v1(ctx.handleGetScheduleV1)).Name("v1.schedule")
+	r.Methods("PUT").Path("/api/v1/schedules/{id}").HandlerFunc(v1(ctx.handleUpdateScheduleV1))
+	r.Methods("DELETE").Path("/api/v1/schedules/{id}").HandlerFunc(v1(ctx.handleDeleteScheduleV1))
+	r.Methods("GET").Path("/api/v1/workloads").HandlerFunc(v1(handleListWorkloadsV1))
+	r.Methods("GET").Path("/api/v1/openapi.json").HandlerFunc(serveOpenAPI)
+}
+
+// v1 writes the body a handler returns as JSON with the given status, and
+// errors as an Error document.
+func v1(fn func(w http.ResponseWriter, r *http.Request) (int, interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, body, err := fn(w, r)
+		if err != nil {
+			switch e := err.(type) {
+			case *Error:
+				body, status = e, e.Status
+			case *api.ValidationError:
+				body, status = &Error{http.StatusBadRequest, "the experiment specification is not valid", e.Errors}, http.StatusBadRequest
+			default:
+				body, status = newError(http.StatusInternalServerError, "%s", err.Error()), http.StatusInternalServerError
+			}
+		}
+
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			status = http.StatusInternalServerError
+			encoded, _ = json.Marshal(newError(status, "%s", err.Error()))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(encoded)
+	}
+}
+
+func (ctx *serverContext) handleListExperimentsV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	limit, err := queryInt(r, "limit", DefaultPageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	if limit < 1 || limit > MaxPageSize {
+		return 0, nil, newError(http.StatusBadRequest, "limit must be between 1 and %d", MaxPageSize)
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	all, err := ctx.list(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// newest first
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+
+	items := make([]*ExperimentDocument, 0)
+	for i := offset; i < len(all) && i < offset+limit; i++ {
+		items = append(items, ctx.describe(all[i]))
+	}
+
+	page := &Page{Items: items, Offset: offset, Limit: limit, Total: len(all), Links: make(map[string]string)}
+	// links keep the filter of the request
+	list, _ := ctx.router.Get("v1.experiments").URL()
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Del("limit")
+	prefix := list.String() + "?"
+	if len(query) > 0 {
+		prefix = prefix + query.Encode() + "&"
+	}
+	if offset+limit < len(all) {
+		page.Links["next"] = fmt.Sprintf("%soffset=%d&limit=%d", prefix, offset+limit, limit)
+	}
+	if offset > 0 {
+		previous := offset - limit
+		if previous < 0 {
+			previous = 0
+		}
+		page.Links["previous"] = fmt.Sprintf("%soffset=%d&limit=%d", prefix, previous, limit)
+	}
+	return http.StatusOK, page, nil
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, newError(http.StatusBadRequest, "%s must be a number that is not negative", name)
+	}
+	return v, nil
+}
+
+func (ctx *serverContext) handleCreateExperimentV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	spec := api.DefaultSpec()
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		return 0, nil, newError(http.StatusBadRequest, "the body is not a valid experiment specification: %s", err.Error())
+	}
+
+	startedBy := ctx.user(r)
+	guid, err := ctx.start(spec, startedBy)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	document := ctx.document(guid, "Running")
+	if document.Position = ctx.position(guid); document.Position > 0 {
+		document.State = "Queued"
+	}
+	document.Name, document.Description, document.Tags = spec.Name, spec.Description, spec.Tags
+	document.StartedBy = startedBy
+	w.Header().Set("Location", document.Links["self"])
+	return http.StatusCreated, document, nil
+}
+
+func (ctx *serverContext) handleGetExperimentV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	name := mux.Vars(r)["name"]
+	e, err := ctx.find(name)
+	if err != nil {
+		if ctx.lab.Running(name) {
+			return http.StatusOK, ctx.document(name, "Running"), nil
+		}
+		return 0, nil, err
+	}
+	return http.StatusOK, ctx.describe(e), nil
+}
+
+func (ctx *serverContext) handleGetSamplesV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	name := mux.Vars(r)["name"]
+	if !ctx.lab.Running(name) {
+		if _, err := ctx.find(name); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	data, err := ctx.samples(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &listResponse{documents(data)}, nil
+}
+
+func (ctx *serverContext) handleCancelExperimentV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	name := mux.Vars(r)["name"]
+	state := "Running"
+	if ctx.position(name) > 0 {
+		state = "Cancelled"
+	}
+
+	switch err := ctx.lab.Cancel(name); err {
+	case nil:
+		return http.StatusAccepted, ctx.document(name, state), nil
+	case ErrNotRunning:
+		if _, err := ctx.find(name); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, newError(http.StatusConflict, "experiment %s is not running", name)
+	default:
+		return 0, nil, err
+	}
+}
+
+func handleListWorkloadsV1(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	steps := make([]map[string]string, 0)
+	for _, step := range workloads.Registered().Workloads {
+		steps = append(steps, map[string]string{"Name": step.Name, "Description": step.Description})
+	}
+	return http.StatusOK, &listResponse{steps}, nil
+}
+
+// find returns the experiment with the given guid, including queued
+// experiments the store does not know yet, or a 404 Error.
+func (ctx *serverContext) find(name string) (Experiment, error) {
+	e, err := ctx.lab.Find(name)
+	if err != nil {
+		return nil, newError(http.StatusInternalServerError, "%s", err.Error())
+	}
+	if e != nil {
+		return e, nil
+	}
+	if ctx.position(name) > 0 {
+		return queuedExperiment(name), nil
+	}
+	return nil, newError(http.StatusNotFound, "experiment %s does not exist", name)
+}
+
+func (ctx *serverContext) describe(e Experiment) *ExperimentDocument {
+	document := ctx.document(e.GetGuid(), ctx.state(e))
+	m := metadata(e)
+	document.Name, document.Description, document.Tags = m.Name, m.Description, m.Tags
+	document.Position = ctx.position(e.GetGuid())
+	document.StartedBy = m.StartedBy
+	return document
+}
+
+func (ctx *serverContext) document(guid string, state string) *ExperimentDocument {
+	links := make(map[string]string)
+	for rel, route := range map[string]string{"self": "v1.experiment", "samples": "v1.samples", "cancel": "v1.cancel", "csv": "csv", "stream": "stream"} {
+		if u, err := ctx.router.Get(route).URL("name", guid); err == nil {
+			links[rel] = u.String()
+		}
+	}
+	return &ExperimentDocument{Guid: guid, State: state, Links: links}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+)
+
+// CompositeStore writes every experiment to all of its stores, and loads
+// each experiment once, from the first store that has it.
+type CompositeStore struct {
+	stores []laboratory.Store
+}
+
+func NewCompositeStore(stores ...laboratory.Store) *CompositeStore {
+	return &CompositeStore{stores}
+}
+
+func (c *CompositeStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
+	writers := make([]func(<-chan *experiment.Sample), len(c.stores))
+	for i, s := range c.stores {
+		writers[i] = s.Writer(guid)
+	}
+
+	return func(samples <-chan *experiment.Sample) {
+		var wg sync.WaitGroup
+		channels := make([]chan *experiment.Sample, len(writers))
+		for i, w := range writers {
+			channels[i] = make(chan *experiment.Sample)
+			wg.Add(1)
+			go func(w func(<-chan *experiment.Sample), ch <-chan *experiment.Sample) {
+				defer wg.Done()
+				w(ch)
+			}(w, channels[i])
+		}
+
+		for s := range samples {
+			for _, ch := range channels {
+				ch <- s
+			}
+		}
+
+		for _, ch := range channels {
+			close(ch)
+		}
+		wg.Wait()
+	}
+}
+
+func (c *CompositeStore) LoadAll() ([]experiment.Experiment, error) {
+	seen := make(map[string]bool)
+	merged := make([]experiment.Experiment, 0)
+	for _, s := range c.stores {
+		loaded, err := s.LoadAll()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range loaded {
+			if !seen[e.GetGuid()] {
+				seen[e.GetGuid()] = true
+				merged = append(merged, e)
+			}
+		}
+	}
+	return merged, nil
+}
+
+// Find looks for the experiment in each store in turn, loading the stores
+// that can't look one up.
+func (c *CompositeStore) Find(guid string) (experiment.Experiment, error) {
+	for _, s := range c.stores {
+		if finder, ok := s.(laboratory.FindStore); ok {
+			found, err := finder.Find(guid)
+			if found != nil || err != nil {
+				return found, err
+			}
+			continue
+		}
+
+		loaded, err := s.LoadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range loaded {
+			if e.GetGuid() == guid {
+				return e, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Configure passes the configuration on to the stores that record it.
+func (c *CompositeStore) Configure(guid string, config experiment.ExperimentConfiguration) error {
+	for _, s := range c.stores {
+		if configured, ok := s.(laboratory.ConfigurationStore); ok {
+			if err := configured.Configure(guid, config); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Describe passes the metadata on to the stores that record it.
+func (c *CompositeStore) Describe(guid string, metadata experiment.Metadata) error {
+	for _, s := range c.stores {
+		if described, ok := s.(laboratory.MetadataStore); ok {
+			if err := described.Describe(guid, metadata); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes the experiment from every store.
+func (c *CompositeStore) Delete(guid string) error {
+	for _, s := range c.stores {
+		if err := s.Delete(guid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
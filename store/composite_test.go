@@ -0,0 +1,127 @@
+package store_test
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CompositeStore", func() {
+	var (
+		first    *memoryStore
+		second   *memoryStore
+		store    *CompositeStore
+		samples  chan *experiment.Sample
+		finished chan bool
+	)
+
+	BeforeEach(func() {
+		first = &memoryStore{written: make(map[string][]*experiment.Sample)}
+		second = &memoryStore{written: make(map[string][]*experiment.Sample)}
+		store = NewCompositeStore(first, second)
+		samples = make(chan *experiment.Sample)
+		finished = make(chan bool)
+	})
+
+	It("writes every sample to all of the stores and returns once they have finished", func() {
+		go func() {
+			store.Writer("abc")(samples)
+			finished <- true
+		}()
+
+		samples <- &experiment.Sample{Total: 1}
+		samples <- &experiment.Sample{Total: 2}
+		close(samples)
+		<-finished
+
+		Ω(first.samples("abc")).Should(HaveLen(2))
+		Ω(second.samples("abc")).Should(HaveLen(2))
+	})
+
+	It("merges the experiments of all of the stores without duplicates", func() {
+		first.loaded = []experiment.Experiment{&memoryExperiment{"a", "first"}, &memoryExperiment{"b", "first"}}
+		second.loaded = []experiment.Experiment{&memoryExperiment{"b", "second"}, &memoryExperiment{"c", "second"}}
+
+		loaded, err := store.LoadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(loaded).Should(Equal([]experiment.Experiment{
+			&memoryExperiment{"a", "first"},
+			&memoryExperiment{"b", "first"},
+			&memoryExperiment{"c", "second"},
+		}))
+	})
+
+	It("finds an experiment in the first store that has it", func() {
+		first.loaded = []experiment.Experiment{&memoryExperiment{"a", "first"}}
+		second.loaded = []experiment.Experiment{&memoryExperiment{"a", "second"}, &memoryExperiment{"b", "second"}}
+
+		Ω(store.Find("a")).Should(Equal(&memoryExperiment{"a", "first"}))
+		Ω(store.Find("b")).Should(Equal(&memoryExperiment{"b", "second"}))
+		Ω(store.Find("c")).Should(BeNil())
+	})
+
+	It("deletes an experiment from every store", func() {
+		first.written["abc"] = []*experiment.Sample{&experiment.Sample{}}
+		second.written["abc"] = []*experiment.Sample{&experiment.Sample{}}
+		Ω(store.Delete("abc")).Should(Succeed())
+		Ω(first.samples("abc")).Should(BeEmpty())
+		Ω(second.samples("abc")).Should(BeEmpty())
+	})
+
+	It("returns an error if a store can't be loaded", func() {
+		second.err = errors.New("unavailable")
+		_, err := store.LoadAll()
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+type memoryStore struct {
+	sync.Mutex
+	written map[string][]*experiment.Sample
+	loaded  []experiment.Experiment
+	err     error
+}
+
+func (m *memoryStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
+	return func(samples <-chan *experiment.Sample) {
+		for s := range samples {
+			m.Lock()
+			m.written[guid] = append(m.written[guid], s)
+			m.Unlock()
+		}
+	}
+}
+
+func (m *memoryStore) LoadAll() ([]experiment.Experiment, error) {
+	return m.loaded, m.err
+}
+
+func (m *memoryStore) Delete(guid string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.written, guid)
+	return m.err
+}
+
+func (m *memoryStore) samples(guid string) []*experiment.Sample {
+	m.Lock()
+	defer m.Unlock()
+	return m.written[guid]
+}
+
+type memoryExperiment struct {
+	guid string
+	from string
+}
+
+func (e *memoryExperiment) GetGuid() string {
+	return e.guid
+}
+
+func (e *memoryExperiment) GetData() ([]*experiment.Sample, error) {
+	return nil, nil
+}
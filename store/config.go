@@ -1,36 +1,122 @@
 package store
 
 import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/logs"
 	"github.com/cloudfoundry-incubator/pat/redis"
 	"github.com/cloudfoundry-incubator/pat/workloads"
 )
 
 var params = struct {
-	csvDir   string
-	useRedis bool
+	csvDir       string
+	stores       string
+	useRedis     bool
+	maxResults   int
+	ttl          int
+	sqliteImport string
+	statsd       string
+	graphite     string
+	influxdb     string
+	sinkPrefix   string
+	sinkTags     string
+	keep         int
+	keepDays     int
 }{}
 
 func DescribeParameters(config config.Config) {
 	config.StringVar(&params.csvDir, "csv-dir", "output/csvs", "Directory to Store CSVs")
-	config.BoolVar(&params.useRedis, "use-redis-store", false, "True if redis should be used (requires the -redis-host, -redis-port and -redis-password arguments)")
+	config.StringVar(&params.statsd, "statsd", "", "comma-separated statsd addresses to send every sample to, e.g. udp://localhost:8125")
+	config.StringVar(&params.graphite, "graphite", "", "comma-separated graphite plaintext addresses to send every sample to, e.g. tcp://localhost:2003")
+	config.StringVar(&params.influxdb, "influxdb", "", "comma-separated influxdb line protocol addresses to send every sample to, e.g. udp://localhost:8089")
+	config.StringVar(&params.sinkPrefix, "sink:prefix", "pat", "prefix of the metric names sent to statsd, graphite and influxdb")
+	config.StringVar(&params.sinkTags, "sink:tags", "", "comma-separated key=value tags added to the metrics sent to statsd, graphite and influxdb")
+	config.StringVar(&params.stores, "store", "", "comma-separated list of stores to write results to: csv (in -csv-dir), csv:<dir>, sqlite, sqlite:<file> or redis; experiments are loaded from the first store that has them (default csv)")
+	config.BoolVar(&params.useRedis, "use-redis-store", false, "deprecated, same as -store=redis (requires the -redis-host, -redis-port and -redis-password arguments)")
+	config.IntVar(&params.maxResults, "redis-store:max-results", MAX_RESULTS, "maximum number of experiments, and of samples per experiment, loaded from redis")
+	config.IntVar(&params.ttl, "redis-store:ttl", 0, "seconds to keep an experiment's samples in redis after its last sample, 0 to keep them forever")
+	config.StringVar(&params.sqliteImport, "sqlite-store:import", "", "a CSV output directory to import into the sqlite store before starting")
+	config.IntVar(&params.keep, "retention:keep", 0, "number of finished experiments to keep, older ones are deleted when pat starts (and hourly by the server); 0 keeps them all")
+	config.IntVar(&params.keepDays, "retention:days", 0, "days to keep finished experiments for, older ones are deleted when pat starts (and hourly by the server); 0 keeps them forever")
 	redis.DescribeParameters(config)
 }
 
+// Retention is the retention policy given on the command line.
+func Retention() laboratory.Retention {
+	return laboratory.Retention{Keep: params.keep, MaxAge: time.Duration(params.keepDays) * 24 * time.Hour}
+}
+
 func WithStore(fn func(store laboratory.Store) error) error {
-	if params.useRedis {
-		return WithRedisConnection(func(conn redis.Conn) error {
+	specs := storeSpecs()
+	for _, spec := range specs {
+		if spec == "redis" {
+			return WithRedisConnection(func(conn redis.Conn) error {
+				return withStores(specs, conn, fn)
+			})
+		}
+	}
+
+	return withStores(specs, nil, fn)
+}
+
+func storeSpecs() []string {
+	specs := make([]string, 0)
+	for _, spec := range strings.Split(params.stores, ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			specs = append(specs, spec)
+		}
+	}
+
+	if len(specs) == 0 && params.useRedis {
+		specs = append(specs, "redis")
+	} else if len(specs) == 0 {
+		specs = append(specs, "csv")
+	}
+	return specs
+}
+
+func withStores(specs []string, conn redis.Conn, fn func(store laboratory.Store) error) error {
+	stores := make([]laboratory.Store, 0, len(specs))
+	for _, spec := range specs {
+		switch {
+		case spec == "csv":
+			stores = append(stores, CsvStoreFactory(params.csvDir))
+		case strings.HasPrefix(spec, "csv:"):
+			stores = append(stores, CsvStoreFactory(strings.TrimPrefix(spec, "csv:")))
+		case spec == "sqlite" || strings.HasPrefix(spec, "sqlite:"):
+			path := strings.TrimPrefix(strings.TrimPrefix(spec, "sqlite"), ":")
+			if path == "" {
+				path = DefaultSqlitePath
+			}
+			store, err := SqliteStoreFactory(path)
+			if err != nil {
+				return err
+			}
+			// Close waits for the writers of experiments that are still running
+			if closer, ok := store.(io.Closer); ok {
+				defer closer.Close()
+			}
+			stores = append(stores, store)
+		case spec == "redis":
 			store, err := RedisStoreFactory(conn)
 			if err != nil {
 				return err
 			}
+			stores = append(stores, store)
+		default:
+			return fmt.Errorf("unknown store %s, expected csv, csv:<dir>, sqlite, sqlite:<file> or redis", spec)
+		}
+	}
 
-			return fn(store)
-		})
-	} else {
-		return fn(CsvStoreFactory(params.csvDir))
+	if len(stores) == 1 {
+		return fn(stores[0])
 	}
+	return fn(NewCompositeStore(stores...))
 }
 
 var WithRedisConnection = func(fn func(conn redis.Conn) error) error {
@@ -41,6 +127,22 @@ var RedisStoreFactory = func(conn redis.Conn) (laboratory.Store, error) {
 	return NewRedisStore(conn)
 }
 
+var SqliteStoreFactory = func(path string) (laboratory.Store, error) {
+	store, err := NewSqliteStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.sqliteImport != "" {
+		imported, err := store.Import(params.sqliteImport)
+		if err != nil {
+			return nil, err
+		}
+		logs.NewLogger("store.sqlite").Infof("Imported %d experiments from %s", imported, params.sqliteImport)
+	}
+	return store, nil
+}
+
 var CsvStoreFactory = func(dir string) laboratory.Store {
-	return NewCsvStore(dir, workloads.DefaultWorkloadList())
+	return NewCsvStore(dir, workloads.Registered())
 }
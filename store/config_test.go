@@ -1,6 +1,8 @@
 package store_test
 
 import (
+	"time"
+
 	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/laboratory"
 	"github.com/cloudfoundry-incubator/pat/redis"
@@ -80,6 +82,94 @@ var _ = Describe("Config.WithStore", func() {
 			Ω(redisConn).Should(Equal(connFromFactory))
 		})
 	})
+
+	Context("When a list of stores is given", func() {
+		BeforeEach(func() {
+			args = []string{"-store", "csv:foo/bar, redis"}
+		})
+
+		It("writes to a composite of the stores", func() {
+			var s laboratory.Store = nil
+			err := WithStore(func(store laboratory.Store) error {
+				s = store
+				return nil
+			})
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(s).Should(Equal(NewCompositeStore(csvStore, redisStore)))
+			Ω(csvStoreDir).Should(Equal("foo/bar"))
+			Ω(redisConn).Should(Equal(connFromFactory))
+		})
+	})
+
+	Context("When -store is csv", func() {
+		BeforeEach(func() {
+			args = []string{"-store", "csv", "-csv-dir", "foo/bar/baz"}
+		})
+
+		It("uses the csv-dir parameter and does not connect to redis", func() {
+			redisConn = nil
+			var s laboratory.Store = nil
+			WithStore(func(store laboratory.Store) error {
+				s = store
+				return nil
+			})
+
+			Ω(s).Should(Equal(csvStore))
+			Ω(csvStoreDir).Should(Equal("foo/bar/baz"))
+			Ω(redisConn).Should(BeNil())
+		})
+	})
+
+	Context("When a sqlite store is given", func() {
+		var sqlitePath string
+
+		BeforeEach(func() {
+			args = []string{"-store", "sqlite:foo/pat.db"}
+			SqliteStoreFactory = func(path string) (laboratory.Store, error) {
+				sqlitePath = path
+				return csvStore, nil
+			}
+		})
+
+		It("opens the store at the given path", func() {
+			var s laboratory.Store = nil
+			WithStore(func(store laboratory.Store) error {
+				s = store
+				return nil
+			})
+
+			Ω(s).Should(Equal(csvStore))
+			Ω(sqlitePath).Should(Equal("foo/pat.db"))
+		})
+	})
+
+	Context("When a retention policy is given", func() {
+		BeforeEach(func() {
+			args = []string{"-retention:keep", "20", "-retention:days", "30"}
+		})
+
+		It("keeps that many experiments for that many days", func() {
+			Ω(Retention()).Should(Equal(laboratory.Retention{Keep: 20, MaxAge: 30 * 24 * time.Hour}))
+		})
+	})
+
+	Context("When a store is unknown", func() {
+		BeforeEach(func() {
+			args = []string{"-store", "csv,mongo"}
+		})
+
+		It("returns an error", func() {
+			called := false
+			err := WithStore(func(store laboratory.Store) error {
+				called = true
+				return nil
+			})
+
+			Ω(err).Should(HaveOccurred())
+			Ω(called).Should(BeFalse())
+		})
+	})
 })
 
 type dummyConn struct{}
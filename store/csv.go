@@ -2,6 +2,8 @@ package store
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -10,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 	"github.com/cloudfoundry-incubator/pat/logs"
 	"github.com/cloudfoundry-incubator/pat/workloads"
@@ -34,6 +37,47 @@ func (store *CsvStore) Writer(guid string) func(samples <-chan *experiment.Sampl
 	return store.newCsvFile(guid).Write
 }
 
+// Describe writes the metadata of an experiment to a JSON file that is found
+// by the guid of the experiment.
+func (store *CsvStore) Describe(guid string, metadata experiment.Metadata) error {
+	if err := os.MkdirAll(store.dir, 0755); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metadataPath(store.dir, guid), encoded, 0644)
+}
+
+// Delete removes the CSV of an experiment, with its events and metadata.
+func (store *CsvStore) Delete(guid string) error {
+	experiments, err := store.LoadAll()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	paths := []string{metadataPath(store.dir, guid)}
+	for _, e := range experiments {
+		if e.GetGuid() == guid {
+			file := e.(*csvFile)
+			paths = append(paths, file.outputPath, file.eventsPath())
+		}
+	}
+
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func metadataPath(dir string, guid string) string {
+	return path.Join(dir, guid+".metadata.json")
+}
+
 func (store *CsvStore) load(filename string, guid string) (experiment.Experiment, error) {
 	return &csvFile{path.Join(store.dir, filename), guid, nil}, nil
 }
@@ -69,19 +113,25 @@ func (self *csvFile) Write(samples <-chan *experiment.Sample) {
 	var body []string
 	w := csv.NewWriter(f)
 
-	header = []string{"Average", "TotalTime", "SystemTime", "Total", "TotalErrors", "LastError", "TotalWorkers", "LastResult", "WorstResult", "NinetyfifthPercentile", "WallTime", "Type"}
+	header = []string{"Average", "TotalTime", "SystemTime", "Total", "TotalErrors", "LastError", "TotalWorkers", "LastResult", "WorstResult", "NinetyfifthPercentile", "WallTime", "Type", "Slaves", "Window", "Throughput"}
 	for _, k := range self.commands {
 		header = append(header, "Commands|"+k+"|Count",
 			"Commands|"+k+"|Throughput",
 			"Commands|"+k+"|Average",
 			"Commands|"+k+"|TotalTime",
 			"Commands|"+k+"|LastTime",
-			"Commands|"+k+"|WorstTime")
+			"Commands|"+k+"|WorstTime",
+			"Commands|"+k+"|PerWorkerThroughput")
 	}
 	w.Write(header)
 
+	events := &eventLog{path: self.eventsPath()}
+	defer events.Close()
+
 	for s := range samples {
-		if s.Type == experiment.ResultSample {
+		if s.Type == experiment.ResultSample || s.Type == experiment.WindowSample || s.Type == experiment.CancelledSample {
+			events.write(s.Event)
+
 			body = []string{strconv.Itoa(int(s.Average.Nanoseconds())),
 				strconv.Itoa(int(s.TotalTime.Nanoseconds())),
 				strconv.Itoa(int(s.Total)),
@@ -93,18 +143,22 @@ func (self *csvFile) Write(samples <-chan *experiment.Sample) {
 				strconv.Itoa(int(s.WorstResult.Nanoseconds())),
 				strconv.Itoa(int(s.NinetyfifthPercentile.Nanoseconds())),
 				strconv.Itoa(int(s.WallTime)),
-				strconv.Itoa(int(s.Type))}
+				strconv.Itoa(int(s.Type)),
+				slaves(s.Slaves),
+				window(s.Window),
+				strconv.FormatFloat(s.Throughput, 'f', 8, 64)}
 
 			for _, k := range self.commands {
 				if s.Commands[k].Count == 0 {
-					body = append(body, "", "", "", "", "", "")
+					body = append(body, "", "", "", "", "", "", "")
 				} else {
 					body = append(body, strconv.Itoa(int(s.Commands[k].Count)),
 						strconv.FormatFloat(s.Commands[k].Throughput, 'f', 8, 64),
 						strconv.Itoa(int(s.Commands[k].Average.Nanoseconds())),
 						strconv.Itoa(int(s.Commands[k].TotalTime.Nanoseconds())),
 						strconv.Itoa(int(s.Commands[k].LastTime.Nanoseconds())),
-						strconv.Itoa(int(s.Commands[k].WorstTime.Nanoseconds())))
+						strconv.Itoa(int(s.Commands[k].WorstTime.Nanoseconds())),
+						strconv.FormatFloat(s.Commands[k].PerWorkerThroughput, 'f', 8, 64))
 				}
 			}
 
@@ -126,60 +180,240 @@ func (self *csvFile) GetData() (samples []*experiment.Sample, err error) {
 		return nil, err
 	}
 
-	var cmd experiment.Command
-	var cmdColumns = make(map[string]int)
+	var columns *csvColumns
 	for i, d := range decoded {
 		if i == 0 {
-			for n, s := range d {
-				if strings.HasPrefix(s, "Commands|") {
-					cmdColumns[s] = n
-				}
-			}
+			columns = newCsvColumns(d)
 		} else {
-			sample := &experiment.Sample{}
-			sample.Commands = make(map[string]experiment.Command)
-			sample.Average, err = duration(d[0])
-			sample.TotalTime, err = duration(d[1])
-			sample.Total, err = i64(d[2])
-			sample.SystemTime = d[3]
-			sample.TotalErrors, err = strconv.Atoi(d[4])
-			sample.LastError = d[5]
-			sample.TotalWorkers, err = strconv.Atoi(d[6])
-			sample.LastResult, err = duration(d[7])
-			sample.WorstResult, err = duration(d[8])
-			sample.NinetyfifthPercentile, err = duration(d[9])
-			sample.WallTime, err = duration(d[10])
-			sample.Type = experiment.ResultSample // this is the only type we currently persist
-
-			var cmdName string
-			for k, _ := range cmdColumns {
-				if strings.Split(k, "|")[2] != "Count" {
-					continue
-				}
-				cmdName = strings.Split(k, "|")[1]
-				cmd.Count, err = i64(d[cmdColumns["Commands|"+cmdName+"|Count"]])
-				if cmd.Count > 0 {
-					cmd.Throughput, err = strconv.ParseFloat(d[cmdColumns["Commands|"+cmdName+"|Throughput"]], 64)
-					cmd.Average, err = duration(d[cmdColumns["Commands|"+cmdName+"|Average"]])
-					cmd.TotalTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|TotalTime"]])
-					cmd.LastTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|LastTime"]])
-					cmd.WorstTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|WorstTime"]])
-					sample.Commands[cmdName] = cmd
-				} else {
-					err = nil //reset the expected error for empty fields
-				}
-			}
-
+			sample, err := columns.decode(d)
 			if err != nil {
 				return nil, err
 			}
-
 			samples = append(samples, sample)
 		}
 	}
 	return
 }
 
+// lastRowSize is how much of the end of a CSV GetLastSample reads to find the
+// last row.
+const lastRowSize = 16 * 1024
+
+// GetLastSample decodes the header and the last row of the CSV, rather than
+// all of it. It reads every sample instead when the last row can't be told
+// apart on its own, such as when an error message spans several lines.
+func (self *csvFile) GetLastSample() (*experiment.Sample, error) {
+	file, err := os.Open(self.outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - lastRowSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err = file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+	if offset == 0 && len(lines) == 1 {
+		return nil, nil
+	}
+	if len(lines) > 1 {
+		row, err := csv.NewReader(strings.NewReader(lines[len(lines)-1])).Read()
+		if err == nil && len(row) == len(header) {
+			return newCsvColumns(header).decode(row)
+		}
+	}
+
+	samples, err := self.GetData()
+	if err != nil || len(samples) == 0 {
+		return nil, err
+	}
+	return samples[len(samples)-1], nil
+}
+
+// csvColumns is where the optional columns of a CSV are, read from its
+// header.
+type csvColumns struct {
+	commands   map[string]int
+	slaves     int
+	window     int
+	throughput int
+}
+
+func newCsvColumns(header []string) *csvColumns {
+	columns := &csvColumns{commands: make(map[string]int), slaves: -1, window: -1, throughput: -1}
+	for n, s := range header {
+		if strings.HasPrefix(s, "Commands|") {
+			columns.commands[s] = n
+		}
+		if s == "Slaves" {
+			columns.slaves = n
+		}
+		if s == "Window" {
+			columns.window = n
+		}
+		if s == "Throughput" {
+			columns.throughput = n
+		}
+	}
+	return columns
+}
+
+func (columns *csvColumns) decode(d []string) (sample *experiment.Sample, err error) {
+	var cmd experiment.Command
+	cmdColumns := columns.commands
+	sample = &experiment.Sample{}
+	sample.Commands = make(map[string]experiment.Command)
+	sample.Average, err = duration(d[0])
+	sample.TotalTime, err = duration(d[1])
+	sample.Total, err = i64(d[2])
+	sample.SystemTime = d[3]
+	sample.TotalErrors, err = strconv.Atoi(d[4])
+	sample.LastError = d[5]
+	sample.TotalWorkers, err = strconv.Atoi(d[6])
+	sample.LastResult, err = duration(d[7])
+	sample.WorstResult, err = duration(d[8])
+	sample.NinetyfifthPercentile, err = duration(d[9])
+	sample.WallTime, err = duration(d[10])
+	sample.Type = experiment.ResultSample
+	if t, err := strconv.Atoi(d[11]); err == nil && (experiment.SampleType(t) == experiment.WindowSample || experiment.SampleType(t) == experiment.CancelledSample) {
+		sample.Type = experiment.SampleType(t)
+	}
+	if columns.slaves >= 0 && d[columns.slaves] != "" {
+		if err = json.Unmarshal([]byte(d[columns.slaves]), &sample.Slaves); err != nil {
+			return nil, err
+		}
+	}
+	if columns.window >= 0 && d[columns.window] != "" {
+		if err = json.Unmarshal([]byte(d[columns.window]), &sample.Window); err != nil {
+			return nil, err
+		}
+	}
+	if columns.throughput >= 0 {
+		if sample.Throughput, err = strconv.ParseFloat(d[columns.throughput], 64); err != nil {
+			return nil, err
+		}
+	}
+
+	var cmdName string
+	for k, _ := range cmdColumns {
+		if strings.Split(k, "|")[2] != "Count" {
+			continue
+		}
+		cmdName = strings.Split(k, "|")[1]
+		cmd.Count, err = i64(d[cmdColumns["Commands|"+cmdName+"|Count"]])
+		if cmd.Count > 0 {
+			cmd.Throughput, err = strconv.ParseFloat(d[cmdColumns["Commands|"+cmdName+"|Throughput"]], 64)
+			cmd.Average, err = duration(d[cmdColumns["Commands|"+cmdName+"|Average"]])
+			cmd.TotalTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|TotalTime"]])
+			cmd.LastTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|LastTime"]])
+			cmd.WorstTime, err = duration(d[cmdColumns["Commands|"+cmdName+"|WorstTime"]])
+			if n, ok := cmdColumns["Commands|"+cmdName+"|PerWorkerThroughput"]; ok {
+				cmd.PerWorkerThroughput, err = strconv.ParseFloat(d[n], 64)
+			} else {
+				// older files only have the per worker throughput, under the name Throughput
+				cmd.PerWorkerThroughput, cmd.Throughput = cmd.Throughput, 0
+			}
+			sample.Commands[cmdName] = cmd
+		} else {
+			err = nil //reset the expected error for empty fields
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// eventLog appends one JSON line per iteration to a file next to the CSV. The
+// file is only created once there is an event to write.
+type eventLog struct {
+	path string
+	f    *os.File
+	enc  *json.Encoder
+}
+
+func (log *eventLog) write(event *experiment.Event) {
+	if event == nil {
+		return
+	}
+
+	if log.f == nil {
+		f, err := os.Create(log.path)
+		if err != nil {
+			logs.NewLogger("store.csv").Errorf("Can't write events: %v", err)
+			return
+		}
+		log.f, log.enc = f, json.NewEncoder(f)
+	}
+
+	log.enc.Encode(event)
+}
+
+func (log *eventLog) Close() {
+	if log.f != nil {
+		log.f.Close()
+	}
+}
+
+func (self *csvFile) eventsPath() string {
+	return strings.TrimSuffix(self.outputPath, ".csv") + ".events.jsonl"
+}
+
+func (self *csvFile) GetEvents() ([]*experiment.Event, error) {
+	events := make([]*experiment.Event, 0)
+	f, err := os.Open(self.eventsPath())
+	if os.IsNotExist(err) {
+		return events, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		var event experiment.Event
+		if err := decoder.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+}
+
+func (self *csvFile) GetMetadata() (metadata experiment.Metadata, err error) {
+	encoded, err := ioutil.ReadFile(metadataPath(filepath.Dir(self.outputPath), self.guid))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(encoded, &metadata)
+	return metadata, err
+}
+
 func (store *CsvStore) LoadAll() (samples []experiment.Experiment, err error) {
 	files, err := ioutil.ReadDir(store.dir)
 	if err != nil {
@@ -188,6 +422,10 @@ func (store *CsvStore) LoadAll() (samples []experiment.Experiment, err error) {
 
 	samples = make([]experiment.Experiment, 0)
 	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".csv") {
+			continue
+		}
+
 		base := strings.Split(f.Name(), ".")[0]
 		name := strings.SplitN(base, "-", 2)[1]
 		if len(name) > 0 {
@@ -205,6 +443,24 @@ func (csv *csvFile) GetGuid() string {
 	return csv.guid
 }
 
+func slaves(s map[string]benchmarker.SlaveStatus) string {
+	if len(s) == 0 {
+		return ""
+	}
+
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+func window(w *experiment.Window) string {
+	if w == nil {
+		return ""
+	}
+
+	encoded, _ := json.Marshal(w)
+	return string(encoded)
+}
+
 func i64(s string) (int64, error) {
 	t, e := strconv.Atoi(s)
 	return int64(t), e
@@ -4,9 +4,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 	. "github.com/cloudfoundry-incubator/pat/store"
 	"github.com/cloudfoundry-incubator/pat/workloads"
@@ -38,11 +40,13 @@ var _ = Describe("Csv Store", func() {
 			store = NewCsvStore(dir, &workloads.WorkloadList{testList})
 			writer := store.Writer("foo")
 			commands = make(map[string]experiment.Command)
-			cmd := experiment.Command{1, 0.5, 2, 3, 4, 5}
+			cmd := experiment.Command{1, 0.5, 2, 3, 4, 5, 0.25}
 			commands["boo"] = cmd
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{commands, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{commands, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, map[string]benchmarker.SlaveStatus{
+					"loader-1": benchmarker.SlaveStatus{"loader-1", 3, 4, 0.75, 9},
+				}, nil, nil, 0},
 			})
 			files, err := ioutil.ReadDir(dir)
 			Ω(err).ShouldNot(HaveOccurred())
@@ -61,6 +65,9 @@ var _ = Describe("Csv Store", func() {
 		It("Includes all fields", func() {
 			meta := reflect.ValueOf(experiment.Sample{}).Type()
 			for i := 0; i < meta.NumField(); i++ {
+				if meta.Field(i).Tag.Get("json") == "-" {
+					continue // not part of the sample, e.g. the raw event
+				}
 				Ω(strings.Split(output, "\n")[0]).Should(ContainSubstring(meta.Field(i).Name))
 			}
 		})
@@ -71,21 +78,32 @@ var _ = Describe("Csv Store", func() {
 			samples, err := ex[0].GetData()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(samples[0]).Should(Equal(&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample}))
+			Ω(samples[0]).Should(Equal(&experiment.Sample{commands, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil, nil, nil, 0}))
+		})
+
+		It("Round trips the status of slaves", func() {
+			ex, _ := store.LoadAll()
+			samples, err := ex[0].GetData()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(samples[0].Slaves).Should(BeNil())
+			Ω(samples[1].Slaves).Should(Equal(map[string]benchmarker.SlaveStatus{
+				"loader-1": benchmarker.SlaveStatus{"loader-1", 3, 4, 0.75, 9},
+			}))
 		})
 
 		It("Loads multiple CSVs from a directory, in order", func() {
 			foo := store.Writer("bar")
 			write(foo, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, nil, nil, nil, 0},
 			})
 
 			bar := store.Writer("baz")
 			write(bar, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 1, 2, "2009-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2010-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 1, 2, "2009-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 3, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 9, 8, "2010-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 7, 2, experiment.ResultSample, nil, nil, nil, 0},
 			})
 
 			samples, err := store.LoadAll()
@@ -98,6 +116,158 @@ var _ = Describe("Csv Store", func() {
 			Ω(data(samples[2].GetData())).Should(HaveLen(3))
 		})
 
+		It("Round trips throughput over wall time and per worker", func() {
+			write(store.Writer("throughput"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample, Throughput: 12.5, Commands: map[string]experiment.Command{
+					"boo": experiment.Command{Count: 2, Throughput: 4, PerWorkerThroughput: 0.5},
+				}},
+			})
+
+			experiments, _ := store.LoadAll()
+			samples, err := experiments[1].GetData()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(samples[0].Throughput).Should(Equal(12.5))
+			Ω(samples[0].Commands["boo"].Throughput).Should(Equal(4.0))
+			Ω(samples[0].Commands["boo"].PerWorkerThroughput).Should(Equal(0.5))
+		})
+
+		It("Reads the throughput of older CSVs as per worker throughput", func() {
+			ioutil.WriteFile(path.Join(dir, "2-old.csv"), []byte(
+				"Average,TotalTime,SystemTime,Total,TotalErrors,LastError,TotalWorkers,LastResult,WorstResult,NinetyfifthPercentile,WallTime,Type,Commands|boo|Count,Commands|boo|Throughput,Commands|boo|Average,Commands|boo|TotalTime,Commands|boo|LastTime,Commands|boo|WorstTime\n"+
+					"1,2,3,2009-11-10T23:00:00Z,4,,5,6,7,8,9,0,2,0.5,1,4,2,2\n"), 0644)
+
+			experiments, _ := store.LoadAll()
+			samples, err := experiments[1].GetData()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(samples[0].Commands["boo"].PerWorkerThroughput).Should(Equal(0.5))
+			Ω(samples[0].Commands["boo"].Throughput).Should(Equal(0.0))
+		})
+
+		It("Round trips windows of interval statistics", func() {
+			w := &experiment.Window{Start: 10, Duration: 10, Count: 3, Errors: 1, Throughput: 0.3, Average: 2, NinetyfifthPercentile: 3, WorstResult: 3}
+			write(store.Writer("windows"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample, SystemTime: "2009-11-10T23:00:00Z"},
+				&experiment.Sample{Type: experiment.WindowSample, SystemTime: "2009-11-10T23:00:01Z", Window: w},
+			})
+
+			experiments, _ := store.LoadAll()
+			samples, err := experiments[1].GetData()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(samples).Should(HaveLen(2))
+			Ω(samples[0].Type).Should(Equal(experiment.ResultSample))
+			Ω(samples[0].Window).Should(BeNil())
+			Ω(samples[1].Type).Should(Equal(experiment.WindowSample))
+			Ω(samples[1].Window).Should(Equal(w))
+		})
+
+		It("Keeps the marker of a cancelled experiment", func() {
+			write(store.Writer("cancelled"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample, SystemTime: "2009-11-10T23:00:00Z"},
+				&experiment.Sample{Type: experiment.CancelledSample, SystemTime: "2009-11-10T23:00:01Z", Total: 1},
+			})
+
+			experiments, _ := store.LoadAll()
+			samples, err := experiments[1].GetData()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(samples).Should(HaveLen(2))
+			Ω(samples[1].Type).Should(Equal(experiment.CancelledSample))
+			Ω(samples[1].Total).Should(Equal(int64(1)))
+		})
+
+		It("Reads the last sample on its own", func() {
+			ex, _ := store.LoadAll()
+			samples, _ := ex[0].GetData()
+			last, err := ex[0].(experiment.LastSampleSource).GetLastSample()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(last).Should(Equal(samples[1]))
+		})
+
+		It("Reads the last sample when its error spans several lines", func() {
+			write(store.Writer("multiline"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample, SystemTime: "2009-11-10T23:00:00Z"},
+				&experiment.Sample{Type: experiment.CancelledSample, SystemTime: "2009-11-10T23:00:01Z", LastError: "first line\nsecond line"},
+			})
+
+			experiments, _ := store.LoadAll()
+			last, err := experiments[1].(experiment.LastSampleSource).GetLastSample()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(last.Type).Should(Equal(experiment.CancelledSample))
+			Ω(last.LastError).Should(Equal("first line\nsecond line"))
+		})
+
+		It("Has no last sample before the first one is written", func() {
+			write(store.Writer("empty"), []*experiment.Sample{})
+
+			experiments, _ := store.LoadAll()
+			last, err := experiments[1].(experiment.LastSampleSource).GetLastSample()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(last).Should(BeNil())
+		})
+
+		It("Round trips the metadata of an experiment", func() {
+			Ω(store.Describe("described", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+			write(store.Writer("described"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+
+			experiments, err := store.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(2))
+			Ω(experiments[1].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{StartedBy: "someone"}))
+			Ω(experiments[0].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{}))
+		})
+
+		It("Deletes the files of an experiment", func() {
+			Ω(store.Describe("deleted", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+			write(store.Writer("deleted"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample, Event: &experiment.Event{Iteration: 1}}})
+
+			Ω(store.Delete("deleted")).Should(Succeed())
+			experiments, err := store.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(1))
+
+			left, _ := filepath.Glob(path.Join(dir, "*deleted*"))
+			Ω(left).Should(BeEmpty())
+			Ω(store.Delete("deleted")).Should(Succeed())
+		})
+
+		Context("When samples carry raw events", func() {
+			var events []*experiment.Event
+
+			JustBeforeEach(func() {
+				events = []*experiment.Event{
+					&experiment.Event{Timestamp: "2009-11-10T23:00:00Z", Worker: 0, Iteration: 0, Duration: 3, Steps: []benchmarker.StepResult{{"boo", 3}}},
+					&experiment.Event{Timestamp: "2009-11-10T23:00:01Z", Worker: 1, Iteration: 1, Duration: 5, Error: "foo"},
+				}
+				write(store.Writer("events"), []*experiment.Sample{
+					&experiment.Sample{Type: experiment.ResultSample, Event: events[0]},
+					&experiment.Sample{Type: experiment.OtherSample},
+					&experiment.Sample{Type: experiment.ResultSample, Event: events[1]},
+				})
+			})
+
+			It("writes one JSON line per event next to the CSV", func() {
+				matches, err := filepath.Glob(path.Join(dir, "*-events.events.jsonl"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(matches).Should(HaveLen(1))
+
+				in, err := ioutil.ReadFile(matches[0])
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(strings.Split(strings.TrimSpace(string(in)), "\n")).Should(HaveLen(2))
+			})
+
+			It("does not load the events file as an experiment", func() {
+				experiments, err := store.LoadAll()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(experiments).Should(HaveLen(2))
+			})
+
+			It("round trips the events", func() {
+				experiments, _ := store.LoadAll()
+				Ω(experiments[1].GetGuid()).Should(Equal("events"))
+				Ω(experiments[1].(experiment.EventSource).GetEvents()).Should(Equal(events))
+				Ω(experiments[0].(experiment.EventSource).GetEvents()).Should(BeEmpty())
+			})
+		})
+
 		PIt("Throws exception if header is not in correct order", func() {
 		})
 
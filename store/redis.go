@@ -10,7 +10,10 @@ import (
 const MAX_RESULTS = 10000
 
 type redisStore struct {
-	c redis.Conn
+	c          redis.Conn
+	ns         redis.Namespace
+	maxResults int
+	ttl        int
 }
 
 type redisExperiment struct {
@@ -19,40 +22,182 @@ type redisExperiment struct {
 }
 
 func NewRedisStore(conn redis.Conn) (*redisStore, error) {
-	return &redisStore{conn}, nil
+	maxResults := params.maxResults
+	if maxResults < 1 {
+		maxResults = MAX_RESULTS
+	}
+	return &redisStore{conn, redis.CurrentNamespace(), maxResults, params.ttl}, nil
 }
 
 func (r *redisStore) LoadAll() ([]experiment.Experiment, error) {
 	c := r.c
-	members, err := redis.Strings(c.Do("LRANGE", "experiments", 0, MAX_RESULTS))
+	members, err := redis.Strings(c.Do("LRANGE", r.ns.Key("experiments"), 0, r.maxResults))
 	if err != nil {
 		return nil, err
 	}
 
-	experiments := make([]experiment.Experiment, len(members))
-	for i := 0; i < len(members); i++ {
-		experiments[i] = &redisExperiment{r, members[i]}
+	experiments := make([]experiment.Experiment, 0, len(members))
+	for _, guid := range members {
+		if r.expired(guid) {
+			c.Do("LREM", r.ns.Key("experiments"), 0, guid)
+			continue
+		}
+		experiments = append(experiments, &redisExperiment{r, guid})
 	}
 
 	return experiments, nil
 }
 
+// Find looks an experiment up by its samples and registration. Without a ttl
+// experiments are not registered, so those that have not written a sample
+// are looked for in the list.
+func (r *redisStore) Find(guid string) (experiment.Experiment, error) {
+	exists, err := redis.Int(r.c.Do("EXISTS", r.registeredKey(guid), r.key(guid)))
+	if err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return &redisExperiment{r, guid}, nil
+	}
+	if r.ttl > 0 {
+		return nil, nil
+	}
+
+	members, err := redis.Strings(r.c.Do("LRANGE", r.ns.Key("experiments"), 0, r.maxResults))
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member == guid {
+			return &redisExperiment{r, guid}, nil
+		}
+	}
+	return nil, nil
+}
+
+// expired is true once an experiment has outlived the ttl since it was
+// registered or last wrote a sample, the experiment is then dropped from the
+// list as well. Experiments that have not written a sample yet, because they
+// are queued or just started, still have their registration.
+func (r *redisStore) expired(guid string) bool {
+	if r.ttl < 1 {
+		return false
+	}
+
+	exists, err := redis.Int(r.c.Do("EXISTS", r.registeredKey(guid), r.key(guid)))
+	return err == nil && exists == 0
+}
+
+func (r *redisStore) key(guid string) string {
+	return r.ns.Key("experiment." + guid)
+}
+
 func (r *redisStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
-	r.c.Do("RPUSH", "experiments", guid)
+	r.c.Do("RPUSH", r.ns.Key("experiments"), guid)
+	if r.ttl > 0 {
+		r.c.Do("SET", r.registeredKey(guid), 1, "EX", r.ttl)
+	}
 	return func(ch <-chan *experiment.Sample) {
 		for sample := range ch {
-			push(r.c, guid, sample)
+			r.push(guid, sample)
+			if sample.Event != nil {
+				r.log(guid, sample.Event)
+			}
 		}
 	}
 }
 
-func push(c redis.Conn, guid string, sample *experiment.Sample) {
+func (r *redisStore) push(guid string, sample *experiment.Sample) {
 	json, _ := json.Marshal(sample)
-	c.Do("RPUSH", "experiment."+guid, json)
+	r.c.Do("RPUSH", r.key(guid), json)
+	r.refresh(r.key(guid), r.registeredKey(guid), r.metadataKey(guid))
+}
+
+func (r *redisStore) log(guid string, event *experiment.Event) {
+	json, _ := json.Marshal(event)
+	r.c.Do("RPUSH", r.eventsKey(guid), json)
+	r.refresh(r.eventsKey(guid))
+}
+
+// refresh restarts the ttl of the keys of an experiment.
+func (r *redisStore) refresh(keys ...string) {
+	if r.ttl < 1 {
+		return
+	}
+	for _, key := range keys {
+		r.c.Do("EXPIRE", key, r.ttl)
+	}
+}
+
+// Describe records the metadata of an experiment, it expires with its samples
+// as each sample restarts its ttl.
+func (r *redisStore) Describe(guid string, metadata experiment.Metadata) error {
+	json, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.c.Do("SET", r.metadataKey(guid), json); err != nil {
+		return err
+	}
+	if r.ttl > 0 {
+		_, err = r.c.Do("EXPIRE", r.metadataKey(guid), r.ttl)
+	}
+	return err
+}
+
+// Delete removes an experiment from the list, and its samples, events and
+// metadata.
+func (r *redisStore) Delete(guid string) error {
+	if _, err := r.c.Do("LREM", r.ns.Key("experiments"), 0, guid); err != nil {
+		return err
+	}
+	_, err := r.c.Do("DEL", r.key(guid), r.eventsKey(guid), r.metadataKey(guid), r.registeredKey(guid))
+	return err
+}
+
+func (r *redisStore) metadataKey(guid string) string {
+	return r.key(guid) + ".metadata"
+}
+
+func (r *redisStore) eventsKey(guid string) string {
+	return r.key(guid) + ".events"
+}
+
+func (r *redisStore) registeredKey(guid string) string {
+	return r.key(guid) + ".registered"
+}
+
+func (r redisExperiment) GetEvents() ([]*experiment.Event, error) {
+	members, err := redis.Strings(r.redisStore.c.Do("LRANGE", r.redisStore.eventsKey(r.guid), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*experiment.Event, len(members))
+	for i, m := range members {
+		if err = json.Unmarshal([]byte(m), &events[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func (r redisExperiment) GetMetadata() (metadata experiment.Metadata, err error) {
+	encoded, err := redis.Bytes(r.redisStore.c.Do("GET", r.redisStore.metadataKey(r.guid)))
+	if err == redis.ErrNil {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(encoded, &metadata)
+	return metadata, err
 }
 
 func (r redisExperiment) GetData() ([]*experiment.Sample, error) {
-	members, err := redis.Strings(r.redisStore.c.Do("LRANGE", "experiment."+r.guid, 0, MAX_RESULTS))
+	members, err := redis.Strings(r.redisStore.c.Do("LRANGE", r.redisStore.key(r.guid), 0, r.redisStore.maxResults))
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +212,20 @@ func (r redisExperiment) GetData() ([]*experiment.Sample, error) {
 	return samples, nil
 }
 
+func (r redisExperiment) GetLastSample() (*experiment.Sample, error) {
+	encoded, err := redis.Bytes(r.redisStore.c.Do("LINDEX", r.redisStore.key(r.guid), -1))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sample *experiment.Sample
+	err = json.Unmarshal(encoded, &sample)
+	return sample, err
+}
+
 func (r redisExperiment) GetGuid() string {
 	return r.guid
 }
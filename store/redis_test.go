@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/cloudfoundry-incubator/pat/config"
 	"github.com/cloudfoundry-incubator/pat/experiment"
 	"github.com/cloudfoundry-incubator/pat/redis"
 	. "github.com/cloudfoundry-incubator/pat/store"
@@ -16,6 +17,7 @@ import (
 type store interface {
 	LoadAll() ([]experiment.Experiment, error)
 	Writer(name string) func(samples <-chan *experiment.Sample)
+	Find(guid string) (experiment.Experiment, error)
 }
 
 var _ = Describe("Redis Store", func() {
@@ -40,20 +42,20 @@ var _ = Describe("Redis Store", func() {
 
 			writer := store.Writer("experiment-1")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 2, "2009-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 9, 8, "2009-12-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample, nil, nil, nil, 0},
 			})
 
 			writer = store.Writer("experiment-2")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 2, 2, "2010-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
+				&experiment.Sample{nil, 2, 2, "2010-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil, nil, nil, 0},
 			})
 
 			writer = store.Writer("experiment-3")
 			write(writer, []*experiment.Sample{
-				&experiment.Sample{nil, 1, 3, "2011-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 2, 3, "2011-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample},
-				&experiment.Sample{nil, 9, 8, "2012-11-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample},
+				&experiment.Sample{nil, 1, 3, "2011-11-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 2, 3, "2011-12-10T23:00:00Z", 3, 4, 5, 6, "", 7, 9, 8, experiment.ResultSample, nil, nil, nil, 0},
+				&experiment.Sample{nil, 9, 8, "2012-11-10T23:00:00Z", 7, 6, 5, 4, "foo", 3, 1, 2, experiment.ResultSample, nil, nil, nil, 0},
 			})
 
 			writer = store.Writer("experiment-with-no-data")
@@ -90,6 +92,30 @@ var _ = Describe("Redis Store", func() {
 			Ω(data(experiments[2].GetData())[2].TotalWorkers).Should(Equal(5))
 		})
 
+		It("Reads the last sample on its own", func() {
+			experiments, err := store.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			last, err := experiments[2].(experiment.LastSampleSource).GetLastSample()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(last.SystemTime).Should(Equal("2012-11-10T23:00:00Z"))
+
+			last, err = experiments[3].(experiment.LastSampleSource).GetLastSample()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(last).Should(BeNil())
+		})
+
+		It("Finds an experiment by its guid", func() {
+			found, err := store.Find("experiment-2")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.GetGuid()).Should(Equal("experiment-2"))
+
+			found, err = store.Find("experiment-with-no-data")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found.GetGuid()).Should(Equal("experiment-with-no-data"))
+
+			Ω(store.Find("unknown")).Should(BeNil())
+		})
+
 		It("Returns empty array if data not found (redis cannot distinguish empty from not-created lists)", func() {
 			experiments, err := store.LoadAll()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -98,6 +124,130 @@ var _ = Describe("Redis Store", func() {
 			Ω(data(experiments[3].GetData())).Should(HaveLen(0))
 		})
 	})
+
+	Describe("Namespaces, limits and expiry", func() {
+		var conn redis.Conn
+
+		parse := func(args ...string) {
+			flags := config.NewConfig()
+			DescribeParameters(flags)
+			flags.Parse(args)
+		}
+
+		BeforeEach(func() {
+			var err error
+			conn, err = redis.Connect("", 63798, "p4ssw0rd")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			parse()
+		})
+
+		It("keeps experiments in different namespaces apart", func() {
+			parse("-redis-namespace", "team-a")
+			a, _ := NewRedisStore(conn)
+			write(a.Writer("experiment-a"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+
+			parse("-redis-namespace", "team-b")
+			b, _ := NewRedisStore(conn)
+			Ω(b.LoadAll()).Should(BeEmpty())
+
+			experiments, err := a.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(1))
+			Ω(experiments[0].GetGuid()).Should(Equal("experiment-a"))
+			Ω(redis.Strings(conn.Do("LRANGE", "team-a:experiment.experiment-a", 0, -1))).Should(HaveLen(1))
+		})
+
+		It("logs the raw events of each experiment", func() {
+			s, _ := NewRedisStore(conn)
+			event := &experiment.Event{Timestamp: "2009-11-10T23:00:00Z", Worker: 2, Duration: 3, Error: "foo"}
+			write(s.Writer("experiment-1"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample, Event: event},
+				&experiment.Sample{Type: experiment.ResultSample},
+			})
+
+			experiments, err := s.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments[0].(experiment.EventSource).GetEvents()).Should(Equal([]*experiment.Event{event}))
+			Ω(data(experiments[0].GetData())[0].Event).Should(BeNil())
+		})
+
+		It("records the metadata of each experiment", func() {
+			s, _ := NewRedisStore(conn)
+			Ω(s.Describe("experiment-1", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+			write(s.Writer("experiment-1"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+			write(s.Writer("experiment-2"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+
+			experiments, err := s.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments[0].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{StartedBy: "someone"}))
+			Ω(experiments[1].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{}))
+		})
+
+		It("deletes an experiment with its samples, events and metadata", func() {
+			s, _ := NewRedisStore(conn)
+			Ω(s.Describe("experiment-1", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+			write(s.Writer("experiment-1"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample, Event: &experiment.Event{Iteration: 1}}})
+			write(s.Writer("experiment-2"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+
+			Ω(s.Delete("experiment-1")).Should(Succeed())
+			experiments, err := s.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(1))
+			Ω(experiments[0].GetGuid()).Should(Equal("experiment-2"))
+			Ω(redis.Strings(conn.Do("KEYS", "experiment.experiment-1*"))).Should(BeEmpty())
+		})
+
+		It("loads at most max-results samples", func() {
+			parse("-redis-store:max-results", "1")
+			s, _ := NewRedisStore(conn)
+			write(s.Writer("experiment-1"), []*experiment.Sample{
+				&experiment.Sample{Type: experiment.ResultSample},
+				&experiment.Sample{Type: experiment.ResultSample},
+				&experiment.Sample{Type: experiment.ResultSample},
+			})
+
+			experiments, err := s.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(data(experiments[0].GetData())).Should(HaveLen(2))
+		})
+
+		It("expires samples after the ttl and forgets the experiment", func() {
+			parse("-redis-store:ttl", "1")
+			s, _ := NewRedisStore(conn)
+			write(s.Writer("experiment-1"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+			Ω(redis.Int(conn.Do("TTL", "experiment.experiment-1"))).Should(BeNumerically(">", 0))
+
+			conn.Do("DEL", "experiment.experiment-1", "experiment.experiment-1.registered")
+			Ω(s.LoadAll()).Should(BeEmpty())
+			Ω(redis.Strings(conn.Do("LRANGE", "experiments", 0, -1))).Should(BeEmpty())
+			Ω(s.Find("experiment-1")).Should(BeNil())
+		})
+
+		It("keeps the metadata for as long as the samples", func() {
+			parse("-redis-store:ttl", "60")
+			s, _ := NewRedisStore(conn)
+			Ω(s.Describe("experiment-1", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+			conn.Do("EXPIRE", "experiment.experiment-1.metadata", 1)
+			write(s.Writer("experiment-1"), []*experiment.Sample{&experiment.Sample{Type: experiment.ResultSample}})
+
+			Ω(redis.Int(conn.Do("TTL", "experiment.experiment-1.metadata"))).Should(Equal(60))
+		})
+
+		It("keeps experiments that have not written a sample yet", func() {
+			parse("-redis-store:ttl", "60")
+			s, _ := NewRedisStore(conn)
+			s.Writer("experiment-1")
+
+			experiments, err := s.LoadAll()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(experiments).Should(HaveLen(1))
+			Ω(redis.Strings(conn.Do("LRANGE", "experiments", 0, -1))).Should(Equal([]string{"experiment-1"}))
+			Ω(s.Find("experiment-1")).ShouldNot(BeNil())
+		})
+	})
 })
 
 func StartRedis(config string) {
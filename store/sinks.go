@@ -0,0 +1,306 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/logs"
+)
+
+type metricKind string
+
+const (
+	timer   metricKind = "ms"
+	counter metricKind = "c"
+	gauge   metricKind = "g"
+)
+
+type point struct {
+	name  string
+	kind  metricKind
+	value float64
+	tags  []tag
+}
+
+type tag struct {
+	key, value string
+}
+
+// format renders a point as one line of a metrics protocol.
+type format func(prefix string, p point, now time.Time) string
+
+var formats = map[string]struct {
+	format  format
+	network string
+}{
+	"statsd":   {statsdLine, "udp"},
+	"graphite": {graphiteLine, "tcp"},
+	"influxdb": {influxLine, "udp"},
+}
+
+// SinkTimeout bounds connecting to a sink, each write to it, and how long the
+// end of an experiment waits for the samples still queued for it.
+var SinkTimeout = 2 * time.Second
+
+// SinkBuffer is how many samples are queued for a sink that is slow or down,
+// later samples are dropped until it catches up.
+var SinkBuffer = 1000
+
+const maxSinkBackoff = time.Minute
+
+var SinkDialer = func(network string, address string) (io.WriteCloser, error) {
+	return net.DialTimeout(network, address, SinkTimeout)
+}
+
+// Sinks returns a handler factory for every statsd, graphite and influxdb
+// address given on the command line.
+func Sinks() ([]laboratory.HandlerFactory, error) {
+	tags, err := parseTags(params.sinkTags)
+	if err != nil {
+		return nil, err
+	}
+
+	factories := make([]laboratory.HandlerFactory, 0)
+	for _, configured := range [][2]string{{"statsd", params.statsd}, {"graphite", params.graphite}, {"influxdb", params.influxdb}} {
+		name := configured[0]
+		for _, addr := range strings.Split(configured[1], ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+
+			network, address := formats[name].network, addr
+			if parts := strings.SplitN(addr, "://", 2); len(parts) == 2 {
+				network, address = parts[0], parts[1]
+			}
+			if network != "udp" && network != "tcp" {
+				return nil, fmt.Errorf("%s sink %s must use udp or tcp", name, addr)
+			}
+
+			factories = append(factories, newSink(network, address, formats[name].format, params.sinkPrefix, tags))
+		}
+	}
+	return factories, nil
+}
+
+func parseTags(list string) ([]tag, error) {
+	tags := make([]tag, 0)
+	for _, kv := range strings.Split(list, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("sink tag %s must be of the form key=value", kv)
+		}
+		tags = append(tags, tag{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	return tags, nil
+}
+
+// newSink makes handlers that write every sample, and the iteration it
+// records, to the given address in the given format.
+func newSink(network string, address string, render format, prefix string, tags []tag) laboratory.HandlerFactory {
+	return func(guid string, ex laboratory.Runnable) func(<-chan *experiment.Sample) {
+		workload := ""
+		if runnable, ok := ex.(*experiment.RunnableExperiment); ok {
+			workload = runnable.Workload
+		}
+		base := append([]tag{{"experiment", guid}, {"workload", workload}}, tags...)
+
+		// samples are handed to a writer through a queue, so a sink that is
+		// down never holds up the experiment or the other handlers
+		return func(samples <-chan *experiment.Sample) {
+			s := &sink{network: network, address: address}
+			queue := make(chan string, SinkBuffer)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				defer s.close()
+				for payload := range queue {
+					s.write(payload)
+				}
+			}()
+
+			dropped := 0
+			for sample := range samples {
+				now := time.Now()
+				lines := make([]string, 0)
+				for _, p := range points(sample, base) {
+					lines = append(lines, render(prefix, p, now))
+				}
+
+				select {
+				case queue <- strings.Join(lines, "\n") + "\n":
+				default:
+					dropped++
+				}
+			}
+			close(queue)
+
+			if dropped > 0 {
+				logs.NewLogger("store.sink").Warnf("Dropped %d samples for %s://%s, it could not keep up", dropped, network, address)
+			}
+			select {
+			case <-done:
+			case <-time.After(SinkTimeout):
+			}
+		}
+	}
+}
+
+type sink struct {
+	network string
+	address string
+	conn    io.WriteCloser
+	retryAt time.Time
+	backoff time.Duration
+}
+
+// write sends a payload, connecting first if need be. After a failure the
+// payloads are skipped until it is time to reconnect, waiting twice as long
+// after each failure.
+func (s *sink) write(payload string) {
+	if s.conn == nil {
+		if time.Now().Before(s.retryAt) {
+			return
+		}
+
+		conn, err := SinkDialer(s.network, s.address)
+		if err != nil {
+			logs.NewLogger("store.sink").Warnf("Can't connect to %s://%s: %v", s.network, s.address, err)
+			s.failed()
+			return
+		}
+		s.conn = conn
+	}
+
+	if deadline, ok := s.conn.(interface {
+		SetWriteDeadline(time.Time) error
+	}); ok {
+		deadline.SetWriteDeadline(time.Now().Add(SinkTimeout))
+	}
+
+	if _, err := io.WriteString(s.conn, payload); err != nil {
+		logs.NewLogger("store.sink").Warnf("Can't write to %s://%s, will reconnect: %v", s.network, s.address, err)
+		s.close()
+		s.failed()
+		return
+	}
+	s.backoff = 0
+}
+
+func (s *sink) failed() {
+	if s.backoff *= 2; s.backoff == 0 {
+		s.backoff = time.Second
+	}
+	if s.backoff > maxSinkBackoff {
+		s.backoff = maxSinkBackoff
+	}
+	s.retryAt = time.Now().Add(s.backoff)
+}
+
+func (s *sink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func points(s *experiment.Sample, base []tag) []point {
+	ms := func(d time.Duration) float64 { return d.Seconds() * 1000 }
+	with := func(extra ...tag) []tag { return append(append([]tag{}, base...), extra...) }
+
+	if s.Type == experiment.WindowSample && s.Window != nil {
+		return []point{
+			{"window.count", gauge, float64(s.Window.Count), base},
+			{"window.errors", gauge, float64(s.Window.Errors), base},
+			{"window.throughput", gauge, s.Window.Throughput, base},
+			{"window.average", gauge, ms(s.Window.Average), base},
+			{"window.percentile95", gauge, ms(s.Window.NinetyfifthPercentile), base},
+			{"window.worst", gauge, ms(s.Window.WorstResult), base},
+		}
+	}
+
+	result := []point{
+		{"workers", gauge, float64(s.TotalWorkers), base},
+		{"total", gauge, float64(s.Total), base},
+		{"errors", gauge, float64(s.TotalErrors), base},
+		{"throughput", gauge, s.Throughput, base},
+		{"average", gauge, ms(s.Average), base},
+		{"percentile95", gauge, ms(s.NinetyfifthPercentile), base},
+	}
+
+	if s.Event != nil {
+		result = append(result, point{"iteration.duration", timer, ms(s.Event.Duration), base})
+		for _, step := range s.Event.Steps {
+			result = append(result, point{"step.duration", timer, ms(step.Duration), with(tag{"command", step.Command})})
+		}
+		if s.Event.Error != "" {
+			command := ""
+			if len(s.Event.Steps) > 0 {
+				command = s.Event.Steps[len(s.Event.Steps)-1].Command
+			}
+			result = append(result, point{"iteration.errors", counter, 1, with(tag{"command", command})})
+		}
+	}
+	return result
+}
+
+func value(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var statsdEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// statsdLine uses the DogStatsD extension for tags.
+func statsdLine(prefix string, p point, now time.Time) string {
+	tags := make([]string, len(p.tags))
+	for i, t := range p.tags {
+		tags[i] = statsdEscaper.Replace(t.key) + ":" + statsdEscaper.Replace(t.value)
+	}
+	return fmt.Sprintf("%s:%s|%s|#%s", join(prefix, p.name), value(p.value), p.kind, strings.Join(tags, ","))
+}
+
+var graphiteEscaper = strings.NewReplacer(";", "_", "~", "_", " ", "_", "\n", "_")
+
+// graphiteLine uses the tagged series syntax of graphite 1.1.
+func graphiteLine(prefix string, p point, now time.Time) string {
+	tags := make([]string, len(p.tags))
+	for i, t := range p.tags {
+		tags[i] = graphiteEscaper.Replace(t.key) + "=" + graphiteEscaper.Replace(t.value)
+	}
+	sort.Strings(tags)
+	name := join(prefix, p.name)
+	if len(tags) > 0 {
+		name = name + ";" + strings.Join(tags, ";")
+	}
+	return fmt.Sprintf("%s %s %d", name, value(p.value), now.Unix())
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`, "\n", " ")
+
+func influxLine(prefix string, p point, now time.Time) string {
+	measurement := influxEscaper.Replace(join(prefix, p.name))
+	for _, t := range p.tags {
+		if t.value == "" {
+			continue
+		}
+		measurement = measurement + "," + influxEscaper.Replace(t.key) + "=" + influxEscaper.Replace(t.value)
+	}
+	return fmt.Sprintf("%s value=%s %d", measurement, value(p.value), now.UnixNano())
+}
+
+func join(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
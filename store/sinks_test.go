@@ -0,0 +1,205 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	"github.com/cloudfoundry-incubator/pat/config"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	. "github.com/cloudfoundry-incubator/pat/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sinks", func() {
+	var (
+		flags   config.Config
+		args    []string
+		dialled map[string]*dummySinkConn
+		lock    sync.Mutex
+	)
+
+	BeforeEach(func() {
+		args = []string{}
+		dialled = make(map[string]*dummySinkConn)
+		SinkDialer = func(network string, address string) (io.WriteCloser, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			if address == "unreachable:1" {
+				return nil, errors.New("connection refused")
+			}
+			conn := &dummySinkConn{}
+			dialled[network+"://"+address] = conn
+			return conn, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		flags = config.NewConfig()
+		DescribeParameters(flags)
+		flags.Parse(args)
+	})
+
+	run := func(samples ...*experiment.Sample) {
+		sinks, err := Sinks()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		config := experiment.NewExperimentConfiguration(1, []int{1}, 0, 0, 0, nil, "cf:push")
+		for _, sink := range sinks {
+			ch := make(chan *experiment.Sample)
+			go func() {
+				for _, s := range samples {
+					ch <- s
+				}
+				close(ch)
+			}()
+			sink("abc", experiment.NewRunnableExperiment(config))(ch)
+		}
+	}
+
+	written := func(addr string) string {
+		lock.Lock()
+		defer lock.Unlock()
+		Ω(dialled).Should(HaveKey(addr))
+		return dialled[addr].String()
+	}
+
+	event := &experiment.Event{Duration: 1500 * time.Millisecond, Steps: []benchmarker.StepResult{{"push", 1500 * time.Millisecond}}, Error: "failed"}
+
+	Context("When no sinks are configured", func() {
+		It("returns no handlers", func() {
+			sinks, err := Sinks()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(sinks).Should(BeEmpty())
+		})
+	})
+
+	Context("When a statsd address is given", func() {
+		BeforeEach(func() {
+			args = []string{"-statsd", "localhost:8125", "-sink:tags", "env=ci"}
+		})
+
+		It("writes the samples over udp with the prefix and tags", func() {
+			run(&experiment.Sample{TotalWorkers: 2, Event: event})
+			out := written("udp://localhost:8125")
+			Ω(out).Should(ContainSubstring("pat.workers:2|g|#experiment:abc,workload:cf:push,env:ci\n"))
+			Ω(out).Should(ContainSubstring("pat.iteration.duration:1500|ms|#experiment:abc,workload:cf:push,env:ci\n"))
+			Ω(out).Should(ContainSubstring("pat.step.duration:1500|ms|#experiment:abc,workload:cf:push,env:ci,command:push\n"))
+			Ω(out).Should(ContainSubstring("pat.iteration.errors:1|c|#experiment:abc,workload:cf:push,env:ci,command:push\n"))
+		})
+	})
+
+	Context("When a graphite address is given", func() {
+		BeforeEach(func() {
+			args = []string{"-graphite", "localhost:2003", "-sink:prefix", "perf"}
+		})
+
+		It("writes tagged plaintext lines over tcp", func() {
+			run(&experiment.Sample{Total: 3})
+			out := written("tcp://localhost:2003")
+			Ω(out).Should(MatchRegexp(`(?m)^perf\.total;experiment=abc;workload=cf:push 3 \d+$`))
+		})
+	})
+
+	Context("When an influxdb address is given", func() {
+		BeforeEach(func() {
+			args = []string{"-influxdb", "tcp://localhost:8089"}
+		})
+
+		It("writes the line protocol", func() {
+			run(&experiment.Sample{Type: experiment.WindowSample, Window: &experiment.Window{Throughput: 2.5}})
+			out := written("tcp://localhost:8089")
+			Ω(out).Should(MatchRegexp(`(?m)^pat\.window\.throughput,experiment=abc,workload=cf:push value=2\.5 \d+$`))
+		})
+	})
+
+	Context("When several sinks are given", func() {
+		BeforeEach(func() {
+			args = []string{"-statsd", "udp://a:1,udp://b:2", "-influxdb", "c:3"}
+		})
+
+		It("writes to all of them", func() {
+			run(&experiment.Sample{})
+			Ω(dialled).Should(HaveLen(3))
+			Ω(written("udp://a:1")).ShouldNot(BeEmpty())
+			Ω(written("udp://b:2")).ShouldNot(BeEmpty())
+			Ω(written("udp://c:3")).ShouldNot(BeEmpty())
+		})
+	})
+
+	Context("When a sink can't be reached", func() {
+		BeforeEach(func() {
+			args = []string{"-statsd", "unreachable:1"}
+		})
+
+		It("still consumes every sample", func() {
+			run(&experiment.Sample{}, &experiment.Sample{})
+		})
+	})
+
+	Context("When a sink is slow to answer", func() {
+		var dials int
+
+		BeforeEach(func() {
+			args = []string{"-graphite", "blackhole:2003"}
+			dials = 0
+			SinkDialer = func(network string, address string) (io.WriteCloser, error) {
+				lock.Lock()
+				dials++
+				lock.Unlock()
+				time.Sleep(500 * time.Millisecond)
+				return nil, errors.New("i/o timeout")
+			}
+		})
+
+		It("does not hold up the samples, and waits before connecting again", func() {
+			samples := make([]*experiment.Sample, 20)
+			for i := range samples {
+				samples[i] = &experiment.Sample{}
+			}
+
+			start := time.Now()
+			run(samples...)
+			Ω(time.Since(start)).Should(BeNumerically("<", 1500*time.Millisecond))
+			lock.Lock()
+			defer lock.Unlock()
+			Ω(dials).Should(Equal(1))
+		})
+	})
+
+	Context("When a sink uses a network other than udp or tcp", func() {
+		BeforeEach(func() {
+			args = []string{"-statsd", "http://localhost:80"}
+		})
+
+		It("returns an error", func() {
+			_, err := Sinks()
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When a tag has no value", func() {
+		BeforeEach(func() {
+			args = []string{"-sink:tags", "env"}
+		})
+
+		It("returns an error", func() {
+			_, err := Sinks()
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
+
+type dummySinkConn struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *dummySinkConn) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,566 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+	"github.com/cloudfoundry-incubator/pat/logs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const DefaultSqlitePath = "output/pat.db"
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS experiments (
+		guid     TEXT PRIMARY KEY,
+		started  INTEGER NOT NULL,
+		workload TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS configuration (
+		guid                  TEXT PRIMARY KEY REFERENCES experiments(guid),
+		iterations            INTEGER,
+		concurrency           TEXT,
+		concurrency_step_time INTEGER,
+		interval              INTEGER,
+		stop                  INTEGER,
+		window                INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		guid  TEXT NOT NULL REFERENCES experiments(guid),
+		key   TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (guid, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS metadata (
+		guid TEXT PRIMARY KEY REFERENCES experiments(guid),
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS samples (
+		guid TEXT NOT NULL REFERENCES experiments(guid),
+		seq  INTEGER NOT NULL,
+		type INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (guid, seq)
+	)`,
+	`CREATE TABLE IF NOT EXISTS iterations (
+		guid      TEXT NOT NULL REFERENCES experiments(guid),
+		seq       INTEGER NOT NULL,
+		started   TEXT NOT NULL,
+		worker    INTEGER,
+		iteration INTEGER,
+		duration  INTEGER,
+		steps     TEXT,
+		error     TEXT,
+		slave     TEXT,
+		PRIMARY KEY (guid, seq)
+	)`,
+	`CREATE INDEX IF NOT EXISTS experiments_started ON experiments (started)`,
+	`CREATE INDEX IF NOT EXISTS experiments_workload ON experiments (workload)`,
+}
+
+// SqliteStore keeps experiments, their configuration, metadata and tags,
+// samples and raw iterations in a SQLite database.
+type SqliteStore struct {
+	sync.Mutex
+	db      *sql.DB
+	writers sync.WaitGroup
+}
+
+type sqliteExperiment struct {
+	store *SqliteStore
+	guid  string
+}
+
+func NewSqliteStore(path string) (*SqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range schema {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SqliteStore{db: db}, nil
+}
+
+// Close waits for the writers of running experiments to write their last
+// sample before closing the database.
+func (s *SqliteStore) Close() error {
+	s.writers.Wait()
+	return s.db.Close()
+}
+
+func (s *SqliteStore) LoadAll() ([]experiment.Experiment, error) {
+	return s.Query(laboratory.Filter{})
+}
+
+// Query selects the experiments that match a filter in the database, the
+// laboratory uses it to list experiments without loading all of them.
+func (s *SqliteStore) Query(filter laboratory.Filter) ([]experiment.Experiment, error) {
+	query := "SELECT guid FROM experiments WHERE 1 = 1"
+	args := make([]interface{}, 0)
+	if !filter.Since.IsZero() {
+		query = query + " AND started >= ?"
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		query = query + " AND started < ?"
+		args = append(args, filter.Until.UnixNano())
+	}
+	if filter.Workload != "" {
+		query = query + " AND workload = ?"
+		args = append(args, filter.Workload)
+	}
+	for k, v := range filter.Tags {
+		query = query + " AND EXISTS (SELECT 1 FROM tags t WHERE t.guid = experiments.guid AND t.key = ? AND t.value = ?)"
+		args = append(args, k, v)
+	}
+
+	rows, err := s.db.Query(query+" ORDER BY started, guid", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	experiments := make([]experiment.Experiment, 0)
+	for rows.Next() {
+		var guid string
+		if err = rows.Scan(&guid); err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, &sqliteExperiment{s, guid})
+	}
+	return experiments, rows.Err()
+}
+
+// Find looks an experiment up without loading the others.
+func (s *SqliteStore) Find(guid string) (experiment.Experiment, error) {
+	var exists int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM experiments WHERE guid = ?", guid).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, nil
+	}
+	return &sqliteExperiment{s, guid}, nil
+}
+
+// Configure records how an experiment was configured, it is called by the
+// laboratory before the experiment starts.
+func (s *SqliteStore) Configure(guid string, config experiment.ExperimentConfiguration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.begin(guid, time.Now(), config.Workload); err != nil {
+		return err
+	}
+
+	concurrency, _ := json.Marshal(config.Concurrency)
+	_, err := s.db.Exec("INSERT OR REPLACE INTO configuration (guid, iterations, concurrency, concurrency_step_time, interval, stop, window) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		guid, config.Iterations, string(concurrency), int64(config.ConcurrencyStepTime), config.Interval, config.Stop, int64(config.Window))
+	return err
+}
+
+// Describe records the metadata of an experiment, its tags are also added to
+// the tags table so that Query can filter on them.
+func (s *SqliteStore) Describe(guid string, metadata experiment.Metadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err = s.begin(guid, time.Now(), metadata.Workload); err != nil {
+		return err
+	}
+
+	if _, err = s.db.Exec("INSERT OR REPLACE INTO metadata (guid, data) VALUES (?, ?)", guid, string(data)); err != nil {
+		return err
+	}
+
+	for k, v := range metadata.Tags {
+		if err = s.tag(guid, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SqliteStore) Tag(guid string, key string, value string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.tag(guid, key, value)
+}
+
+func (s *SqliteStore) tag(guid string, key string, value string) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO tags (guid, key, value) VALUES (?, ?, ?)", guid, key, value)
+	return err
+}
+
+// Delete removes an experiment and everything recorded about it.
+func (s *SqliteStore) Delete(guid string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// experiments last, the other tables refer to it
+	for _, table := range []string{"iterations", "samples", "tags", "metadata", "configuration", "experiments"} {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE guid = ?", guid); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// begin adds the experiment if it is not there yet, and fills in its
+// workload if that was not known when it was added.
+func (s *SqliteStore) begin(guid string, started time.Time, workload string) error {
+	if _, err := s.db.Exec("INSERT OR IGNORE INTO experiments (guid, started, workload) VALUES (?, ?, ?)", guid, started.UnixNano(), workload); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec("UPDATE experiments SET workload = ? WHERE guid = ? AND workload = ''", workload, guid)
+	return err
+}
+
+// SqliteBatchSize and SqliteFlushInterval bound how many samples a writer
+// holds before writing them to the database in one transaction.
+var (
+	SqliteBatchSize     = 100
+	SqliteFlushInterval = time.Second
+)
+
+// Writer keeps the same samples as the CSV store: results, windows and the
+// marker of a cancelled experiment. They are written in batches so that the
+// sampler does not wait on the disk for each one.
+func (s *SqliteStore) Writer(guid string) func(samples <-chan *experiment.Sample) {
+	s.Lock()
+	s.begin(guid, time.Now(), "")
+	s.Unlock()
+
+	s.writers.Add(1)
+	return func(ch <-chan *experiment.Sample) {
+		defer s.writers.Done()
+		ticker := time.NewTicker(SqliteFlushInterval)
+		defer ticker.Stop()
+
+		batch := &sqliteBatch{store: s, guid: guid}
+		for {
+			select {
+			case sample, ok := <-ch:
+				if !ok {
+					batch.flush()
+					return
+				}
+				if !persisted(sample) {
+					continue
+				}
+				batch.pending = append(batch.pending, sample)
+				if len(batch.pending) >= SqliteBatchSize {
+					batch.flush()
+				}
+			case <-ticker.C:
+				batch.flush()
+			}
+		}
+	}
+}
+
+func persisted(sample *experiment.Sample) bool {
+	return sample.Type == experiment.ResultSample || sample.Type == experiment.WindowSample || sample.Type == experiment.CancelledSample
+}
+
+// sqliteBatch holds the samples of an experiment that have not been written
+// yet, and where the next ones go.
+type sqliteBatch struct {
+	store      *SqliteStore
+	guid       string
+	pending    []*experiment.Sample
+	seq        int
+	iterations int
+}
+
+func (b *sqliteBatch) flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+
+	b.store.Lock()
+	defer b.store.Unlock()
+
+	logger := logs.NewLogger("store.sqlite")
+	tx, err := b.store.db.Begin()
+	if err != nil {
+		logger.Errorf("Can't write samples: %v", err)
+		return
+	}
+
+	if b.seq == 0 {
+		if err := start(tx, b.guid, b.pending[0]); err != nil {
+			logger.Errorf("Can't record when the experiment started: %v", err)
+		}
+	}
+
+	for _, sample := range b.pending {
+		if err := insertSample(tx, b.guid, b.seq, sample); err != nil {
+			logger.Errorf("Can't write sample: %v", err)
+		}
+		b.seq++
+
+		if sample.Event != nil {
+			if err := insertIteration(tx, b.guid, b.iterations, sample.Event); err != nil {
+				logger.Errorf("Can't write iteration: %v", err)
+			}
+			b.iterations++
+		}
+	}
+	b.pending = b.pending[:0]
+
+	if err = tx.Commit(); err != nil {
+		logger.Errorf("Can't write samples: %v", err)
+	}
+}
+
+// start records the time of the first sample as when the experiment started,
+// as StartTime does, rather than when the writer was made. This keeps the
+// start of an experiment restored from an archive.
+func start(db execer, guid string, first *experiment.Sample) error {
+	started, err := time.Parse(time.RFC3339Nano, first.SystemTime)
+	if err != nil {
+		return nil
+	}
+
+	_, err = db.Exec("UPDATE experiments SET started = ? WHERE guid = ?", started.UnixNano(), guid)
+	return err
+}
+
+// execer is a database or a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertSample(db execer, guid string, seq int, sample *experiment.Sample) error {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT OR REPLACE INTO samples (guid, seq, type, data) VALUES (?, ?, ?, ?)", guid, seq, int(sample.Type), string(data))
+	return err
+}
+
+func insertIteration(db execer, guid string, seq int, event *experiment.Event) error {
+	steps, err := json.Marshal(event.Steps)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT OR REPLACE INTO iterations (guid, seq, started, worker, iteration, duration, steps, error, slave) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		guid, seq, event.Timestamp, event.Worker, event.Iteration, int64(event.Duration), string(steps), event.Error, event.Slave)
+	return err
+}
+
+// Import copies the experiments of a CSV output directory, with their raw
+// iterations when they were logged, into the database. Experiments that are
+// already in the database are skipped.
+func (s *SqliteStore) Import(dir string) (imported int, err error) {
+	experiments, err := NewCsvStore(dir, nil).LoadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range experiments {
+		var exists int
+		if err = s.db.QueryRow("SELECT COUNT(*) FROM experiments WHERE guid = ?", e.GetGuid()).Scan(&exists); err != nil {
+			return imported, err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		samples, err := e.GetData()
+		if err != nil {
+			return imported, err
+		}
+
+		if err = s.importSamples(e, samples); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func (s *SqliteStore) importSamples(e experiment.Experiment, samples []*experiment.Sample) error {
+	started := time.Now()
+	if len(samples) > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, samples[0].SystemTime); err == nil {
+			started = t
+		}
+	}
+
+	// the workload comes from the metadata, if the experiment has any
+	s.Lock()
+	err := s.begin(e.GetGuid(), started, "")
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	for i, sample := range samples {
+		if err = insertSample(s.db, e.GetGuid(), i, sample); err != nil {
+			break
+		}
+	}
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if source, ok := e.(experiment.MetadataSource); ok {
+		metadata, err := source.GetMetadata()
+		if err != nil {
+			return err
+		}
+		if err = s.Describe(e.GetGuid(), metadata); err != nil {
+			return err
+		}
+	}
+
+	if source, ok := e.(experiment.EventSource); ok {
+		events, err := source.GetEvents()
+		if err != nil {
+			return err
+		}
+		s.Lock()
+		defer s.Unlock()
+		for i, event := range events {
+			if err = insertIteration(s.db, e.GetGuid(), i, event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *sqliteExperiment) GetGuid() string {
+	return e.guid
+}
+
+func (e *sqliteExperiment) GetMetadata() (metadata experiment.Metadata, err error) {
+	var data string
+	err = e.store.db.QueryRow("SELECT data FROM metadata WHERE guid = ?", e.guid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal([]byte(data), &metadata)
+	return metadata, err
+}
+
+func (e *sqliteExperiment) GetConfiguration() (*experiment.ExperimentConfiguration, error) {
+	var concurrency string
+	var stepTime, window int64
+	config := &experiment.ExperimentConfiguration{}
+	err := e.store.db.QueryRow("SELECT c.iterations, c.concurrency, c.concurrency_step_time, c.interval, c.stop, c.window, e.workload FROM configuration c JOIN experiments e ON e.guid = c.guid WHERE c.guid = ?", e.guid).
+		Scan(&config.Iterations, &concurrency, &stepTime, &config.Interval, &config.Stop, &window, &config.Workload)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config.ConcurrencyStepTime = time.Duration(stepTime)
+	config.Window = time.Duration(window)
+	err = json.Unmarshal([]byte(concurrency), &config.Concurrency)
+	return config, err
+}
+
+func (e *sqliteExperiment) GetData() ([]*experiment.Sample, error) {
+	rows, err := e.store.db.Query("SELECT data FROM samples WHERE guid = ? ORDER BY seq", e.guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]*experiment.Sample, 0)
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var sample *experiment.Sample
+		if err = json.Unmarshal([]byte(data), &sample); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+func (e *sqliteExperiment) GetLastSample() (*experiment.Sample, error) {
+	var data string
+	err := e.store.db.QueryRow("SELECT data FROM samples WHERE guid = ? ORDER BY seq DESC LIMIT 1", e.guid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sample *experiment.Sample
+	err = json.Unmarshal([]byte(data), &sample)
+	return sample, err
+}
+
+func (e *sqliteExperiment) GetEvents() ([]*experiment.Event, error) {
+	rows, err := e.store.db.Query("SELECT started, worker, iteration, duration, steps, error, slave FROM iterations WHERE guid = ? ORDER BY seq", e.guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*experiment.Event, 0)
+	for rows.Next() {
+		var steps string
+		var duration int64
+		event := &experiment.Event{}
+		if err = rows.Scan(&event.Timestamp, &event.Worker, &event.Iteration, &duration, &steps, &event.Error, &event.Slave); err != nil {
+			return nil, err
+		}
+		event.Duration = time.Duration(duration)
+		if err = json.Unmarshal([]byte(steps), &event.Steps); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
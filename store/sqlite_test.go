@@ -0,0 +1,342 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cloudfoundry-incubator/pat/benchmarker"
+	"github.com/cloudfoundry-incubator/pat/experiment"
+	"github.com/cloudfoundry-incubator/pat/laboratory"
+	. "github.com/cloudfoundry-incubator/pat/store"
+	"github.com/cloudfoundry-incubator/pat/workloads"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sqlite Store", func() {
+	var (
+		dir   string
+		store *SqliteStore
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "sqlitestore")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err = NewSqliteStore(path.Join(dir, "db", "pat.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	write := func(guid string, samples ...*experiment.Sample) {
+		ch := make(chan *experiment.Sample)
+		go func() {
+			for _, s := range samples {
+				ch <- s
+			}
+			close(ch)
+		}()
+		store.Writer(guid)(ch)
+	}
+
+	configure := func(guid string, workload string) {
+		config := experiment.NewExperimentConfiguration(3, []int{1, 2}, time.Second, 0, 0, nil, workload)
+		Ω(store.Configure(guid, config)).Should(Succeed())
+	}
+
+	guids := func(experiments []experiment.Experiment) []string {
+		result := make([]string, len(experiments))
+		for i, e := range experiments {
+			result[i] = e.GetGuid()
+		}
+		return result
+	}
+
+	It("loads the samples it wrote, in order", func() {
+		write("abc", &experiment.Sample{Total: 1, Type: experiment.ResultSample}, &experiment.Sample{Total: 2, Commands: map[string]experiment.Command{"push": {Count: 2}}})
+
+		loaded, err := store.LoadAll()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(guids(loaded)).Should(Equal([]string{"abc"}))
+
+		data, err := loaded[0].GetData()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(data).Should(HaveLen(2))
+		Ω(data[0].Total).Should(BeEquivalentTo(1))
+		Ω(data[1].Commands["push"].Count).Should(BeEquivalentTo(2))
+	})
+
+	It("keeps only results, windows and the cancelled marker", func() {
+		write("abc", &experiment.Sample{Total: 1}, &experiment.Sample{Type: experiment.OtherSample}, &experiment.Sample{Type: experiment.WorkerSample},
+			&experiment.Sample{Type: experiment.WindowSample}, &experiment.Sample{Type: experiment.CancelledSample})
+
+		loaded, _ := store.LoadAll()
+		data, err := loaded[0].GetData()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(data).Should(HaveLen(3))
+		Ω(data[0].Type).Should(Equal(experiment.ResultSample))
+		Ω(data[1].Type).Should(Equal(experiment.WindowSample))
+		Ω(data[2].Type).Should(Equal(experiment.CancelledSample))
+	})
+
+	Describe("Batching", func() {
+		var batchSize int
+		var interval time.Duration
+
+		BeforeEach(func() {
+			batchSize, interval = SqliteBatchSize, SqliteFlushInterval
+		})
+
+		AfterEach(func() {
+			SqliteBatchSize, SqliteFlushInterval = batchSize, interval
+		})
+
+		stored := func() int {
+			found, _ := store.Find("abc")
+			if found == nil {
+				return 0
+			}
+			data, _ := found.GetData()
+			return len(data)
+		}
+
+		It("writes a full batch straight away", func() {
+			SqliteBatchSize, SqliteFlushInterval = 2, time.Hour
+			ch := make(chan *experiment.Sample)
+			go store.Writer("abc")(ch)
+
+			ch <- &experiment.Sample{Total: 1}
+			Consistently(stored, "100ms").Should(Equal(0))
+			ch <- &experiment.Sample{Total: 2}
+			Eventually(stored).Should(Equal(2))
+			close(ch)
+		})
+
+		It("writes a partial batch on the flush interval", func() {
+			SqliteFlushInterval = 50 * time.Millisecond
+			ch := make(chan *experiment.Sample)
+			go store.Writer("abc")(ch)
+
+			ch <- &experiment.Sample{Total: 1}
+			Eventually(stored).Should(Equal(1))
+			close(ch)
+		})
+	})
+
+	It("reads the last sample on its own", func() {
+		write("abc", &experiment.Sample{Total: 1}, &experiment.Sample{Total: 2, Type: experiment.CancelledSample})
+		write("empty")
+
+		loaded, _ := store.LoadAll()
+		last, err := loaded[0].(experiment.LastSampleSource).GetLastSample()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(last.Total).Should(BeEquivalentTo(2))
+		Ω(last.Type).Should(Equal(experiment.CancelledSample))
+
+		last, err = loaded[1].(experiment.LastSampleSource).GetLastSample()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(last).Should(BeNil())
+	})
+
+	It("finds an experiment without loading the others", func() {
+		write("abc", &experiment.Sample{Total: 1})
+
+		found, err := store.Find("abc")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found.GetGuid()).Should(Equal("abc"))
+		Ω(store.Find("unknown")).Should(BeNil())
+	})
+
+	It("keeps the raw iterations", func() {
+		event := &experiment.Event{Timestamp: "2014-01-01T00:00:00Z", Worker: 2, Iteration: 5, Duration: time.Second, Steps: []benchmarker.StepResult{{"push", time.Second}}, Error: "boom", Slave: "s1"}
+		write("abc", &experiment.Sample{Event: event}, &experiment.Sample{})
+
+		loaded, _ := store.LoadAll()
+		events, err := loaded[0].(experiment.EventSource).GetEvents()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(events).Should(Equal([]*experiment.Event{event}))
+	})
+
+	It("reads back how an experiment was configured", func() {
+		configure("abc", "cf:push")
+		write("def", &experiment.Sample{})
+
+		found, _ := store.Find("abc")
+		config, err := found.(experiment.ConfigurationSource).GetConfiguration()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config).Should(Equal(&experiment.ExperimentConfiguration{Iterations: 3, Concurrency: []int{1, 2}, ConcurrencyStepTime: time.Second, Workload: "cf:push", Window: experiment.DefaultWindow}))
+
+		found, _ = store.Find("def")
+		Ω(found.(experiment.ConfigurationSource).GetConfiguration()).Should(BeNil())
+	})
+
+	It("records the metadata of an experiment", func() {
+		Ω(store.Describe("abc", experiment.Metadata{StartedBy: "someone"})).Should(Succeed())
+		write("abc", &experiment.Sample{})
+		write("def", &experiment.Sample{})
+
+		loaded, _ := store.LoadAll()
+		Ω(loaded[0].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{StartedBy: "someone"}))
+		Ω(loaded[1].(experiment.MetadataSource).GetMetadata()).Should(Equal(experiment.Metadata{}))
+	})
+
+	It("deletes an experiment and everything recorded about it", func() {
+		configure("abc", "cf:push")
+		Ω(store.Describe("abc", experiment.Metadata{Tags: map[string]string{"env": "ci"}})).Should(Succeed())
+		write("abc", &experiment.Sample{Event: &experiment.Event{Iteration: 1}})
+		write("def", &experiment.Sample{})
+
+		Ω(store.Delete("abc")).Should(Succeed())
+		loaded, _ := store.LoadAll()
+		Ω(guids(loaded)).Should(Equal([]string{"def"}))
+		found, _ := store.Query(laboratory.Filter{Tags: map[string]string{"env": "ci"}})
+		Ω(found).Should(BeEmpty())
+	})
+
+	It("persists experiments across restarts", func() {
+		write("abc", &experiment.Sample{})
+		store.Close()
+
+		var err error
+		store, err = NewSqliteStore(path.Join(dir, "db", "pat.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+		loaded, _ := store.LoadAll()
+		Ω(guids(loaded)).Should(Equal([]string{"abc"}))
+	})
+
+	It("waits for running writers to finish before closing", func() {
+		ch := make(chan *experiment.Sample)
+		go store.Writer("abc")(ch)
+		ch <- &experiment.Sample{Total: 1}
+
+		closed := make(chan error)
+		go func() { closed <- store.Close() }()
+		Consistently(closed).ShouldNot(Receive())
+
+		ch <- &experiment.Sample{Total: 2}
+		close(ch)
+		Eventually(closed).Should(Receive(BeNil()))
+
+		var err error
+		store, err = NewSqliteStore(path.Join(dir, "db", "pat.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+		loaded, _ := store.LoadAll()
+		data, _ := loaded[0].GetData()
+		Ω(data).Should(HaveLen(2))
+	})
+
+	Describe("Filtering", func() {
+		var before, after time.Time
+
+		BeforeEach(func() {
+			configure("a", "cf:push")
+			write("a", &experiment.Sample{})
+			time.Sleep(10 * time.Millisecond)
+			before = time.Now()
+			configure("b", "dummy")
+			write("b", &experiment.Sample{})
+			Ω(store.Tag("b", "env", "ci")).Should(Succeed())
+			after = time.Now()
+			configure("c", "dummy")
+			write("c", &experiment.Sample{})
+			Ω(store.Tag("c", "env", "prod")).Should(Succeed())
+		})
+
+		It("filters by workload", func() {
+			found, err := store.Query(laboratory.Filter{Workload: "dummy"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"b", "c"}))
+		})
+
+		It("filters by start time", func() {
+			found, err := store.Query(laboratory.Filter{Since: before, Until: after})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"b"}))
+		})
+
+		It("filters by the time of the first sample rather than when it was written", func() {
+			restored := time.Now().Add(-48 * time.Hour)
+			Ω(store.Describe("d", experiment.Metadata{Name: "restored"})).Should(Succeed())
+			write("d", &experiment.Sample{SystemTime: restored.Format(time.RFC3339Nano)})
+
+			found, err := store.Query(laboratory.Filter{Until: before})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"d", "a"}))
+		})
+
+		It("filters by tag", func() {
+			found, err := store.Query(laboratory.Filter{Tags: map[string]string{"env": "prod"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"c"}))
+		})
+
+		It("filters by the tags an experiment was described with", func() {
+			Ω(store.Describe("a", experiment.Metadata{Name: "nightly", Tags: map[string]string{"env": "staging"}})).Should(Succeed())
+			found, err := store.Query(laboratory.Filter{Tags: map[string]string{"env": "staging"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"a"}))
+		})
+	})
+
+	Describe("Importing CSV output", func() {
+		var csvDir string
+
+		BeforeEach(func() {
+			csvDir = path.Join(dir, "csvs")
+			csvs := NewCsvStore(csvDir, &workloads.WorkloadList{[]workloads.WorkloadStep{workloads.Step("push", func() error { return nil }, "")}})
+
+			ch := make(chan *experiment.Sample)
+			go func() {
+				ch <- &experiment.Sample{Total: 1, Type: experiment.ResultSample, SystemTime: "2014-05-01T10:00:00Z", Commands: map[string]experiment.Command{"push": {Count: 1}},
+					Event: &experiment.Event{Timestamp: "2014-05-01T09:59:59Z", Duration: time.Second, Steps: []benchmarker.StepResult{{"push", time.Second}}}}
+				close(ch)
+			}()
+			csvs.Describe("imported", experiment.Metadata{Name: "nightly", Workload: "gcf:push"})
+			csvs.Writer("imported")(ch)
+		})
+
+		It("copies the experiments, samples and iterations into the database", func() {
+			imported, err := store.Import(csvDir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imported).Should(Equal(1))
+
+			found, err := store.Query(laboratory.Filter{Workload: "gcf:push", Until: time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC)})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"imported"}))
+
+			data, _ := found[0].GetData()
+			Ω(data).Should(HaveLen(1))
+			Ω(data[0].Total).Should(BeEquivalentTo(1))
+
+			events, _ := found[0].(experiment.EventSource).GetEvents()
+			Ω(events).Should(HaveLen(1))
+		})
+
+		It("leaves the workload empty when the experiment has no metadata", func() {
+			os.Remove(path.Join(csvDir, "imported.metadata.json"))
+			store.Import(csvDir)
+
+			found, err := store.Query(laboratory.Filter{Workload: "push"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(found).Should(BeEmpty())
+
+			found, err = store.Query(laboratory.Filter{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(guids(found)).Should(Equal([]string{"imported"}))
+		})
+
+		It("skips experiments that were already imported", func() {
+			store.Import(csvDir)
+			imported, err := store.Import(csvDir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imported).Should(Equal(0))
+		})
+	})
+})
@@ -1,6 +1,6 @@
 pat = {}
 
-pat.experiment = function(refreshRate) {
+pat.experiment = function(refreshRate, openStream) {
 
   function exports() {}
 
@@ -8,34 +8,124 @@ pat.experiment = function(refreshRate) {
   exports.url = ko.observable("")
   exports.csvUrl = ko.observable("")
   exports.data = ko.observableArray()
-  exports.config = { iterations: ko.observable(1), concurrency: ko.observable(1), interval: ko.observable(0), stop: ko.observable(0), cfWorkload: ko.observable(""), cfTarget: ko.observable(""), cfUsername: ko.observable(""), cfPassword: ko.observable(""), cfSpace: ko.observable("") }
+  exports.windows = ko.observableArray()
+  exports.errors = ko.observableArray()
+  exports.config = { iterations: ko.observable(1), concurrency: ko.observable("1"), concurrencyStepTime: ko.observable(60), interval: ko.observable(0), stop: ko.observable(0), window: ko.observable(10), app: ko.observable(""), manifest: ko.observable(""), cfWorkload: ko.observable(""), cfTarget: ko.observable(""), cfUsername: ko.observable(""), cfPassword: ko.observable(""), cfSpace: ko.observable(""), name: ko.observable(""), description: ko.observable(""), tags: ko.observable("") }
+
+  // polls instead when openStream is null, or the browser has no EventSource
+  if (openStream === undefined && window.EventSource) {
+    openStream = function(url) { return new EventSource(url) }
+  }
 
   var timer = null
+  var stream = null
+  var flush = null
 
   exports.refresh = function() {
     $.get(exports.url(), function(data) {
       exports.data(data.Items.filter(function(d) { return d.Type === 0 }))
+      exports.windows(data.Items.filter(function(d) { return d.Type === 4 }).map(function(d) { return d.Window }))
+      if (data.Items.some(function(d) { return d.Type === 5 })) {
+        exports.state("cancelled")
+        return
+      }
       exports.waitAndRefreshOnce()
     })
   }
 
   exports.refreshNow = function() {
     if(timer) { clearTimeout(timer) }
-    exports.refresh()
+    if(openStream) { exports.listen() } else { exports.refresh() }
   }
 
   exports.waitAndRefreshOnce = function() {
     timer = setTimeout(exports.refresh, refreshRate)
   }
 
+  // listen replays the samples of the experiment from its stream, then
+  // receives new ones as they are produced, until the experiment finishes.
+  exports.listen = function() {
+    if(stream) { stream.close() }
+    exports.data([])
+    exports.windows([])
+
+    var data = [], windows = [], cancelled = false
+    var redraw = function() {
+      flush = null
+      exports.data.push.apply(exports.data, data.splice(0))
+      exports.windows.push.apply(exports.windows, windows.splice(0))
+    }
+
+    stream = openStream(exports.url() + "/stream")
+    // the server replays every sample each time the stream reconnects
+    stream.addEventListener("open", function() {
+      data.splice(0)
+      windows.splice(0)
+      exports.data([])
+      exports.windows([])
+    })
+    stream.addEventListener("sample", function(e) {
+      var s = JSON.parse(e.data)
+      if (s.Type === 0) data.push(s)
+      if (s.Type === 4) windows.push(s.Window)
+      if (s.Type === 5) cancelled = true
+      if (!flush) flush = setTimeout(redraw, 0)
+    })
+    stream.addEventListener("end", function() {
+      stream.close()
+      stream = null
+      if (flush) { clearTimeout(flush); redraw() }
+      exports.state(cancelled ? "cancelled" : "finished")
+    })
+  }
+
+  // cancel asks the server to stop the experiment, the state follows once
+  // the stream reports that it has ended. If the server refuses, the
+  // experiment goes back to the state it was in and the error is shown.
+  exports.cancel = function() {
+    var previous = exports.state()
+    exports.state("stopping")
+    $.ajax({ url: exports.url() + "/cancel", type: "POST",
+      error: function(xhr) {
+        if (exports.state() == "stopping") exports.state(previous)
+        exports.errors([{ Field: "", Message: xhr.responseText || "the experiment could not be cancelled" }])
+      }
+    })
+  }
+
+  // spec is the experiment specification the server runs, text fields that
+  // are left empty keep the server's defaults.
+  exports.spec = function() {
+    var c = exports.config
+    var spec = { "iterations": Number(c.iterations()), "concurrency": String(c.concurrency()), "concurrency:timeBetweenSteps": Number(c.concurrencyStepTime()), "interval": Number(c.interval()), "stop": Number(c.stop()), "window": Number(c.window()) }
+    var text = { "workload": c.cfWorkload(), "app": c.app(), "app:manifest": c.manifest(), "rest:target": c.cfTarget(), "rest:username": c.cfUsername(), "rest:password": c.cfPassword(), "rest:space": c.cfSpace() }
+    for (var k in text) {
+      if (text[k]) spec[k] = text[k]
+    }
+    if (c.name()) spec.name = c.name()
+    if (c.description()) spec.description = c.description()
+    var tags = pat.parseTags(c.tags())
+    if (Object.keys(tags).length > 0) spec.tags = tags
+    return spec
+  }
+
   exports.run = function() {
     exports.state("running")
+    exports.errors([])
     exports.data([])
-		$.post( "/experiments/", { "iterations": exports.config.iterations(), "concurrency": exports.config.concurrency(), "interval": exports.config.interval(), "stop": exports.config.stop(),  "workload": exports.config.cfWorkload(), "cfTarget":  exports.config.cfTarget(), "cfUsername":  exports.config.cfUsername(), "cfPassword":  exports.config.cfPassword(), "cfSpace":  exports.config.cfSpace() }, function(data) {
-			exports.url(data.Location)
-			exports.csvUrl(data.CsvLocation)
-			exports.refreshNow()
-		})
+    exports.windows([])
+    $.ajax({ url: "/experiments/", type: "POST", contentType: "application/json", dataType: "json", data: JSON.stringify(exports.spec()),
+      success: function(data) {
+        exports.url(data.Location)
+        exports.csvUrl(data.CsvLocation)
+        exports.refreshNow()
+      },
+      error: function(xhr) {
+        var body = xhr.responseJSON || {}
+        exports.errors(body.Errors || [{ Field: "", Message: xhr.responseText || "the experiment could not be started" }])
+        exports.state("")
+      }
+    })
   }
 
   exports.view = function(url) {
@@ -52,6 +142,23 @@ pat.experiment = function(refreshRate) {
   return exports
 }
 
+// parseTags reads tags written as "key=value, key=value", items without a
+// key or a value are left out.
+pat.parseTags = function(text) {
+  var tags = {}
+  String(text || "").split(",").forEach(function(item) {
+    var i = item.indexOf("=")
+    if (i < 1) return
+    var key = item.slice(0, i).trim(), value = item.slice(i + 1).trim()
+    if (key) tags[key] = value
+  })
+  return tags
+}
+
+pat.formatTags = function(tags) {
+  return Object.keys(tags || {}).sort().map(function(k) { return k + "=" + tags[k] }).join(", ")
+}
+
 pat.experimentList = function() {
   var exports = {}
 
@@ -59,12 +166,19 @@ pat.experimentList = function() {
   var timer = null
   self.active = ko.observable()
 
+  // tagFilter lists only the experiments with some tags, e.g. "env=staging"
+  exports.tagFilter = ko.observable("")
+  // selected holds the guids of the experiments picked for comparing
+  exports.selected = ko.observableArray()
   exports.experiments = ko.observable()
   exports.refresh = function() {
-    $.get("/experiments/", function(data) {
+    var tags = pat.parseTags(exports.tagFilter())
+    var query = Object.keys(tags).map(function(k) { return "tag=" + encodeURIComponent(k + "=" + tags[k]) }).join("&")
+    $.get("/experiments/" + (query ? "?" + query : ""), function(data) {
       // fixme(jz) be better to do an append here, when server supports it
       data.Items.forEach(function(d) {
         d.active = ko.computed(function() { return self.active() == d.Location })
+        d.canDelete = d.State === "Finished" || d.State === "Cancelled" || d.State === "Unknown"
       })
       exports.experiments(data.Items.reverse())
       timer = setTimeout(exports.refresh, 1000 * 10)
@@ -76,6 +190,13 @@ pat.experimentList = function() {
     exports.refresh()
   }
 
+  // remove deletes a finished experiment from the history
+  exports.remove = function(experiment) {
+    $.ajax({ url: experiment.Location, type: "DELETE", success: exports.refreshNow })
+  }
+
+  exports.tagFilter.subscribe(exports.refreshNow)
+
   $(document).on("experimentChanged", function(e, url) {
     self.active(url)
   })
@@ -85,41 +206,149 @@ pat.experimentList = function() {
   return exports
 }
 
+// comparison loads several experiments lined up on the time since each of
+// them started, the first of them is the baseline of the deltas.
+pat.comparison = function() {
+  var exports = {}
+
+  exports.result = ko.observable(null)
+  exports.deltas = ko.computed(function() {
+    return exports.result() ? pat.commandDeltas(exports.result().Experiments) : []
+  })
+  exports.experiments = ko.computed(function() {
+    return exports.result() ? exports.result().Experiments : []
+  })
+  exports.error = ko.observable("")
+
+  exports.load = function(guids) {
+    exports.error("")
+    var query = guids.map(function(g) { return "experiment=" + encodeURIComponent(g) }).join("&")
+    $.ajax({ url: "/api/v1/compare?" + query, dataType: "json",
+      success: function(data) { exports.result(data) },
+      error: function(xhr) {
+        var body = xhr.responseJSON || {}
+        exports.result(null)
+        exports.error(body.Message || xhr.responseText || "the experiments could not be compared")
+      }
+    })
+  }
+
+  return exports
+}
+
+// commandDeltas lists the iteration and then each command with how long it
+// took on average and how often it ran in every experiment, by the last
+// sample of each. Deltas are the change in the average from the first
+// experiment, they are null for the first and where it lacks the command.
+pat.commandDeltas = function(experiments) {
+  const second = 1000000000;
+  var last = experiments.map(function(e) { return e.Last || { "Commands": {} } })
+
+  var names = d3.set()
+  last.forEach(function(l) { Object.keys(l.Commands || {}).forEach(function(n) { names.add(n) }) })
+
+  var row = function(name, read) {
+    var base = read(last[0])
+    return {
+      "name": name,
+      "values": last.map(function(l, i) {
+        var v = read(l)
+        return {
+          "average": v ? v.Average / second : null,
+          "throughput": v ? v.Throughput : null,
+          "delta": i > 0 && v && base && base.Average ? (v.Average - base.Average) / base.Average : null
+        }
+      })
+    }
+  }
+
+  return [row("Iteration", function(l) { return l.Total ? l : null })].concat(names.values().sort().map(function(n) {
+    return row(n, function(l) { return (l.Commands || {})[n] || null })
+  }))
+}
+
+pat.formatDelta = function(delta) {
+  if (delta === null) return ""
+  return (delta > 0 ? "+" : "") + (delta * 100).toFixed(1) + "%"
+}
+
 ko.bindingHandlers.chart = {
   c: {},
   init: function(element, valueAccessor) {
     ko.bindingHandlers.chart.b = d3_workload.init(element);
     ko.bindingHandlers.chart.t = d3_throughput.init(element);
+    ko.bindingHandlers.chart.l = d3_latency.init(element);
+    ko.bindingHandlers.chart.d = d3_distribution.init(element);
   },
   update: function(element, valueAccessor) {
     var data = ko.unwrap(valueAccessor())
     data.forEach(function(obj) {
       for (k in obj) {
         if (k == "Average" || k == "WallTime" || k == "LastResult" || k == "TotalTime") obj[k + '_fmt'] = (obj[k] / 1000000000).toFixed(2) + " sec";
+        if (k == "Throughput") obj[k + '_fmt'] = obj[k].toFixed(2) + " / sec";
       }
     });
     ko.bindingHandlers.chart.b(data);
     ko.bindingHandlers.chart.t(data);
+    ko.bindingHandlers.chart.l(data);
+    ko.bindingHandlers.chart.d(data);
+  }
+}
+
+ko.bindingHandlers.windowChart = {
+  init: function(element, valueAccessor) {
+    ko.bindingHandlers.windowChart.w = d3_window.init(element);
+  },
+  update: function(element, valueAccessor) {
+    ko.bindingHandlers.windowChart.w(ko.unwrap(valueAccessor()))
+  }
+}
+
+ko.bindingHandlers.compareChart = {
+  init: function(element, valueAccessor, allBindingsAccessor) {
+    var options = allBindingsAccessor()
+    element.compareChart = d3_compare.chart(element, options.compareTitle, options.compareValue)
+  },
+  update: function(element, valueAccessor) {
+    element.compareChart(ko.unwrap(valueAccessor()))
   }
 }
 
-pat.view = function(experimentList, experiment) {
+pat.view = function(experimentList, experiment, comparison) {
   var self = this
+  comparison = comparison || pat.comparison()
 
   var dom = new DOM();
   d3_workload.changeState(dom.showGraph)
   d3_throughput.changeState(dom.hideContent)
+  d3_window.changeState(dom.hideContent)
+  d3_latency.changeState(dom.hideContent)
+  d3_distribution.changeState(dom.hideContent)
 
   this.workloadVisible = ko.observable(true)
   this.throughputVisible = ko.observable(false)
+  this.windowVisible = ko.observable(false)
+  this.latencyVisible = ko.observable(false)
+  this.distributionVisible = ko.observable(false)
 
   this.workloadModels = new patWorkload();
 
   this.redirectTo = function(location) { window.location = location }
 
   this.start = function() { experiment.run() }
-  this.stop = function() { alert("Not implemented") }
+  this.stop = function() { experiment.cancel() }
   this.downloadCsv = function() { self.redirectTo(experiment.csvUrl()) }
+  this.showComparison = function() {
+    $("#historyPopup").modal("hide")
+    $("#comparePopup").modal("show")
+  }
+  this.compare = function() {
+    comparison.load(self.compareSelection())
+    self.showComparison()
+  }
+  this.deleteExperiment = function(e) {
+    if (window.confirm("Delete " + e.Name + " and all of its results?")) experimentList.remove(e)
+  }
 
   experiment.config.cfWorkload = this.workloadModels.workloads
   experiment.config.cfTarget = this.workloadModels.cfTarget
@@ -127,21 +356,47 @@ pat.view = function(experimentList, experiment) {
   experiment.config.cfPassword = this.workloadModels.cfPassword
   experiment.config.cfSpace = this.workloadModels.cfSpace
 
-  this.canStart = ko.computed(function() { return experiment.state() !== "running" })
+  this.canStart = ko.computed(function() { return experiment.state() !== "running" && experiment.state() !== "stopping" })
   this.canStop = ko.computed(function() { return experiment.state() === "running" })
   this.canDownloadCsv = ko.computed(function() { return experiment.csvUrl() !== "" })
   this.noExperimentRunning = ko.computed(function() { return self.canStart() })
   this.numIterations = experiment.config.iterations
   this.numIterationsHasError = ko.computed(function() { return experiment.config.iterations() <= 0 })
   this.numConcurrent = experiment.config.concurrency
-  this.numConcurrentHasError = ko.computed(function() { return experiment.config.concurrency() <= 0 })
+  this.numConcurrentHasError = ko.computed(function() {
+    var m = /^\s*(\d+)(\.\.(\d+))?\s*$/.exec(String(experiment.config.concurrency()))
+    if (!m) return true
+    return m[3] === undefined ? Number(m[1]) <= 0 : Number(m[3]) <= 0 || Number(m[1]) > Number(m[3])
+  })
+  this.numConcurrencyStepTime = experiment.config.concurrencyStepTime
+  this.numConcurrencyStepTimeHasError = ko.computed(function() { return experiment.config.concurrencyStepTime() < 0 })
   this.numInterval = experiment.config.interval
   this.numIntervalHasError = ko.computed(function() { return experiment.config.interval() < 0 })
   this.numStop = experiment.config.stop
   this.numStopHasError = ko.computed(function() { return experiment.config.stop() < 0 })
-  this.formHasNoErrors = ko.computed(function() { return ! ( this.workloadModels.validation.HasError() | this.numIterationsHasError() | this.numConcurrentHasError() | this.numIntervalHasError() | this.numStopHasError() ) }, this)
+  this.numWindow = experiment.config.window
+  this.numWindowHasError = ko.computed(function() { return experiment.config.window() < 0 })
+  this.appPath = experiment.config.app
+  this.manifestPath = experiment.config.manifest
+  this.experimentName = experiment.config.name
+  this.experimentDescription = experiment.config.description
+  this.experimentTags = experiment.config.tags
+  this.tagFilter = experimentList.tagFilter
+  this.formatTags = pat.formatTags
+  this.formHasNoErrors = ko.computed(function() { return ! ( this.workloadModels.validation.HasError() | this.numIterationsHasError() | this.numConcurrentHasError() | this.numConcurrencyStepTimeHasError() | this.numIntervalHasError() | this.numStopHasError() | this.numWindowHasError() ) }, this)
+  this.errors = experiment.errors
   this.previousExperiments = experimentList.experiments
+  this.compareSelection = experimentList.selected
+  this.canCompare = ko.computed(function() { return self.compareSelection().length >= 2 })
+  this.comparison = comparison.result
+  this.comparedExperiments = comparison.experiments
+  this.commandDeltas = comparison.deltas
+  this.comparisonError = comparison.error
+  this.formatDelta = pat.formatDelta
+  this.formatSeconds = function(v) { return v === null ? "-" : v.toFixed(2) + " sec" }
+  this.formatThroughput = function(v) { return v === null ? "-" : v.toFixed(2) + " / sec" }
   this.data = experiment.data
+  this.windows = experiment.windows
 
   experiment.url.subscribe(function(url) {
     window.location.hash = "#" + url
@@ -162,10 +417,16 @@ pat.view = function(experimentList, experiment) {
 
   this.showWorkload = function() { d3_workload.changeState(dom.contentIn); updateVisibility(self.workloadVisible) }
   this.showThroughput = function() { d3_throughput.changeState(dom.contentIn); updateVisibility(self.throughputVisible) }
+  this.showWindows = function() { d3_window.changeState(dom.contentIn); updateVisibility(self.windowVisible) }
+  this.showLatency = function() { d3_latency.changeState(dom.contentIn); updateVisibility(self.latencyVisible) }
+  this.showDistribution = function() { d3_distribution.changeState(dom.contentIn); updateVisibility(self.distributionVisible) }
 
   function updateVisibility(ob) {
     self.workloadVisible(false)
     self.throughputVisible(false)
+    self.windowVisible(false)
+    self.latencyVisible(false)
+    self.distributionVisible(false)
     ob(true)
   }
 
@@ -285,30 +285,25 @@ d3_workload = function() {
 
 }()
 
-d3_workload.toBarGraph = function(commands) {
-  var iterationStart = {}
-    var LastCmdDuration = 0;
-    var list = []
-    
-    for (var i = 0; i < commands.length; i++) {
-      LastCmdDuration = 0
-      for (var k in commands[i].Commands) {
-    
-        if (!iterationStart.k) {
-          iterationStart.k = []
-          iterationStart.k[0] = 0
-        } else if (!iterationStart.k[i]) {
-          iterationStart.k[i] = 0
-        }
-
-        iterationStart.k[i] += LastCmdDuration
-        LastCmdDuration = commands[i].Commands[k].LastTime
-
-        list.push( {"label": k, "y": iterationStart.k[i], "height": commands[i].Commands[k].LastTime, "iteration": i} )
-      }
-      
-    }
-    return list
-     
+d3_workload.toBarGraph = function(data) {
+  var list = []
+
+  for (var i = 0; i < data.length; i++) {
+    var y = 0
+    d3_workload.steps(data[i]).forEach(function(step) {
+      list.push( {"label": step.label, "y": y, "height": step.duration, "iteration": i} )
+      y += step.duration
+    })
+  }
+  return list
 }
 
+// steps are the commands of the iteration a result sample counts, with how
+// long each took. The server sends them with the sample when the store keeps
+// events, otherwise the last time of each command is the best guess.
+d3_workload.steps = function(d) {
+  if (d.Event && d.Event.Steps) {
+    return d.Event.Steps.map(function(s) { return {"label": s.Command, "duration": s.Duration} })
+  }
+  return Object.keys(d.Commands || {}).map(function(k) { return {"label": k, "duration": d.Commands[k].LastTime} })
+}
@@ -0,0 +1,131 @@
+d3_compare = function() {
+  const second = 1000000000;
+
+  var margin = {top: 40, right: 30, bottom: 30, left: 50};
+
+  // chart draws the value of each step of every experiment in a comparison
+  // against the time since the experiments started, unlike the other charts
+  // there can be more than one of these on the page.
+  var chart = function(el, title, value) {
+    var jqObj = $(el);
+    var width = jqObj.width() || 860, height = jqObj.height() || 300;
+    var svgWidth = width - margin.left - margin.right;
+    var svgHeight = height - margin.top - margin.bottom;
+    var x = d3.scale.linear().range([0, svgWidth]);
+    var y = d3.scale.linear().range([svgHeight, 10]);
+    var color = d3.scale.category10();
+
+    var xAxis = d3.svg.axis()
+      .scale(x)
+      .orient("bottom")
+      .tickSize(-svgHeight);
+    var yAxis = d3.svg.axis()
+      .scale(y)
+      .orient("left")
+      .tickSize(-svgWidth);
+
+    var d3Graph = document.createElement('div');
+    d3Graph.className = "compareContainer";
+    el.appendChild(d3Graph);
+
+    var svg = d3.select(d3Graph)
+      .append("svg")
+        .attr("width", width)
+        .attr("height", height)
+        .attr("class", "compare")
+      .append("g")
+        .attr("transform", "translate(" + margin.left + "," + margin.top + ")");
+
+    svg.append("g")
+      .attr("class", "x axis")
+      .attr("transform", "translate(0," + svgHeight + ")")
+      .call(xAxis);
+    svg.append("g")
+      .attr("class", "y axis")
+      .call(yAxis);
+
+    var graphBox = svg.append("g");
+    var legendBox = svg.append("g");
+
+    svg.append("text")
+      .attr("x", svgWidth - 15)
+      .attr("y", svgHeight + 25)
+      .text("Time Since Start (seconds)")
+      .attr("text-anchor", "end");
+    svg.append("text")
+      .attr("x", svgWidth / 2)
+      .attr("y", -10)
+      .text(title)
+      .attr("style", "text-anchor: middle; font-size: 15pt; fill: #888;");
+
+    return function(comparison) {
+      if (!comparison) return;
+
+      var lines = d3_compare.toLines(comparison, value)
+      x.domain([0, d3.max(comparison.Times) / second || 1]);
+      y.domain([0, d3.max(lines, function(l) { return d3.max(l.values, function(v) { return v.y }) }) || 1]);
+      color.domain(lines.map(function(l) { return l.name }));
+      svg.select(".x.axis").call(xAxis);
+      svg.select(".y.axis").call(yAxis);
+
+      var paths = graphBox.selectAll("path.line").data(lines)
+      paths.enter()
+        .append("path")
+          .attr("class", "line")
+      paths.style("stroke", function(l) { return color(l.name) })
+        .attr("d", function(l) {
+          return d3.svg.line()
+            .defined(function(v) { return v.y !== null })
+            .x(function(v) { return x(v.x) })
+            .y(function(v) { return y(v.y) })(l.values)
+        })
+      paths.exit().remove();
+
+      var legend = legendBox.selectAll("g.comparelegend").data(lines)
+      var entered = legend.enter()
+        .append("g")
+          .attr("class", "comparelegend")
+      entered.append("rect")
+        .attr("x", 10)
+        .attr("height", 10)
+        .attr("width", 30)
+      entered.append("text")
+        .attr("x", 45)
+        .attr("dy", ".7em")
+        .attr("style", "text-anchor: start;")
+      legend.select("rect")
+        .attr("y", function(d, i) { return i * 15 + 2 })
+        .style("fill", function(d) { return color(d.name) })
+      legend.select("text")
+        .attr("y", function(d, i) { return i * 15 + 3 })
+        .text(function(d) { return d.name })
+      legend.exit().remove();
+    }
+  }
+
+  return {
+    chart: chart
+  }
+
+}()
+
+// values reads what a chart of a comparison draws from each step.
+d3_compare.values = {
+  "latency": function(p) { return p.Count ? p.Average / 1000000000 : null },
+  "throughput": function(p) { return p.Throughput }
+}
+
+// toLines turns a comparison into a line for each experiment, of the value
+// of each step against the time the step ended. Steps of the latency line
+// without any iterations are left as gaps.
+d3_compare.toLines = function(comparison, value) {
+  const second = 1000000000;
+  var read = d3_compare.values[value]
+
+  return comparison.Experiments.map(function(e) {
+    return {
+      "name": e.Name || e.Guid,
+      "values": (e.Points || []).map(function(p, i) { return { "x": comparison.Times[i] / second, "y": read(p) } })
+    }
+  })
+}
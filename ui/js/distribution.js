@@ -0,0 +1,151 @@
+d3_distribution = function() {
+  const second = 1000000000,
+        bins = 20;
+
+  var margin = {top: 50, right: 50, bottom: 30, left: 40};
+  var svgWidth, svgHeight;
+  var x, y, yCumulative, xAxis, yAxis, yCumulativeAxis, svg, graphBox;
+
+  var d3Graph = document.createElement('div');
+  d3Graph.className = "distributionContainer";
+  d3Graph.width = "100%";
+  d3Graph.height = "100%";
+
+  var initDOM = function(el) {
+    var jqObj = $(el);
+
+    svgWidth = jqObj.width() - margin.left - margin.right;
+    svgHeight = jqObj.height() - margin.top - margin.bottom;
+    x = d3.scale.linear().range([0, svgWidth]);
+    y = d3.scale.linear().range([svgHeight, 10]);
+    yCumulative = d3.scale.linear().domain([0, 1]).range([svgHeight, 10]);
+
+    xAxis = d3.svg.axis()
+      .scale(x)
+      .orient("bottom");
+    yAxis = d3.svg.axis()
+      .scale(y)
+      .orient("left")
+      .tickFormat(d3.format("d"))
+      .tickSize(-svgWidth);
+    yCumulativeAxis = d3.svg.axis()
+      .scale(yCumulative)
+      .orient("right")
+      .tickFormat(d3.format("%"));
+
+    el.appendChild(d3Graph);
+
+    svg = d3.select(d3Graph)
+      .append("svg")
+        .attr("width", jqObj.width())
+        .attr("height", jqObj.height())
+        .attr("class", "distribution")
+      .append("g")
+        .attr("transform", "translate(" + margin.left + "," + margin.top + ")");
+
+    svg.append("g")
+      .attr("class", "x axis")
+      .attr("transform", "translate(0," + svgHeight + ")")
+      .call(xAxis);
+    svg.append("g")
+      .attr("class", "y axis")
+      .call(yAxis);
+    svg.append("g")
+      .attr("class", "y cumulative axis")
+      .attr("transform", "translate(" + svgWidth + ",0)")
+      .call(yCumulativeAxis);
+
+    graphBox = svg.append("g");
+    graphBox.append("path")
+      .attr("class", "cdf");
+    var p95 = graphBox.append("g")
+      .attr("class", "p95");
+    p95.append("line")
+      .attr("y1", 10)
+      .attr("y2", svgHeight);
+    p95.append("text")
+      .attr("x", 4)
+      .attr("y", 20);
+
+    svg.append("text")
+      .attr("x", svgWidth - 15)
+      .attr("y", svgHeight + 25)
+      .text("Iteration Duration (seconds)")
+      .attr("text-anchor", "end");
+    svg.append("text")
+      .attr("x", svgWidth / 2)
+      .attr("y", -10)
+      .text("Distribution of Iteration Durations")
+      .attr("style", "text-anchor: middle; font-size: 15pt; fill: #888;");
+  } //end initDOM
+
+  var drawGraph = function(data) {
+    if (!data[0]) return;
+
+    var histogram = d3_distribution.toHistogram(data, bins)
+    var p95 = d3_distribution.percentile(data.map(function(d) { return d.LastResult }), 0.95) / second
+    var last = histogram[histogram.length - 1]
+    x.domain([histogram[0].x, Math.max(last.x + last.dx, histogram[0].x + 1)]);
+    y.domain([0, d3.max(histogram, function(b) { return b.count }) || 1]);
+    svg.select(".x.axis").call(xAxis);
+    svg.select(".y.axis").call(yAxis);
+
+    var width = function(b) { return Math.max(1, x(b.x + b.dx) - x(b.x) - 1) }
+    var bars = graphBox.selectAll("rect.bin").data(histogram)
+    bars.enter()
+      .insert("rect", "path.cdf")
+        .attr("class", "bin")
+    bars.transition()
+      .attr("x", function(b) { return x(b.x) })
+      .attr("width", width)
+      .attr("y", function(b) { return y(b.count) })
+      .attr("height", function(b) { return svgHeight - y(b.count) })
+    bars.exit().remove();
+
+    graphBox.select("path.cdf")
+      .datum(histogram)
+      .transition()
+      .attr("d", d3.svg.line()
+        .x(function(b) { return x(b.x + b.dx) })
+        .y(function(b) { return yCumulative(b.cumulative) }));
+
+    graphBox.select("g.p95")
+      .attr("transform", "translate(" + x(p95) + ",0)")
+      .select("text")
+        .text("95th percentile " + p95.toFixed(2) + " sec");
+  } //end drawGraph
+
+  var changeState = function(fn) {
+    fn(d3Graph)
+  }
+
+  return {
+    init: function(el) {
+      initDOM(el);
+      return drawGraph;
+    },
+    changeState: changeState
+  }
+
+}()
+
+// percentile is the nearest rank percentile of the values, as the server
+// works out the 95th percentile of a window.
+d3_distribution.percentile = function(values, p) {
+  if (!values.length) return 0
+  var sorted = values.slice().sort(d3.ascending)
+  return sorted[Math.max(0, Math.ceil(sorted.length * p) - 1)]
+}
+
+// toHistogram counts the iterations of the result samples by how long they
+// took, in seconds, with the share of iterations up to the end of each bin.
+d3_distribution.toHistogram = function(data, bins) {
+  const second = 1000000000;
+  var values = data.map(function(d) { return d.LastResult / second })
+
+  var seen = 0
+  return d3.layout.histogram().bins(bins)(values).map(function(b) {
+    seen += b.y
+    return { "x": b.x, "dx": b.dx, "count": b.y, "cumulative": seen / values.length }
+  })
+}
@@ -0,0 +1,181 @@
+d3_latency = function() {
+  const second = 1000000000,
+        slices = 20;
+
+  var margin = {top: 50, right: 50, bottom: 30, left: 40};
+  var svgWidth, svgHeight;
+  var x, y, yErrors, xAxis, yAxis, yErrorsAxis, svg, graphBox, legendBox, color;
+
+  var d3Graph = document.createElement('div');
+  d3Graph.className = "latencyContainer";
+  d3Graph.width = "100%";
+  d3Graph.height = "100%";
+
+  var initDOM = function(el) {
+    var jqObj = $(el);
+
+    svgWidth = jqObj.width() - margin.left - margin.right;
+    svgHeight = jqObj.height() - margin.top - margin.bottom;
+    x = d3.scale.linear().range([0, svgWidth]);
+    y = d3.scale.linear().range([svgHeight, 10]);
+    yErrors = d3.scale.linear().domain([0, 1]).range([svgHeight, 10]);
+    color = d3.scale.category10();
+
+    xAxis = d3.svg.axis()
+      .scale(x)
+      .orient("bottom")
+      .tickSize(-svgHeight);
+    yAxis = d3.svg.axis()
+      .scale(y)
+      .orient("left")
+      .tickSize(-svgWidth);
+    yErrorsAxis = d3.svg.axis()
+      .scale(yErrors)
+      .orient("right")
+      .tickFormat(d3.format("%"));
+
+    el.appendChild(d3Graph);
+
+    svg = d3.select(d3Graph)
+      .append("svg")
+        .attr("width", jqObj.width())
+        .attr("height", jqObj.height())
+        .attr("class", "latency")
+      .append("g")
+        .attr("transform", "translate(" + margin.left + "," + margin.top + ")");
+
+    svg.append("g")
+      .attr("class", "x axis")
+      .attr("transform", "translate(0," + svgHeight + ")")
+      .call(xAxis);
+    svg.append("g")
+      .attr("class", "y axis")
+      .call(yAxis);
+    svg.append("g")
+      .attr("class", "y errors axis")
+      .attr("transform", "translate(" + svgWidth + ",0)")
+      .call(yErrorsAxis);
+
+    graphBox = svg.append("g");
+    graphBox.append("path")
+      .attr("class", "errorrate");
+    legendBox = svg.append("g");
+
+    svg.append("text")
+      .attr("x", svgWidth - 15)
+      .attr("y", svgHeight + 25)
+      .text("Wall Time (seconds)")
+      .attr("text-anchor", "end");
+    svg.append("text")
+      .attr("x", svgWidth / 2)
+      .attr("y", -10)
+      .text("Latency per Command (seconds) and Error Rate")
+      .attr("style", "text-anchor: middle; font-size: 15pt; fill: #888;");
+  } //end initDOM
+
+  var drawGraph = function(data) {
+    if (!data[0]) return;
+
+    var lines = d3_latency.toLines(data)
+    var errors = d3_latency.errorRate(data, slices)
+    x.domain([0, d3.max(data, function(d) { return d.WallTime / second }) || 1]);
+    y.domain([0, d3.max(lines, function(l) { return d3.max(l.values, function(v) { return v.y }) }) || 1]);
+    color.domain(lines.map(function(l) { return l.name }));
+    svg.select(".x.axis").call(xAxis);
+    svg.select(".y.axis").call(yAxis);
+
+    graphBox.select("path.errorrate")
+      .datum(errors)
+      .transition()
+      .attr("d", d3.svg.area()
+        .interpolate("step-before")
+        .x(function(e) { return x(e.x) })
+        .y0(svgHeight)
+        .y1(function(e) { return yErrors(e.y) }));
+
+    var paths = graphBox.selectAll("path.line").data(lines, function(l) { return l.name })
+    paths.enter()
+      .append("path")
+        .attr("class", "line")
+    paths.style("stroke", function(l) { return color(l.name) })
+      .transition()
+      .attr("d", function(l) {
+        return d3.svg.line()
+          .x(function(v) { return x(v.x) })
+          .y(function(v) { return y(v.y) })(l.values)
+      })
+    paths.exit().remove();
+
+    var legend = legendBox.selectAll("g.latencylegend").data(lines.concat([{ name: "Error rate", errors: true }]))
+    var entered = legend.enter()
+      .append("g")
+        .attr("class", "latencylegend")
+    entered.append("rect")
+      .attr("x", 30)
+      .attr("height", 10)
+      .attr("width", 55)
+    entered.append("text")
+      .attr("x", 90)
+      .attr("dy", ".7em")
+      .attr("style", "text-anchor: start;")
+    legend.select("rect")
+      .attr("y", function(d, i) { return i * 15 + 2 })
+      .attr("class", function(d) { return d.errors ? "errorrate" : "" })
+      .style("fill", function(d) { return d.errors ? null : color(d.name) })
+    legend.select("text")
+      .attr("y", function(d, i) { return i * 15 + 3 })
+      .text(function(d) { return d.name })
+    legend.exit().remove();
+  } //end drawGraph
+
+  var changeState = function(fn) {
+    fn(d3Graph)
+  }
+
+  return {
+    init: function(el) {
+      initDOM(el);
+      return drawGraph;
+    },
+    changeState: changeState
+  }
+
+}()
+
+// toLines turns result samples into a line for each command, of how long the
+// command took in each iteration against the wall time the iteration ended.
+d3_latency.toLines = function(data) {
+  const second = 1000000000;
+  var lines = {}, names = []
+
+  data.forEach(function(d) {
+    d3_workload.steps(d).forEach(function(s) {
+      if (!lines[s.label]) {
+        lines[s.label] = []
+        names.push(s.label)
+      }
+      lines[s.label].push({ "x": d.WallTime / second, "y": s.duration / second })
+    })
+  })
+  return names.map(function(name) { return { "name": name, "values": lines[name] } })
+}
+
+// errorRate splits the wall time of the result samples into n slices, and
+// gives the share of the iterations ending in each slice that failed.
+d3_latency.errorRate = function(data, n) {
+  const second = 1000000000;
+  if (!data[0]) return []
+
+  var end = d3.max(data, function(d) { return d.WallTime }) || 1
+  var slices = d3.range(n).map(function(i) { return { "x": (i + 1) * end / n / second, "count": 0, "errors": 0 } })
+  var errors = 0
+  data.forEach(function(d) {
+    var slice = slices[Math.min(n - 1, Math.floor(d.WallTime / end * n))]
+    slice.count++
+    if (d.TotalErrors > errors) {
+      slice.errors += d.TotalErrors - errors
+      errors = d.TotalErrors
+    }
+  })
+  return slices.map(function(s) { return { "x": s.x, "y": s.count ? s.errors / s.count : 0 } })
+}
@@ -196,20 +196,25 @@ describe("Workload List", function(){
 describe("The view", function() {
   var experiment
   var experimentList
+  var comparison
   var workloadNode
   var throughputNode
+  var windowNode
 
   beforeEach(function() {
-    experiment = { run: function() {}, url: ko.observable(""), state: ko.observable(""), view: function() {}, csvUrl: ko.observable(""), config: { iterations: ko.observable(1), concurrency: ko.observable(1), interval: ko.observable(0), stop: ko.observable(0) } }
-    experimentList = { experiments: [], refreshNow: function(){} }
+    experiment = { run: function() {}, url: ko.observable(""), state: ko.observable(""), view: function() {}, csvUrl: ko.observable(""), windows: ko.observableArray(), errors: ko.observableArray(), config: { iterations: ko.observable(1), concurrency: ko.observable("1"), concurrencyStepTime: ko.observable(60), interval: ko.observable(0), stop: ko.observable(0), window: ko.observable(10), app: ko.observable(""), manifest: ko.observable("") } }
+    experimentList = { experiments: [], selected: ko.observableArray(), refreshNow: function(){} }
+    comparison = { load: function() {}, result: ko.observable(null), experiments: ko.observableArray(), deltas: ko.observableArray(), error: ko.observable("") }
     spyOn(experimentList, "refreshNow")
     spyOn(experiment, "view")
     spyOn(experiment, "run")
-    v = new pat.view(experimentList, experiment)
+    spyOn(comparison, "load")
+    v = new pat.view(experimentList, experiment, comparison)
     spyOn(v, "redirectTo").andReturn()
     v.start()
     workloadNode = $("div.workloadContainer").get(0)
     throughputNode = $("div.throughputContainer").get(0)
+    windowNode = $("div.windowContainer").get(0)
   })
 
   describe("clicking start", function() {
@@ -231,6 +236,38 @@ describe("The view", function() {
     })
   })
 
+  describe("showWindows()", function() {
+    it("shows the interval statistics graph and hides others when called", function() {
+      v.showWindows()
+      expect( $(windowNode).css('display') ).toBe("block")
+      expect( $(workloadNode).css('display') ).toBe("none")
+      expect( $(throughputNode).css('display') ).toBe("none")
+    })
+
+    it("sets windowVisible to true", function() {
+      v.showWindows()
+      expect(v.windowVisible()).toBe(true)
+      expect(v.throughputVisible()).toBe(false)
+    })
+  })
+
+  describe("showLatency()", function() {
+    it("sets latencyVisible to true and the others to false", function() {
+      v.showLatency()
+      expect(v.latencyVisible()).toBe(true)
+      expect(v.workloadVisible()).toBe(false)
+      expect(v.distributionVisible()).toBe(false)
+    })
+  })
+
+  describe("showDistribution()", function() {
+    it("sets distributionVisible to true and the others to false", function() {
+      v.showDistribution()
+      expect(v.distributionVisible()).toBe(true)
+      expect(v.latencyVisible()).toBe(false)
+    })
+  })
+
   describe("showWorkload()", function() {
     it("shows workload graph and hides others when called", function() {
       v.showWorkload()
@@ -264,6 +301,28 @@ describe("The view", function() {
     })
   })
 
+  describe("clicking stop", function() {
+    beforeEach(function() {
+      experiment.cancel = function() {}
+      spyOn(experiment, "cancel")
+      experiment.state("running")
+      v.stop()
+    })
+
+    it("cancels the experiment", function() {
+      expect(experiment.cancel).toHaveBeenCalled()
+    })
+  })
+
+  describe("when the experiment is stopping", function() {
+    beforeEach(function() { experiment.state("stopping") })
+
+    it("can neither start nor stop", function() {
+      expect(v.canStart()).toBe(false)
+      expect(v.canStop()).toBe(false)
+    })
+  })
+
   describe("validation", function() {
     it("prevents iterations being <= 0", function() {
       v.numIterations(-1)
@@ -281,6 +340,30 @@ describe("The view", function() {
       expect(v.formHasNoErrors()).toBe(false)
     })
 
+    it("allows concurrency to ramp up", function() {
+      v.numConcurrent("1..10")
+      expect(v.numConcurrentHasError()).toBe(false)
+    })
+
+    it("prevents concurrency from ramping down or being malformed", function() {
+      v.numConcurrent("10..1")
+      expect(v.numConcurrentHasError()).toBe(true)
+      v.numConcurrent("1-10")
+      expect(v.numConcurrentHasError()).toBe(true)
+    })
+
+    it("prevents the time between concurrency steps being < 0", function() {
+      v.numConcurrencyStepTime(-1)
+      expect(v.numConcurrencyStepTimeHasError()).toBe(true)
+      expect(v.formHasNoErrors()).toBe(false)
+    })
+
+    it("prevents window being < 0", function() {
+      v.numWindow(-1)
+      expect(v.numWindowHasError()).toBe(true)
+      expect(v.formHasNoErrors()).toBe(false)
+    })
+
     it("prevents interval being < 0", function() {
       v.numInterval(-1)
       expect(v.numIntervalHasError()).toBe(true)
@@ -321,6 +404,45 @@ describe("The view", function() {
     })
   })
 
+  describe("deleting an experiment from the history", function() {
+    beforeEach(function() {
+      experimentList.remove = jasmine.createSpy("remove")
+    })
+
+    it("deletes it once the user confirms", function() {
+      spyOn(window, "confirm").andReturn(true)
+      v.deleteExperiment({ "Name": "Nightly push" })
+      expect(window.confirm.mostRecentCall.args[0]).toContain("Nightly push")
+      expect(experimentList.remove).toHaveBeenCalledWith({ "Name": "Nightly push" })
+    })
+
+    it("keeps it when the user does not", function() {
+      spyOn(window, "confirm").andReturn(false)
+      v.deleteExperiment({ "Name": "Nightly push" })
+      expect(experimentList.remove).not.toHaveBeenCalled()
+    })
+  })
+
+  describe("comparing experiments from the history", function() {
+    beforeEach(function() {
+      spyOn(v, "showComparison")
+    })
+
+    it("needs at least two experiments", function() {
+      experimentList.selected(["a"])
+      expect(v.canCompare()).toBe(false)
+      experimentList.selected(["a", "b"])
+      expect(v.canCompare()).toBe(true)
+    })
+
+    it("loads the comparison of the picked experiments and shows it", function() {
+      experimentList.selected(["a", "b"])
+      v.compare()
+      expect(comparison.load).toHaveBeenCalledWith(["a", "b"])
+      expect(v.showComparison).toHaveBeenCalled()
+    })
+  })
+
   describe("Previous Histories Popup", function() {
     it("should be hidden from the view by default", function() {
       var property = $('#historyPopup').css('display');
@@ -781,8 +903,190 @@ describe("Bar chart", function() {
     expect(cmdData[2]).toEqual({"label" : "dummy3", "y" : 4 * sec, "height" : 2 * sec, "iteration" : 0})
   })
 
+  it("stacks the steps of the iteration itself when the sample has them", function() {
+    var data = [{"Commands": { "push": { "LastTime": 9 * sec } }, "LastResult": 3 * sec},
+                {"Commands": { "push": { "LastTime": 9 * sec } }, "LastResult": 3 * sec,
+                 "Event": {"Steps": [{"Command": "login", "Duration": 1 * sec}, {"Command": "push", "Duration": 2 * sec}]}}]
+
+    var cmdData = d3_workload.toBarGraph(data)
+
+    expect(cmdData.length).toBe(3)
+    expect(cmdData[0]).toEqual({"label" : "push", "y" : 0, "height" : 9 * sec, "iteration" : 0})
+    expect(cmdData[1]).toEqual({"label" : "login", "y" : 0, "height" : 1 * sec, "iteration" : 1})
+    expect(cmdData[2]).toEqual({"label" : "push", "y" : 1 * sec, "height" : 2 * sec, "iteration" : 1})
+  })
+
 });
 
+describe("Latency chart", function() {
+  const sec = 1000000000;
+
+  var chart, node
+  var data = [
+    {"WallTime": 2 * sec, "TotalErrors": 0, "Event": {"Steps": [{"Command": "login", "Duration": 1 * sec}, {"Command": "push", "Duration": 3 * sec}]}},
+    {"WallTime": 4 * sec, "TotalErrors": 1, "Event": {"Steps": [{"Command": "login", "Duration": 2 * sec}]}},
+    {"WallTime": 6 * sec, "TotalErrors": 1, "Event": {"Steps": [{"Command": "login", "Duration": 1 * sec}, {"Command": "push", "Duration": 4 * sec}]}},
+    {"WallTime": 8 * sec, "TotalErrors": 1, "Event": {"Steps": [{"Command": "login", "Duration": 1 * sec}, {"Command": "push", "Duration": 2 * sec}]}}
+  ]
+
+  beforeEach(function() {
+    $("div.latencyContainer").empty();
+    $("#target").empty();
+    chart = d3_latency.init(document.getElementById("target"));
+    node = $("div.latencyContainer").get(0);
+  })
+
+  it("draws a line for each command", function() {
+    chart(data)
+    expect($(node).find("path.line").length).toBe(2)
+  })
+
+  it("lists each command and the error rate in the legend", function() {
+    chart(data)
+    var legend = $(node).find("g.latencylegend text").map(function() { return this.textContent }).get()
+    expect(legend).toEqual(["login", "push", "Error rate"])
+  })
+
+  it("turns samples into the time each command took against wall time", function() {
+    var lines = d3_latency.toLines(data)
+    expect(lines.map(function(l) { return l.name })).toEqual(["login", "push"])
+    expect(lines[1].values).toEqual([{"x": 2, "y": 3}, {"x": 6, "y": 4}, {"x": 8, "y": 2}])
+  })
+
+  it("works out the share of iterations that failed in each slice of wall time", function() {
+    expect(d3_latency.errorRate(data, 2)).toEqual([{"x": 4, "y": 0}, {"x": 8, "y": 1 / 3}])
+    expect(d3_latency.errorRate([], 2)).toEqual([])
+  })
+})
+
+describe("Distribution chart", function() {
+  const sec = 1000000000;
+
+  var chart, node
+  var data = []
+  for (var i = 1; i <= 20; i++) {
+    data.push({"LastResult": i * sec})
+  }
+
+  beforeEach(function() {
+    $("div.distributionContainer").empty();
+    $("#target").empty();
+    chart = d3_distribution.init(document.getElementById("target"));
+    node = $("div.distributionContainer").get(0);
+  })
+
+  it("draws a bar for each bin of iteration durations", function() {
+    chart(data)
+    expect($(node).find("rect.bin").length).toBe(20)
+  })
+
+  it("marks the 95th percentile", function() {
+    chart(data)
+    expect($(node).find("g.p95 text").text()).toBe("95th percentile 19.00 sec")
+  })
+
+  it("works out nearest rank percentiles", function() {
+    expect(d3_distribution.percentile([5, 1, 4, 2, 3], 0.95)).toBe(5)
+    expect(d3_distribution.percentile([5, 1, 4, 2, 3], 0.5)).toBe(3)
+    expect(d3_distribution.percentile([], 0.95)).toBe(0)
+  })
+
+  it("counts iterations by duration with the cumulative share", function() {
+    var histogram = d3_distribution.toHistogram(data, 4)
+    expect(histogram.map(function(b) { return b.count })).toEqual([5, 5, 5, 5])
+    expect(histogram.map(function(b) { return b.cumulative })).toEqual([0.25, 0.5, 0.75, 1])
+    expect(histogram[0].x).toBe(1)
+  })
+})
+
+describe("Comparison chart", function() {
+  const sec = 1000000000;
+
+  var chart, node
+  var comparison = {
+    "Step": 5 * sec,
+    "Times": [5 * sec, 10 * sec, 15 * sec],
+    "Experiments": [
+      {"Guid": "a", "Name": "before", "Points": [{"Count": 2, "Average": 2 * sec, "Throughput": 0.4}, {"Count": 0, "Average": 0, "Throughput": 0}, {"Count": 1, "Average": 4 * sec, "Throughput": 0.2}]},
+      {"Guid": "b", "Points": [{"Count": 1, "Average": 3 * sec, "Throughput": 0.2}]}
+    ]
+  }
+
+  beforeEach(function() {
+    $("#target").empty();
+    chart = d3_compare.chart(document.getElementById("target"), "Latency", "latency");
+    node = $("#target div.compareContainer").get(0);
+  })
+
+  it("draws a line for each experiment", function() {
+    chart(comparison)
+    expect($(node).find("path.line").length).toBe(2)
+  })
+
+  it("names each experiment in the legend", function() {
+    chart(comparison)
+    var legend = $(node).find("g.comparelegend text").map(function() { return this.textContent }).get()
+    expect(legend).toEqual(["before", "b"])
+  })
+
+  it("leaves gaps in the latency where no iteration ended", function() {
+    var lines = d3_compare.toLines(comparison, "latency")
+    expect(lines[0].values).toEqual([{"x": 5, "y": 2}, {"x": 10, "y": null}, {"x": 15, "y": 4}])
+    expect(lines[1].values).toEqual([{"x": 5, "y": 3}])
+  })
+
+  it("draws the throughput of each step", function() {
+    var lines = d3_compare.toLines(comparison, "throughput")
+    expect(lines[0].values.map(function(v) { return v.y })).toEqual([0.4, 0, 0.2])
+  })
+})
+
+describe("Comparing experiments", function() {
+  const sec = 1000000000;
+
+  var comparison
+
+  beforeEach(function() {
+    comparison = pat.comparison()
+  })
+
+  it("asks the server for the experiments lined up", function() {
+    spyOn($, "ajax").andCallFake(function(options) { options.success({ "Experiments": [] }) })
+    comparison.load(["a", "b c"])
+    expect($.ajax.mostRecentCall.args[0].url).toBe("/api/v1/compare?experiment=a&experiment=b%20c")
+    expect(comparison.result()).toEqual({ "Experiments": [] })
+  })
+
+  it("shows why the experiments could not be compared", function() {
+    spyOn($, "ajax").andCallFake(function(options) { options.error({ "responseJSON": { "Message": "no such experiment" } }) })
+    comparison.load(["a", "b"])
+    expect(comparison.result()).toBe(null)
+    expect(comparison.error()).toBe("no such experiment")
+  })
+
+  it("works out the change of each command from the first experiment", function() {
+    var deltas = pat.commandDeltas([
+      {"Last": {"Total": 4, "Average": 2 * sec, "Throughput": 1, "Commands": {"push": {"Average": 2 * sec, "Throughput": 1}}}},
+      {"Last": {"Total": 4, "Average": 3 * sec, "Throughput": 0.5, "Commands": {"push": {"Average": 1 * sec, "Throughput": 2}, "login": {"Average": 1 * sec, "Throughput": 2}}}}
+    ])
+    expect(deltas.map(function(d) { return d.name })).toEqual(["Iteration", "login", "push"])
+    expect(deltas[0].values).toEqual([{"average": 2, "throughput": 1, "delta": null}, {"average": 3, "throughput": 0.5, "delta": 0.5}])
+    expect(deltas[1].values[1].delta).toBe(null)
+    expect(deltas[2].values[1].delta).toBe(-0.5)
+  })
+
+  it("has no values for experiments without results", function() {
+    var deltas = pat.commandDeltas([{}, {"Last": {"Total": 1, "Average": 1 * sec, "Throughput": 1, "Commands": {}}}])
+    expect(deltas[0].values).toEqual([{"average": null, "throughput": null, "delta": null}, {"average": 1, "throughput": 1, "delta": null}])
+  })
+
+  it("formats deltas as percentages", function() {
+    expect(pat.formatDelta(0.5)).toBe("+50.0%")
+    expect(pat.formatDelta(-0.25)).toBe("-25.0%")
+    expect(pat.formatDelta(null)).toBe("")
+  })
+})
+
 describe("The experiment list", function() {
 
   var self = this
@@ -806,6 +1110,38 @@ describe("The experiment list", function() {
       expect(list.experiments()).toEqual(self.experiments.reverse())
     })
 
+    it("asks only for the experiments with the tags of the filter", function() {
+      list.tagFilter("env=staging")
+      expect($.get.mostRecentCall.args[0]).toBe("/experiments/?tag=env%3Dstaging")
+    })
+
+    it("formats tags for the list", function() {
+      expect(pat.formatTags({ "team": "runtime", "env": "staging" })).toBe("env=staging, team=runtime")
+      expect(pat.formatTags(undefined)).toBe("")
+    })
+
+    it("only lets experiments that have finished be deleted", function() {
+      self.experiments = [ { "State": "Running" }, { "State": "Queued" }, { "State": "Finished" }, { "State": "Cancelled" } ]
+      list.refresh()
+      expect(list.experiments().map(function(e) { return e.canDelete })).toEqual([true, true, false, false])
+    })
+
+    describe("deleting an experiment", function() {
+      beforeEach(function() {
+        spyOn($, "ajax").andCallFake(function(options) { options.success() })
+        list.remove({ "Location": "/experiments/123" })
+      })
+
+      it("asks the server to delete it", function() {
+        expect($.ajax.mostRecentCall.args[0].url).toBe("/experiments/123")
+        expect($.ajax.mostRecentCall.args[0].type).toBe("DELETE")
+      })
+
+      it("refreshes the list", function() {
+        expect($.get.callCount).toBe(2)
+      })
+    })
+
     describe("when an experimentChanged event fired", function() {
       it("sets the active experiment in the list", function() {
         $(document).trigger("experimentChanged", "/experiments/123")
@@ -827,18 +1163,20 @@ describe("Running an experiment", function my() {
     var concurrency = 5
     var experiment
     var listener = { onExperimentChanged: function() {} }
+    var streams
 
     beforeEach(function() {
 
       replyUrl = replyUrl + 1
+      streams = []
 
-      spyOn($, "post").andCallFake(function(url, data, callback) { callback({ "Location": replyUrl }) })
+      spyOn($, "ajax").andCallFake(function(options) { options.success({ "Location": replyUrl }) })
       spyOn($, "get").andCallFake(function(url, callback) {  })
       spyOn(listener, "onExperimentChanged")
 
       $(document).on("experimentChanged", listener.onExperimentChanged)
 
-      experiment = pat.experiment()
+      experiment = pat.experiment(800, function(url) { streams.push(url); return fakeStream() })
       experiment.config.iterations(pushes)
       experiment.config.concurrency(concurrency)
       experiment.data([1,2,3])
@@ -846,16 +1184,39 @@ describe("Running an experiment", function my() {
     })
 
     it("sends a POST to the /experiments/ endpoint", function() {
-      expect($.post).toHaveBeenCalledWith("/experiments/", jasmine.any(Object), jasmine.any(Function))
+      expect($.ajax.mostRecentCall.args[0].url).toBe("/experiments/")
+      expect($.ajax.mostRecentCall.args[0].type).toBe("POST")
+      expect($.ajax.mostRecentCall.args[0].contentType).toBe("application/json")
     })
 
-    it("sends the iterations and concurrency in the POST body", function() {
-      expect($.post.mostRecentCall.args[1].iterations).toBe(3)
-      expect($.post.mostRecentCall.args[1].concurrency).toBe(5)
+    it("sends the experiment specification as JSON in the POST body", function() {
+      var spec = JSON.parse($.ajax.mostRecentCall.args[0].data)
+      expect(spec.iterations).toBe(3)
+      expect(spec.concurrency).toBe("5")
+      expect(spec["concurrency:timeBetweenSteps"]).toBe(60)
+      expect(spec.window).toBe(10)
     })
 
-    it("sends a GET to the tracking URL", function() {
-      expect($.get).toHaveBeenCalledWith(replyUrl, jasmine.any(Function))
+    it("leaves out empty text fields so the server defaults are used", function() {
+      var spec = JSON.parse($.ajax.mostRecentCall.args[0].data)
+      expect(spec.app).toBeUndefined()
+      expect(spec["rest:space"]).toBeUndefined()
+      expect(spec.name).toBeUndefined()
+      expect(spec.tags).toBeUndefined()
+    })
+
+    it("sends the name, description and tags", function() {
+      experiment.config.name("nightly")
+      experiment.config.description("the nightly push")
+      experiment.config.tags("env=staging, team = runtime, broken")
+      var spec = experiment.spec()
+      expect(spec.name).toBe("nightly")
+      expect(spec.description).toBe("the nightly push")
+      expect(spec.tags).toEqual({ "env": "staging", "team": "runtime" })
+    })
+
+    it("opens a stream of the samples of the tracking URL", function() {
+      expect(streams).toEqual([replyUrl + "/stream"])
     })
 
     it("clears any existing data", function() {
@@ -867,7 +1228,110 @@ describe("Running an experiment", function my() {
     })
   })
 
-  describe("When results are returned", function() {
+  describe("When the specification is not valid", function() {
+    var experiment
+
+    beforeEach(function() {
+      spyOn($, "ajax").andCallFake(function(options) {
+        options.error({ status: 400, responseJSON: { "Errors": [{ "Field": "concurrency", "Message": "must not ramp down" }] } })
+      })
+      experiment = pat.experiment(800, null)
+      experiment.run()
+    })
+
+    it("shows the errors", function() {
+      expect(experiment.errors()).toEqual([{ "Field": "concurrency", "Message": "must not ramp down" }])
+    })
+
+    it("is no longer running", function() {
+      expect(experiment.state()).toBe("")
+    })
+  })
+
+  describe("When results are streamed", function() {
+    var stream
+    var experiment
+
+    beforeEach(function() {
+      jasmine.Clock.useMock()
+      stream = fakeStream()
+      spyOn($, "ajax").andCallFake(function(options) { options.success({ "Location": replyUrl }) })
+      experiment = pat.experiment(800, function(url) { return stream })
+      experiment.run()
+    })
+
+    it("adds each result sample and window as it arrives", function() {
+      stream.send("sample", {"Type": 0, "name": "a"})
+      stream.send("sample", {"Type": 4, "Window": {"Count": 3}})
+      stream.send("sample", {"Type": 1, "name": "b"})
+      jasmine.Clock.tick(1)
+      expect(experiment.data()).toEqual([{"Type": 0, "name": "a"}])
+      expect(experiment.windows()).toEqual([{"Count": 3}])
+
+      stream.send("sample", {"Type": 0, "name": "c"})
+      jasmine.Clock.tick(1)
+      expect(experiment.data().length).toEqual(2)
+    })
+
+    it("starts over when the stream reconnects, as the server replays every sample", function() {
+      stream.send("open", {})
+      stream.send("sample", {"Type": 0, "name": "a"})
+      jasmine.Clock.tick(1)
+      stream.send("open", {})
+      stream.send("sample", {"Type": 0, "name": "a"})
+      jasmine.Clock.tick(1)
+      expect(experiment.data()).toEqual([{"Type": 0, "name": "a"}])
+    })
+
+    it("closes the stream and finishes when the experiment ends", function() {
+      stream.send("sample", {"Type": 0, "name": "a"})
+      stream.send("end", {})
+      expect(stream.closed).toBe(true)
+      expect(experiment.data().length).toEqual(1)
+      expect(experiment.state()).toBe("finished")
+    })
+
+    it("is cancelled when the experiment ends with a cancelled sample", function() {
+      stream.send("sample", {"Type": 0, "name": "a"})
+      stream.send("sample", {"Type": 5, "name": "b"})
+      stream.send("end", {})
+      expect(experiment.data().length).toEqual(1)
+      expect(experiment.state()).toBe("cancelled")
+    })
+
+    describe("cancelling", function() {
+      beforeEach(function() {
+        $.ajax.andCallFake(function(options) {})
+        experiment.cancel()
+      })
+
+      it("asks the server to cancel the experiment", function() {
+        expect($.ajax.mostRecentCall.args[0].url).toBe(replyUrl + "/cancel")
+        expect($.ajax.mostRecentCall.args[0].type).toBe("POST")
+      })
+
+      it("goes back to running and shows the error when the server refuses", function() {
+        $.ajax.mostRecentCall.args[0].error({ status: 409, responseText: "experiment is not running\n" })
+        expect(experiment.state()).toBe("running")
+        expect(experiment.errors()).toEqual([{ Field: "", Message: "experiment is not running\n" }])
+      })
+
+      it("is stopping until the stream ends", function() {
+        expect(experiment.state()).toBe("stopping")
+        stream.send("sample", {"Type": 5})
+        stream.send("end", {})
+        expect(experiment.state()).toBe("cancelled")
+      })
+    })
+
+    it("does not poll", function() {
+      spyOn($, "get")
+      jasmine.Clock.tick(2000)
+      expect($.get).not.toHaveBeenCalled()
+    })
+  })
+
+  describe("When results are polled, in browsers without EventSource", function() {
 
     var refreshRate = 800
     var csvUrl   = "foo/bar/baz.csv"
@@ -877,12 +1341,12 @@ describe("Running an experiment", function my() {
     beforeEach(function() {
       a = {"Type": 0, "name": "a"}
       b = {"Type": 1, "name": "b"}
-      spyOn($, "post").andCallFake(function(url, data, callback) { callback({ "Location": replyUrl, "CsvLocation": csvUrl }) })
+      spyOn($, "ajax").andCallFake(function(options) { options.success({ "Location": replyUrl, "CsvLocation": csvUrl }) })
       spyOn($, "get").andCallFake(function(url, callback) {
         callback({ "Items": [a,b] })
       })
 
-      experiment = pat.experiment(refreshRate)
+      experiment = pat.experiment(refreshRate, null)
       spyOn(experiment, "refresh").andCallThrough()
       spyOn(experiment, "waitAndRefreshOnce") //mocked because jasmine.Clock was being painful
       experiment.run()
@@ -909,6 +1373,22 @@ describe("Running an experiment", function my() {
     it("updates the state to 'running'", function() {
       expect(experiment.state()).toBe("running")
     })
+
+    it("stops refreshing once the experiment was cancelled", function() {
+      $.get.mostRecentCall.args[1]({"Items": [{"Type": 0}, {"Type": 5}]})
+      expect(experiment.waitAndRefreshOnce.callCount).toEqual(1)
+      expect(experiment.state()).toBe("cancelled")
+    })
   })
 })
 
+function fakeStream() {
+  var listeners = {}
+  var stream = {
+    closed: false,
+    addEventListener: function(name, fn) { listeners[name] = fn },
+    close: function() { stream.closed = true },
+    send: function(name, data) { listeners[name]({ data: JSON.stringify(data) }) }
+  }
+  return stream
+}
@@ -0,0 +1,132 @@
+d3_window = function() {
+  const second = 1000000000;
+
+  var margin = {top: 50, right: 50, bottom: 30, left: 40};
+  var svgWidth, svgHeight;
+  var x, y, yLatency, xAxis, yAxis, yLatencyAxis, svg, graphBox, color;
+
+  var series = [
+    { name: "Throughput / sec", value: function(w) { return w.Throughput }, latency: false },
+    { name: "Average (sec)", value: function(w) { return w.Average / second }, latency: true },
+    { name: "95th Percentile (sec)", value: function(w) { return w.NinetyfifthPercentile / second }, latency: true },
+    { name: "Errors", value: function(w) { return w.Errors }, latency: false }
+  ];
+
+  var d3Graph = document.createElement('div');
+  d3Graph.className = "windowContainer";
+  d3Graph.width = "100%";
+  d3Graph.height = "100%";
+
+  var initDOM = function(el) {
+    var jqObj = $(el);
+
+    svgWidth = jqObj.width() - margin.left - margin.right;
+    svgHeight = jqObj.height() - margin.top - margin.bottom;
+    x = d3.scale.linear().range([0, svgWidth]);
+    y = d3.scale.linear().range([svgHeight, 10]);
+    yLatency = d3.scale.linear().range([svgHeight, 10]);
+    color = d3.scale.category10().domain(series.map(function(s) { return s.name }));
+
+    xAxis = d3.svg.axis()
+      .scale(x)
+      .orient("bottom")
+      .tickFormat(d3.format("d"))
+      .tickSize(-svgHeight);
+    yAxis = d3.svg.axis()
+      .scale(y)
+      .orient("left")
+      .tickSize(-svgWidth);
+    yLatencyAxis = d3.svg.axis()
+      .scale(yLatency)
+      .orient("right");
+
+    el.appendChild(d3Graph);
+
+    svg = d3.select(d3Graph)
+      .append("svg")
+        .attr("width", jqObj.width())
+        .attr("height", jqObj.height())
+        .attr("class", "window")
+      .append("g")
+        .attr("transform", "translate(" + margin.left + "," + margin.top + ")");
+
+    svg.append("g")
+      .attr("class", "x axis")
+      .attr("transform", "translate(0," + svgHeight + ")")
+      .call(xAxis);
+    svg.append("g")
+      .attr("class", "y axis")
+      .call(yAxis);
+    svg.append("g")
+      .attr("class", "y latency axis")
+      .attr("transform", "translate(" + svgWidth + ",0)")
+      .call(yLatencyAxis);
+
+    graphBox = svg.append("g");
+
+    svg.append("text")
+      .attr("x", svgWidth - 15)
+      .attr("y", svgHeight + 25)
+      .text("Seconds")
+      .attr("text-anchor", "end");
+    svg.append("text")
+      .attr("x", svgWidth / 2)
+      .attr("y", -10)
+      .text("Interval Statistics")
+      .attr("style", "text-anchor: middle; font-size: 15pt; fill: #888;");
+
+    var legend = svg.selectAll("g.windowlegend").data(series).enter()
+      .append("g")
+        .attr("class", "windowlegend")
+    legend.append("rect")
+      .attr("x", 30)
+      .attr("y", function(d, i) { return i * 15 + 2 })
+      .attr("height", 10)
+      .attr("width", 55)
+      .style("fill", function(d) { return color(d.name) })
+    legend.append("text")
+      .attr("x", 90)
+      .attr("y", function(d, i) { return i * 15 + 3 })
+      .attr("dy", ".7em")
+      .attr("style", "text-anchor: start;")
+      .text(function(d) { return d.name })
+  } //end initDOM
+
+  var drawGraph = function(windows) {
+    if (!windows[0]) return;
+
+    var start = function(w) { return (w.Start + w.Duration) / second }
+    x.domain([0, d3.max(windows, start)]);
+    y.domain([0, d3.max(series.filter(function(s) { return !s.latency }), function(s) { return d3.max(windows, s.value) }) || 1]);
+    yLatency.domain([0, d3.max(series.filter(function(s) { return s.latency }), function(s) { return d3.max(windows, s.value) }) || 1]);
+    svg.select(".x.axis").call(xAxis);
+    svg.select(".y.axis").call(yAxis);
+    svg.select(".y.latency.axis").call(yLatencyAxis);
+
+    var lines = graphBox.selectAll("path.line").data(series)
+    lines.enter()
+      .append("path")
+        .attr("class", "line")
+        .style("stroke", function(s) { return color(s.name) })
+    lines.transition()
+      .attr("d", function(s) {
+        var scale = s.latency ? yLatency : y
+        return d3.svg.line()
+          .x(function(w) { return x(start(w)) })
+          .y(function(w) { return scale(s.value(w)) })(windows)
+      })
+  } //end drawGraph
+
+  var changeState = function(fn) {
+    fn(d3Graph)
+  }
+
+  return {
+    init: function(el) {
+      initDOM(el);
+      return drawGraph;
+    },
+    changeState: changeState
+  }
+
+}()
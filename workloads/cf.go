@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -30,14 +29,7 @@ func random(min, max int) int {
 func Dummy(ctx context.Context) error {
 	guid, _ := uuid.NewV4()
 	appName := "pats-" + guid.String()
-	appNames, _ := ctx.GetString("appNames")
-
-	if appNames != "" {
-		appNames += fmt.Sprintf(",%s", appName)
-	} else {
-		appNames = appName
-	}
-	ctx.PutString("appNames", appNames)
+	rememberAppName(ctx, appName)
 
 	time.Sleep(time.Duration(random(1, 5)) * time.Second)
 	return nil
@@ -61,14 +53,7 @@ func Push(ctx context.Context) error {
 	pathToApp, _ := ctx.GetString("app")
 	pathToManifest, _ := ctx.GetString("app:manifest")
 	appName := "pats-" + guid.String()
-	appNames, _ := ctx.GetString("appNames")
-
-	if appNames != "" {
-		appNames += fmt.Sprintf(",%s", appName)
-	} else {
-		appNames = appName
-	}
-	ctx.PutString("appNames", appNames)
+	rememberAppName(ctx, appName)
 
 	if pathToManifest == "" {
 		return expectCfToSay("App started", "push", appName, "-m", "64M", "-p", pathToApp)
@@ -78,18 +63,25 @@ func Push(ctx context.Context) error {
 }
 
 func Delete(ctx context.Context) error {
-	appNames, _ := ctx.GetString("appNames")
-	if appNames == "" {
+	workerCtx := ctx.Scoped(context.WorkerScope)
+	appNames, _ := workerCtx.GetStrings("appNames")
+	if len(appNames) == 0 {
 		return errors.New("No app to delete")
 	}
-	appNamesArray := strings.Split(appNames, ",")
-	appNameToDelete := appNamesArray[len(appNamesArray)-1]
+	appNameToDelete := appNames[len(appNames)-1]
 
-	appNames = strings.Replace(appNames, ","+appNameToDelete, "", -1)
-	appNames = strings.Replace(appNames, appNameToDelete, "", -1)
-	ctx.PutString("appNames", appNames)
+	workerCtx.PutStrings("appNames", appNames[:len(appNames)-1])
 	return expectCfToSay("Deleting app", "delete", appNameToDelete, "-f")
 }
+
+// app names are kept in the worker scope, so that a later iteration on the
+// same worker can delete an app pushed by an earlier one
+func rememberAppName(ctx context.Context, appName string) {
+	workerCtx := ctx.Scoped(context.WorkerScope)
+	appNames, _ := workerCtx.GetStrings("appNames")
+	workerCtx.PutStrings("appNames", append(appNames, appName))
+}
+
 func CopyAndReplaceText(srcDir string, dstDir string, searchText string, replaceText string) error {
 	return filepath.Walk(srcDir, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/cloudfoundry-incubator/pat/context"
 	"github.com/cloudfoundry-incubator/pat/logs"
 )
 
@@ -84,6 +85,17 @@ func (context *rest) PostToUaaSuccessfully(url string, data url.Values, response
 	})
 }
 
+var sensitiveFields = []string{"access_token", "refresh_token", "password"}
+
+func redact(body map[string]interface{}) map[string]interface{} {
+	for _, k := range sensitiveFields {
+		if _, ok := body[k]; ok {
+			body[k] = context.Redacted
+		}
+	}
+	return body
+}
+
 func jsonToString(data interface{}) io.Reader {
 	j, _ := json.Marshal(data)
 	return strings.NewReader(string(j))
@@ -118,7 +130,7 @@ func (client rest) req(token string, method string, url string, contentType stri
 	if TRACE_REST_CALLS {
 		body := make(map[string]interface{})
 		json.Unmarshal(resp_body, &body)
-		logger.Debug1f(">> %s", body)
+		logger.Debug1f(">> %s", redact(body))
 	}
 
 	json.Unmarshal(resp_body, &reply)
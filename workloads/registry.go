@@ -0,0 +1,48 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type registry struct {
+	sync.Mutex
+	steps []WorkloadStep
+}
+
+var registered = &registry{}
+
+func Register(step WorkloadStep) error {
+	if step.Name == "" {
+		return errors.New("a workload step must have a name")
+	}
+
+	if step.Fn == nil {
+		return fmt.Errorf("workload step %s has no function", step.Name)
+	}
+
+	registered.Lock()
+	defer registered.Unlock()
+
+	for _, existing := range registered.list().Workloads {
+		if existing.Name == step.Name {
+			return fmt.Errorf("workload step %s is already registered", step.Name)
+		}
+	}
+
+	registered.steps = append(registered.steps, step)
+	return nil
+}
+
+func Registered() *WorkloadList {
+	registered.Lock()
+	defer registered.Unlock()
+	return registered.list()
+}
+
+func (r *registry) list() *WorkloadList {
+	list := DefaultWorkloadList()
+	list.Workloads = append(list.Workloads, r.steps...)
+	return list
+}
@@ -33,16 +33,14 @@ func NewRestWorkloadWithClient(client httpclient) *rest {
 func PopulateRestContext(target string, username string, password string, space string, ctx context.Context) {
 	ctx.PutString("rest:target", target)
 	ctx.PutString("rest:username", username)
-	ctx.PutString("rest:password", password)
+	ctx.PutSecret("rest:password", password)
 	ctx.PutString("rest:space", space)
 }
 
 func (r *rest) Target(ctx context.Context) error {
-	var target string
-	if _, ok := ctx.GetString("rest:target"); ok {
-		target, _ = ctx.GetString("rest:target")
-	} else {
-		return errors.New("argument rest:target does not exist")
+	target, err := ctx.GetString("rest:target")
+	if err != nil {
+		return argumentError("rest:target", err)
 	}
 
 	body := &TargetResponse{}
@@ -56,26 +54,23 @@ func (r *rest) Target(ctx context.Context) error {
 func (r *rest) Login(ctx context.Context) error {
 	body := &LoginResponse{}
 
-	iterationIndex, exist := ctx.GetInt("iterationIndex")
-	if !exist {
-		return errors.New("Iteration Index does not exist in context map")
+	iterationIndex, err := ctx.GetInt("iterationIndex")
+	if err != nil {
+		return err
 	}
 
-	var userList, passList string
-	if _, ok := ctx.GetString("rest:username"); ok {
-		userList, _ = ctx.GetString("rest:username")
-	} else {
-		return errors.New("argument rest:username does not exist")
+	userList, err := ctx.GetString("rest:username")
+	if err != nil {
+		return argumentError("rest:username", err)
 	}
-	if _, ok := ctx.GetString("rest:password"); ok {
-		passList, _ = ctx.GetString("rest:password")
-	} else {
-		return errors.New("argument rest:password does not exist")
+	passList, err := ctx.GetString("rest:password")
+	if err != nil {
+		return argumentError("rest:password", err)
 	}
 
 	return checkTargetted(ctx, func(loginEndpoint string, apiEndpoint string) error {
 		return r.PostToUaaSuccessfully(fmt.Sprintf("%s/oauth/token", loginEndpoint), r.oauthInputs(credentialsForWorker(iterationIndex, userList, passList)), body, func(reply Reply) error {
-			ctx.PutString("token", body.Token)
+			ctx.PutSecret("token", body.Token)
 			return r.targetSpace(ctx)
 		})
 	})
@@ -84,11 +79,9 @@ func (r *rest) Login(ctx context.Context) error {
 func (r *rest) targetSpace(ctx context.Context) error {
 	apiEndpoint, _ := ctx.GetString("apiEndpoint")
 
-	var space string
-	if _, ok := ctx.GetString("rest:space"); ok {
-		space, _ = ctx.GetString("rest:space")
-	} else {
-		return errors.New("argument rest:space does not exist")
+	space, err := ctx.GetString("rest:space")
+	if err != nil {
+		return argumentError("rest:space", err)
 	}
 	replyBody := &SpaceResponse{}
 
@@ -204,28 +197,35 @@ func checkSpaceExists(s *SpaceResponse, then func() error) error {
 }
 
 func checkLoggedIn(ctx context.Context, then func(token string) error) error {
-	if _, exists := ctx.GetString("token"); !exists {
+	token, err := ctx.GetString("token")
+	if err != nil {
 		return errors.New("Error: not logged in")
 	}
 
-	token, _ := ctx.GetString("token")
 	return then(token)
 }
 
 func checkTargetted(ctx context.Context, then func(loginEndpoint string, apiEndpoint string) error) error {
-	if _, exists := ctx.GetString("loginEndpoint"); !exists {
+	loginEndpoint, err := ctx.GetString("loginEndpoint")
+	if err != nil {
 		return errors.New("Not targetted")
 	}
 
-	if _, exists := ctx.GetString("apiEndpoint"); !exists {
+	apiEndpoint, err := ctx.GetString("apiEndpoint")
+	if err != nil {
 		return errors.New("Not targetted")
 	}
 
-	apiEndpoint, _ := ctx.GetString("apiEndpoint")
-	loginEndpoint, _ := ctx.GetString("loginEndpoint")
 	return then(loginEndpoint, apiEndpoint)
 }
 
+func argumentError(name string, err error) error {
+	if context.IsNotFound(err) {
+		return fmt.Errorf("argument %s does not exist", name)
+	}
+	return err
+}
+
 func checkSuccessfulReply(reply Reply, then func() error) error {
 	if err := reply.checkError(); err != nil {
 		return err
@@ -49,11 +49,11 @@ var _ = Describe("Workloads", func() {
 		It("inserts the app path and manifest path into the context", func() {
 			ctx := context.New()
 			PopulateAppContext("foo", "manifest.yml", ctx)
-			appPath, ok := ctx.GetString("app")
-			Ω(Expect(ok).To(BeTrue()))
+			appPath, err := ctx.GetString("app")
+			Ω(Expect(err).ToNot(HaveOccurred()))
 			Ω(Expect(appPath).To(Equal("foo")))
-			manifestPath, ok := ctx.GetString("app:manifest")
-			Ω(Expect(ok).To(BeTrue()))
+			manifestPath, err := ctx.GetString("app:manifest")
+			Ω(Expect(err).ToNot(HaveOccurred()))
 			Ω(Expect(manifestPath).To(Equal("manifest.yml")))
 		})
 
@@ -66,11 +66,11 @@ var _ = Describe("Workloads", func() {
 				appPathActual := fmt.Sprintf("%s/foo", usr.HomeDir)
 				manifestPathActual := fmt.Sprintf("%s/manifest.yml", usr.HomeDir)
 
-				appPath, ok := ctx.GetString("app")
-				Ω(Expect(ok).To(BeTrue()))
+				appPath, err := ctx.GetString("app")
+				Ω(Expect(err).ToNot(HaveOccurred()))
 				Ω(Expect(appPath).To(Equal(appPathActual)))
-				manifestPath, ok := ctx.GetString("app:manifest")
-				Ω(Expect(ok).To(BeTrue()))
+				manifestPath, err := ctx.GetString("app:manifest")
+				Ω(Expect(err).ToNot(HaveOccurred()))
 				Ω(Expect(manifestPath).To(Equal(manifestPathActual)))
 			} else if runtime.GOOS == "windows" {
 				//TODO: figure out how windows works
@@ -78,4 +78,27 @@ var _ = Describe("Workloads", func() {
 		})
 
 	})
+
+	Describe("#Register", func() {
+		It("adds the step to the registered workloads, after the defaults", func() {
+			err := Register(Step("registered:foo", func() error { return nil }, "a registered step"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			list := Registered().Workloads
+			Ω(list).Should(HaveLen(len(DefaultWorkloadList().Workloads) + 1))
+			Ω(list[len(list)-1].Name).Should(Equal("registered:foo"))
+			Ω(list[len(list)-1].Description).Should(Equal("a registered step"))
+		})
+
+		It("rejects a step whose name is already taken", func() {
+			err := Register(Step("dummy", func() error { return nil }, "clashes with a default"))
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("dummy"))
+		})
+
+		It("rejects a step without a name or function", func() {
+			Ω(Register(Step("", func() error { return nil }, ""))).Should(HaveOccurred())
+			Ω(Register(StepWithContext("registered:nofn", nil, ""))).Should(HaveOccurred())
+		})
+	})
 })